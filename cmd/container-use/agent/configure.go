@@ -1,13 +1,17 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/dagger/container-use/mcpserver"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 )
 
@@ -33,19 +37,66 @@ var AgentCmd = &cobra.Command{
 	Use:   "agent [agent]",
 	Short: "Configure MCP server for different agents",
 	Long:  `Setup the container-use MCP server according to the specified agent including Claude Code, Goose, Cursor, and others.`,
+	Example: `# Configure Claude Code
+container-use config agent claude
+
+# Configure Claude Code for all projects
+container-use config agent claude --global
+
+# Only approve tools that don't change environments automatically
+container-use config agent claude --allow read
+
+# Also approve file writes, but confirm commands and deletions
+container-use config agent codex --allow read,environment_file_write,environment_file_edit
+
+# Remove container-use from Claude Code
+container-use config agent claude --remove`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		remove, _ := cmd.Flags().GetBool("remove")
+		global, _ := cmd.Flags().GetBool("global")
+		applyFlags := func(agent ConfigurableAgent) error {
+			if global {
+				if err := setGlobal(agent); err != nil {
+					return err
+				}
+			}
+			if cmd.Flags().Changed("allow") {
+				allow, _ := cmd.Flags().GetStringSlice("allow")
+				if err := setAllowedTools(agent, allow); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
 		if len(args) == 0 {
-			return interactiveConfiguration()
+			if remove {
+				return fmt.Errorf("specify the agent to remove container-use from")
+			}
+			return interactiveConfiguration(applyFlags)
 		}
 		agent, err := selectAgent(args[0])
 		if err != nil {
 			return err
 		}
+		if err := applyFlags(agent); err != nil {
+			return err
+		}
+		if remove {
+			return removeAgent(agent)
+		}
 		return configureAgent(agent)
 	},
 }
 
-func interactiveConfiguration() error {
+func init() {
+	AgentCmd.Flags().Bool("remove", false, "Remove the container-use MCP server and rules from the agent configuration")
+	AgentCmd.Flags().StringSlice("allow", []string{allowAll}, "Tools to approve automatically: all, read (tools that don't change environments), write, or tool names (claude, codex)")
+	AgentCmd.Flags().Bool("global", false, "Install the MCP server and rules in the user configuration instead of the current project (claude, goose, codex)")
+}
+
+// interactiveConfiguration lets the user pick the agents to configure, applying the command flags to each of them
+func interactiveConfiguration(applyFlags func(ConfigurableAgent) error) error {
 	selectedAgent, err := RunAgentSelector()
 	if err != nil {
 		// If the user quits, it's not an error, just exit gracefully.
@@ -55,10 +106,33 @@ func interactiveConfiguration() error {
 		return fmt.Errorf("failed to select agent: %w", err)
 	}
 
+	if selectedAgent == allDetectedAgents {
+		for i, detected := range getDetectedAgents() {
+			agent, err := selectAgent(detected.Key)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := applyFlags(agent); err != nil {
+				fmt.Printf("Skipping %s: %s\n", agent.name(), err)
+				continue
+			}
+			if err := configureAgent(agent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	agent, err := selectAgent(selectedAgent)
 	if err != nil {
 		return err
 	}
+	if err := applyFlags(agent); err != nil {
+		return err
+	}
 	return configureAgent(agent)
 }
 
@@ -67,9 +141,45 @@ type ConfigurableAgent interface {
 	description() string
 	editMcpConfig() error
 	editRules() error
+	removeMcpConfig() error
+	removeRules() error
 	isInstalled() bool
 }
 
+// globalAgent is implemented by agents whose MCP server and rules can be installed for all projects of the user.
+// Other agents either only have a user configuration already or only read rules from the project.
+type globalAgent interface {
+	setGlobal()
+}
+
+func setGlobal(agent ConfigurableAgent) error {
+	g, ok := agent.(globalAgent)
+	if !ok {
+		return fmt.Errorf("%s does not support global configuration", agent.name())
+	}
+	g.setGlobal()
+	return nil
+}
+
+// allowListAgent is implemented by agents that approve container-use tools automatically.
+// Tools left out of the allow-list require confirmation from the user.
+type allowListAgent interface {
+	setAllowedTools(tools []string)
+}
+
+func setAllowedTools(agent ConfigurableAgent, allow []string) error {
+	a, ok := agent.(allowListAgent)
+	if !ok {
+		return fmt.Errorf("%s does not support a tool allow-list", agent.name())
+	}
+	tools, err := allowedTools(allow)
+	if err != nil {
+		return err
+	}
+	a.setAllowedTools(tools)
+	return nil
+}
+
 // Add agents here
 func selectAgent(agentKey string) (ConfigurableAgent, error) {
 	// Check if agent is supported on current platform
@@ -82,15 +192,17 @@ func selectAgent(agentKey string) (ConfigurableAgent, error) {
 
 	switch agentKey {
 	case "claude":
-		return &ConfigureClaude{}, nil
+		return NewConfigureClaude(), nil
 	case "goose":
-		return &ConfigureGoose{}, nil
+		return NewConfigureGoose(), nil
 	case "cursor":
-		return &ConfigureCursor{}, nil
+		return NewConfigureCursor(), nil
 	case "codex":
-		return &ConfigureCodex{}, nil
+		return NewConfigureCodex(), nil
 	case "amazonq":
-		return &ConfigureQ{}, nil
+		return NewConfigureQ(), nil
+	case "zed":
+		return NewConfigureZed(), nil
 	}
 	return nil, fmt.Errorf("unknown agent: %s", agentKey)
 }
@@ -116,7 +228,47 @@ func configureAgent(agent ConfigurableAgent) error {
 	return nil
 }
 
+func removeAgent(agent ConfigurableAgent) error {
+	fmt.Printf("Removing container-use from %s...\n", agent.name())
+
+	if err := agent.removeMcpConfig(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Removed container-use from %s MCP configuration\n", agent.name())
+
+	if err := agent.removeRules(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Removed %s container-use rules\n", agent.name())
+
+	return nil
+}
+
 // Helper functions
+
+// detectInstalled reports whether one of the agent's binaries is in PATH or one of its config directories exists.
+// Config directories may start with ~ and empty entries are ignored.
+func detectInstalled(binaries []string, configDirs ...string) bool {
+	for _, binary := range binaries {
+		if _, err := exec.LookPath(binary); err == nil {
+			return true
+		}
+	}
+	for _, dir := range configDirs {
+		if dir == "" {
+			continue
+		}
+		dir, err := homedir.Expand(dir)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
 func saveRulesFile(rulesFile, content string) error {
 	dir := filepath.Dir(rulesFile)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -143,17 +295,18 @@ func saveRulesFile(rulesFile, content string) error {
 	return nil
 }
 
+// rulesMarker delimits the container-use section of rules files
+const rulesMarker = "<!-- container-use-rules -->"
+
 func editRulesFile(existingRules, content string) (string, error) {
 	// Look for section markers
-	const marker = "<!-- container-use-rules -->"
-
-	if strings.Contains(existingRules, marker) {
+	if strings.Contains(existingRules, rulesMarker) {
 		// Update existing section
-		parts := strings.Split(existingRules, marker)
+		parts := strings.Split(existingRules, rulesMarker)
 		if len(parts) != 3 {
-			return "", fmt.Errorf("malformed rules file - expected single section marked with %s", marker)
+			return "", fmt.Errorf("malformed rules file - expected single section marked with %s", rulesMarker)
 		}
-		newContent := parts[0] + marker + "\n" + content + "\n" + marker + parts[2]
+		newContent := parts[0] + rulesMarker + "\n" + content + "\n" + rulesMarker + parts[2]
 		return newContent, nil
 	} else {
 		// Append new section
@@ -161,15 +314,145 @@ func editRulesFile(existingRules, content string) (string, error) {
 		if len(newContent) > 0 && !strings.HasSuffix(newContent, "\n") {
 			newContent += "\n"
 		}
-		newContent += "\n" + marker + "\n" + content + "\n" + marker + "\n"
+		newContent += "\n" + rulesMarker + "\n" + content + "\n" + rulesMarker + "\n"
 		return newContent, nil
 	}
 }
 
-func tools(prefix string) []string {
+// removeRulesFile strips the container-use section from a rules file, deleting the file if nothing else is left.
+func removeRulesFile(rulesFile string) error {
+	existing, err := os.ReadFile(rulesFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read existing rules: %w", err)
+	}
+
+	remaining, err := stripRulesSection(string(existing))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(remaining) == "" {
+		if err := os.Remove(rulesFile); err != nil {
+			return fmt.Errorf("failed to remove rules: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(rulesFile, []byte(remaining), 0600); err != nil {
+		return fmt.Errorf("failed to update rules: %w", err)
+	}
+	return nil
+}
+
+// stripRulesSection undoes editRulesFile.
+func stripRulesSection(existingRules string) (string, error) {
+	if !strings.Contains(existingRules, rulesMarker) {
+		return existingRules, nil
+	}
+	parts := strings.Split(existingRules, rulesMarker)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed rules file - expected single section marked with %s", rulesMarker)
+	}
+	before := strings.TrimSuffix(parts[0], "\n")
+	after := strings.TrimPrefix(parts[2], "\n")
+	if before != "" && after != "" {
+		return before + "\n" + after, nil
+	}
+	return before + after, nil
+}
+
+// removeMCPServer removes container-use from a JSON config file listing servers under key,
+// leaving the rest of the file untouched.
+func removeMCPServer(configPath, key string) error {
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse existing config: %w", err)
+	}
+
+	data, err = removeServerEntry(config, key)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// removeServerEntry deletes the container-use entry from the servers listed under key.
+// Returns nil if there was nothing to remove.
+func removeServerEntry(config map[string]any, key string) ([]byte, error) {
+	servers, ok := config[key].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := servers["container-use"]; !ok {
+		return nil, nil
+	}
+	delete(servers, "container-use")
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// tools returns the prefixed names of the allowed tools, or of all tools if allowed is nil
+func tools(prefix string, allowed []string) []string {
 	tools := []string{}
 	for _, t := range mcpserver.Tools() {
+		if allowed != nil && !slices.Contains(allowed, t.Definition.Name) {
+			continue
+		}
 		tools = append(tools, fmt.Sprintf("%s%s", prefix, t.Definition.Name))
 	}
 	return tools
 }
+
+// Tool groups accepted by --allow besides tool names
+const (
+	allowAll   = "all"
+	allowRead  = "read"
+	allowWrite = "write"
+)
+
+// allowedTools resolves tool groups and names to the tool names to approve automatically.
+// read tools only inspect environments, while write tools change them or run commands.
+func allowedTools(allow []string) ([]string, error) {
+	allowed := []string{}
+	for _, value := range allow {
+		matched := false
+		for _, t := range mcpserver.Tools() {
+			name := t.Definition.Name
+			readOnly := t.IsReadOnly()
+			switch {
+			case value == allowAll,
+				value == allowRead && readOnly,
+				value == allowWrite && !readOnly,
+				value == name:
+				matched = true
+				if !slices.Contains(allowed, name) {
+					allowed = append(allowed, name)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("unknown tool %q, expected %s, %s, %s or a tool name", value, allowAll, allowRead, allowWrite)
+		}
+	}
+	return allowed, nil
+}
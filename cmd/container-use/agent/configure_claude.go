@@ -9,11 +9,20 @@ import (
 	"strings"
 
 	"github.com/dagger/container-use/rules"
+	"github.com/mitchellh/go-homedir"
 )
 
+const claudeRulesFile = "CLAUDE.md"
+
+var claudeSettingsLocalPath = filepath.Join(".claude", "settings.local.json")
+
 type ConfigureClaude struct {
 	Name        string
 	Description string
+	// Global adds the MCP server with the user scope and installs the rules in ~/.claude instead of the current project
+	Global bool
+	// AllowedTools are the tools approved automatically, all of them if nil
+	AllowedTools []string
 }
 
 func NewConfigureClaude() *ConfigureClaude {
@@ -23,16 +32,6 @@ func NewConfigureClaude() *ConfigureClaude {
 	}
 }
 
-type ClaudeSettingsLocal struct {
-	Permissions *ClaudePermissions `json:"permissions,omitempty"`
-	Env         map[string]string  `json:"env,omitempty"`
-}
-
-type ClaudePermissions struct {
-	Allow []string `json:"allow,omitempty"`
-	Deny  []string `json:"deny,omitempty"`
-}
-
 func (c *ConfigureClaude) name() string {
 	return c.Name
 }
@@ -41,25 +40,61 @@ func (c *ConfigureClaude) description() string {
 	return c.Description
 }
 
+func (c *ConfigureClaude) setAllowedTools(tools []string) {
+	c.AllowedTools = tools
+}
+
+func (c *ConfigureClaude) setGlobal() {
+	c.Global = true
+}
+
+// scope returns the claude mcp scope to add the server to
+func (c *ConfigureClaude) scope() string {
+	if c.Global {
+		return "user"
+	}
+	return "local"
+}
+
+// settingsPath returns the settings file holding the tool permissions
+func (c *ConfigureClaude) settingsPath() (string, error) {
+	if c.Global {
+		return homedir.Expand(filepath.Join("~", ".claude", "settings.json"))
+	}
+	return claudeSettingsLocalPath, nil
+}
+
+// rulesFile returns the project CLAUDE.md, or the user memory file loaded for every project
+func (c *ConfigureClaude) rulesFile() (string, error) {
+	if c.Global {
+		return homedir.Expand(filepath.Join("~", ".claude", claudeRulesFile))
+	}
+	return claudeRulesFile, nil
+}
+
 func (c *ConfigureClaude) editMcpConfig() error {
 	// Remove existing MCP server (ignore errors if it doesn't exist)
-	removeCmd := exec.Command("claude", "mcp", "remove", "container-use")
+	removeCmd := exec.Command("claude", "mcp", "remove", "--scope", c.scope(), "container-use")
 	_ = removeCmd.Run() // Ignore error - server might not exist
 
 	// Add MCP server
-	cmd := exec.Command("claude", "mcp", "add", "container-use", "--", ContainerUseBinary, "stdio")
+	cmd := exec.Command("claude", "mcp", "add", "--scope", c.scope(), "container-use", "--", ContainerUseBinary, "stdio")
 	err := cmd.Run()
 	if err != nil {
 		return fmt.Errorf("could not automatically add MCP server: %w", err)
 	}
 
 	// Configure auto approve settings
-	configPath := filepath.Join(".claude", "settings.local.json")
+	configPath, err := c.settingsPath()
+	if err != nil {
+		return err
+	}
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
-	var config ClaudeSettingsLocal
+	// Settings are edited as a map, so that the ones container-use doesn't know about are kept
+	config := map[string]any{}
 	if data, err := os.ReadFile(configPath); err == nil {
 		if err := json.Unmarshal(data, &config); err != nil {
 			return fmt.Errorf("failed to parse existing config: %w", err)
@@ -78,24 +113,29 @@ func (c *ConfigureClaude) editMcpConfig() error {
 	return nil
 }
 
-func (c *ConfigureClaude) updateSettingsLocal(config ClaudeSettingsLocal) ([]byte, error) {
-	// Initialize permissions map if nil
-	if config.Permissions == nil {
-		config.Permissions = &ClaudePermissions{Allow: []string{}}
+// updateSettingsLocal allows the container-use tools, replacing the ones previously allowed and keeping any other setting.
+func (c *ConfigureClaude) updateSettingsLocal(config map[string]any) ([]byte, error) {
+	permissions, ok := config["permissions"].(map[string]any)
+	if !ok {
+		permissions = map[string]any{}
+		config["permissions"] = permissions
 	}
 
 	// remove save non-container-use items from allow
-	allows := []string{}
-	for _, tool := range config.Permissions.Allow {
-		if !strings.HasPrefix(tool, "mcp__container-use") {
-			allows = append(allows, tool)
+	allows := []any{}
+	if allow, ok := permissions["allow"].([]any); ok {
+		for _, tool := range allow {
+			if name, ok := tool.(string); !ok || !strings.HasPrefix(name, "mcp__container-use") {
+				allows = append(allows, tool)
+			}
 		}
 	}
 
 	// Add container-use tools to allow
-	tools := tools("mcp__container-use__")
-	allows = append(allows, tools...)
-	config.Permissions.Allow = allows
+	for _, tool := range tools("mcp__container-use__", c.AllowedTools) {
+		allows = append(allows, tool)
+	}
+	permissions["allow"] = allows
 
 	// Write config back
 	data, err := json.MarshalIndent(config, "", "  ")
@@ -106,10 +146,72 @@ func (c *ConfigureClaude) updateSettingsLocal(config ClaudeSettingsLocal) ([]byt
 }
 
 func (c *ConfigureClaude) editRules() error {
-	return saveRulesFile("CLAUDE.md", rules.AgentRules)
+	rulesFile, err := c.rulesFile()
+	if err != nil {
+		return err
+	}
+	return saveRulesFile(rulesFile, rules.AgentRules)
+}
+
+func (c *ConfigureClaude) removeMcpConfig() error {
+	// The server might not have been added, or the claude CLI might be gone already
+	_ = exec.Command("claude", "mcp", "remove", "--scope", c.scope(), "container-use").Run()
+
+	configPath, err := c.settingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse existing config: %w", err)
+	}
+
+	data, err = c.removeSettingsLocal(config)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// removeSettingsLocal drops the container-use tools from the allowed tools, keeping any other setting.
+func (c *ConfigureClaude) removeSettingsLocal(config map[string]any) ([]byte, error) {
+	if permissions, ok := config["permissions"].(map[string]any); ok {
+		if allow, ok := permissions["allow"].([]any); ok {
+			allows := []any{}
+			for _, tool := range allow {
+				if name, ok := tool.(string); !ok || !strings.HasPrefix(name, "mcp__container-use") {
+					allows = append(allows, tool)
+				}
+			}
+			permissions["allow"] = allows
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+func (c *ConfigureClaude) removeRules() error {
+	rulesFile, err := c.rulesFile()
+	if err != nil {
+		return err
+	}
+	return removeRulesFile(rulesFile)
 }
 
 func (c *ConfigureClaude) isInstalled() bool {
-	_, err := exec.LookPath("claude")
-	return err == nil
+	return detectInstalled([]string{"claude"}, filepath.Join("~", ".claude"))
 }
@@ -3,7 +3,6 @@ package agent
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/dagger/container-use/rules"
@@ -11,9 +10,15 @@ import (
 	"github.com/pelletier/go-toml/v2"
 )
 
+const codexRulesFile = "AGENTS.md"
+
 type ConfigureCodex struct {
 	Name        string
 	Description string
+	// Global installs the rules in the global AGENTS.md instead of in the current project
+	Global bool
+	// AllowedTools are the tools approved automatically, all of them if nil
+	AllowedTools []string
 }
 
 func NewConfigureCodex() *ConfigureCodex {
@@ -33,9 +38,13 @@ func (a *ConfigureCodex) description() string {
 	return a.Description
 }
 
+func codexConfigPath() (string, error) {
+	return homedir.Expand(filepath.Join("~", ".codex", "config.toml"))
+}
+
 // Save the MCP config with container-use enabled
 func (a *ConfigureCodex) editMcpConfig() error {
-	configPath, err := homedir.Expand(filepath.Join("~", ".codex", "config.toml"))
+	configPath, err := codexConfigPath()
 	if err != nil {
 		return err
 	}
@@ -81,7 +90,7 @@ func (a *ConfigureCodex) updateCodexConfig(config map[string]any) ([]byte, error
 	mcpServers["container-use"] = map[string]any{
 		"command":      ContainerUseBinary,
 		"args":         []any{"stdio"},
-		"auto_approve": tools(""),
+		"auto_approve": tools("", a.AllowedTools),
 	}
 
 	// Write config back
@@ -92,13 +101,82 @@ func (a *ConfigureCodex) updateCodexConfig(config map[string]any) ([]byte, error
 	return data, nil
 }
 
+// Remove container-use from the MCP config
+func (a *ConfigureCodex) removeMcpConfig() error {
+	configPath, err := codexConfigPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var config map[string]any
+	if err := toml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse existing config: %w", err)
+	}
+
+	mcpServers, ok := config["mcp_servers"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	if _, ok := mcpServers["container-use"]; !ok {
+		return nil
+	}
+	delete(mcpServers, "container-use")
+
+	data, err = toml.Marshal(&config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+func (a *ConfigureCodex) setAllowedTools(tools []string) {
+	a.AllowedTools = tools
+}
+
+func (a *ConfigureCodex) setGlobal() {
+	a.Global = true
+}
+
+// rulesFile returns the project AGENTS.md, or the global one next to the codex config
+func (a *ConfigureCodex) rulesFile() (string, error) {
+	if !a.Global {
+		return codexRulesFile, nil
+	}
+	configPath, err := codexConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), codexRulesFile), nil
+}
+
 // Save the agent rules with the container-use prompt
 func (a *ConfigureCodex) editRules() error {
-	agentsFile := "AGENTS.md"
-	return saveRulesFile(agentsFile, rules.AgentRules)
+	rulesFile, err := a.rulesFile()
+	if err != nil {
+		return err
+	}
+	return saveRulesFile(rulesFile, rules.AgentRules)
+}
+
+// Remove the container-use prompt from the agent rules
+func (a *ConfigureCodex) removeRules() error {
+	rulesFile, err := a.rulesFile()
+	if err != nil {
+		return err
+	}
+	return removeRulesFile(rulesFile)
 }
 
 func (a *ConfigureCodex) isInstalled() bool {
-	_, err := exec.LookPath("codex")
-	return err == nil
+	return detectInstalled([]string{"codex"}, filepath.Join("~", ".codex"))
 }
@@ -9,6 +9,11 @@ import (
 	"github.com/dagger/container-use/rules"
 )
 
+var (
+	cursorMcpConfigPath = filepath.Join(".cursor", "mcp.json")
+	cursorRulesFile     = filepath.Join(".cursor", "rules", "container-use.mdc")
+)
+
 type ConfigureCursor struct {
 	Name        string
 	Description string
@@ -33,7 +38,7 @@ func (a *ConfigureCursor) description() string {
 
 // Save the MCP config with container-use enabled
 func (a *ConfigureCursor) editMcpConfig() error {
-	configPath := filepath.Join(".cursor", "mcp.json")
+	configPath := cursorMcpConfigPath
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
@@ -82,10 +87,19 @@ func (a *ConfigureCursor) updateMcpConfig(config MCPServersConfig) ([]byte, erro
 
 // Save the agent rules with the container-use prompt
 func (a *ConfigureCursor) editRules() error {
-	rulesFile := filepath.Join(".cursor", "rules", "container-use.mdc")
-	return saveRulesFile(rulesFile, rules.CursorRules)
+	return saveRulesFile(cursorRulesFile, rules.CursorRules)
+}
+
+// Remove container-use from the MCP config
+func (a *ConfigureCursor) removeMcpConfig() error {
+	return removeMCPServer(cursorMcpConfigPath, "mcpServers")
+}
+
+// Remove the container-use prompt from the agent rules
+func (a *ConfigureCursor) removeRules() error {
+	return removeRulesFile(cursorRulesFile)
 }
 
 func (a *ConfigureCursor) isInstalled() bool {
-	return true
+	return detectInstalled([]string{"cursor", "cursor-agent"}, filepath.Join("~", ".cursor"), "/Applications/Cursor.app")
 }
@@ -3,7 +3,6 @@ package agent
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 
@@ -12,9 +11,13 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+const gooseRulesFile = ".goosehints"
+
 type ConfigureGoose struct {
 	Name        string
 	Description string
+	// Global installs the rules as global hints instead of in the current project
+	Global bool
 }
 
 func NewConfigureGoose() *ConfigureGoose {
@@ -34,25 +37,25 @@ func (a *ConfigureGoose) description() string {
 	return a.Description
 }
 
-// Save the MCP config with container-use enabled
-func (a *ConfigureGoose) editMcpConfig() error {
-	var configPath string
-	var err error
-
+func gooseConfigPath() (string, error) {
 	if runtime.GOOS == "windows" {
 		// Windows: %APPDATA%\Block\goose\config\config.yaml
 		// Reference: https://block.github.io/goose/docs/guides/config-file
 		appData := os.Getenv("APPDATA")
 		if appData == "" {
-			return fmt.Errorf("APPDATA environment variable not set")
-		}
-		configPath = filepath.Join(appData, "Block", "goose", "config", "config.yaml")
-	} else {
-		// macOS/Linux: ~/.config/goose/config.yaml
-		configPath, err = homedir.Expand(filepath.Join("~", ".config", "goose", "config.yaml"))
-		if err != nil {
-			return err
+			return "", fmt.Errorf("APPDATA environment variable not set")
 		}
+		return filepath.Join(appData, "Block", "goose", "config", "config.yaml"), nil
+	}
+	// macOS/Linux: ~/.config/goose/config.yaml
+	return homedir.Expand(filepath.Join("~", ".config", "goose", "config.yaml"))
+}
+
+// Save the MCP config with container-use enabled
+func (a *ConfigureGoose) editMcpConfig() error {
+	configPath, err := gooseConfigPath()
+	if err != nil {
+		return err
 	}
 
 	// Create directory if it doesn't exist
@@ -109,12 +112,82 @@ func (a *ConfigureGoose) updateGooseConfig(config map[string]any) ([]byte, error
 	return data, nil
 }
 
+// Remove container-use from the MCP config
+func (a *ConfigureGoose) removeMcpConfig() error {
+	configPath, err := gooseConfigPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var config map[string]any
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse existing config: %w", err)
+	}
+
+	extensions, ok := config["extensions"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	if _, ok := extensions["container-use"]; !ok {
+		return nil
+	}
+	delete(extensions, "container-use")
+
+	data, err = yaml.Marshal(&config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+func (a *ConfigureGoose) setGlobal() {
+	a.Global = true
+}
+
+// rulesFile returns the project hints file, or the global hints file next to the goose config
+func (a *ConfigureGoose) rulesFile() (string, error) {
+	if !a.Global {
+		return gooseRulesFile, nil
+	}
+	configPath, err := gooseConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), gooseRulesFile), nil
+}
+
 // Save the agent rules with the container-use prompt
 func (a *ConfigureGoose) editRules() error {
-	return saveRulesFile(".goosehints", rules.AgentRules)
+	rulesFile, err := a.rulesFile()
+	if err != nil {
+		return err
+	}
+	return saveRulesFile(rulesFile, rules.AgentRules)
+}
+
+// Remove the container-use prompt from the agent rules
+func (a *ConfigureGoose) removeRules() error {
+	rulesFile, err := a.rulesFile()
+	if err != nil {
+		return err
+	}
+	return removeRulesFile(rulesFile)
 }
 
 func (a *ConfigureGoose) isInstalled() bool {
-	_, err := exec.LookPath("goose")
-	return err == nil
+	configDir := ""
+	if configPath, err := gooseConfigPath(); err == nil {
+		configDir = filepath.Dir(configPath)
+	}
+	return detectInstalled([]string{"goose"}, configDir)
 }
@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/dagger/container-use/rules"
 )
 
+var (
+	qMcpConfigPath = filepath.Join(".amazonq", "mcp.json")
+	qRulesFile     = filepath.Join(".amazonq", "rules", "container-use.md")
+)
+
 type ConfigureQ struct {
 	Name        string
 	Description string
@@ -34,7 +38,7 @@ func (a *ConfigureQ) description() string {
 
 // Save the MCP config with container-use enabled
 func (a *ConfigureQ) editMcpConfig() error {
-	configPath := filepath.Join(".amazonq", "mcp.json")
+	configPath := qMcpConfigPath
 
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
@@ -85,10 +89,19 @@ func (a *ConfigureQ) updateMcpConfig(config MCPServersConfig) ([]byte, error) {
 
 // Save the agent rules with the container-use prompt
 func (a *ConfigureQ) editRules() error {
-	return saveRulesFile(".amazonq/rules/container-use.md", rules.AgentRules)
+	return saveRulesFile(qRulesFile, rules.AgentRules)
+}
+
+// Remove container-use from the MCP config
+func (a *ConfigureQ) removeMcpConfig() error {
+	return removeMCPServer(qMcpConfigPath, "mcpServers")
+}
+
+// Remove the container-use prompt from the agent rules
+func (a *ConfigureQ) removeRules() error {
+	return removeRulesFile(qRulesFile)
 }
 
 func (a *ConfigureQ) isInstalled() bool {
-	_, err := exec.LookPath("q")
-	return err == nil
+	return detectInstalled([]string{"q"}, filepath.Join("~", ".aws", "amazonq"))
 }
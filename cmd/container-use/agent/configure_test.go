@@ -1,10 +1,15 @@
 package agent
 
 import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/dagger/container-use/rules"
+	"github.com/mitchellh/go-homedir"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfigureEditRulesFile(t *testing.T) {
@@ -27,7 +32,7 @@ func TestConfigureEditRulesFile(t *testing.T) {
 
 func TestConfigureClaudeUpdateSettings(t *testing.T) {
 	claude := &ConfigureClaude{}
-	settings := ClaudeSettingsLocal{}
+	settings := map[string]any{}
 	expect := `{
   "permissions": {
     "allow": [
@@ -37,6 +42,28 @@ func TestConfigureClaudeUpdateSettings(t *testing.T) {
 	assert.Contains(t, string(editedSettings), expect)
 }
 
+func TestConfigureClaudeUpdateSettingsKeepsOtherSettings(t *testing.T) {
+	claude := &ConfigureClaude{}
+	var settings map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "model": "opus",
+  "hooks": {"PostToolUse": [{"matcher": "Edit"}]},
+  "permissions": {"allow": ["Bash(ls:*)", "mcp__container-use__environment_old"], "defaultMode": "acceptEdits"}
+}`), &settings))
+
+	data, err := claude.updateSettingsLocal(settings)
+	require.NoError(t, err)
+
+	var edited map[string]any
+	require.NoError(t, json.Unmarshal(data, &edited))
+	assert.Equal(t, "opus", edited["model"])
+	assert.Equal(t, map[string]any{"PostToolUse": []any{map[string]any{"matcher": "Edit"}}}, edited["hooks"])
+	permissions := edited["permissions"].(map[string]any)
+	assert.Equal(t, "acceptEdits", permissions["defaultMode"])
+	assert.Contains(t, permissions["allow"], "Bash(ls:*)")
+	assert.NotContains(t, permissions["allow"], "mcp__container-use__environment_old")
+}
+
 func TestConfigureCodexUpdateConfig(t *testing.T) {
 	codex := &ConfigureCodex{}
 	config := make(map[string]any)
@@ -102,3 +129,190 @@ func TestConfigureCursorUpdateConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, string(editedConfig), expect)
 }
+
+func TestConfigureZedUpdateConfig(t *testing.T) {
+	zed := &ConfigureZed{}
+	config := map[string]any{
+		"theme": "One Dark",
+		"context_servers": map[string]any{
+			"other-server": map[string]any{"command": "other"},
+		},
+	}
+	expect := `"container-use": {
+      "args": [
+        "stdio"
+      ],
+      "command": "container-use",
+      "enabled": true,
+      "env": {},
+      "remote": false,
+      "timeout": 300
+    }`
+	editedConfig, err := zed.updateZedConfig(config)
+	assert.NoError(t, err)
+	assert.Contains(t, string(editedConfig), expect)
+	// Other settings and servers are kept
+	assert.Contains(t, string(editedConfig), `"theme": "One Dark"`)
+	assert.Contains(t, string(editedConfig), `"other-server"`)
+}
+
+func TestStripJSONComments(t *testing.T) {
+	settings := `// Zed settings
+{
+  /* block
+     comment */
+  "url": "https://example.com", // trailing comment
+  "escaped": "quote \" // not a comment",
+  "list": [1, 2,],
+}
+`
+	var config map[string]any
+	assert.NoError(t, json.Unmarshal(stripJSONComments([]byte(settings)), &config))
+	assert.Equal(t, "https://example.com", config["url"])
+	assert.Equal(t, `quote " // not a comment`, config["escaped"])
+	assert.Len(t, config["list"], 2)
+}
+
+func TestConfigureStripRulesSection(t *testing.T) {
+	userRules := "# My rules\n\nBe nice.\n"
+
+	// Appended section is removed without leftovers
+	edited, err := editRulesFile(userRules, rules.AgentRules)
+	assert.NoError(t, err)
+	stripped, err := stripRulesSection(edited)
+	assert.NoError(t, err)
+	assert.Equal(t, "# My rules\n\nBe nice.\n", stripped)
+
+	// Rules files only holding container-use rules end up empty
+	edited, err = editRulesFile("", rules.AgentRules)
+	assert.NoError(t, err)
+	stripped, err = stripRulesSection(edited)
+	assert.NoError(t, err)
+	assert.Empty(t, strings.TrimSpace(stripped))
+
+	// Files without container-use rules are unchanged
+	stripped, err = stripRulesSection(userRules)
+	assert.NoError(t, err)
+	assert.Equal(t, userRules, stripped)
+}
+
+func TestConfigureClaudeRemoveSettings(t *testing.T) {
+	claude := &ConfigureClaude{}
+	config := map[string]any{
+		"permissions": map[string]any{
+			"allow": []any{"Bash(ls:*)", "mcp__container-use__environment_open"},
+		},
+		"env": map[string]any{"FOO": "bar"},
+	}
+	editedSettings, err := claude.removeSettingsLocal(config)
+	assert.NoError(t, err)
+	assert.Contains(t, string(editedSettings), `"Bash(ls:*)"`)
+	assert.Contains(t, string(editedSettings), `"FOO": "bar"`)
+	assert.NotContains(t, string(editedSettings), "mcp__container-use")
+}
+
+func TestConfigureRemoveServerEntry(t *testing.T) {
+	config := map[string]any{
+		"theme": "One Dark",
+		"context_servers": map[string]any{
+			"container-use": map[string]any{"command": "container-use"},
+			"other-server":  map[string]any{"command": "other"},
+		},
+	}
+	edited, err := removeServerEntry(config, "context_servers")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(edited), `"container-use"`)
+	assert.Contains(t, string(edited), `"other-server"`)
+	assert.Contains(t, string(edited), `"theme": "One Dark"`)
+
+	// Nothing to remove
+	edited, err = removeServerEntry(config, "context_servers")
+	assert.NoError(t, err)
+	assert.Nil(t, edited)
+}
+
+func TestConfigureDetectAgents(t *testing.T) {
+	installed := map[string]bool{"cursor": true, "zed": true}
+	detected := detectAgents(agents, func(key string) bool { return installed[key] })
+
+	assert.Len(t, detected, len(agents))
+	assert.Equal(t, "cursor", detected[0].Key)
+	assert.Equal(t, "zed", detected[1].Key)
+	assert.True(t, detected[0].Detected)
+	assert.Equal(t, "claude", detected[2].Key)
+	assert.False(t, detected[2].Detected)
+
+	items := selectorItems(detected)
+	assert.Equal(t, allDetectedAgents, items[0].Key)
+	assert.Equal(t, "Cursor, Zed", items[0].Description)
+	assert.Len(t, items, len(agents)+1)
+
+	// A single detected agent is just listed first
+	installed = map[string]bool{"goose": true}
+	items = selectorItems(detectAgents(agents, func(key string) bool { return installed[key] }))
+	assert.Equal(t, "goose", items[0].Key)
+	assert.Len(t, items, len(agents))
+}
+
+func TestConfigureGlobal(t *testing.T) {
+	home, err := homedir.Dir()
+	require.NoError(t, err)
+
+	claude := NewConfigureClaude()
+	require.NoError(t, setGlobal(claude))
+	assert.Equal(t, "user", claude.scope())
+	rulesFile, err := claude.rulesFile()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".claude", "CLAUDE.md"), rulesFile)
+	settingsPath, err := claude.settingsPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".claude", "settings.json"), settingsPath)
+
+	codex := NewConfigureCodex()
+	require.NoError(t, setGlobal(codex))
+	rulesFile, err = codex.rulesFile()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(home, ".codex", "AGENTS.md"), rulesFile)
+
+	// Project scoped by default
+	rulesFile, err = NewConfigureGoose().rulesFile()
+	require.NoError(t, err)
+	assert.Equal(t, gooseRulesFile, rulesFile)
+
+	assert.Error(t, setGlobal(NewConfigureCursor()))
+}
+
+func TestConfigureAllowedTools(t *testing.T) {
+	all, err := allowedTools([]string{allowAll})
+	require.NoError(t, err)
+	assert.Equal(t, tools("", nil), all)
+
+	read, err := allowedTools([]string{allowRead})
+	require.NoError(t, err)
+	assert.Contains(t, read, "environment_file_read")
+	assert.Contains(t, read, "environment_list")
+	assert.NotContains(t, read, "environment_run_cmd")
+	assert.NotContains(t, read, "environment_file_delete")
+
+	write, err := allowedTools([]string{allowWrite})
+	require.NoError(t, err)
+	assert.Contains(t, write, "environment_run_cmd")
+	assert.Len(t, append(read, write...), len(all))
+
+	custom, err := allowedTools([]string{allowRead, "environment_file_write", "environment_file_read"})
+	require.NoError(t, err)
+	assert.Equal(t, append(read, "environment_file_write"), custom)
+
+	_, err = allowedTools([]string{"environment_nope"})
+	assert.Error(t, err)
+
+	claude := NewConfigureClaude()
+	require.NoError(t, setAllowedTools(claude, []string{"environment_file_read"}))
+	data, err := claude.updateSettingsLocal(map[string]any{"permissions": map[string]any{"allow": []any{"mcp__container-use__environment_run_cmd", "Bash"}}})
+	require.NoError(t, err)
+	var settings map[string]any
+	require.NoError(t, json.Unmarshal(data, &settings))
+	assert.Equal(t, map[string]any{"allow": []any{"Bash", "mcp__container-use__environment_file_read"}}, settings["permissions"])
+
+	assert.Error(t, setAllowedTools(NewConfigureGoose(), []string{allowRead}))
+}
@@ -14,8 +14,12 @@ type Agent struct {
 	Key         string
 	Name        string
 	Description string
+	Detected    bool
 }
 
+// allDetectedAgents is the selector key for configuring every detected agent at once
+const allDetectedAgents = "all-detected"
+
 // Available agents
 var agents = []Agent{
 	{
@@ -43,6 +47,11 @@ var agents = []Agent{
 		Name:        "Amazon Q Developer",
 		Description: "Amazon's agentic chat experience in your terminal (Linux/macOS/WSL)",
 	},
+	{
+		Key:         "zed",
+		Name:        "Zed",
+		Description: "High-performance, multiplayer code editor with an agent panel",
+	},
 }
 
 // getSupportedAgents returns agents that are supported on the current platform
@@ -60,16 +69,72 @@ func getSupportedAgents() []Agent {
 	return agents
 }
 
+// detectAgents marks which agents are installed and lists them first, keeping the original order otherwise.
+func detectAgents(agents []Agent, installed func(key string) bool) []Agent {
+	var detected, others []Agent
+	for _, agent := range agents {
+		agent.Detected = installed(agent.Key)
+		if agent.Detected {
+			detected = append(detected, agent)
+		} else {
+			others = append(others, agent)
+		}
+	}
+	return append(detected, others...)
+}
+
+// isAgentInstalled reports whether the agent with the given key is installed locally
+func isAgentInstalled(key string) bool {
+	agent, err := selectAgent(key)
+	if err != nil {
+		return false
+	}
+	return agent.isInstalled()
+}
+
+// getDetectedAgents returns the supported agents that are installed locally
+func getDetectedAgents() []Agent {
+	var detected []Agent
+	for _, agent := range detectAgents(getSupportedAgents(), isAgentInstalled) {
+		if agent.Detected {
+			detected = append(detected, agent)
+		}
+	}
+	return detected
+}
+
+// selectorItems lists agents for the selector, offering to configure all of them when several are detected
+func selectorItems(agents []Agent) []Agent {
+	var names []string
+	for _, agent := range agents {
+		if agent.Detected {
+			names = append(names, agent.Name)
+		}
+	}
+	if len(names) < 2 {
+		return agents
+	}
+	all := Agent{
+		Key:         allDetectedAgents,
+		Name:        "All detected agents",
+		Description: strings.Join(names, ", "),
+	}
+	return append([]Agent{all}, agents...)
+}
+
 // AgentSelectorModel represents the bubbletea model for agent selection
 type AgentSelectorModel struct {
+	items    []Agent
 	cursor   int
 	selected string
 	quit     bool
 }
 
-// InitialModel creates the initial model for agent selection
+// InitialModel creates the initial model for agent selection, with detected agents listed first
 func InitialModel() AgentSelectorModel {
-	return AgentSelectorModel{}
+	return AgentSelectorModel{
+		items: selectorItems(detectAgents(getSupportedAgents(), isAgentInstalled)),
+	}
 }
 
 // Init initializes the model
@@ -79,7 +144,6 @@ func (m AgentSelectorModel) Init() tea.Cmd {
 
 // Update handles incoming messages and updates the model
 func (m AgentSelectorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	supportedAgents := getSupportedAgents()
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
@@ -91,11 +155,11 @@ func (m AgentSelectorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.cursor--
 			}
 		case "down", "j":
-			if m.cursor < len(supportedAgents)-1 {
+			if m.cursor < len(m.items)-1 {
 				m.cursor++
 			}
 		case "enter", " ":
-			m.selected = supportedAgents[m.cursor].Key
+			m.selected = m.items[m.cursor].Key
 			m.quit = true
 			return m, tea.Quit
 		}
@@ -164,15 +228,17 @@ func (m AgentSelectorModel) View() string {
 		s.WriteString("\n\n")
 	}
 
-	// Agent list TODO: filter or sort agents based on if they are installed (ConfigurableAgent.isInstalled())
-	supportedAgents := getSupportedAgents()
-	for i, agent := range supportedAgents {
+	// Agent list
+	for i, agent := range m.items {
 		cursor := "  " // not selected
 		if m.cursor == i {
 			cursor = "▶ " // selected
 		}
 
 		agentLine := fmt.Sprintf("%s%s", cursor, agent.Name)
+		if agent.Detected {
+			agentLine += " (detected)"
+		}
 		if m.cursor == i {
 			s.WriteString(selectedStyle.Render(agentLine))
 		} else {
@@ -195,7 +261,8 @@ func (m AgentSelectorModel) View() string {
 	return s.String()
 }
 
-// RunAgentSelector runs the interactive agent selector and returns the selected agent key
+// RunAgentSelector runs the interactive agent selector and returns the selected agent key,
+// or allDetectedAgents to configure every detected agent
 func RunAgentSelector() (string, error) {
 	p := tea.NewProgram(InitialModel())
 	finalModel, err := p.Run()
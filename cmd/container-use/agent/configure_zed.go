@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/dagger/container-use/rules"
+	"github.com/mitchellh/go-homedir"
+)
+
+const zedRulesFile = ".rules"
+
+type ConfigureZed struct {
+	Name        string
+	Description string
+}
+
+func NewConfigureZed() *ConfigureZed {
+	return &ConfigureZed{
+		Name:        "Zed",
+		Description: "High-performance, multiplayer code editor with an agent panel",
+	}
+}
+
+// Return the agents full name
+func (a *ConfigureZed) name() string {
+	return a.Name
+}
+
+// Return a description of the agent
+func (a *ConfigureZed) description() string {
+	return a.Description
+}
+
+func zedSettingsPath() (string, error) {
+	if runtime.GOOS == "windows" {
+		// Windows: %APPDATA%\Zed\settings.json
+		appData := os.Getenv("APPDATA")
+		if appData == "" {
+			return "", fmt.Errorf("APPDATA environment variable not set")
+		}
+		return filepath.Join(appData, "Zed", "settings.json"), nil
+	}
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" && runtime.GOOS == "linux" {
+		return filepath.Join(configHome, "zed", "settings.json"), nil
+	}
+	// macOS/Linux: ~/.config/zed/settings.json
+	return homedir.Expand(filepath.Join("~", ".config", "zed", "settings.json"))
+}
+
+// Save the MCP config with container-use enabled
+func (a *ConfigureZed) editMcpConfig() error {
+	configPath, err := zedSettingsPath()
+	if err != nil {
+		return err
+	}
+
+	// Create directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	// Read existing config or create new
+	config, err := readZedSettings(configPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := a.updateZedConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// readZedSettings parses Zed settings, which allow comments and trailing commas.
+// Comments can't be preserved when rewriting the settings, so the original file is backed up if it has any.
+func readZedSettings(configPath string) (map[string]any, error) {
+	config := make(map[string]any)
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	stripped := stripJSONComments(data)
+	if len(bytes.TrimSpace(stripped)) > 0 {
+		if err := json.Unmarshal(stripped, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse existing config: %w", err)
+		}
+	}
+	if !bytes.Equal(stripped, data) {
+		backupPath := configPath + ".bak"
+		if err := os.WriteFile(backupPath, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to back up config: %w", err)
+		}
+		fmt.Printf("Comments in %s are not preserved, original saved to %s\n", configPath, backupPath)
+	}
+	return config, nil
+}
+
+func (a *ConfigureZed) updateZedConfig(config map[string]any) ([]byte, error) {
+	// Get context servers map
+	servers, ok := config["context_servers"].(map[string]any)
+	if !ok {
+		servers = make(map[string]any)
+		config["context_servers"] = servers
+	}
+
+	// Add container-use server
+	servers["container-use"] = map[string]any{
+		"enabled": true,
+		"remote":  false,
+		"command": ContainerUseBinary,
+		"args":    []any{"stdio"},
+		"env":     map[string]any{},
+		"timeout": 300,
+	}
+
+	// Write config back
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// Remove container-use from the MCP config
+func (a *ConfigureZed) removeMcpConfig() error {
+	configPath, err := zedSettingsPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	config, err := readZedSettings(configPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := removeServerEntry(config, "context_servers")
+	if err != nil || data == nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// Save the agent rules with the container-use prompt
+func (a *ConfigureZed) editRules() error {
+	return saveRulesFile(zedRulesFile, rules.AgentRules)
+}
+
+// Remove the container-use prompt from the agent rules
+func (a *ConfigureZed) removeRules() error {
+	return removeRulesFile(zedRulesFile)
+}
+
+func (a *ConfigureZed) isInstalled() bool {
+	configDir := ""
+	if settingsPath, err := zedSettingsPath(); err == nil {
+		configDir = filepath.Dir(settingsPath)
+	}
+	// Linux packages install the CLI as zeditor
+	return detectInstalled([]string{"zed", "zeditor"}, configDir, "/Applications/Zed.app")
+}
+
+// stripJSONComments turns JSON with comments and trailing commas into plain JSON.
+func stripJSONComments(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end == -1 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	// Drop trailing commas now that comments can't hide them
+	stripped := out.Bytes()
+	out = bytes.Buffer{}
+	inString = false
+	for i := 0; i < len(stripped); i++ {
+		c := stripped[i]
+		switch {
+		case inString:
+			if c == '\\' && i+1 < len(stripped) {
+				out.WriteByte(c)
+				i++
+				c = stripped[i]
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == ',':
+			next := bytes.TrimLeft(stripped[i+1:], " \t\r\n")
+			if len(next) > 0 && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.Bytes()
+}
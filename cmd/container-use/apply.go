@@ -10,6 +10,9 @@ import (
 
 var (
 	applyDelete bool
+	applyDryRun bool
+	applyBase   string
+	applySince  bool
 )
 
 var applyCmd = &cobra.Command{
@@ -21,6 +24,11 @@ for you to commit manually, discarding the original commit sequence. This lets y
 review and customize the final commit before making the agent's work permanent.
 Your working directory will be automatically stashed and restored.
 
+To apply an environment again after committing what you applied, use --since-last-apply
+to only stage the changes made since it was last applied to the current branch, so they
+aren't applied twice. Use --base to apply the changes made since another commit of the
+environment instead.
+
 If no environment is specified, automatically selects from environments 
 that are descendants of the current HEAD.`,
 	Args:              cobra.MaximumNArgs(1),
@@ -32,6 +40,12 @@ cu apply backend-api
 cu apply -d backend-api
 cu apply --delete backend-api
 
+# Preview what applying would change without touching your working tree
+cu apply --dry-run backend-api
+
+# Apply what the environment did since you last applied and committed its work
+cu apply --since-last-apply backend-api
+
 # After applying, you can review and commit the changes
 git status
 git commit -m "Add backend API implementation"
@@ -52,7 +66,16 @@ cu apply`,
 			return err
 		}
 
-		if err := repo.Apply(ctx, envID, os.Stdout); err != nil {
+		if applyDryRun {
+			preview, err := repo.PreviewApply(ctx, envID, repository.ApplyOptions{Base: applyBase, SinceLastApply: applySince})
+			if err != nil {
+				return fmt.Errorf("failed to preview environment: %w", err)
+			}
+			printApplyPreview(envID, preview)
+			return nil
+		}
+
+		if err := repo.ApplyWithOptions(ctx, envID, repository.ApplyOptions{Base: applyBase, SinceLastApply: applySince}, os.Stdout); err != nil {
 			return fmt.Errorf("failed to apply environment: %w", err)
 		}
 
@@ -60,8 +83,45 @@ cu apply`,
 	},
 }
 
+func printApplyPreview(envID string, preview *repository.ApplyPreview) {
+	if len(preview.Changes) == 0 {
+		fmt.Printf("Environment '%s' has no changes to apply.\n", envID)
+		return
+	}
+
+	fmt.Printf("Applying '%s' would stage changes to %d file(s):\n", envID, len(preview.Changes))
+	for _, change := range preview.Changes {
+		fmt.Printf("  %s\n", change)
+	}
+
+	if len(preview.LocalChanges) > 0 {
+		fmt.Printf("\nYour uncommitted changes to %d file(s) would be stashed and restored:\n", len(preview.LocalChanges))
+		for _, file := range preview.LocalChanges {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+
+	if len(preview.Conflicts) > 0 {
+		fmt.Printf("\nConflicts expected with your branch in:\n")
+		for _, file := range preview.Conflicts {
+			fmt.Printf("  %s\n", file)
+		}
+	} else {
+		fmt.Printf("\nNo conflicts expected with your branch.\n")
+	}
+	if len(preview.LocalConflicts) > 0 {
+		fmt.Printf("Restoring your uncommitted changes may conflict in:\n")
+		for _, file := range preview.LocalConflicts {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+}
+
 func init() {
 	applyCmd.Flags().BoolVarP(&applyDelete, "delete", "d", false, "Delete the environment after successful application")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Show which files would change and whether conflicts are expected, without applying")
+	applyCmd.Flags().StringVar(&applyBase, "base", "", "Apply the changes made since this commit of the environment, instead of since it forked from your branch")
+	applyCmd.Flags().BoolVar(&applySince, "since-last-apply", false, "Only apply the changes made since the environment was last applied to the current branch")
 
 	rootCmd.AddCommand(applyCmd)
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <file>",
+	Short: "Archive all environments for migration to another machine",
+	Long: `Archive all container-use data, including the environments of every repository,
+their history and notes, into a single file.
+
+Use 'container-use restore' on the new machine to recreate them.
+Avoid running this while agents are working, as in-flight changes may not be captured.`,
+	Args: cobra.ExactArgs(1),
+	Example: `# Back up all environments
+container-use backup container-use.tar.gz`,
+	RunE: func(app *cobra.Command, args []string) error {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create backup file: %w", err)
+		}
+		defer f.Close()
+
+		if err := repository.Backup(app.Context(), f); err != nil {
+			os.Remove(args[0])
+			return err
+		}
+
+		fmt.Printf("Backup written to %s\n", args[0])
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Recreate environments from a backup",
+	Long: `Restore container-use data from an archive produced by 'container-use backup'.
+
+Worktrees and forks are relinked to their new location. Repositories pick up
+their restored environments the next time container-use is run in them.
+Existing environments are never overwritten.`,
+	Args: cobra.ExactArgs(1),
+	Example: `# Restore environments on a new machine
+container-use restore container-use.tar.gz
+
+# Check the environments of a repository
+cd my-project && container-use list`,
+	RunE: func(app *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open backup file: %w", err)
+		}
+		defer f.Close()
+
+		if err := repository.Restore(app.Context(), f); err != nil {
+			return err
+		}
+
+		fmt.Printf("Backup restored from %s\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
@@ -15,7 +17,10 @@ This creates a local branch from the environment's state so you can
 explore files in your IDE, make changes, or continue development.
 
 If no environment is specified, automatically selects from environments 
-that are descendants of the current HEAD.`,
+that are descendants of the current HEAD.
+
+With --worktree, the branch is checked out in a separate directory instead,
+leaving your current branch and uncommitted work untouched.`,
 	Args:              cobra.MaximumNArgs(1),
 	ValidArgsFunction: suggestEnvironments,
 	Example: `# Switch to environment's branch locally
@@ -25,7 +30,13 @@ container-use checkout fancy-mallard
 container-use checkout fancy-mallard -b my-review-branch
 
 # Auto-select environment
-container-use checkout`,
+container-use checkout
+
+# Review an environment side by side with your work
+container-use checkout fancy-mallard --worktree ../fancy-mallard
+
+# Remove the worktree once done
+container-use checkout --worktree ../fancy-mallard --remove`,
 	RunE: func(app *cobra.Command, args []string) error {
 		ctx := app.Context()
 
@@ -35,6 +46,27 @@ container-use checkout`,
 			return err
 		}
 
+		worktree, err := app.Flags().GetString("worktree")
+		if err != nil {
+			return err
+		}
+		if worktree != "" {
+			if worktree, err = filepath.Abs(worktree); err != nil {
+				return err
+			}
+		}
+
+		if remove, _ := app.Flags().GetBool("remove"); remove {
+			if worktree == "" {
+				return errors.New("--remove requires --worktree")
+			}
+			if err := repo.RemoveCheckoutWorktree(ctx, worktree); err != nil {
+				return err
+			}
+			fmt.Printf("Removed worktree '%s'\n", worktree)
+			return nil
+		}
+
 		envID, err := resolveEnvironmentID(ctx, repo, args)
 		if err != nil {
 			return err
@@ -45,6 +77,15 @@ container-use checkout`,
 			return err
 		}
 
+		if worktree != "" {
+			branch, err := repo.CheckoutWorktree(ctx, envID, branchName, worktree)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Checked out branch '%s' in '%s'\n", branch, worktree)
+			return nil
+		}
+
 		branch, err := repo.Checkout(ctx, envID, branchName)
 		if err != nil {
 			return err
@@ -57,5 +98,7 @@ container-use checkout`,
 
 func init() {
 	checkoutCmd.Flags().StringP("branch", "b", "", "Local branch name to use")
+	checkoutCmd.Flags().String("worktree", "", "Check out the environment in a new git worktree at this path instead of switching branches")
+	checkoutCmd.Flags().Bool("remove", false, "Remove the worktree created with --worktree")
 	rootCmd.AddCommand(checkoutCmd)
 }
@@ -1,15 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
+	"dagger.io/dagger"
 	"github.com/dagger/container-use/cmd/container-use/agent"
 	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // Helper function for read-only config operations
@@ -20,6 +28,14 @@ func withConfig(cmd *cobra.Command, fn func(*environment.EnvironmentConfig) erro
 		return fmt.Errorf("failed to open repository: %w", err)
 	}
 
+	if envID, _ := cmd.Flags().GetString("environment"); envID != "" {
+		env, err := repo.Info(ctx, envID)
+		if err != nil {
+			return err
+		}
+		return fn(env.State.Config)
+	}
+
 	config := environment.DefaultConfig()
 	if err := config.Load(repo.SourcePath()); err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
@@ -36,6 +52,10 @@ func updateConfig(cmd *cobra.Command, fn func(*environment.EnvironmentConfig) er
 		return fmt.Errorf("failed to open repository: %w", err)
 	}
 
+	if envID, _ := cmd.Flags().GetString("environment"); envID != "" {
+		return updateEnvironmentConfig(cmd, repo, envID, fn)
+	}
+
 	config := environment.DefaultConfig()
 	if err := config.Load(repo.SourcePath()); err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
@@ -52,15 +72,55 @@ func updateConfig(cmd *cobra.Command, fn func(*environment.EnvironmentConfig) er
 	return nil
 }
 
+// updateEnvironmentConfig applies a config update to an existing environment and rebuilds its container.
+func updateEnvironmentConfig(cmd *cobra.Command, repo *repository.Repository, envID string, fn func(*environment.EnvironmentConfig) error) error {
+	ctx := cmd.Context()
+
+	dag, err := connectDagger(ctx, dagger.WithLogOutput(os.Stderr))
+	if err != nil {
+		if isDockerDaemonError(err) {
+			handleDockerDaemonError()
+		}
+		return fmt.Errorf("failed to connect to dagger: %w", err)
+	}
+	defer dag.Close()
+
+	env, err := repo.Get(ctx, dag, envID)
+	if err != nil {
+		return err
+	}
+
+	config := env.State.Config.Copy()
+	if err := fn(config); err != nil {
+		return err
+	}
+
+	if err := env.UpdateConfig(ctx, config); err != nil {
+		return fmt.Errorf("failed to rebuild environment: %w", err)
+	}
+
+	return repo.Update(ctx, env, fmt.Sprintf("Update configuration with '%s'", cmd.CommandPath()))
+}
+
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage environment configuration",
 	Long: `Configure the development environment settings such as base image and setup commands.
-These settings are stored in .container-use/environment.json and apply to all new environments.`,
+These settings are stored in .container-use/environment.json and apply to all new environments.
+
+With --environment, settings of an existing environment are changed instead and its container is rebuilt.`,
+	Example: `# Use Go for all new environments
+container-use config base-image set golang:1.24
+
+# Add a setup command to an existing environment and rebuild it
+container-use config setup-command add "apt-get install -y jq" --environment fancy-mallard`,
 }
 
 func init() {
 	configShowCmd.Flags().Bool("json", false, "Dump the configuration in JSON")
+	configResolveCmd.Flags().Bool("json", false, "Dump the resolved configuration in JSON")
+	configResolveCmd.Flags().String("base-image", "", "Override the base image")
+	configResolveCmd.Flags().String("workdir", "", "Override the working directory")
 }
 
 var configShowCmd = &cobra.Command{
@@ -122,6 +182,9 @@ container-use config show my-env
 		} else {
 			fmt.Fprintf(tw, "Setup Commands:\t(none)\n")
 		}
+		if config.SetupScript != "" {
+			fmt.Fprintf(tw, "Setup Script:\t%s\n", config.SetupScript)
+		}
 
 		if len(config.InstallCommands) > 0 {
 			fmt.Fprintf(tw, "Install Commands:\t\n")
@@ -154,6 +217,146 @@ container-use config show my-env
 			fmt.Fprintf(tw, "Secrets:\t(none)\n")
 		}
 
+		if len(config.Services) > 0 {
+			fmt.Fprintf(tw, "Services:\t\n")
+			for i, svc := range config.Services {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, formatServiceConfig(svc))
+			}
+		} else {
+			fmt.Fprintf(tw, "Services:\t(none)\n")
+		}
+
+		if len(config.ExtraHosts) > 0 {
+			fmt.Fprintf(tw, "Extra Hosts:\t\n")
+			for i, host := range config.ExtraHosts {
+				fmt.Fprintf(tw, "  %d.\t%s\n", i+1, formatExtraHost(host))
+			}
+		}
+
+		if config.CommitTemplate != "" {
+			fmt.Fprintf(tw, "Commit Template:\t%s\n", config.CommitTemplate)
+		}
+
+		if config.CommitAuthor != "" {
+			fmt.Fprintf(tw, "Commit Author:\t%s\n", config.CommitAuthor)
+		}
+
+		if len(config.CommitIgnore) > 0 {
+			fmt.Fprintf(tw, "Commit Ignore:\t%s\n", strings.Join(config.CommitIgnore, ", "))
+		}
+
+		if config.BinaryFilePolicy != "" {
+			fmt.Fprintf(tw, "Binary File Policy:\t%s\n", config.BinaryFilePolicy)
+		}
+
+		if config.DefaultShell != "" || config.LoginShell {
+			fmt.Fprintf(tw, "Shell:\t%s\n", formatShell(config))
+		}
+
+		if config.IncludeGitDir {
+			fmt.Fprintf(tw, "Include Git Dir:\t%t\n", config.IncludeGitDir)
+		}
+
+		if len(config.SourcePaths) > 0 {
+			fmt.Fprintf(tw, "Source Paths:\t%s\n", strings.Join(config.SourcePaths, ", "))
+		}
+
+		if config.DetectSource {
+			fmt.Fprintf(tw, "Detect Source:\t%t\n", config.DetectSource)
+		}
+
+		return nil
+	},
+}
+
+var configResolveCmd = &cobra.Command{
+	Use:   "resolve [<env>]",
+	Short: "Show the effective configuration and where each value comes from",
+	Long: `Display the effective environment configuration along with the source of each field.
+Sources are applied in order: built-in defaults, the repository configuration
+(.container-use/environment.json), the environment's recorded configuration
+when an environment is given, and finally command-line flags.`,
+	Example: `# Explain the configuration new environments will get
+container-use config resolve
+
+# Explain why an environment got its base image
+container-use config resolve my-env
+
+# Preview the effect of overriding the base image
+container-use config resolve --base-image python:3.12`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		repoConfig := &environment.EnvironmentConfig{}
+		if err := repoConfig.Load(repo.SourcePath()); err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		layers := []environment.ConfigLayer{
+			{Source: environment.ConfigSourceDefault, Config: environment.DefaultConfig()},
+			{Source: environment.ConfigSourceRepository, Config: repoConfig},
+		}
+
+		if len(args) == 1 {
+			env, err := repo.Info(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			layers = append(layers, environment.ConfigLayer{
+				Source:   environment.ConfigSourceEnvironment,
+				Config:   env.State.Config,
+				Complete: true,
+			})
+		}
+
+		flagConfig := &environment.EnvironmentConfig{}
+		flagConfig.BaseImage, _ = cmd.Flags().GetString("base-image")
+		flagConfig.Workdir, _ = cmd.Flags().GetString("workdir")
+		layers = append(layers, environment.ConfigLayer{Source: environment.ConfigSourceFlag, Config: flagConfig})
+
+		_, fields := environment.ResolveConfig(layers...)
+
+		if ok, _ := cmd.Flags().GetBool("json"); ok {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(fields)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+
+		fmt.Fprintln(tw, "FIELD\tVALUE\tSOURCE")
+		for _, field := range fields {
+			value := "(none)"
+			switch v := field.Value.(type) {
+			case string:
+				if v != "" {
+					value = v
+				}
+			case nil:
+			default:
+				out, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if string(out) != "null" {
+					value = string(out)
+				}
+			}
+			source := string(field.Source)
+			if source == "" {
+				source = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", field.Name, value, source)
+		}
+
 		return nil
 	},
 }
@@ -163,13 +366,17 @@ var configImportCmd = &cobra.Command{
 	Short: "Import configuration from an environment",
 	Long: `Import configuration from an existing environment and set it as the default.
 This copies the environment's base image, setup commands, environment variables,
-and secrets to be used as defaults for new environments.`,
+and secrets to .container-use/environment.json, to be used as defaults for new environments.
+If the repository already has a configuration, you are asked before it is overwritten.`,
 	Example: `# Import configuration from an environment
 container-use config import my-env
 
 # View the configuration before importing
 container-use config show my-env
-container-use config import my-env`,
+container-use config import my-env
+
+# Replace the existing configuration without asking
+container-use config import my-env --force`,
 	Args:              cobra.ExactArgs(1),
 	ValidArgsFunction: suggestEnvironments,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -181,19 +388,47 @@ container-use config import my-env`,
 		}
 
 		envID := args[0]
-		env, err := repo.Info(ctx, envID)
+		force, _ := cmd.Flags().GetBool("force")
+		configPath, err := repo.ExportConfig(ctx, envID, force)
+		if errors.Is(err, repository.ErrConfigExists) {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", configPath)
+			}
+			fmt.Printf("%s already exists. Overwrite it? [y/N] ", configPath)
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				return errors.New("import cancelled")
+			}
+			_, err = repo.ExportConfig(ctx, envID, true)
+		}
 		if err != nil {
 			return err
 		}
-		if err := env.State.Config.Save(repo.SourcePath()); err != nil {
-			return fmt.Errorf("failed to save configuration: %w", err)
-		}
 
 		fmt.Printf("Configuration imported from environment '%s'\n", envID)
 		return nil
 	},
 }
 
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the configuration file",
+	Long: `Print the JSON Schema of .container-use/environment.json.
+Reference it from the configuration file with "$schema" to get completion and validation in editors.`,
+	Example: `# Enable validation of the configuration in editors
+container-use config schema > .container-use/environment.schema.json
+# then add "$schema": "./environment.schema.json" to .container-use/environment.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := environment.ConfigSchema()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(schema))
+		return nil
+	},
+}
+
 // Base image object commands
 var configBaseImageCmd = &cobra.Command{
 	Use:   "base-image",
@@ -242,6 +477,589 @@ var configBaseImageResetCmd = &cobra.Command{
 	},
 }
 
+// Dockerfile object commands
+var configDockerfileCmd = &cobra.Command{
+	Use:   "dockerfile",
+	Short: "Manage building environments from a Dockerfile",
+	Long:  `Build the base of new environments from a Dockerfile in the repository instead of pulling the base image.`,
+}
+
+var configDockerfileSetCmd = &cobra.Command{
+	Use:   "set <path>",
+	Short: "Build environments from a Dockerfile",
+	Long: `Build new environments from a Dockerfile in the repository (e.g., Dockerfile, .devcontainer/Dockerfile).
+Paths are relative to the root of the repository. The base image is ignored while a Dockerfile is set.`,
+	Example: `# Build from the project's Dockerfile
+container-use config dockerfile set Dockerfile
+
+# Build from a devcontainer definition with a build argument
+container-use config dockerfile set .devcontainer/Dockerfile --context .devcontainer --build-arg VARIANT=3.12`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerfile := args[0]
+		buildContext, _ := cmd.Flags().GetString("context")
+		buildArgs, _ := cmd.Flags().GetStringArray("build-arg")
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Dockerfile = dockerfile
+			config.BuildContext = buildContext
+			config.BuildArgs = nil
+			for _, arg := range buildArgs {
+				key, value, found := strings.Cut(arg, "=")
+				if !found {
+					return fmt.Errorf("invalid build argument %q, expected KEY=VALUE", arg)
+				}
+				config.BuildArgs.Set(key, value)
+			}
+			fmt.Printf("Dockerfile set to: %s\n", dockerfile)
+			return nil
+		})
+	},
+}
+
+var configDockerfileGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the current Dockerfile",
+	Long:  `Display the Dockerfile, build context and build arguments used to build environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Dockerfile == "" {
+				fmt.Println("No Dockerfile set, using base image", config.BaseImage)
+				return nil
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			defer tw.Flush()
+			fmt.Fprintf(tw, "Dockerfile:\t%s\n", config.Dockerfile)
+			fmt.Fprintf(tw, "Build Context:\t%s\n", cmp.Or(config.BuildContext, "."))
+			for _, key := range config.BuildArgs.Keys() {
+				fmt.Fprintf(tw, "Build Arg:\t%s=%s\n", key, config.BuildArgs.Get(key))
+			}
+			return nil
+		})
+	},
+}
+
+var configDockerfileResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Stop building environments from a Dockerfile",
+	Long:  `Clear the Dockerfile settings so new environments use the base image again.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Dockerfile = ""
+			config.BuildContext = ""
+			config.BuildArgs = nil
+			fmt.Printf("Dockerfile reset, using base image: %s\n", config.BaseImage)
+			return nil
+		})
+	},
+}
+
+// Commit template object commands
+var configCommitTemplateCmd = &cobra.Command{
+	Use:   "commit-template",
+	Short: "Manage the commit message template",
+	Long: `Manage the template used to format the messages of environment commits.
+The template can reference {explanation} (the explanation given by the agent), {operation}
+(the first operation since the previous commit, e.g. "Write main.go"), {environment} and {title}.`,
+}
+
+var configCommitTemplateSetCmd = &cobra.Command{
+	Use:   "set <template>",
+	Short: "Set the commit message template",
+	Long:  `Set the template used to format the messages of environment commits.`,
+	Example: `# Follow conventional commits
+container-use config commit-template set "feat(env): {explanation}"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		template := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommitTemplate = template
+			fmt.Printf("Commit template set to: %s\n", template)
+			return nil
+		})
+	},
+}
+
+var configCommitTemplateGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the commit message template",
+	Long:  `Display the template used to format the messages of environment commits.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CommitTemplate == "" {
+				fmt.Println("No commit template set, commits use the explanation as message")
+				return nil
+			}
+			fmt.Println(config.CommitTemplate)
+			return nil
+		})
+	},
+}
+
+var configCommitTemplateResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the commit message template",
+	Long:  `Remove the commit message template, going back to using the explanation as message.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommitTemplate = ""
+			fmt.Println("Commit template reset, commits use the explanation as message")
+			return nil
+		})
+	},
+}
+
+// Commit author object commands
+var configCommitAuthorCmd = &cobra.Command{
+	Use:   "commit-author",
+	Short: "Manage the identity of environment commits",
+	Long: `Manage the identity environment commits and notes are made with, so that they can be
+told apart from your own commits in git log and blame. Environment commits use your git
+identity by default. Your own commits are never affected.`,
+}
+
+var configCommitAuthorSetCmd = &cobra.Command{
+	Use:   "set <name <email>>",
+	Short: "Set the identity of environment commits",
+	Long:  `Set the identity environment commits and notes are made with, as "Name <email>".`,
+	Example: `# Attribute environment commits to the agent
+container-use config commit-author set "Agent <agent@example.com>"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		author := args[0]
+		if _, _, ok := (&environment.EnvironmentConfig{CommitAuthor: author}).CommitIdentity(); !ok {
+			return fmt.Errorf("invalid commit author %q, expected a name and email like 'Agent <agent@example.com>'", author)
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommitAuthor = author
+			fmt.Printf("Commit author set to: %s\n", author)
+			return nil
+		})
+	},
+}
+
+var configCommitAuthorGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the identity of environment commits",
+	Long:  `Display the identity environment commits and notes are made with.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.CommitAuthor == "" {
+				fmt.Println("No commit author set, commits use your git identity")
+				return nil
+			}
+			fmt.Println(config.CommitAuthor)
+			return nil
+		})
+	},
+}
+
+var configCommitAuthorResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the identity of environment commits",
+	Long:  `Remove the commit author, going back to making environment commits with your git identity.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommitAuthor = ""
+			fmt.Println("Commit author reset, commits use your git identity")
+			return nil
+		})
+	},
+}
+
+// Commit ignore object commands
+var configCommitIgnoreCmd = &cobra.Command{
+	Use:   "commit-ignore",
+	Short: "Manage files never committed to environments",
+	Long: `Manage glob patterns of files never committed to environments, on top of your .gitignore.
+Patterns without a slash match file and directory names anywhere, e.g. "*.log" or ".cache/".
+Patterns with a slash match paths from the root of the repository, e.g. "/generated".`,
+}
+
+var configCommitIgnoreAddCmd = &cobra.Command{
+	Use:   "add <pattern>",
+	Short: "Add a commit ignore pattern",
+	Long:  `Add a glob pattern of files to keep out of environment commits (e.g., ".cache/").`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if slices.Contains(config.CommitIgnore, pattern) {
+				return fmt.Errorf("commit ignore pattern already configured: %s", pattern)
+			}
+			config.CommitIgnore = append(config.CommitIgnore, pattern)
+			if err := config.Validate(); err != nil {
+				return err
+			}
+			fmt.Printf("Commit ignore pattern added: %s\n", pattern)
+			return nil
+		})
+	},
+}
+
+var configCommitIgnoreRemoveCmd = &cobra.Command{
+	Use:   "remove <pattern>",
+	Short: "Remove a commit ignore pattern",
+	Long:  `Remove a glob pattern from the files kept out of environment commits.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			index := slices.Index(config.CommitIgnore, pattern)
+			if index == -1 {
+				return fmt.Errorf("commit ignore pattern not found: %s", pattern)
+			}
+
+			config.CommitIgnore = slices.Delete(config.CommitIgnore, index, index+1)
+			fmt.Printf("Commit ignore pattern removed: %s\n", pattern)
+			return nil
+		})
+	},
+}
+
+var configCommitIgnoreListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all commit ignore patterns",
+	Long:  `List the glob patterns of files kept out of environment commits.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.CommitIgnore) == 0 {
+				fmt.Println("No commit ignore patterns configured")
+				return nil
+			}
+
+			for i, pattern := range config.CommitIgnore {
+				fmt.Printf("%d. %s\n", i+1, pattern)
+			}
+			return nil
+		})
+	},
+}
+
+var configCommitIgnoreClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all commit ignore patterns",
+	Long:  `Remove all commit ignore patterns from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.CommitIgnore = []string{}
+			fmt.Println("All commit ignore patterns cleared")
+			return nil
+		})
+	},
+}
+
+// Binary file policy object commands
+var configBinaryFilePolicyCmd = &cobra.Command{
+	Use:   "binary-file-policy",
+	Short: "Manage how binary files are committed",
+	Long: `Manage whether binary files written in environments are committed:
+skip (default) leaves them out and reports the files skipped, commit commits them
+like any other file, and lfs commits them with Git LFS, which must be installed.`,
+}
+
+var configBinaryFilePolicySetCmd = &cobra.Command{
+	Use:       "set <skip|commit|lfs>",
+	Short:     "Set the binary file policy",
+	Long:      `Set whether binary files written in environments are committed.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{string(environment.BinaryFilePolicySkip), string(environment.BinaryFilePolicyCommit), string(environment.BinaryFilePolicyLFS)},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy := environment.BinaryFilePolicy(args[0])
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.BinaryFilePolicy = policy
+			if err := config.Validate(); err != nil {
+				return err
+			}
+			fmt.Printf("Binary file policy set to: %s\n", policy)
+			return nil
+		})
+	},
+}
+
+var configBinaryFilePolicyGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the binary file policy",
+	Long:  `Display whether binary files written in environments are committed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			fmt.Println(cmp.Or(config.BinaryFilePolicy, environment.BinaryFilePolicySkip))
+			return nil
+		})
+	},
+}
+
+var configBinaryFilePolicyResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the binary file policy",
+	Long:  `Go back to leaving binary files out of environment commits.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.BinaryFilePolicy = ""
+			fmt.Println("Binary file policy reset, binary files are not committed")
+			return nil
+		})
+	},
+}
+
+// Git directory object commands
+var configIncludeGitDirCmd = &cobra.Command{
+	Use:   "include-git-dir",
+	Short: "Manage whether environments keep the .git directory",
+	Long: `Manage whether new environments keep the .git directory, with the full history,
+so that git commands like log, blame or bisect work inside them. It is off by default,
+as the history of large repositories takes time and space to copy into each environment.
+The setting only applies to environments created after it is changed.`,
+}
+
+var configIncludeGitDirSetCmd = &cobra.Command{
+	Use:       "set <true|false>",
+	Short:     "Set whether environments keep the .git directory",
+	Long:      `Set whether new environments keep the .git directory with the full history.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"true", "false"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		include, err := strconv.ParseBool(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected true or false", args[0])
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.IncludeGitDir = include
+			fmt.Printf("Include git dir set to: %t\n", include)
+			return nil
+		})
+	},
+}
+
+var configIncludeGitDirGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get whether environments keep the .git directory",
+	Long:  `Display whether new environments keep the .git directory.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			fmt.Println(config.IncludeGitDir)
+			return nil
+		})
+	},
+}
+
+var configIncludeGitDirResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset whether environments keep the .git directory",
+	Long:  `Go back to discarding the .git directory in new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.IncludeGitDir = false
+			fmt.Println("Include git dir reset, environments don't keep the .git directory")
+			return nil
+		})
+	},
+}
+
+// Source paths object commands
+var configSourcePathsCmd = &cobra.Command{
+	Use:   "source-paths",
+	Short: "Manage the paths of the repository environments start from",
+	Long: `Manage the paths of the repository new environments are limited to, e.g. the
+directory of one service of a monorepo, so that environments don't copy and build
+the rest of it. Paths keep their place in the workdir, and files outside of them are
+left untouched in environment commits. Setup scripts and Dockerfiles are still read
+from the whole repository. By default, environments start from the whole repository.
+The setting only applies to environments created after it is changed.`,
+}
+
+var configSourcePathsAddCmd = &cobra.Command{
+	Use:   "add <path>",
+	Short: "Add a source path",
+	Long:  `Add a path of the repository to the source of new environments (e.g., "services/api").`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sourcePath := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if slices.Contains(config.SourcePaths, sourcePath) {
+				return fmt.Errorf("source path already configured: %s", sourcePath)
+			}
+			config.SourcePaths = append(config.SourcePaths, sourcePath)
+			if err := config.Validate(); err != nil {
+				return err
+			}
+			fmt.Printf("Source path added: %s\n", sourcePath)
+			return nil
+		})
+	},
+}
+
+var configSourcePathsRemoveCmd = &cobra.Command{
+	Use:   "remove <path>",
+	Short: "Remove a source path",
+	Long:  `Remove a path of the repository from the source of new environments.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sourcePath := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			index := slices.Index(config.SourcePaths, sourcePath)
+			if index == -1 {
+				return fmt.Errorf("source path not found: %s", sourcePath)
+			}
+
+			config.SourcePaths = slices.Delete(config.SourcePaths, index, index+1)
+			fmt.Printf("Source path removed: %s\n", sourcePath)
+			return nil
+		})
+	},
+}
+
+var configSourcePathsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all source paths",
+	Long:  `List the paths of the repository new environments are limited to.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.SourcePaths) == 0 {
+				fmt.Println("No source paths configured, environments start from the whole repository")
+				return nil
+			}
+
+			for i, sourcePath := range config.SourcePaths {
+				fmt.Printf("%d. %s\n", i+1, sourcePath)
+			}
+			return nil
+		})
+	},
+}
+
+var configSourcePathsClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all source paths",
+	Long:  `Remove all source paths, so that new environments start from the whole repository.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.SourcePaths = []string{}
+			fmt.Println("All source paths cleared")
+			return nil
+		})
+	},
+}
+
+// Source detection object commands
+var configDetectSourceCmd = &cobra.Command{
+	Use:   "detect-source",
+	Short: "Manage whether the workdir follows the source's language",
+	Long: `Manage whether new environments detect the language of their source from go.mod,
+pyproject.toml or package.json. The workdir then defaults to the language's convention,
+e.g. the module path under /go/src for Go, and agents get a suggested base image along
+with the environment. A configured workdir or base image always wins.
+The setting only applies to environments created after it is changed.`,
+}
+
+var configDetectSourceSetCmd = &cobra.Command{
+	Use:       "set <true|false>",
+	Short:     "Set whether environments detect the source's language",
+	Long:      `Set whether new environments detect the language of their source.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"true", "false"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		detect, err := strconv.ParseBool(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected true or false", args[0])
+		}
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DetectSource = detect
+			fmt.Printf("Detect source set to: %t\n", detect)
+			return nil
+		})
+	},
+}
+
+var configDetectSourceGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get whether environments detect the source's language",
+	Long:  `Display whether new environments detect the language of their source.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			fmt.Println(config.DetectSource)
+			return nil
+		})
+	},
+}
+
+var configDetectSourceResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset whether environments detect the source's language",
+	Long:  `Go back to using the configured workdir regardless of the source's language.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DetectSource = false
+			fmt.Println("Detect source reset, environments use the configured workdir")
+			return nil
+		})
+	},
+}
+
+// Shell object commands
+var configShellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Manage the shell commands run in",
+	Long: `Manage the shell interpreting commands, including install commands, when the agent
+doesn't pick one. Setup commands and the setup script run with sh, so they can install it. With --login, commands run in login shells (e.g. bash -lc),
+which read /etc/profile and ~/.profile, so tools set up by shell profiles are found.`,
+}
+
+var configShellSetCmd = &cobra.Command{
+	Use:   "set <shell>",
+	Short: "Set the default shell",
+	Long:  `Set the shell interpreting commands, e.g. bash or /bin/zsh.`,
+	Example: `# Run commands with bash, reading shell profiles
+container-use config shell set bash --login`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := args[0]
+		login, _ := cmd.Flags().GetBool("login")
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DefaultShell = shell
+			config.LoginShell = login
+			if err := config.Validate(); err != nil {
+				return err
+			}
+			fmt.Printf("Shell set to: %s\n", formatShell(config))
+			return nil
+		})
+	},
+}
+
+var configShellGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get the default shell",
+	Long:  `Display the shell interpreting commands.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			fmt.Println(formatShell(config))
+			return nil
+		})
+	},
+}
+
+var configShellResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Reset the default shell",
+	Long:  `Go back to running commands with sh.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.DefaultShell = ""
+			config.LoginShell = false
+			fmt.Println("Shell reset to: sh")
+			return nil
+		})
+	},
+}
+
+func formatShell(config *environment.EnvironmentConfig) string {
+	shell := cmp.Or(config.DefaultShell, "sh")
+	if config.LoginShell {
+		shell += " (login)"
+	}
+	return shell
+}
+
 // Setup command object commands
 var configSetupCommandCmd = &cobra.Command{
 	Use:   "setup-command",
@@ -556,12 +1374,274 @@ var configSecretClearCmd = &cobra.Command{
 	},
 }
 
+// Service object commands
+var configServiceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage sidecar services",
+	Long: `Manage services (databases, caches, ...) that are started alongside new environments.
+Each service is reachable from the environment at its name (e.g., db:5432).`,
+}
+
+var configServiceAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a service",
+	Long:  `Add a service that is started alongside new environments and reachable at <name>.`,
+	Example: `# Add a postgres database reachable at db:5432
+container-use config service add db --image postgres:16 --port 5432 --env POSTGRES_PASSWORD=postgres
+
+# Add a redis cache
+container-use config service add cache --image redis:7 --port 6379`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		image, _ := cmd.Flags().GetString("image")
+		command, _ := cmd.Flags().GetString("command")
+		ports, _ := cmd.Flags().GetIntSlice("port")
+		envs, _ := cmd.Flags().GetStringArray("env")
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Services.Get(name) != nil {
+				return fmt.Errorf("service already exists: %s", name)
+			}
+			for _, env := range envs {
+				if !strings.Contains(env, "=") {
+					return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", env)
+				}
+			}
+			config.Services = append(config.Services, &environment.ServiceConfig{
+				Name:         name,
+				Image:        image,
+				Command:      command,
+				ExposedPorts: ports,
+				Env:          envs,
+			})
+			fmt.Printf("Service added: %s (%s)\n", name, image)
+			return nil
+		})
+	},
+}
+
+var configServiceRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a service",
+	Long:  `Remove a service from the environment configuration.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.Services.Get(name) == nil {
+				return fmt.Errorf("service not found: %s", name)
+			}
+			config.Services = slices.DeleteFunc(config.Services, func(svc *environment.ServiceConfig) bool {
+				return svc.Name == name
+			})
+			fmt.Printf("Service removed: %s\n", name)
+			return nil
+		})
+	},
+}
+
+var configServiceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all services",
+	Long:  `List all services that will be started alongside new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.Services) == 0 {
+				fmt.Println("No services configured")
+				return nil
+			}
+
+			for i, svc := range config.Services {
+				fmt.Printf("%d. %s\n", i+1, formatServiceConfig(svc))
+			}
+			return nil
+		})
+	},
+}
+
+var configServiceClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all services",
+	Long:  `Remove all services from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.Services = nil
+			fmt.Println("All services cleared")
+			return nil
+		})
+	},
+}
+
+func formatServiceConfig(svc *environment.ServiceConfig) string {
+	s := fmt.Sprintf("%s (%s)", svc.Name, svc.Image)
+	if len(svc.ExposedPorts) > 0 {
+		ports := make([]string, len(svc.ExposedPorts))
+		for i, port := range svc.ExposedPorts {
+			ports[i] = strconv.Itoa(port)
+		}
+		s += " ports: " + strings.Join(ports, ", ")
+	}
+	if svc.Command != "" {
+		s += " command: " + svc.Command
+	}
+	return s
+}
+
+// Extra host object commands
+var configExtraHostCmd = &cobra.Command{
+	Use:   "extra-host",
+	Short: "Manage hostnames reachable from environments",
+	Long: `Manage extra hosts, hostnames that environments can reach like with --add-host,
+e.g. internal registries or databases that only your machine can resolve.
+The listed ports of each host are forwarded to its address, as reached from the
+machine running container-use, so hostnames can't be mapped to an address without ports.
+Custom DNS resolvers are configured on the engine, not per environment.`,
+}
+
+var configExtraHostAddCmd = &cobra.Command{
+	Use:   "add <hostname> <address>",
+	Short: "Add an extra host",
+	Long:  `Make <hostname> reachable from new environments, forwarding the given ports to <address>.`,
+	Example: `# Reach an internal package mirror
+container-use config extra-host add pypi.corp.internal 10.0.0.12 --port 443
+
+# Reach a database listening on the host
+container-use config extra-host add db.internal localhost --port 5432`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hostname, address := args[0], args[1]
+		ports, _ := cmd.Flags().GetIntSlice("port")
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.ExtraHosts.Get(hostname) != nil {
+				return fmt.Errorf("extra host already exists: %s", hostname)
+			}
+			config.ExtraHosts = append(config.ExtraHosts, &environment.ExtraHost{
+				Hostname: hostname,
+				Address:  address,
+				Ports:    ports,
+			})
+			fmt.Printf("Extra host added: %s -> %s\n", hostname, address)
+			return nil
+		})
+	},
+}
+
+var configExtraHostRemoveCmd = &cobra.Command{
+	Use:   "remove <hostname>",
+	Short: "Remove an extra host",
+	Long:  `Remove an extra host from the environment configuration.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hostname := args[0]
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if config.ExtraHosts.Get(hostname) == nil {
+				return fmt.Errorf("extra host not found: %s", hostname)
+			}
+			config.ExtraHosts = slices.DeleteFunc(config.ExtraHosts, func(host *environment.ExtraHost) bool {
+				return host.Hostname == hostname
+			})
+			fmt.Printf("Extra host removed: %s\n", hostname)
+			return nil
+		})
+	},
+}
+
+var configExtraHostListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all extra hosts",
+	Long:  `List all hostnames reachable from new environments.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			if len(config.ExtraHosts) == 0 {
+				fmt.Println("No extra hosts configured")
+				return nil
+			}
+
+			for i, host := range config.ExtraHosts {
+				fmt.Printf("%d. %s\n", i+1, formatExtraHost(host))
+			}
+			return nil
+		})
+	},
+}
+
+var configExtraHostClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Clear all extra hosts",
+	Long:  `Remove all extra hosts from the environment configuration.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfig(cmd, func(config *environment.EnvironmentConfig) error {
+			config.ExtraHosts = nil
+			fmt.Println("All extra hosts cleared")
+			return nil
+		})
+	},
+}
+
+func formatExtraHost(host *environment.ExtraHost) string {
+	ports := make([]string, len(host.Ports))
+	for i, port := range host.Ports {
+		ports[i] = strconv.Itoa(port)
+	}
+	return fmt.Sprintf("%s -> %s ports: %s", host.Hostname, host.Address, strings.Join(ports, ", "))
+}
+
 func init() {
 	// Add base-image commands
 	configBaseImageCmd.AddCommand(configBaseImageSetCmd)
 	configBaseImageCmd.AddCommand(configBaseImageGetCmd)
 	configBaseImageCmd.AddCommand(configBaseImageResetCmd)
 
+	// Dockerfile commands
+	configDockerfileSetCmd.Flags().String("context", "", "Build context directory, relative to the repository root (default: repository root)")
+	configDockerfileSetCmd.Flags().StringArray("build-arg", nil, "Build argument in the form KEY=VALUE (can be repeated)")
+	configDockerfileCmd.AddCommand(configDockerfileSetCmd)
+	configDockerfileCmd.AddCommand(configDockerfileGetCmd)
+	configDockerfileCmd.AddCommand(configDockerfileResetCmd)
+
+	// Add commit-template commands
+	configCommitTemplateCmd.AddCommand(configCommitTemplateSetCmd)
+	configCommitTemplateCmd.AddCommand(configCommitTemplateGetCmd)
+	configCommitTemplateCmd.AddCommand(configCommitTemplateResetCmd)
+
+	// Add commit-author commands
+	configCommitAuthorCmd.AddCommand(configCommitAuthorSetCmd)
+	configCommitAuthorCmd.AddCommand(configCommitAuthorGetCmd)
+	configCommitAuthorCmd.AddCommand(configCommitAuthorResetCmd)
+
+	// Add commit-ignore commands
+	configCommitIgnoreCmd.AddCommand(configCommitIgnoreAddCmd)
+	configCommitIgnoreCmd.AddCommand(configCommitIgnoreRemoveCmd)
+	configCommitIgnoreCmd.AddCommand(configCommitIgnoreListCmd)
+	configCommitIgnoreCmd.AddCommand(configCommitIgnoreClearCmd)
+
+	// Add binary-file-policy commands
+	configBinaryFilePolicyCmd.AddCommand(configBinaryFilePolicySetCmd)
+	configBinaryFilePolicyCmd.AddCommand(configBinaryFilePolicyGetCmd)
+	configBinaryFilePolicyCmd.AddCommand(configBinaryFilePolicyResetCmd)
+
+	// Add shell commands
+	configShellSetCmd.Flags().Bool("login", false, "Run commands in login shells, which read shell profiles")
+	configShellCmd.AddCommand(configShellSetCmd)
+	configShellCmd.AddCommand(configShellGetCmd)
+	configShellCmd.AddCommand(configShellResetCmd)
+
+	// Add include-git-dir commands
+	configIncludeGitDirCmd.AddCommand(configIncludeGitDirSetCmd)
+	configIncludeGitDirCmd.AddCommand(configIncludeGitDirGetCmd)
+	configIncludeGitDirCmd.AddCommand(configIncludeGitDirResetCmd)
+
+	// Add source-paths commands
+	configSourcePathsCmd.AddCommand(configSourcePathsAddCmd)
+	configSourcePathsCmd.AddCommand(configSourcePathsRemoveCmd)
+	configSourcePathsCmd.AddCommand(configSourcePathsListCmd)
+	configSourcePathsCmd.AddCommand(configSourcePathsClearCmd)
+
+	// Add detect-source commands
+	configDetectSourceCmd.AddCommand(configDetectSourceSetCmd)
+	configDetectSourceCmd.AddCommand(configDetectSourceGetCmd)
+	configDetectSourceCmd.AddCommand(configDetectSourceResetCmd)
+
 	// Add setup-command commands
 	configSetupCommandCmd.AddCommand(configSetupCommandAddCmd)
 	configSetupCommandCmd.AddCommand(configSetupCommandRemoveCmd)
@@ -586,14 +1666,67 @@ func init() {
 	configSecretCmd.AddCommand(configSecretListCmd)
 	configSecretCmd.AddCommand(configSecretClearCmd)
 
+	// Add service commands
+	configServiceAddCmd.Flags().String("image", "", "Image to run the service from (required)")
+	configServiceAddCmd.Flags().String("command", "", "Command to run instead of the image's default command")
+	configServiceAddCmd.Flags().IntSlice("port", nil, "Port exposed by the service (can be repeated)")
+	configServiceAddCmd.Flags().StringArray("env", nil, "Environment variable in the form KEY=VALUE (can be repeated)")
+	_ = configServiceAddCmd.MarkFlagRequired("image")
+	configServiceCmd.AddCommand(configServiceAddCmd)
+	configServiceCmd.AddCommand(configServiceRemoveCmd)
+	configServiceCmd.AddCommand(configServiceListCmd)
+	configServiceCmd.AddCommand(configServiceClearCmd)
+
+	// Add extra-host commands
+	configExtraHostAddCmd.Flags().IntSlice("port", nil, "Port forwarded to the address (required, can be repeated)")
+	_ = configExtraHostAddCmd.MarkFlagRequired("port")
+	configExtraHostCmd.AddCommand(configExtraHostAddCmd)
+	configExtraHostCmd.AddCommand(configExtraHostRemoveCmd)
+	configExtraHostCmd.AddCommand(configExtraHostListCmd)
+	configExtraHostCmd.AddCommand(configExtraHostClearCmd)
+
+	// Object commands can target an existing environment instead of the default configuration
+	for _, cmd := range []*cobra.Command{
+		configBaseImageCmd,
+		configDockerfileCmd,
+		configSetupCommandCmd,
+		configInstallCommandCmd,
+		configEnvCmd,
+		configSecretCmd,
+		configServiceCmd,
+		configExtraHostCmd,
+		configCommitTemplateCmd,
+		configCommitAuthorCmd,
+		configCommitIgnoreCmd,
+		configBinaryFilePolicyCmd,
+		configShellCmd,
+	} {
+		cmd.PersistentFlags().String("environment", "", "Change the configuration of an existing environment and rebuild it, instead of the default configuration")
+		_ = cmd.RegisterFlagCompletionFunc("environment", suggestEnvironments)
+	}
+
 	// Add object commands to config
 	configCmd.AddCommand(configBaseImageCmd)
+	configCmd.AddCommand(configDockerfileCmd)
 	configCmd.AddCommand(configSetupCommandCmd)
 	configCmd.AddCommand(configInstallCommandCmd)
 	configCmd.AddCommand(configEnvCmd)
 	configCmd.AddCommand(configSecretCmd)
+	configCmd.AddCommand(configServiceCmd)
+	configCmd.AddCommand(configExtraHostCmd)
+	configCmd.AddCommand(configCommitTemplateCmd)
+	configCmd.AddCommand(configCommitAuthorCmd)
+	configCmd.AddCommand(configCommitIgnoreCmd)
+	configCmd.AddCommand(configBinaryFilePolicyCmd)
+	configCmd.AddCommand(configIncludeGitDirCmd)
+	configCmd.AddCommand(configSourcePathsCmd)
+	configCmd.AddCommand(configDetectSourceCmd)
+	configCmd.AddCommand(configShellCmd)
 	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configResolveCmd)
+	configImportCmd.Flags().BoolP("force", "f", false, "Overwrite an existing configuration without asking")
 	configCmd.AddCommand(configImportCmd)
+	configCmd.AddCommand(configSchemaCmd)
 
 	// Add agent command
 	configCmd.AddCommand(agent.AgentCmd)
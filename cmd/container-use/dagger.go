@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+const connectAttempts = 3
+
+var (
+	// connect and connectBackoff are variables so tests can simulate engine failures
+	connect        = dagger.Connect
+	connectBackoff = 2 * time.Second
+)
+
+// connectDagger connects to the Dagger engine, retrying with backoff to ride out engines that are still
+// starting. Docker not running isn't transient, so it fails right away.
+func connectDagger(ctx context.Context, opts ...dagger.ClientOpt) (*dagger.Client, error) {
+	backoff := connectBackoff
+	for attempt := 1; ; attempt++ {
+		dag, err := connect(ctx, opts...)
+		if err == nil {
+			return dag, nil
+		}
+		if attempt == connectAttempts || isDockerDaemonError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		slog.Warn("Failed to connect to dagger, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectDagger(t *testing.T) {
+	originalConnect, originalBackoff := connect, connectBackoff
+	t.Cleanup(func() {
+		connect, connectBackoff = originalConnect, originalBackoff
+	})
+	connectBackoff = time.Millisecond
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "connects first time",
+			errs:         nil,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retries transient failures",
+			errs:         []error{errors.New("engine not ready"), errors.New("engine not ready")},
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after the last attempt",
+			errs:         []error{errors.New("engine not ready"), errors.New("engine not ready"), errors.New("engine not ready")},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "doesn't retry when docker is not running",
+			errs:         []error{errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?")},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			connect = func(ctx context.Context, opts ...dagger.ClientOpt) (*dagger.Client, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return nil, tt.errs[attempts-1]
+				}
+				return &dagger.Client{}, nil
+			}
+
+			dag, err := connectDagger(context.Background())
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.NotNil(t, dag)
+			}
+			assert.Equal(t, tt.wantAttempts, attempts)
+		})
+	}
+}
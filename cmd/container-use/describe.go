@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var describeCmd = &cobra.Command{
+	Use:   "describe [<env>]",
+	Short: "Show how an environment's container is built",
+	Long: `Print a Dockerfile-equivalent description of how an environment's container is built:
+its base image or Dockerfile, environment variables, setup and install commands.
+Secrets, mounts and services are listed as comments, as they are not part of the image.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Review how an agent set up its environment
+container-use describe fancy-mallard
+
+# Keep it as a reviewed build definition
+container-use describe fancy-mallard > Dockerfile`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		plan, err := repo.DescribeBuild(ctx, envID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(plan)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+}
@@ -12,6 +12,8 @@ var diffCmd = &cobra.Command{
 	Short: "Show what files an agent changed",
 	Long: `Display the code changes made by an agent in an environment.
 Shows a git diff between the environment's state and your current branch.
+With --local, compares the environment's files to your working tree as it is now,
+uncommitted and untracked changes included, to review what applying it would change.
 
 If no environment is specified, automatically selects from environments 
 that are descendants of the current HEAD.`,
@@ -23,6 +25,9 @@ container-use diff fancy-mallard
 # Quick assessment before merging
 container-use diff backend-api
 
+# Compare to your uncommitted work before applying
+container-use diff fancy-mallard --local
+
 # Auto-select environment
 container-use diff`,
 	RunE: func(app *cobra.Command, args []string) error {
@@ -39,10 +44,14 @@ container-use diff`,
 			return err
 		}
 
+		if local, _ := app.Flags().GetBool("local"); local {
+			return repo.DiffLocal(ctx, envID, false, nil, os.Stdout)
+		}
 		return repo.Diff(ctx, envID, os.Stdout)
 	},
 }
 
 func init() {
+	diffCmd.Flags().Bool("local", false, "Compare to your working tree, uncommitted and untracked changes included")
 	rootCmd.AddCommand(diffCmd)
 }
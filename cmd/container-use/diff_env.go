@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var diffEnvCmd = &cobra.Command{
+	Use:   "diff-env <env-a> <env-b> [<path>...]",
+	Short: "Compare the changes of two environments",
+	Long: `Display the differences between the latest states of two environments.
+Useful to compare two agent attempts at the same task before deciding which one to keep.
+Paths limit the diff to matching files.`,
+	Args: cobra.MinimumNArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// Paths follow the two environments
+		if len(args) >= 2 {
+			return nil, cobra.ShellCompDirectiveDefault
+		}
+		return suggestEnvironments(cmd, args, toComplete)
+	},
+	Example: `# Compare two attempts
+container-use diff-env fancy-mallard clever-dolphin
+
+# Summarize which files differ
+container-use diff-env fancy-mallard clever-dolphin --stat
+
+# Only compare the frontend
+container-use diff-env fancy-mallard clever-dolphin web/`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		// Ensure we're in a git repository
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		stat, _ := app.Flags().GetBool("stat")
+		return repo.DiffEnvironments(ctx, args[0], args[1], stat, args[2:], os.Stdout)
+	},
+}
+
+func init() {
+	diffEnvCmd.Flags().Bool("stat", false, "Only show a summary of changed files")
+	rootCmd.AddCommand(diffEnvCmd)
+}
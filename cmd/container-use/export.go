@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [<env>]",
+	Short: "Archive an environment as a git bundle or tarball",
+	Long: `Export an environment so it can be archived, shared, or moved to another machine.
+
+With --format=bundle (the default), produces a git bundle containing the full
+history of the environment along with its container-use notes.
+With --format=tar, produces a tarball of the environment's current files.
+
+Output is written to the path given with --output, or to stdout.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Export the full history of an environment
+container-use export fancy-mallard -o fancy-mallard.bundle
+
+# Export only the current files
+container-use export fancy-mallard --format=tar > fancy-mallard.tar`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		// Ensure we're in a git repository
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		format, _ := app.Flags().GetString("format")
+		output, _ := app.Flags().GetString("output")
+
+		if output != "" && output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			if err := repo.Export(ctx, envID, repository.ExportFormat(format), f); err != nil {
+				// Don't leave a truncated archive behind
+				f.Close()
+				os.Remove(output)
+				return err
+			}
+			return f.Close()
+		}
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			return errors.New("refusing to write archive to a terminal, use --output or redirect stdout")
+		}
+
+		return repo.Export(ctx, envID, repository.ExportFormat(format), os.Stdout)
+	},
+}
+
+func init() {
+	exportCmd.Flags().String("format", string(repository.ExportFormatBundle), "Archive format (bundle or tar)")
+	exportCmd.Flags().StringP("output", "o", "", "Write the archive to a file instead of stdout")
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Compact the repository storing environments",
+	Long: `Reclaim the space used by deleted environments in the repository container-use
+stores environments in. Their commits and notes are pruned, and the remaining objects
+repacked, then the space reclaimed is reported.
+
+Deleting environments already compacts the repository from time to time, but
+keeps the objects of recently deleted environments.`,
+	Example: `# Reclaim space after pruning old environments
+container-use prune --before 2w
+container-use gc`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		result, err := repo.GC(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to compact repository: %w", err)
+		}
+
+		fmt.Printf("Reclaimed %s (%s -> %s)\n", formatBytes(result.Reclaimed()), formatBytes(result.SizeBefore), formatBytes(result.SizeAfter))
+		return nil
+	},
+}
+
+// formatBytes renders a size in bytes with a binary unit, e.g. 1.5 MiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Recreate an environment from an exported bundle",
+	Long: `Import a git bundle produced by 'container-use export --format=bundle'.
+
+The environment's branch and history are added to this repository and its
+container is rebuilt from the configuration recorded in the bundle.
+If an environment with the same ID already exists, a new ID is generated.`,
+	Args: cobra.ExactArgs(1),
+	Example: `# Restore an environment exported on another machine
+container-use import fancy-mallard.bundle`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		// Ensure we're in a git repository
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		dag, err := connectDagger(ctx)
+		if err != nil {
+			if isDockerDaemonError(err) {
+				handleDockerDaemonError()
+			}
+			return fmt.Errorf("failed to connect to dagger: %w", err)
+		}
+		defer dag.Close()
+
+		env, err := repo.Import(ctx, dag, args[0], fmt.Sprintf("Import environment from %s", args[0]))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Environment '%s' imported successfully.\n", env.ID)
+		fmt.Printf("To view this environment's changes, use: container-use checkout %s\n", env.ID)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/repository"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
@@ -14,16 +17,52 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all environments",
 	Long: `Display all active environments with their IDs, titles, and timestamps.
-Use -q for environment IDs only, useful for scripting.`,
+Use -q for environment IDs only, or --json for all their details, useful for scripting.`,
+	Example: `# List all environments
+container-use list
+
+# Find environments by ID or title
+container-use list --name api
+
+# List environments building on the current branch
+container-use list --descendants-of HEAD
+
+# Get the base image of each environment
+container-use list --json | jq -r '.[] | .id + " " + .state.config.base_image'`,
 	RunE: func(app *cobra.Command, _ []string) error {
 		ctx := app.Context()
 		repo, err := repository.Open(ctx, ".")
 		if err != nil {
 			return err
 		}
-		envInfos, err := repo.List(ctx)
-		if err != nil {
-			return err
+
+		var envInfos []*environment.EnvironmentInfo
+		if ref, _ := app.Flags().GetString("descendants-of"); ref != "" {
+			commit, err := repository.RunGitCommand(ctx, repo.SourcePath(), "rev-parse", "--verify", ref+"^{commit}")
+			if err != nil {
+				return fmt.Errorf("unknown git reference %q", ref)
+			}
+			envInfos, err = repo.ListDescendantEnvironments(ctx, strings.TrimSpace(commit))
+			if err != nil {
+				return err
+			}
+		} else {
+			envInfos, err = repo.List(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if name, _ := app.Flags().GetString("name"); name != "" {
+			envInfos = filterEnvironmentsByName(envInfos, name)
+		}
+
+		if asJSON, _ := app.Flags().GetBool("json"); asJSON {
+			if envInfos == nil {
+				envInfos = []*environment.EnvironmentInfo{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(envInfos)
 		}
 		if quiet, _ := app.Flags().GetBool("quiet"); quiet {
 			for _, envInfo := range envInfos {
@@ -43,6 +82,18 @@ Use -q for environment IDs only, useful for scripting.`,
 	},
 }
 
+// filterEnvironmentsByName keeps the environments whose ID or title contains name, ignoring case.
+func filterEnvironmentsByName(envInfos []*environment.EnvironmentInfo, name string) []*environment.EnvironmentInfo {
+	name = strings.ToLower(name)
+	var filtered []*environment.EnvironmentInfo
+	for _, envInfo := range envInfos {
+		if strings.Contains(strings.ToLower(envInfo.ID), name) || strings.Contains(strings.ToLower(envInfo.State.Title), name) {
+			filtered = append(filtered, envInfo)
+		}
+	}
+	return filtered
+}
+
 func truncate(app *cobra.Command, s string, max int) string {
 	if noTrunc, _ := app.Flags().GetBool("no-trunc"); noTrunc {
 		return s
@@ -56,5 +107,8 @@ func truncate(app *cobra.Command, s string, max int) string {
 func init() {
 	listCmd.Flags().BoolP("quiet", "q", false, "Display only environment IDs")
 	listCmd.Flags().BoolP("no-trunc", "", false, "Don't truncate output")
+	listCmd.Flags().Bool("json", false, "Output environments in JSON")
+	listCmd.Flags().String("name", "", "Only list environments whose ID or title contains this text")
+	listCmd.Flags().String("descendants-of", "", "Only list environments building on this git reference, e.g. HEAD")
 	rootCmd.AddCommand(listCmd)
 }
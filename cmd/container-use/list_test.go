@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterEnvironmentsByName(t *testing.T) {
+	envs := []*environment.EnvironmentInfo{
+		{ID: "fancy-mallard", State: &environment.State{Title: "User API"}},
+		{ID: "clever-dolphin", State: &environment.State{Title: "Fix login page"}},
+	}
+
+	ids := func(envs []*environment.EnvironmentInfo) []string {
+		var ids []string
+		for _, env := range envs {
+			ids = append(ids, env.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"fancy-mallard"}, ids(filterEnvironmentsByName(envs, "mallard")))
+	assert.Equal(t, []string{"fancy-mallard"}, ids(filterEnvironmentsByName(envs, "api")), "titles match ignoring case")
+	assert.Equal(t, []string{"fancy-mallard", "clever-dolphin"}, ids(filterEnvironmentsByName(envs, "l")))
+	assert.Empty(t, filterEnvironmentsByName(envs, "checkout"))
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dagger/container-use/repository"
 	"github.com/spf13/cobra"
@@ -24,6 +28,12 @@ container-use log fancy-mallard
 # Include code changes
 container-use log fancy-mallard -p
 
+# Follow the changes to a single file
+container-use log fancy-mallard -p --path src/main.go
+
+# See what the agent did in the last hour
+container-use log fancy-mallard --since 1h
+
 # Auto-select environment
 container-use log`,
 	RunE: func(app *cobra.Command, args []string) error {
@@ -40,13 +50,61 @@ container-use log`,
 			return err
 		}
 
-		patch, _ := app.Flags().GetBool("patch")
+		opts := repository.LogOptions{}
+		opts.Patch, _ = app.Flags().GetBool("patch")
+		opts.Paths, _ = app.Flags().GetStringArray("path")
+		opts.Since, opts.Until, err = timeRangeFlags(app, time.Now())
+		if err != nil {
+			return err
+		}
 
-		return repo.Log(ctx, envID, patch, os.Stdout)
+		return repo.LogWithOptions(ctx, envID, opts, os.Stdout)
 	},
 }
 
+// addTimeRangeFlags adds the --since and --until flags read by timeRangeFlags.
+func addTimeRangeFlags(cmd *cobra.Command, what string) {
+	cmd.Flags().String("since", "", fmt.Sprintf("Only show %s made since a time (RFC3339) or a duration ago (e.g. 1h, 30m, 2d)", what))
+	cmd.Flags().String("until", "", fmt.Sprintf("Only show %s made until a time (RFC3339) or a duration ago (e.g. 1h, 30m, 2d)", what))
+}
+
+// timeRangeFlags reads the --since and --until flags, zero when unset.
+func timeRangeFlags(app *cobra.Command, now time.Time) (since, until time.Time, err error) {
+	sinceFlag, _ := app.Flags().GetString("since")
+	if since, err = parseTimeFlag(sinceFlag, now); err != nil {
+		return since, until, fmt.Errorf("invalid --since: %w", err)
+	}
+	untilFlag, _ := app.Flags().GetString("until")
+	if until, err = parseTimeFlag(untilFlag, now); err != nil {
+		return since, until, fmt.Errorf("invalid --until: %w", err)
+	}
+	return since, until, nil
+}
+
+// parseTimeFlag parses a point in time given either as an RFC3339 time, or as a duration before now like 1h
+// or 2d. Empty values parse as the zero time.
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	// time.ParseDuration stops at hours, days are common when looking back
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("expected a time like 2025-07-01T10:00:00Z or a duration like 1h or 2d, got %q", value)
+}
+
 func init() {
 	logCmd.Flags().BoolP("patch", "p", false, "Generate patch")
+	logCmd.Flags().StringArray("path", nil, "Only show commits touching this path (can be repeated)")
+	addTimeRangeFlags(logCmd, "commits")
 	rootCmd.AddCommand(logCmd)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2025, 7, 3, 12, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Time{
+		"":                     {},
+		"2025-07-01T10:00:00Z": time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC),
+		"1h":                   now.Add(-time.Hour),
+		"1h30m":                now.Add(-90 * time.Minute),
+		"2d":                   now.AddDate(0, 0, -2),
+	} {
+		parsed, err := parseTimeFlag(value, now)
+		require.NoError(t, err, value)
+		assert.True(t, expected.Equal(parsed), "%s: expected %s, got %s", value, expected, parsed)
+	}
+
+	for _, value := range []string{"yesterday", "-1h", "2025-07-01", "d"} {
+		_, err := parseTimeFlag(value, now)
+		assert.Error(t, err, value)
+	}
+}
@@ -9,23 +9,40 @@ import (
 	"time"
 )
 
+// logLevelEnv configures the log level, overridden by the --log-level flag.
+const logLevelEnv = "CONTAINER_USE_LOG_LEVEL"
+
 var (
 	logWriter = io.Discard
+	logLevel  = new(slog.LevelVar)
 )
 
-func parseLogLevel(levelStr string) slog.Level {
+// parseLogLevel parses a log level name, reporting whether it is known.
+// Unknown levels fall back to info.
+func parseLogLevel(levelStr string) (slog.Level, bool) {
 	switch levelStr {
 	case "debug", "DEBUG":
-		return slog.LevelDebug
-	case "info", "INFO":
-		return slog.LevelInfo
+		return slog.LevelDebug, true
+	case "info", "INFO", "":
+		return slog.LevelInfo, true
 	case "warn", "WARN", "warning", "WARNING":
-		return slog.LevelWarn
+		return slog.LevelWarn, true
 	case "error", "ERROR":
-		return slog.LevelError
+		return slog.LevelError, true
 	default:
-		return slog.LevelInfo
+		return slog.LevelInfo, false
+	}
+}
+
+// setLogLevel changes the level of the logger set up by setupLogger.
+// The level is also exported to processes container-use starts, e.g. when re-running under `dagger run`.
+func setLogLevel(levelStr string) error {
+	level, ok := parseLogLevel(levelStr)
+	if !ok {
+		return fmt.Errorf("invalid log level %q: must be one of debug, info, warn, error", levelStr)
 	}
+	logLevel.Set(level)
+	return os.Setenv(logLevelEnv, levelStr)
 }
 
 func setupLogger() error {
@@ -46,7 +63,8 @@ func setupLogger() error {
 		fmt.Fprintf(os.Stderr, "%s Logging disabled. Set CONTAINER_USE_STDERR_FILE and CONTAINER_USE_LOG_LEVEL environment variables\n", time.Now().Format(time.DateTime))
 	}
 
-	logLevel := parseLogLevel(os.Getenv("CONTAINER_USE_LOG_LEVEL"))
+	level, _ := parseLogLevel(os.Getenv(logLevelEnv))
+	logLevel.Set(level)
 	logWriter = io.MultiWriter(writers...)
 	handler := slog.NewTextHandler(logWriter, &slog.HandlerOptions{
 		Level: logLevel,
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	t.Setenv(logLevelEnv, "")
+	defer logLevel.Set(slog.LevelInfo)
+
+	tests := []struct {
+		level    string
+		expected slog.Level
+	}{
+		{level: "debug", expected: slog.LevelDebug},
+		{level: "INFO", expected: slog.LevelInfo},
+		{level: "warning", expected: slog.LevelWarn},
+		{level: "error", expected: slog.LevelError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			if err := setLogLevel(tt.level); err != nil {
+				t.Fatalf("setLogLevel(%q) returned error: %v", tt.level, err)
+			}
+			if logLevel.Level() != tt.expected {
+				t.Errorf("setLogLevel(%q) set level %v, expected %v", tt.level, logLevel.Level(), tt.expected)
+			}
+			if got := os.Getenv(logLevelEnv); got != tt.level {
+				t.Errorf("%s = %q, expected %q", logLevelEnv, got, tt.level)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		logLevel.Set(slog.LevelWarn)
+		if err := setLogLevel("verbose"); err == nil {
+			t.Error("setLogLevel(\"verbose\") should return an error")
+		}
+		if logLevel.Level() != slog.LevelWarn {
+			t.Errorf("invalid level should leave the level unchanged, got %v", logLevel.Level())
+		}
+	})
+}
@@ -22,6 +22,28 @@ Each environment runs in its own container with dedicated git branches.`,
 	}
 )
 
+func init() {
+	rootCmd.PersistentFlags().String("config-dir", "", "Directory container-use stores environments in (default: $"+repository.ConfigDirEnv+" or ~/.config/container-use)")
+	rootCmd.PersistentFlags().String("log-level", "", "Level of the log file: debug, info, warn or error (default: $"+logLevelEnv+" or info)")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
+		if level, _ := cmd.Flags().GetString("log-level"); level != "" {
+			if err := setLogLevel(level); err != nil {
+				return err
+			}
+		}
+
+		configDir, _ := cmd.Flags().GetString("config-dir")
+		if configDir == "" {
+			return nil
+		}
+		if err := repository.SetConfigDir(configDir); err != nil {
+			return err
+		}
+		// Processes started by container-use, e.g. when re-running under `dagger run`, use the same directory
+		return os.Setenv(repository.ConfigDirEnv, repository.ConfigDir())
+	}
+}
+
 func main() {
 	ctx := context.Background()
 	setupSignalHandling()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -10,7 +11,11 @@ import (
 )
 
 var (
-	mergeDelete bool
+	mergeDelete   bool
+	mergeSquash   bool
+	mergeMessage  string
+	mergeNoFF     bool
+	mergeStrategy string
 )
 
 var mergeCmd = &cobra.Command{
@@ -31,6 +36,12 @@ container-use merge backend-api
 container-use merge -d backend-api
 container-use merge --delete backend-api
 
+# Merge the environment's work as a single commit
+container-use merge --squash -m "Add user API" backend-api
+
+# Resolve conflicts in favor of the environment
+container-use merge --strategy theirs backend-api
+
 # Auto-select environment
 container-use merge`,
 	RunE: func(app *cobra.Command, args []string) error {
@@ -47,7 +58,29 @@ container-use merge`,
 			return err
 		}
 
-		if err := repo.Merge(ctx, envID, os.Stdout); err != nil {
+		if mergeSquash && app.Flags().Changed("no-ff") {
+			return fmt.Errorf("--squash and --no-ff cannot be used together")
+		}
+
+		opts := repository.MergeOptions{
+			Squash:      mergeSquash,
+			Message:     mergeMessage,
+			FastForward: !mergeNoFF,
+			Strategy:    repository.MergeStrategy(mergeStrategy),
+		}
+		if err := repo.MergeWithOptions(ctx, envID, opts, os.Stdout); err != nil {
+			var conflict *repository.MergeConflictError
+			if errors.As(err, &conflict) {
+				fmt.Println("\nConflicting files:")
+				for _, file := range conflict.Files {
+					fmt.Printf("  %s\n", file)
+				}
+				abort := "git merge --abort"
+				if mergeSquash {
+					abort = "git reset --merge"
+				}
+				fmt.Printf("\nResolve the conflicts and commit, or abort with '%s'.\n", abort)
+			}
 			return fmt.Errorf("failed to merge environment: %w", err)
 		}
 
@@ -69,6 +102,10 @@ func deleteAfterMerge(ctx context.Context, repo *repository.Repository, env stri
 
 func init() {
 	mergeCmd.Flags().BoolVarP(&mergeDelete, "delete", "d", false, "Delete the environment after successful merge")
+	mergeCmd.Flags().BoolVar(&mergeSquash, "squash", false, "Merge the environment's changes as a single commit")
+	mergeCmd.Flags().StringVarP(&mergeMessage, "message", "m", "", "Commit message for the merge")
+	mergeCmd.Flags().BoolVar(&mergeNoFF, "no-ff", true, "Always create a merge commit, use --no-ff=false to fast-forward when possible")
+	mergeCmd.Flags().StringVar(&mergeStrategy, "strategy", string(repository.MergeStrategyManual), "How to resolve conflicts: manual, ours (keep your changes) or theirs (keep the environment's changes)")
 
 	rootCmd.AddCommand(mergeCmd)
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var notesCmd = &cobra.Command{
+	Use:   "notes [<env>]",
+	Short: "Show the audit log of an environment",
+	Long: `Display the audit log of an environment as a timeline: for each change,
+when it was made, the explanation given for it, and the operations and
+commands that were run, with their output.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Review everything an agent ran
+container-use notes fancy-mallard
+
+# Review the last hour of work
+container-use notes fancy-mallard --since 1h
+
+# Process the audit log with other tools
+container-use notes fancy-mallard --json | jq '.[].explanation'`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		since, until, err := timeRangeFlags(app, time.Now())
+		if err != nil {
+			return err
+		}
+
+		history, err := repo.History(ctx, envID)
+		if err != nil {
+			return err
+		}
+		history = repository.FilterHistory(history, since, until)
+
+		if ok, _ := app.Flags().GetBool("json"); ok {
+			if history == nil {
+				history = []repository.HistoryEntry{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(history)
+		}
+
+		if len(history) == 0 {
+			if !since.IsZero() || !until.IsZero() {
+				fmt.Printf("No changes in environment '%s' in this time range\n", envID)
+				return nil
+			}
+			fmt.Printf("No changes in environment '%s' yet\n", envID)
+			return nil
+		}
+		for i, entry := range history {
+			if i > 0 {
+				fmt.Println()
+			}
+			printHistoryEntry(os.Stdout, entry)
+		}
+		return nil
+	},
+}
+
+// printHistoryEntry writes an entry of the audit log: when the change was made, its commit and explanation,
+// followed by the operations and commands run, indented.
+func printHistoryEntry(w io.Writer, entry repository.HistoryEntry) {
+	fmt.Fprintf(w, "%s  %s  %s\n", entry.Time.Local().Format(time.DateTime), entry.Commit[:7], entry.Explanation)
+	printHistoryNote(w, entry.Note)
+}
+
+func printHistoryNote(w io.Writer, note string) {
+	for line := range strings.Lines(note) {
+		fmt.Fprintf(w, "    %s", line)
+	}
+	if note != "" {
+		fmt.Fprintln(w)
+	}
+}
+
+func init() {
+	notesCmd.Flags().Bool("json", false, "Dump the audit log in JSON")
+	addTimeRangeFlags(notesCmd, "changes")
+	rootCmd.AddCommand(notesCmd)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var publishCmd = &cobra.Command{
+	Use:   "publish [<env>] --image <ref>",
+	Short: "Publish an environment's container as an image",
+	Long: `Publish the current state of an environment's container to an image registry,
+with the tools the agent installed along the way. The published image can be shared,
+or used to start new environments with environment_create's from_image.
+
+Registry credentials are given as a secret reference, like configured secrets,
+so that the password never shows up in your shell history.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Publish an environment to a registry you are logged into
+container-use publish fancy-mallard --image ghcr.io/acme/golden-dev:v1
+
+# Authenticate with a token read from the environment
+container-use publish fancy-mallard --image ghcr.io/acme/golden-dev:v1 --username acme-bot --secret env://GHCR_TOKEN`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		image, _ := app.Flags().GetString("image")
+		username, _ := app.Flags().GetString("username")
+		secret, _ := app.Flags().GetString("secret")
+		auth, err := environment.NewRegistryAuth(username, secret)
+		if err != nil {
+			return fmt.Errorf("invalid registry credentials: %w", err)
+		}
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		dag, err := connectDagger(ctx, dagger.WithLogOutput(os.Stderr))
+		if err != nil {
+			if isDockerDaemonError(err) {
+				handleDockerDaemonError()
+			}
+			return fmt.Errorf("failed to connect to dagger: %w", err)
+		}
+		defer dag.Close()
+
+		env, err := repo.Get(ctx, dag, envID)
+		if err != nil {
+			return err
+		}
+
+		ref, err := env.Checkpoint(ctx, image, auth)
+		if err != nil {
+			return fmt.Errorf("failed to publish environment '%s': %w", envID, err)
+		}
+
+		fmt.Println(ref)
+		return nil
+	},
+}
+
+func init() {
+	publishCmd.Flags().String("image", "", "Image reference to publish to, e.g. ghcr.io/acme/dev:latest")
+	publishCmd.Flags().String("username", "", "Username to authenticate to the registry with")
+	publishCmd.Flags().String("secret", "", "Reference to the registry password or token, e.g. env://REGISTRY_TOKEN")
+	_ = publishCmd.MarkFlagRequired("image")
+	rootCmd.AddCommand(publishCmd)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var pushCmd = &cobra.Command{
+	Use:   "push [<env>]",
+	Short: "Push an environment's branch to a git remote",
+	Long: `Publish an environment's work to one of your git remotes, e.g. to open a pull request.
+The environment's branch is pushed as is, using your git credentials.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Push to origin as cu-fancy-mallard
+container-use push fancy-mallard
+
+# Push to a branch of your choice
+container-use push fancy-mallard --remote origin --branch feature/user-api`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		remote, err := app.Flags().GetString("remote")
+		if err != nil {
+			return err
+		}
+		branch, err := app.Flags().GetString("branch")
+		if err != nil {
+			return err
+		}
+
+		ref, err := repo.PushToRemote(ctx, envID, remote, branch)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Pushed environment '%s' to %s as '%s'\n", envID, remote, ref)
+		return nil
+	},
+}
+
+func init() {
+	pushCmd.Flags().String("remote", "origin", "Git remote to push to")
+	pushCmd.Flags().StringP("branch", "b", "", "Branch to push to (default cu-<env>)")
+	rootCmd.AddCommand(pushCmd)
+}
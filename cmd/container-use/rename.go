@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <env> <new-id>",
+	Short: "Give an environment a new ID",
+	Long: `Rename an environment, e.g. to replace its generated ID with a meaningful one.
+The environment keeps its history, state and log. Its branch in the container-use
+remote is renamed accordingly. Background processes must be stopped first.`,
+	Example: `# Give an environment a meaningful name
+container-use rename fancy-mallard user-api`,
+	Args: cobra.ExactArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return suggestEnvironments(cmd, args, toComplete)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+
+		oldID, newID := args[0], args[1]
+		if err := repo.Rename(ctx, oldID, newID); err != nil {
+			return fmt.Errorf("failed to rename environment '%s': %w", oldID, err)
+		}
+
+		fmt.Printf("Environment '%s' renamed to '%s'.\n", oldID, newID)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renameCmd)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var resetCmd = &cobra.Command{
+	Use:   "reset [<env>]",
+	Short: "Discard an environment's changes back to its base",
+	Long: `Start an environment over from the source it was created from, keeping its
+configuration. The container is rebuilt from the configuration, discarding the files
+changed and the tools installed since.
+
+Use --to-version to go back to the source after a given change instead, counting the
+changes listed by 'container-use notes' from 1. Version 0 is the base.
+
+The reset is recorded as a new change, so nothing is lost: reset to a later version
+to bring discarded changes back.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Start an environment over from its base
+container-use reset fancy-mallard
+
+# Keep the first two changes, discard the rest
+container-use reset fancy-mallard --to-version 2`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		dag, err := connectDagger(ctx, dagger.WithLogOutput(os.Stderr))
+		if err != nil {
+			if isDockerDaemonError(err) {
+				handleDockerDaemonError()
+			}
+			return fmt.Errorf("failed to connect to dagger: %w", err)
+		}
+		defer dag.Close()
+
+		version, _ := app.Flags().GetInt("to-version")
+		if _, err := repo.Reset(ctx, dag, envID, version); err != nil {
+			return fmt.Errorf("failed to reset environment '%s': %w", envID, err)
+		}
+
+		fmt.Printf("Environment '%s' reset to version %d.\n", envID, version)
+		return nil
+	},
+}
+
+func init() {
+	resetCmd.Flags().Int("to-version", 0, "Reset to the source after this change instead of the base, counting changes from 1")
+	rootCmd.AddCommand(resetCmd)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var servicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "List background services running across environments",
+	Long: `List the background processes agents started in all environments, grouped by environment,
+with the host endpoints their ports are forwarded to.
+
+Processes only run as long as the agent session that started them. Ask the agent to stop
+strays with environment_process_stop.`,
+	Args: cobra.NoArgs,
+	Example: `# See what's listening and where
+container-use services
+
+# Get the host endpoints for scripting
+container-use services --json | jq -r '.[][] | .endpoints[]?.host_external'`,
+	RunE: func(app *cobra.Command, _ []string) error {
+		running, err := environment.ListPublishedProcesses(filepath.Join(repository.ConfigDir(), "processes"))
+		if err != nil {
+			return fmt.Errorf("failed to list background services: %w", err)
+		}
+
+		if asJSON, _ := app.Flags().GetBool("json"); asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(running)
+		}
+
+		if len(running) == 0 {
+			fmt.Println("No background services running")
+			return nil
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer tw.Flush()
+		fmt.Fprintln(tw, "ENVIRONMENT\tPROCESS\tCOMMAND\tENDPOINTS\tSTARTED")
+		for _, envID := range slices.Sorted(maps.Keys(running)) {
+			for _, p := range running[envID] {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", envID, p.ID, truncate(app, strings.ReplaceAll(p.Command, "\n", " "), 40), formatEndpoints(p.Endpoints), humanize.Time(p.StartedAt))
+			}
+		}
+		return nil
+	},
+}
+
+// formatEndpoints lists the host endpoints of a process by port, e.g. "3000->127.0.0.1:53124".
+func formatEndpoints(endpoints environment.EndpointMappings) string {
+	if len(endpoints) == 0 {
+		return "-"
+	}
+	var formatted []string
+	for _, port := range slices.Sorted(maps.Keys(endpoints)) {
+		formatted = append(formatted, strconv.Itoa(port)+"->"+endpoints[port].HostExternal)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func init() {
+	servicesCmd.Flags().Bool("json", false, "Output the services of each environment in JSON format")
+	servicesCmd.Flags().Bool("no-trunc", false, "Don't truncate output")
+	rootCmd.AddCommand(servicesCmd)
+}
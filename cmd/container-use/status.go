@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the environment tracked by the current branch",
+	Long: `Show which environment the current branch was checked out from, when the
+environment was last updated, and how far the branch and the environment diverged.`,
+	Example: `# After checking out an environment
+container-use checkout fancy-mallard
+container-use status`,
+	Args: cobra.NoArgs,
+	RunE: func(app *cobra.Command, _ []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		status, err := repo.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		env := status.Environment
+		remoteRef := "container-use/" + env.ID
+		fmt.Printf("On branch %s, tracking environment %s (%s)\n", status.Branch, env.ID, env.State.Title)
+		fmt.Printf("Environment updated %s\n", humanize.Time(env.State.UpdatedAt))
+		switch {
+		case status.Ahead == 0 && status.Behind == 0:
+			fmt.Printf("Your branch is up to date with %s\n", remoteRef)
+		case status.Behind == 0:
+			fmt.Printf("Your branch is ahead of %s by %s\n", remoteRef, pluralCommits(status.Ahead))
+		case status.Ahead == 0:
+			fmt.Printf("Your branch is behind %s by %s, run `container-use checkout %s` to catch up\n", remoteRef, pluralCommits(status.Behind), env.ID)
+		default:
+			fmt.Printf("Your branch and %s have diverged, and have %d and %d different commits each\n", remoteRef, status.Ahead, status.Behind)
+		}
+		if status.Dirty {
+			fmt.Println("You have uncommitted changes")
+		}
+		return nil
+	},
+}
+
+func pluralCommits(n int) string {
+	if n == 1 {
+		return "1 commit"
+	}
+	return fmt.Sprintf("%d commits", n)
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 
 	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
 	"github.com/dagger/container-use/mcpserver"
 	"github.com/spf13/cobra"
 )
 
-var singleTenant bool
+var (
+	singleTenant            bool
+	readOnly                bool
+	hostServices            []string
+	prewarm                 int
+	maxConcurrentOperations int
+)
 
 var stdioCmd = &cobra.Command{
 	Use:   "stdio",
@@ -18,9 +27,29 @@ var stdioCmd = &cobra.Command{
 	RunE: func(app *cobra.Command, _ []string) error {
 		ctx := app.Context()
 
+		hostSvcs := []*environment.HostService{}
+		for _, spec := range hostServices {
+			hs, err := environment.ParseHostService(spec)
+			if err != nil {
+				return err
+			}
+			hostSvcs = append(hostSvcs, hs)
+		}
+
+		if !app.Flags().Changed("max-concurrent-operations") {
+			if v := os.Getenv(environment.MaxConcurrentOperationsEnv); v != "" {
+				limit, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid %s %q: %w", environment.MaxConcurrentOperationsEnv, v, err)
+				}
+				maxConcurrentOperations = limit
+			}
+		}
+		environment.SetMaxConcurrentOperations(maxConcurrentOperations)
+
 		slog.Info("connecting to dagger")
 
-		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(logWriter))
+		dag, err := connectDagger(ctx, dagger.WithLogOutput(logWriter))
 		if err != nil {
 			slog.Error("Error starting dagger", "error", err)
 
@@ -32,11 +61,19 @@ var stdioCmd = &cobra.Command{
 		}
 		defer dag.Close()
 
-		return mcpserver.RunStdioServer(ctx, dag, singleTenant)
+		if prewarm > 0 {
+			go mcpserver.Prewarm(ctx, dag, ".", prewarm)
+		}
+
+		return mcpserver.RunStdioServer(ctx, dag, singleTenant, readOnly, hostSvcs)
 	},
 }
 
 func init() {
 	stdioCmd.Flags().BoolVar(&singleTenant, "single-tenant", false, "Enable single-tenant mode where environment ID is optional (assumes one session per server)")
+	stdioCmd.Flags().BoolVar(&readOnly, "read-only", false, "Only serve the tools that inspect environments, plus environment_create, e.g. for code review agents")
+	stdioCmd.Flags().StringArrayVar(&hostServices, "host-service", nil, "Expose a host service (host:port) to environments, reachable at "+environment.HostServiceAlias+" for loopback hosts")
+	stdioCmd.Flags().IntVar(&prewarm, "prewarm", 0, "Pull the base images of up to N recently used environments in the background on startup")
+	stdioCmd.Flags().IntVar(&maxConcurrentOperations, "max-concurrent-operations", 0, "Bound how many container operations run at once across environments, queuing the rest (default: $"+environment.MaxConcurrentOperationsEnv+" or unbounded)")
 	rootCmd.AddCommand(stdioCmd)
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/spf13/cobra"
+)
+
+var summaryCmd = &cobra.Command{
+	Use:   "summary [<env>]",
+	Short: "Summarize an environment's work as markdown",
+	Long: `Print a markdown changelog of what was done in an environment: each change
+with the commands that were run, and the files changed. Use it as the
+description of a pull request after 'container-use push'.
+
+If no environment is specified, automatically selects from environments
+that are descendants of the current HEAD.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
+	Example: `# Print the summary of an environment
+container-use summary fancy-mallard
+
+# Open a pull request described by the summary
+container-use push fancy-mallard --branch feature/user-api
+container-use summary fancy-mallard | gh pr create --head feature/user-api --body-file -`,
+	RunE: func(app *cobra.Command, args []string) error {
+		ctx := app.Context()
+
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
+			return err
+		}
+
+		envID, err := resolveEnvironmentID(ctx, repo, args)
+		if err != nil {
+			return err
+		}
+
+		summary, err := repo.GenerateSummary(ctx, envID)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(summary)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(summaryCmd)
+}
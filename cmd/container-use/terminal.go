@@ -26,6 +26,9 @@ container-use terminal fancy-mallard
 # Debug agent's work interactively
 container-use terminal backend-api
 
+# Use a specific shell
+container-use terminal fancy-mallard --shell zsh
+
 # Auto-select environment
 container-use terminal`,
 	RunE: func(app *cobra.Command, args []string) error {
@@ -49,7 +52,7 @@ container-use terminal`,
 			return execDaggerRun(daggerBin, append([]string{"dagger", "run"}, os.Args...), os.Environ())
 		}
 
-		dag, err := dagger.Connect(ctx, dagger.WithLogOutput(os.Stderr))
+		dag, err := connectDagger(ctx, dagger.WithLogOutput(os.Stderr))
 		if err != nil {
 			if isDockerDaemonError(err) {
 				handleDockerDaemonError()
@@ -68,10 +71,12 @@ container-use terminal`,
 			return err
 		}
 
-		return env.Terminal(ctx)
+		shell, _ := app.Flags().GetString("shell")
+		return env.Terminal(ctx, shell)
 	},
 }
 
 func init() {
+	terminalCmd.Flags().String("shell", "", "Shell to run, e.g. zsh or /bin/ash (default: bash when available, sh otherwise)")
 	rootCmd.AddCommand(terminalCmd)
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+)
+
+// watchEnvironmentTail is the number of past changes shown when starting to watch an environment.
+const watchEnvironmentTail = 5
+
+// watchEnvironment prints the audit log of an environment as it grows: each change as it is committed,
+// followed by the operations and commands run, until ctx is done.
+func watchEnvironment(ctx context.Context, repo *repository.Repository, envID string, w io.Writer, interval time.Duration) error {
+	history, err := repo.History(ctx, envID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Watching environment '%s', press Ctrl+C to stop\n\n", envID)
+	follower := &historyFollower{printed: map[string]string{}}
+	// Only show the latest of the changes made so far
+	for _, entry := range history[:max(0, len(history)-watchEnvironmentTail)] {
+		follower.printed[entry.Commit] = entry.Note
+	}
+	follower.update(w, history)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			history, err := repo.History(ctx, envID)
+			if err != nil {
+				// The environment may be updated while it's read, try again next time
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				continue
+			}
+			follower.update(w, history)
+		}
+	}
+}
+
+// historyFollower prints the changes of an audit log not printed yet. Notes are added to a commit after it is
+// made, so the note of a change already printed may grow: the new operations are printed then.
+type historyFollower struct {
+	// printed is the note of each commit as it was last printed
+	printed map[string]string
+}
+
+func (f *historyFollower) update(w io.Writer, history []repository.HistoryEntry) {
+	for _, entry := range history {
+		printed, ok := f.printed[entry.Commit]
+		switch {
+		case !ok:
+			printHistoryEntry(w, entry)
+		case entry.Note != printed && strings.HasPrefix(entry.Note, printed):
+			printHistoryNote(w, strings.TrimPrefix(strings.TrimPrefix(entry.Note, printed), "\n"))
+		default:
+			continue
+		}
+		f.printed[entry.Commit] = entry.Note
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryFollower(t *testing.T) {
+	created := time.Date(2025, 7, 1, 10, 12, 3, 0, time.Local)
+	follower := &historyFollower{printed: map[string]string{}}
+	var buf bytes.Buffer
+
+	first := repository.HistoryEntry{Commit: "3f2c1ab0", Time: created, Explanation: "Add user API"}
+	follower.update(&buf, []repository.HistoryEntry{first})
+	assert.Equal(t, "2025-07-01 10:12:03  3f2c1ab  Add user API\n", buf.String())
+
+	// The note of the commit shows up later, along with a new change
+	buf.Reset()
+	first.Note = "Write api/users.go"
+	second := repository.HistoryEntry{Commit: "9e8d7c6b", Time: created.Add(time.Minute), Explanation: "Run tests", Note: "$ go test ./..."}
+	follower.update(&buf, []repository.HistoryEntry{first, second})
+	assert.Equal(t, "    Write api/users.go\n"+
+		"2025-07-01 10:13:03  9e8d7c6  Run tests\n    $ go test ./...\n", buf.String())
+
+	// Operations appended to a note are printed alone
+	buf.Reset()
+	second.Note += "\n$ go vet ./..."
+	follower.update(&buf, []repository.HistoryEntry{first, second})
+	assert.Equal(t, "    $ go vet ./...\n", buf.String())
+
+	buf.Reset()
+	follower.update(&buf, []repository.HistoryEntry{first, second})
+	assert.Empty(t, buf.String())
+}
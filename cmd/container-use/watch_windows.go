@@ -19,24 +19,34 @@ import (
 )
 
 var watchCmd = &cobra.Command{
-	Use:   "watch",
+	Use:   "watch [<env>]",
 	Short: "Watch environment activity in real-time",
 	Long: `Continuously display environment activity as agents work.
 Shows new commits and environment changes updated every second.
+Given an environment, follows its audit log instead: each change is printed
+as it happens, with the explanation given for it and the operations and
+commands run.
 Press Ctrl+C to stop watching.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: suggestEnvironments,
 	Example: `# Watch all environment activity
 container-use watch
 
-# Monitor agents while they work
-container-use watch`,
-	RunE: func(app *cobra.Command, _ []string) error {
+# Follow what an agent does in an environment
+container-use watch fancy-mallard`,
+	RunE: func(app *cobra.Command, args []string) error {
 		ctx := app.Context()
 
 		// Ensure we're in a git repository
-		if _, err := repository.Open(ctx, "."); err != nil {
+		repo, err := repository.Open(ctx, ".")
+		if err != nil {
 			return err
 		}
 
+		if len(args) == 1 {
+			return watchEnvironment(ctx, repo, args[0], os.Stdout, time.Second)
+		}
+
 		// Enter alternate screen buffer and hide cursor
 		fmt.Print("\x1b[?1049h\x1b[?25l")
 		defer fmt.Print("\x1b[?25h\x1b[?1049l") // restore screen + show cursor
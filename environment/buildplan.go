@@ -0,0 +1,110 @@
+package environment
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// BuildPlan renders how environments are built from the configuration as a Dockerfile-equivalent text.
+// For Dockerfile-based configurations, dockerfile holds the contents of the Dockerfile the build starts from.
+// Secrets, mounts, services and extra hosts are not part of the image, so they are listed as comments.
+func (config *EnvironmentConfig) BuildPlan(dockerfile string) string {
+	var sb strings.Builder
+
+	if config.Dockerfile != "" {
+		fmt.Fprintf(&sb, "# Built from %s with build context %s\n", config.Dockerfile, cmp.Or(config.BuildContext, "."))
+		for _, key := range config.BuildArgs.Keys() {
+			fmt.Fprintf(&sb, "# --build-arg %s=%s\n", key, config.BuildArgs.Get(key))
+		}
+		sb.WriteString(strings.TrimRight(dockerfile, "\n"))
+		sb.WriteString("\n\n# Environment setup\n")
+	} else {
+		fmt.Fprintf(&sb, "FROM %s\n", config.BaseImage)
+	}
+
+	fmt.Fprintf(&sb, "WORKDIR %s\n", config.Workdir)
+	if config.LoginShell {
+		writeShell(&sb, config.shellCommand("sh", ""))
+	}
+	for _, key := range config.Env.Keys() {
+		fmt.Fprintf(&sb, "ENV %s=%s\n", key, strconv.Quote(config.Env.Get(key)))
+	}
+	for _, key := range config.Secrets.Keys() {
+		fmt.Fprintf(&sb, "# Secret %s is read from %s when commands run\n", key, config.Secrets.Get(key))
+	}
+	for _, svc := range config.Services {
+		fmt.Fprintf(&sb, "# Service %s runs %s", svc.Name, svc.Image)
+		if len(svc.ExposedPorts) > 0 {
+			ports := make([]string, len(svc.ExposedPorts))
+			for i, port := range svc.ExposedPorts {
+				ports[i] = strconv.Itoa(port)
+			}
+			fmt.Fprintf(&sb, " on ports %s", strings.Join(ports, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	for _, host := range config.ExtraHosts {
+		ports := make([]string, len(host.Ports))
+		for i, port := range host.Ports {
+			ports[i] = strconv.Itoa(port)
+		}
+		fmt.Fprintf(&sb, "# Host %s forwards ports %s to %s\n", host.Hostname, strings.Join(ports, ", "), host.Address)
+	}
+
+	for _, command := range config.SetupCommands {
+		writeRun(&sb, command)
+	}
+	if config.SetupScript != "" {
+		scriptPath := path.Join("/", config.SetupScript)
+		fmt.Fprintf(&sb, "RUN --mount=type=bind,source=%s,target=%s %s\n", config.SetupScript, scriptPath, scriptPath)
+	}
+	// Setup commands run with sh, the default shell only applies from here on
+	if config.DefaultShell != "" {
+		writeShell(&sb, config.shellCommand("", ""))
+	}
+	if len(config.SourcePaths) == 0 {
+		sb.WriteString("COPY . .\n")
+	}
+	for _, sourcePath := range config.SourcePaths {
+		sourcePath = path.Clean(sourcePath)
+		fmt.Fprintf(&sb, "COPY %s %s\n", sourcePath, sourcePath)
+	}
+	if len(config.SourcePaths) > 0 && config.IncludeGitDir {
+		sb.WriteString("COPY .git .git\n")
+	}
+	for _, mount := range config.Mounts {
+		fmt.Fprintf(&sb, "# Host directory %s is mounted at %s\n", mount.Source, mount.Target)
+	}
+	for _, command := range config.InstallCommands {
+		writeRun(&sb, command)
+	}
+
+	return sb.String()
+}
+
+// quoteAll quotes each string, as in the JSON form of Dockerfile instructions.
+func quoteAll(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return quoted
+}
+
+// writeShell writes a SHELL instruction for the arguments of a shell command.
+func writeShell(sb *strings.Builder, args []string) {
+	fmt.Fprintf(sb, "SHELL [%s]\n", strings.Join(quoteAll(args[:len(args)-1]), ", "))
+}
+
+// writeRun writes a RUN instruction, using a heredoc for multi-line commands.
+func writeRun(sb *strings.Builder, command string) {
+	command = strings.TrimSpace(command)
+	if !strings.Contains(command, "\n") {
+		fmt.Fprintf(sb, "RUN %s\n", command)
+		return
+	}
+	fmt.Fprintf(sb, "RUN <<EOF\n%s\nEOF\n", command)
+}
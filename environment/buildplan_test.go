@@ -0,0 +1,98 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPlan(t *testing.T) {
+	t.Run("base_image", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Env = KVList{"PYTHONPATH=/workdir", "GREETING=hello world"}
+		config.Secrets = KVList{"API_KEY=env://API_KEY"}
+		config.SetupCommands = []string{"apt-get update", "cat > /etc/motd <<EOT\nhello\nEOT"}
+		config.InstallCommands = []string{"pip install -r requirements.txt"}
+		config.Mounts = MountConfigs{{Source: "/home/user/.cache", Target: "/root/.cache"}}
+		config.Services = ServiceConfigs{{Name: "db", Image: "postgres:16", ExposedPorts: []int{5432}}}
+		config.ExtraHosts = ExtraHosts{{Hostname: "pypi.corp.internal", Address: "10.0.0.12", Ports: []int{80, 443}}}
+
+		assert.Equal(t, `FROM ubuntu:24.04
+WORKDIR /workdir
+ENV PYTHONPATH="/workdir"
+ENV GREETING="hello world"
+# Secret API_KEY is read from env://API_KEY when commands run
+# Service db runs postgres:16 on ports 5432
+# Host pypi.corp.internal forwards ports 80, 443 to 10.0.0.12
+RUN apt-get update
+RUN <<EOF
+cat > /etc/motd <<EOT
+hello
+EOT
+EOF
+COPY . .
+# Host directory /home/user/.cache is mounted at /root/.cache
+RUN pip install -r requirements.txt
+`, config.BuildPlan(""))
+	})
+
+	t.Run("dockerfile", func(t *testing.T) {
+		config := DefaultConfig()
+		config.BaseImage = ""
+		config.Dockerfile = "build/Dockerfile"
+		config.BuildArgs = KVList{"VERSION=1.24"}
+		config.SetupCommands = []string{"go version"}
+
+		assert.Equal(t, `# Built from build/Dockerfile with build context .
+# --build-arg VERSION=1.24
+FROM golang:${VERSION}
+
+# Environment setup
+WORKDIR /workdir
+RUN go version
+COPY . .
+`, config.BuildPlan("FROM golang:${VERSION}\n\n"))
+	})
+	t.Run("login_shell", func(t *testing.T) {
+		config := DefaultConfig()
+		config.DefaultShell = "bash"
+		config.LoginShell = true
+		config.SetupCommands = []string{"apt-get update"}
+		config.InstallCommands = []string{"nvm install 22"}
+
+		assert.Equal(t, `FROM ubuntu:24.04
+WORKDIR /workdir
+SHELL ["sh", "-lc"]
+RUN apt-get update
+SHELL ["bash", "-lc"]
+COPY . .
+RUN nvm install 22
+`, config.BuildPlan(""))
+	})
+
+	t.Run("source_paths", func(t *testing.T) {
+		config := DefaultConfig()
+		config.SourcePaths = []string{"services/api/", "libs/shared"}
+		config.IncludeGitDir = true
+
+		assert.Equal(t, `FROM ubuntu:24.04
+WORKDIR /workdir
+COPY services/api services/api
+COPY libs/shared libs/shared
+COPY .git .git
+`, config.BuildPlan(""))
+	})
+
+	t.Run("setup_script", func(t *testing.T) {
+		config := DefaultConfig()
+		config.SetupCommands = []string{"apt-get update"}
+		config.SetupScript = ".container-use/setup.sh"
+
+		assert.Equal(t, `FROM ubuntu:24.04
+WORKDIR /workdir
+RUN apt-get update
+RUN --mount=type=bind,source=.container-use/setup.sh,target=/.container-use/setup.sh /.container-use/setup.sh
+COPY . .
+`, config.BuildPlan(""))
+	})
+}
@@ -0,0 +1,115 @@
+package environment
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCommandCanceled is the cause of the commands interrupted by CancelCommands.
+var ErrCommandCanceled = errors.New("command canceled")
+
+// runningCommand is a foreground command being run by Run.
+type runningCommand struct {
+	command   string
+	startedAt time.Time
+	// logPath is where the output of the command is mirrored while it runs, see wrapRunCommand
+	logPath string
+	cancel  context.CancelCauseFunc
+}
+
+// runningCommands tracks the foreground commands of all environments so that they can be canceled from
+// another operation. Like background processes, they are tracked per server process rather than per Environment.
+type runningCommands struct {
+	mu       sync.Mutex
+	commands map[string][]*runningCommand
+}
+
+var running = &runningCommands{
+	commands: map[string][]*runningCommand{},
+}
+
+func (r *runningCommands) add(envID string, c *runningCommand) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[envID] = append(r.commands[envID], c)
+}
+
+func (r *runningCommands) list(envID string) []*runningCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.commands[envID])
+}
+
+func (r *runningCommands) remove(envID string, c *runningCommand) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[envID] = slices.DeleteFunc(r.commands[envID], func(other *runningCommand) bool {
+		return other == c
+	})
+	if len(r.commands[envID]) == 0 {
+		delete(r.commands, envID)
+	}
+}
+
+// canceledExitCode is the exit code canceled commands are recorded with, like commands interrupted with Ctrl-C.
+const canceledExitCode = 130
+
+// runLogPath returns where the output of a foreground command is mirrored. It only depends on the command and
+// the state of the container it runs in, identified by stateID, so that runs of the same command in the same
+// state are still cached. Such runs are a single exec for the engine, so they can't write the same log
+// concurrently, whereas the same command run from different states gets its own log.
+func runLogPath(stateID, shell, command, cwd string, envs []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(slices.Concat([]string{stateID, shell, command, cwd}, envs), "\x00")))
+	return path.Join(processDir, fmt.Sprintf("run-%x.log", sum[:8]))
+}
+
+// wrapRunCommand wraps the arguments running a foreground command to mirror its combined output to logPath
+// while it runs, for CancelCommands to return. Stdout and stderr are still returned separately, and the log is
+// removed once the command completes. The wrapper runs under sh whatever the shell of the command, and runs the
+// command as is in images missing the tools it needs. Images without sh aren't wrapped, see RunWithExitCode.
+func wrapRunCommand(args []string, logPath string) []string {
+	script := fmt.Sprintf(`for tool in tee cat rm; do command -v "$tool" >/dev/null 2>&1 || exec "$@"; done
+: >%[1]s
+{ { "$@" 2>&1 1>&3 3>&-; echo $? >%[1]s.exit; } | tee -a %[1]s 1>&2; } 3>&1 | tee -a %[1]s
+code="$(cat %[1]s.exit)"; rm -f %[1]s %[1]s.exit; exit "$code"`, logPath)
+	return append([]string{"sh", "-c", script, "sh"}, args...)
+}
+
+// CanceledCommand is a foreground command interrupted by CancelCommands.
+type CanceledCommand struct {
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+	// Output is the combined stdout and stderr the command produced before it was canceled
+	Output string `json:"output"`
+}
+
+// CancelCommands interrupts the foreground commands running in the environment, returning the output they
+// produced so far, if the image has sh to mirror it. The changes they made are discarded.
+func (env *Environment) CancelCommands(ctx context.Context) ([]*CanceledCommand, error) {
+	var canceled []*CanceledCommand
+	for _, c := range running.list(env.ID) {
+		c.cancel(ErrCommandCanceled)
+
+		output := ""
+		if c.logPath != "" {
+			var err error
+			output, err = env.processShell(ctx, fmt.Sprintf("cat %[1]s 2>/dev/null; rm -f %[1]s %[1]s.exit", c.logPath))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the output of canceled command %q: %w", c.command, err)
+			}
+		}
+		canceled = append(canceled, &CanceledCommand{
+			Command:   c.command,
+			StartedAt: c.startedAt,
+			Output:    output,
+		})
+	}
+	return canceled, nil
+}
@@ -0,0 +1,109 @@
+package environment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapRunCommand(t *testing.T) {
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	run := func(logPath, command string, env ...string) (string, string, error) {
+		args := wrapRunCommand([]string{shell, "-c", command}, logPath)
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+
+	t.Run("passthrough", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "run.log")
+		stdout, stderr, err := run(logPath, "echo out; echo err >&2; exit 3")
+
+		// The command's streams and exit code are passed through, and its output log removed once it completes
+		var exitErr *exec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		assert.Equal(t, 3, exitErr.ExitCode())
+		assert.Equal(t, "out\n", stdout)
+		assert.Equal(t, "err\n", stderr)
+		assert.NoFileExists(t, logPath)
+		assert.NoFileExists(t, logPath+".exit")
+	})
+
+	t.Run("partial_output", func(t *testing.T) {
+		dir := t.TempDir()
+		logPath := filepath.Join(dir, "run.log")
+		done := filepath.Join(dir, "done")
+
+		result := make(chan error, 1)
+		go func() {
+			_, _, err := run(logPath, "echo out; echo err >&2; while [ ! -e "+done+" ]; do sleep 0.05; done")
+			result <- err
+		}()
+
+		// The output produced so far can be read while the command runs
+		assert.Eventually(t, func() bool {
+			data, err := os.ReadFile(logPath)
+			return err == nil && strings.Contains(string(data), "out\n") && strings.Contains(string(data), "err\n")
+		}, 10*time.Second, 50*time.Millisecond)
+
+		require.NoError(t, os.WriteFile(done, nil, 0600))
+		require.NoError(t, <-result)
+		assert.NoFileExists(t, logPath)
+	})
+
+	t.Run("missing_tools", func(t *testing.T) {
+		// Without tee, the command runs without mirroring its output
+		logPath := filepath.Join(t.TempDir(), "run.log")
+		stdout, _, err := run(logPath, "echo out", "PATH="+t.TempDir())
+		require.NoError(t, err)
+		assert.Equal(t, "out\n", stdout)
+		assert.NoFileExists(t, logPath)
+	})
+}
+
+func TestRunLogPath(t *testing.T) {
+	// Identical runs share a path so that they are still cached
+	assert.Equal(t, runLogPath("state", "sh", "go test ./...", "", nil), runLogPath("state", "sh", "go test ./...", "", nil))
+	assert.NotEqual(t, runLogPath("state", "sh", "go test ./...", "", nil), runLogPath("state", "sh", "go test ./...", "api", nil))
+	assert.NotEqual(t, runLogPath("state", "sh", "go test ./...", "", nil), runLogPath("state", "sh", "go test ./...", "", []string{"CI=true"}))
+	assert.NotEqual(t, runLogPath("state", "sh", "go test ./...", "", nil), runLogPath("other state", "sh", "go test ./...", "", nil))
+}
+
+func TestCancelCommands(t *testing.T) {
+	env := &Environment{EnvironmentInfo: &EnvironmentInfo{ID: "cancel-test"}}
+
+	canceled, err := env.CancelCommands(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, canceled)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	run := &runningCommand{command: "sleep 600", startedAt: time.Now(), cancel: cancel}
+	running.add(env.ID, run)
+	defer running.remove(env.ID, run)
+
+	canceled, err = env.CancelCommands(context.Background())
+	require.NoError(t, err)
+	require.Len(t, canceled, 1)
+	assert.Equal(t, "sleep 600", canceled[0].Command)
+	assert.ErrorIs(t, context.Cause(ctx), ErrCommandCanceled)
+
+	running.remove(env.ID, run)
+	assert.Empty(t, running.list(env.ID))
+}
@@ -2,10 +2,16 @@ package environment
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -14,6 +20,10 @@ const (
 	alpineImage     = "alpine:3.21.3@sha256:a8560b36e8b8210634f77d9f7f9efd7ffa463e380b75e2e74aff4511df3ef88c"
 	configDir       = ".container-use"
 	environmentFile = "environment.json"
+	setupScriptFile = "setup.sh"
+
+	// DefaultSetupScript is the setup script environments run when their source has one, relative to its root
+	DefaultSetupScript = configDir + "/" + setupScriptFile
 )
 
 func DefaultConfig() *EnvironmentConfig {
@@ -24,15 +34,61 @@ func DefaultConfig() *EnvironmentConfig {
 }
 
 type EnvironmentConfig struct {
-	Workdir         string         `json:"workdir,omitempty"`
-	BaseImage       string         `json:"base_image,omitempty"`
-	SetupCommands   []string       `json:"setup_commands,omitempty"`
+	Workdir   string `json:"workdir,omitempty"`
+	BaseImage string `json:"base_image,omitempty"`
+	// Dockerfile, when set, builds the base image instead of pulling BaseImage.
+	// Both Dockerfile and BuildContext are relative to the root of the repository.
+	Dockerfile    string   `json:"dockerfile,omitempty"`
+	BuildContext  string   `json:"build_context,omitempty"`
+	BuildArgs     KVList   `json:"build_args,omitempty"`
+	SetupCommands []string `json:"setup_commands,omitempty"`
+	// SetupScript is a script of the repository run as a single setup step, after SetupCommands.
+	// It defaults to .container-use/setup.sh when the source environments are created from has one, see
+	// Repository.CreateConfig.
+	SetupScript     string         `json:"setup_script,omitempty"`
 	InstallCommands []string       `json:"install_commands,omitempty"`
 	Env             KVList         `json:"env,omitempty"`
 	Secrets         KVList         `json:"secrets,omitempty"`
 	Services        ServiceConfigs `json:"services,omitempty"`
+	Mounts          MountConfigs   `json:"mounts,omitempty"`
+	// DefaultShell interprets commands when none is given, e.g. bash. Defaults to sh.
+	DefaultShell string `json:"default_shell,omitempty"`
+	// LoginShell runs commands in login shells (`bash -lc`), so the PATH set up by shell profiles applies.
+	LoginShell bool `json:"login_shell,omitempty"`
+	// IncludeGitDir keeps the .git directory, with the full history, in the source of new environments,
+	// so that git commands like log or blame work inside them. Off by default, as the history can be large.
+	IncludeGitDir bool `json:"include_git_dir,omitempty"`
+	// SourcePaths, when set, limits the source of new environments to these paths of the repository, e.g. the
+	// directory of one service of a monorepo. They keep their place in the workdir. See InSourcePaths.
+	SourcePaths []string `json:"source_paths,omitempty"`
+	// DetectSource defaults the workdir of new environments to the convention of the language of their source,
+	// detected from markers like go.mod, and suggests a base image for it. See DetectSource.
+	DetectSource bool `json:"detect_source,omitempty"`
+	// ExtraHosts makes hostnames reachable from the environment, e.g. internal services only the host can resolve.
+	ExtraHosts ExtraHosts `json:"extra_hosts,omitempty"`
+	// CommitTemplate, when set, formats the messages of environment commits. See Environment.CommitMessage.
+	CommitTemplate string `json:"commit_template,omitempty"`
+	// CommitAuthor, when set, is the identity environment commits and notes are made with, as `Name <email>`,
+	// telling them apart from the user's commits. Defaults to the user's git identity.
+	CommitAuthor string `json:"commit_author,omitempty"`
+	// CommitIgnore holds glob patterns of files never committed to environments, on top of the repository's .gitignore.
+	CommitIgnore []string `json:"commit_ignore,omitempty"`
+	// BinaryFilePolicy decides whether binary files are committed to environments. Defaults to BinaryFilePolicySkip.
+	BinaryFilePolicy BinaryFilePolicy `json:"binary_file_policy,omitempty" jsonschema:"enum=skip,enum=commit,enum=lfs"`
 }
 
+// BinaryFilePolicy decides how binary files written in environments are committed.
+type BinaryFilePolicy string
+
+const (
+	// BinaryFilePolicySkip leaves binary files out of commits, reporting the files skipped
+	BinaryFilePolicySkip BinaryFilePolicy = "skip"
+	// BinaryFilePolicyCommit commits binary files like any other file
+	BinaryFilePolicyCommit BinaryFilePolicy = "commit"
+	// BinaryFilePolicyLFS commits binary files with Git LFS, which must be installed on the host
+	BinaryFilePolicyLFS BinaryFilePolicy = "lfs"
+)
+
 type ServiceConfig struct {
 	Name         string   `json:"name,omitempty"`
 	Image        string   `json:"image,omitempty"`
@@ -52,6 +108,45 @@ func (sc ServiceConfigs) Get(name string) *ServiceConfig {
 	return nil
 }
 
+// ExtraHost makes a hostname reachable from the environment by forwarding its ports to an address
+// the host can reach, like `--add-host` would. Only the listed ports are forwarded.
+type ExtraHost struct {
+	Hostname string `json:"hostname"`
+	// Address is the IP address or hostname the ports are forwarded to, resolved from the machine running container-use.
+	Address string `json:"address"`
+	Ports   []int  `json:"ports"`
+}
+
+type ExtraHosts []*ExtraHost
+
+func (hosts ExtraHosts) Get(hostname string) *ExtraHost {
+	for _, host := range hosts {
+		if host.Hostname == hostname {
+			return host
+		}
+	}
+	return nil
+}
+
+// MountConfig is a host directory mounted into the environment.
+type MountConfig struct {
+	// Source is the absolute path of the directory on the host.
+	Source string `json:"source"`
+	// Target is the absolute path the directory is mounted at in the container.
+	Target string `json:"target"`
+}
+
+type MountConfigs []*MountConfig
+
+func (mc MountConfigs) Get(target string) *MountConfig {
+	for _, cfg := range mc {
+		if cfg.Target == target {
+			return cfg
+		}
+	}
+	return nil
+}
+
 // KVList represents a list of key-value pairs in the format KEY=VALUE
 type KVList []string
 
@@ -117,9 +212,46 @@ func (config *EnvironmentConfig) Copy() *EnvironmentConfig {
 		svcCopy := *svc
 		copy.Services[i] = &svcCopy
 	}
+	copy.Mounts = make(MountConfigs, len(config.Mounts))
+	for i, mount := range config.Mounts {
+		mountCopy := *mount
+		copy.Mounts[i] = &mountCopy
+	}
+	copy.ExtraHosts = make(ExtraHosts, len(config.ExtraHosts))
+	for i, host := range config.ExtraHosts {
+		hostCopy := *host
+		hostCopy.Ports = slices.Clone(host.Ports)
+		copy.ExtraHosts[i] = &hostCopy
+	}
 	return &copy
 }
 
+// StartingFrom returns a copy of the configuration for environments starting from image, an image that
+// already holds the tools the setup commands would install, e.g. one published from another environment.
+// The base image or Dockerfile is replaced and setup commands are skipped. Install commands still run,
+// as they depend on the source.
+func (config *EnvironmentConfig) StartingFrom(image string) *EnvironmentConfig {
+	copy := config.Copy()
+	copy.BaseImage = image
+	copy.Dockerfile = ""
+	copy.BuildContext = ""
+	copy.BuildArgs = nil
+	copy.SetupCommands = nil
+	copy.SetupScript = ""
+	return copy
+}
+
+// configFile is the on-disk representation of the configuration.
+type configFile struct {
+	Schema string `json:"$schema,omitempty"`
+	*EnvironmentConfig
+}
+
+// ConfigPath returns the path of the configuration file in baseDir.
+func ConfigPath(baseDir string) string {
+	return filepath.Join(baseDir, configDir, environmentFile)
+}
+
 func (config *EnvironmentConfig) Save(baseDir string) error {
 	configPath := filepath.Join(baseDir, configDir)
 	if err := os.MkdirAll(configPath, 0755); err != nil {
@@ -132,7 +264,22 @@ func (config *EnvironmentConfig) Save(baseDir string) error {
 	encoder.SetIndent("", "  ")
 	encoder.SetEscapeHTML(false) // This prevents & from being escaped as \u0026
 
-	if err := encoder.Encode(config); err != nil {
+	// Keep the schema reference users may have added for editor validation
+	file := configFile{EnvironmentConfig: config}
+	// The default setup script is detected when creating environments, don't pin it
+	if config.SetupScript == DefaultSetupScript {
+		saved := *config
+		saved.SetupScript = ""
+		file.EnvironmentConfig = &saved
+	}
+	if data, err := os.ReadFile(filepath.Join(configPath, environmentFile)); err == nil {
+		var existing configFile
+		if json.Unmarshal(data, &existing) == nil {
+			file.Schema = existing.Schema
+		}
+	}
+
+	if err := encoder.Encode(file); err != nil {
 		return err
 	}
 
@@ -154,7 +301,231 @@ func (config *EnvironmentConfig) Load(baseDir string) error {
 		if err := json.Unmarshal(data, config); err != nil {
 			return err
 		}
+		// The file only overrides the defaults: validate the configuration environments get from it,
+		// whether config started from the defaults or, to tell where values come from, empty
+		effective, _ := ResolveConfig(
+			ConfigLayer{Source: ConfigSourceDefault, Config: DefaultConfig()},
+			ConfigLayer{Source: ConfigSourceRepository, Config: config},
+		)
+		if err := effective.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration in %s: %w", filepath.Join(configPath, environmentFile), err)
+		}
 	}
 
 	return nil
 }
+
+// imageReferencePattern loosely matches image references such as `ubuntu:24.04`,
+// `ghcr.io/org/image:tag` or `localhost:5000/image@sha256:...`.
+var imageReferencePattern = regexp.MustCompile(`^(?:[a-zA-Z0-9.-]+(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*(?::\w[\w.-]{0,127})?(?:@[a-z0-9]+:[a-fA-F0-9]{32,})?$`)
+
+// Validate reports settings that would otherwise only fail once the container is built.
+func (config *EnvironmentConfig) Validate() error {
+	var errs []error
+
+	switch {
+	case config.BaseImage == "" && config.Dockerfile == "":
+		errs = append(errs, errors.New("base_image is required"))
+	case config.BaseImage != "" && !imageReferencePattern.MatchString(config.BaseImage):
+		errs = append(errs, fmt.Errorf("base_image must be an image reference like 'ubuntu:24.04', got '%s'", config.BaseImage))
+	}
+
+	if !path.IsAbs(config.Workdir) {
+		errs = append(errs, fmt.Errorf("workdir must be an absolute path, got '%s'", config.Workdir))
+	}
+
+	for i, command := range config.SetupCommands {
+		if strings.TrimSpace(command) == "" {
+			errs = append(errs, fmt.Errorf("setup_commands[%d] must not be empty", i))
+		}
+	}
+	if config.SetupScript != "" && !filepath.IsLocal(filepath.FromSlash(config.SetupScript)) {
+		errs = append(errs, fmt.Errorf("setup_script must be a path within the repository like '%s', got '%s'", DefaultSetupScript, config.SetupScript))
+	}
+	for i, command := range config.InstallCommands {
+		if strings.TrimSpace(command) == "" {
+			errs = append(errs, fmt.Errorf("install_commands[%d] must not be empty", i))
+		}
+	}
+
+	if config.CommitAuthor != "" {
+		if _, _, ok := config.CommitIdentity(); !ok {
+			errs = append(errs, fmt.Errorf("commit_author must be like 'Agent <agent@example.com>', got '%s'", config.CommitAuthor))
+		}
+	}
+
+	for i, sourcePath := range config.SourcePaths {
+		if !filepath.IsLocal(filepath.FromSlash(sourcePath)) || path.Clean(sourcePath) == "." {
+			errs = append(errs, fmt.Errorf("source_paths[%d] must be a path within the repository like 'services/api', got '%s'", i, sourcePath))
+		}
+	}
+
+	for i, pattern := range config.CommitIgnore {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			errs = append(errs, fmt.Errorf("commit_ignore[%d] must be a glob pattern like 'build/' or '*.log', got '%s'", i, pattern))
+		}
+	}
+
+	switch config.BinaryFilePolicy {
+	case "", BinaryFilePolicySkip, BinaryFilePolicyCommit, BinaryFilePolicyLFS:
+	default:
+		errs = append(errs, fmt.Errorf("binary_file_policy must be one of skip, commit or lfs, got '%s'", config.BinaryFilePolicy))
+	}
+
+	for i, svc := range config.Services {
+		if svc.Name == "" {
+			errs = append(errs, fmt.Errorf("services[%d] must have a name", i))
+		}
+		if svc.Image == "" {
+			errs = append(errs, fmt.Errorf("services[%d] must have an image", i))
+		}
+	}
+
+	if strings.ContainsAny(config.DefaultShell, " \t\n") {
+		errs = append(errs, fmt.Errorf("default_shell must be a shell like 'bash' or '/bin/zsh', got '%s'", config.DefaultShell))
+	}
+
+	seenHosts := map[string]bool{}
+	for i, host := range config.ExtraHosts {
+		if !hostnamePattern.MatchString(host.Hostname) {
+			errs = append(errs, fmt.Errorf("extra_hosts[%d] must have a hostname like 'db.internal', got '%s'", i, host.Hostname))
+		} else if seenHosts[host.Hostname] {
+			errs = append(errs, fmt.Errorf("extra_hosts[%d] duplicates hostname '%s'", i, host.Hostname))
+		}
+		seenHosts[host.Hostname] = true
+		if host.Address == "" {
+			errs = append(errs, fmt.Errorf("extra_hosts[%d] must have an address", i))
+		}
+		if len(host.Ports) == 0 {
+			errs = append(errs, fmt.Errorf("extra_hosts[%d] must forward at least one port, hostnames can't be mapped to an address without ports", i))
+		}
+		for _, port := range host.Ports {
+			if port <= 0 || port > 65535 {
+				errs = append(errs, fmt.Errorf("extra_hosts[%d] has invalid port %d", i, port))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// commitAuthorPattern matches git identities such as `Agent <agent@example.com>`.
+var commitAuthorPattern = regexp.MustCompile(`^([^<>]*[^<>\s])\s*<([^<>\s]+)>$`)
+
+// CommitIdentity returns the name and email of CommitAuthor, ok is false when it's unset or invalid.
+func (config *EnvironmentConfig) CommitIdentity() (name, email string, ok bool) {
+	m := commitAuthorPattern.FindStringSubmatch(strings.TrimSpace(config.CommitAuthor))
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// sourceInclude returns the patterns of the files of the source copied into the workdir, or nil for all of them.
+func (config *EnvironmentConfig) sourceInclude() []string {
+	if len(config.SourcePaths) == 0 {
+		return nil
+	}
+	var include []string
+	for _, sourcePath := range config.SourcePaths {
+		sourcePath = path.Clean(sourcePath)
+		include = append(include, sourcePath, sourcePath+"/**")
+	}
+	if config.IncludeGitDir {
+		include = append(include, ".git", ".git/**")
+	}
+	return include
+}
+
+// InSourcePaths reports whether a slash-separated path of the repository is part of the source of environments,
+// that is within one of SourcePaths, or anywhere when there are none.
+func (config *EnvironmentConfig) InSourcePaths(p string) bool {
+	if len(config.SourcePaths) == 0 {
+		return true
+	}
+	p = path.Clean(p)
+	for _, sourcePath := range config.SourcePaths {
+		sourcePath = path.Clean(sourcePath)
+		if p == sourcePath || strings.HasPrefix(p, sourcePath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hostnamePattern matches hostnames made of dot separated labels, such as `db` or `api.corp.internal`.
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// shellCommand returns the arguments running command with shell, or the default shell when empty.
+func (config *EnvironmentConfig) shellCommand(shell, command string) []string {
+	shell = cmp.Or(shell, config.DefaultShell, "sh")
+	if config.LoginShell {
+		return []string{shell, "-lc", command}
+	}
+	return []string{shell, "-c", command}
+}
+
+// ConfigSource identifies where an effective configuration value was set.
+type ConfigSource string
+
+const (
+	ConfigSourceDefault     ConfigSource = "default"
+	ConfigSourceRepository  ConfigSource = "repository"
+	ConfigSourceEnvironment ConfigSource = "environment"
+	ConfigSourceFlag        ConfigSource = "flag"
+)
+
+// ConfigLayer is the configuration provided by a single source.
+type ConfigLayer struct {
+	Source ConfigSource
+	Config *EnvironmentConfig
+	// Complete layers specify every field, so their empty values override earlier layers
+	// instead of being inherited (e.g. the configuration recorded in an environment's state).
+	Complete bool
+}
+
+// ResolvedConfigField is the effective value of a configuration field and the source that set it.
+type ResolvedConfigField struct {
+	Name   string       `json:"name"`
+	Value  any          `json:"value,omitempty"`
+	Source ConfigSource `json:"source,omitempty"`
+}
+
+// ResolveConfig merges configuration layers in order, later layers overriding earlier ones.
+// Each field is attributed to the layer that last changed its value, so a layer repeating
+// an inherited value doesn't take credit for it. Fields no layer sets have an empty source.
+func ResolveConfig(layers ...ConfigLayer) (*EnvironmentConfig, []*ResolvedConfigField) {
+	resolved := &EnvironmentConfig{}
+	resolvedValue := reflect.ValueOf(resolved).Elem()
+	configType := resolvedValue.Type()
+
+	fields := make([]*ResolvedConfigField, configType.NumField())
+	for i := range fields {
+		name, _, _ := strings.Cut(configType.Field(i).Tag.Get("json"), ",")
+		fields[i] = &ResolvedConfigField{Name: name}
+	}
+
+	for _, layer := range layers {
+		if layer.Config == nil {
+			continue
+		}
+		layerValue := reflect.ValueOf(layer.Config).Elem()
+		for i, field := range fields {
+			value := layerValue.Field(i)
+			if value.IsZero() && !layer.Complete {
+				continue
+			}
+			if reflect.DeepEqual(value.Interface(), resolvedValue.Field(i).Interface()) {
+				continue
+			}
+			resolvedValue.Field(i).Set(value)
+			field.Source = layer.Source
+		}
+	}
+
+	for i, field := range fields {
+		field.Value = resolvedValue.Field(i).Interface()
+	}
+
+	return resolved.Copy(), fields
+}
@@ -109,6 +109,272 @@ func TestEnvironmentConfig_Load(t *testing.T) {
 	}
 }
 
+func TestEnvironmentConfig_SetupScript(t *testing.T) {
+	dir := t.TempDir()
+
+	// The default script is detected in the source environments are created from, not when loading
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".container-use"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".container-use", "setup.sh"), []byte("#!/bin/bash\napt-get update\n"), 0755))
+	config := DefaultConfig()
+	require.NoError(t, config.Load(dir))
+	assert.Empty(t, config.SetupScript)
+
+	// Once detected, it isn't written to the configuration file
+	config.SetupScript = DefaultSetupScript
+	require.NoError(t, config.Save(dir))
+	data, err := os.ReadFile(filepath.Join(dir, ".container-use", "environment.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "setup_script")
+	assert.Equal(t, ".container-use/setup.sh", config.SetupScript)
+
+	// Other scripts are kept
+	config.SetupScript = "scripts/provision.sh"
+	require.NoError(t, config.Save(dir))
+	config = DefaultConfig()
+	require.NoError(t, config.Load(dir))
+	assert.Equal(t, "scripts/provision.sh", config.SetupScript)
+}
+
+func TestEnvironmentConfig_Validate(t *testing.T) {
+	scenarios := []struct {
+		name        string
+		modify      func(config *EnvironmentConfig)
+		expectError string
+	}{
+		{
+			name:   "default",
+			modify: func(config *EnvironmentConfig) {},
+		},
+		{
+			name: "registry_image_with_digest",
+			modify: func(config *EnvironmentConfig) {
+				config.BaseImage = "localhost:5000/org/image:1.0@sha256:a8560b36e8b8210634f77d9f7f9efd7ffa463e380b75e2e74aff4511df3ef88c"
+			},
+		},
+		{
+			name: "pinned_alpine",
+			modify: func(config *EnvironmentConfig) {
+				config.BaseImage = alpineImage
+			},
+		},
+		{
+			name: "missing_base_image",
+			modify: func(config *EnvironmentConfig) {
+				config.BaseImage = ""
+			},
+			expectError: "base_image is required",
+		},
+		{
+			name: "dockerfile_without_base_image",
+			modify: func(config *EnvironmentConfig) {
+				config.BaseImage = ""
+				config.Dockerfile = "Dockerfile"
+			},
+		},
+		{
+			name: "malformed_base_image",
+			modify: func(config *EnvironmentConfig) {
+				config.BaseImage = "Ubuntu 24.04"
+			},
+			expectError: "base_image must be an image reference like 'ubuntu:24.04', got 'Ubuntu 24.04'",
+		},
+		{
+			name: "relative_workdir",
+			modify: func(config *EnvironmentConfig) {
+				config.Workdir = "workdir"
+			},
+			expectError: "workdir must be an absolute path, got 'workdir'",
+		},
+		{
+			name: "empty_setup_command",
+			modify: func(config *EnvironmentConfig) {
+				config.SetupCommands = []string{"apt-get update", "  "}
+			},
+			expectError: "setup_commands[1] must not be empty",
+		},
+		{
+			name: "commit_ignore",
+			modify: func(config *EnvironmentConfig) {
+				config.CommitIgnore = []string{".cache/", "*.log", "/generated/*.go"}
+			},
+		},
+		{
+			name: "malformed_commit_ignore",
+			modify: func(config *EnvironmentConfig) {
+				config.CommitIgnore = []string{"[build"}
+			},
+			expectError: "commit_ignore[0] must be a glob pattern like 'build/' or '*.log', got '[build'",
+		},
+		{
+			name: "source_paths",
+			modify: func(config *EnvironmentConfig) {
+				config.SourcePaths = []string{"services/api", "libs/shared/"}
+			},
+		},
+		{
+			name: "source_paths_outside_repository",
+			modify: func(config *EnvironmentConfig) {
+				config.SourcePaths = []string{"../other"}
+			},
+			expectError: "source_paths[0] must be a path within the repository like 'services/api', got '../other'",
+		},
+		{
+			name: "source_paths_root",
+			modify: func(config *EnvironmentConfig) {
+				config.SourcePaths = []string{"."}
+			},
+			expectError: "source_paths[0] must be a path within the repository like 'services/api', got '.'",
+		},
+		{
+			name: "commit_author",
+			modify: func(config *EnvironmentConfig) {
+				config.CommitAuthor = "Coding Agent <agent@example.com>"
+			},
+		},
+		{
+			name: "commit_author_without_email",
+			modify: func(config *EnvironmentConfig) {
+				config.CommitAuthor = "Agent"
+			},
+			expectError: "commit_author must be like 'Agent <agent@example.com>', got 'Agent'",
+		},
+		{
+			name: "unknown_binary_file_policy",
+			modify: func(config *EnvironmentConfig) {
+				config.BinaryFilePolicy = "ignore"
+			},
+			expectError: "binary_file_policy must be one of skip, commit or lfs, got 'ignore'",
+		},
+		{
+			name: "service_without_image",
+			modify: func(config *EnvironmentConfig) {
+				config.Services = ServiceConfigs{{Name: "db"}}
+			},
+			expectError: "services[0] must have an image",
+		},
+		{
+			name: "default_shell",
+			modify: func(config *EnvironmentConfig) {
+				config.DefaultShell = "/bin/bash"
+				config.LoginShell = true
+			},
+		},
+		{
+			name: "setup_script",
+			modify: func(config *EnvironmentConfig) {
+				config.SetupScript = "scripts/provision.sh"
+			},
+		},
+		{
+			name: "setup_script_outside_repository",
+			modify: func(config *EnvironmentConfig) {
+				config.SetupScript = "../provision.sh"
+			},
+			expectError: "setup_script must be a path within the repository like '.container-use/setup.sh', got '../provision.sh'",
+		},
+		{
+			name: "default_shell_with_arguments",
+			modify: func(config *EnvironmentConfig) {
+				config.DefaultShell = "bash -l"
+			},
+			expectError: "default_shell must be a shell like 'bash' or '/bin/zsh', got 'bash -l'",
+		},
+		{
+			name: "extra_host",
+			modify: func(config *EnvironmentConfig) {
+				config.ExtraHosts = ExtraHosts{{Hostname: "registry.corp.internal", Address: "10.0.0.12", Ports: []int{443}}}
+			},
+		},
+		{
+			name: "extra_host_without_ports",
+			modify: func(config *EnvironmentConfig) {
+				config.ExtraHosts = ExtraHosts{{Hostname: "db.internal", Address: "10.0.0.12"}}
+			},
+			expectError: "extra_hosts[0] must forward at least one port",
+		},
+		{
+			name: "malformed_extra_host",
+			modify: func(config *EnvironmentConfig) {
+				config.ExtraHosts = ExtraHosts{{Hostname: "db internal", Address: "10.0.0.12", Ports: []int{5432}}}
+			},
+			expectError: "extra_hosts[0] must have a hostname like 'db.internal', got 'db internal'",
+		},
+		{
+			name: "duplicate_extra_host",
+			modify: func(config *EnvironmentConfig) {
+				config.ExtraHosts = ExtraHosts{
+					{Hostname: "db.internal", Address: "10.0.0.12", Ports: []int{5432}},
+					{Hostname: "db.internal", Address: "10.0.0.13", Ports: []int{5433}},
+				}
+			},
+			expectError: "extra_hosts[1] duplicates hostname 'db.internal'",
+		},
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			config := DefaultConfig()
+			scenario.modify(config)
+
+			err := config.Validate()
+			if scenario.expectError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, scenario.expectError)
+			}
+		})
+	}
+
+	t.Run("load", func(t *testing.T) {
+		dir := t.TempDir()
+		createConfigFile(t, dir, &EnvironmentConfig{BaseImage: "ubuntu:24.04", Workdir: "workdir"})
+
+		err := DefaultConfig().Load(dir)
+		assert.ErrorContains(t, err, "workdir must be an absolute path")
+	})
+
+	t.Run("load_without_defaults", func(t *testing.T) {
+		// Configuration files only override the defaults, and may be loaded on their own to tell them apart
+		dir := t.TempDir()
+		createConfigFile(t, dir, &EnvironmentConfig{BaseImage: "ubuntu:24.04"})
+
+		config := &EnvironmentConfig{}
+		require.NoError(t, config.Load(dir))
+		assert.Equal(t, "ubuntu:24.04", config.BaseImage)
+		assert.Empty(t, config.Workdir)
+	})
+}
+
+func TestEnvironmentConfig_ShellCommand(t *testing.T) {
+	config := DefaultConfig()
+	assert.Equal(t, []string{"sh", "-c", "make"}, config.shellCommand("", "make"))
+	assert.Equal(t, []string{"zsh", "-c", "make"}, config.shellCommand("zsh", "make"))
+
+	config.DefaultShell = "bash"
+	assert.Equal(t, []string{"bash", "-c", "make"}, config.shellCommand("", "make"))
+
+	config.LoginShell = true
+	assert.Equal(t, []string{"bash", "-lc", "make"}, config.shellCommand("", "make"))
+	assert.Equal(t, []string{"zsh", "-lc", "make"}, config.shellCommand("zsh", "make"))
+}
+
+func TestEnvironmentConfig_SourcePaths(t *testing.T) {
+	config := DefaultConfig()
+	assert.Nil(t, config.sourceInclude())
+	assert.True(t, config.InSourcePaths("anything/at/all.go"))
+
+	config.SourcePaths = []string{"services/api/", "go.mod"}
+	assert.Equal(t, []string{"services/api", "services/api/**", "go.mod", "go.mod/**"}, config.sourceInclude())
+	assert.True(t, config.InSourcePaths("services/api"))
+	assert.True(t, config.InSourcePaths("services/api/main.go"))
+	assert.True(t, config.InSourcePaths("go.mod"))
+	assert.False(t, config.InSourcePaths("services/api-gateway/main.go"))
+	assert.False(t, config.InSourcePaths("services/web/index.ts"))
+
+	config.IncludeGitDir = true
+	assert.Contains(t, config.sourceInclude(), ".git/**")
+}
+
 // TestEnvironmentConfig_PreservesShellOperators tests that shell operators like && are not
 // escaped as unicode sequences when saving and loading configuration
 func TestEnvironmentConfig_PreservesShellOperators(t *testing.T) {
@@ -171,3 +437,57 @@ func createConfigFile(t *testing.T, dir string, config *EnvironmentConfig) {
 	require.NoError(t, err)
 	require.NoError(t, os.WriteFile(filepath.Join(configDir, "environment.json"), data, 0644))
 }
+
+func TestResolveConfig(t *testing.T) {
+	repoConfig := &EnvironmentConfig{
+		BaseImage:     "python:3.11",
+		SetupCommands: []string{"pip install -r requirements.txt"},
+	}
+	flagConfig := &EnvironmentConfig{
+		BaseImage: "python:3.12",
+	}
+
+	t.Run("flag_overrides_repository", func(t *testing.T) {
+		config, fields := ResolveConfig(
+			ConfigLayer{Source: ConfigSourceDefault, Config: DefaultConfig()},
+			ConfigLayer{Source: ConfigSourceRepository, Config: repoConfig},
+			ConfigLayer{Source: ConfigSourceFlag, Config: flagConfig},
+		)
+
+		assert.Equal(t, "python:3.12", config.BaseImage)
+		assert.Equal(t, "/workdir", config.Workdir)
+		assert.Equal(t, []string{"pip install -r requirements.txt"}, config.SetupCommands)
+
+		sources := map[string]ConfigSource{}
+		for _, field := range fields {
+			sources[field.Name] = field.Source
+		}
+		assert.Equal(t, ConfigSourceFlag, sources["base_image"])
+		assert.Equal(t, ConfigSourceDefault, sources["workdir"])
+		assert.Equal(t, ConfigSourceRepository, sources["setup_commands"])
+		assert.Empty(t, sources["install_commands"])
+	})
+
+	t.Run("complete_layer_only_credited_for_changes", func(t *testing.T) {
+		envConfig := DefaultConfig()
+		envConfig.BaseImage = "python:3.11"
+		envConfig.InstallCommands = []string{"make deps"}
+
+		config, fields := ResolveConfig(
+			ConfigLayer{Source: ConfigSourceDefault, Config: DefaultConfig()},
+			ConfigLayer{Source: ConfigSourceRepository, Config: repoConfig},
+			ConfigLayer{Source: ConfigSourceEnvironment, Config: envConfig, Complete: true},
+		)
+
+		assert.Empty(t, config.SetupCommands, "complete layers clear fields they leave empty")
+
+		sources := map[string]ConfigSource{}
+		for _, field := range fields {
+			sources[field.Name] = field.Source
+		}
+		assert.Equal(t, ConfigSourceRepository, sources["base_image"])
+		assert.Equal(t, ConfigSourceDefault, sources["workdir"])
+		assert.Equal(t, ConfigSourceEnvironment, sources["setup_commands"])
+		assert.Equal(t, ConfigSourceEnvironment, sources["install_commands"])
+	})
+}
@@ -0,0 +1,121 @@
+package environment
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// sourceWorkdir is where the official language images suggest putting an application's source.
+const sourceWorkdir = "/usr/src/app"
+
+// SourceDetection is what the markers of a project (go.mod, pyproject.toml, package.json) tell about the
+// environment it needs.
+type SourceDetection struct {
+	// Marker is the file the project was detected from
+	Marker   string `json:"marker"`
+	Language string `json:"language"`
+	// Workdir is the conventional location of the source for the language
+	Workdir string `json:"workdir"`
+	// BaseImage is an image providing the language's toolchain, in the version the project asks for when it says
+	BaseImage string `json:"suggested_base_image,omitempty"`
+}
+
+var (
+	goModulePattern      = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+	goVersionPattern     = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+	requiresPythonLine   = regexp.MustCompile(`(?m)^requires-python\s*=\s*["']([^"']*)["']`)
+	pythonVersionPattern = regexp.MustCompile(`3\.\d+`)
+	nodeMajorPattern     = regexp.MustCompile(`\d+`)
+)
+
+// DetectSource looks for the markers of common project types in the source, read with readFile.
+// The first marker found wins, package.json last as other projects often have one for their tooling.
+// Returns nil when the source has none.
+func DetectSource(readFile func(name string) ([]byte, error)) (*SourceDetection, error) {
+	for _, detect := range []func(readFile func(string) ([]byte, error)) (*SourceDetection, error){
+		detectGo,
+		detectPython,
+		detectNode,
+	} {
+		detection, err := detect(readFile)
+		if err != nil || detection != nil {
+			return detection, err
+		}
+	}
+	return nil, nil
+}
+
+// readMarker reads a marker file, reporting a missing one as nil without error.
+func readMarker(readFile func(string) ([]byte, error), name string) ([]byte, error) {
+	data, err := readFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func detectGo(readFile func(string) ([]byte, error)) (*SourceDetection, error) {
+	data, err := readMarker(readFile, "go.mod")
+	if data == nil {
+		return nil, err
+	}
+	detection := &SourceDetection{Marker: "go.mod", Language: "go", Workdir: sourceWorkdir, BaseImage: "golang"}
+	// Modules live at their import path in the GOPATH, where the golang images look for them
+	if m := goModulePattern.FindSubmatch(data); m != nil {
+		detection.Workdir = path.Join("/go/src", string(m[1]))
+	}
+	if m := goVersionPattern.FindSubmatch(data); m != nil {
+		detection.BaseImage += ":" + string(m[1])
+	}
+	return detection, nil
+}
+
+func detectPython(readFile func(string) ([]byte, error)) (*SourceDetection, error) {
+	data, err := readMarker(readFile, "pyproject.toml")
+	if data == nil {
+		return nil, err
+	}
+	detection := &SourceDetection{Marker: "pyproject.toml", Language: "python", Workdir: sourceWorkdir, BaseImage: "python:3"}
+	// The lowest version listed, e.g. 3.11 for ">=3.11,<4"
+	if m := requiresPythonLine.FindSubmatch(data); m != nil {
+		if version := pythonVersionPattern.Find(m[1]); version != nil {
+			detection.BaseImage = "python:" + string(version)
+		}
+	}
+	return detection, nil
+}
+
+func detectNode(readFile func(string) ([]byte, error)) (*SourceDetection, error) {
+	data, err := readMarker(readFile, "package.json")
+	if data == nil {
+		return nil, err
+	}
+	detection := &SourceDetection{Marker: "package.json", Language: "javascript", Workdir: sourceWorkdir, BaseImage: "node:lts"}
+	var pkg struct {
+		Engines struct {
+			Node string `json:"node"`
+		} `json:"engines"`
+	}
+	// An invalid package.json still marks a node project, only the version is unknown
+	if json.Unmarshal(data, &pkg) == nil {
+		// The lowest major version listed, e.g. 20 for ">=20.1" or "^20 || ^22"
+		if major := nodeMajorPattern.FindString(strings.TrimSpace(pkg.Engines.Node)); major != "" {
+			detection.BaseImage = "node:" + major
+		}
+	}
+	return detection, nil
+}
+
+// WithDetected returns a copy of the configuration using the workdir of the detected source, unless the
+// repository layer of the configuration sets one, even to the default.
+func (config *EnvironmentConfig) WithDetected(detection *SourceDetection, repository *EnvironmentConfig) *EnvironmentConfig {
+	config = config.Copy()
+	if detection != nil && (repository == nil || repository.Workdir == "") {
+		config.Workdir = detection.Workdir
+	}
+	return config
+}
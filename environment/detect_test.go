@@ -0,0 +1,82 @@
+package environment
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectSource(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		files    map[string]string
+		expected *SourceDetection
+	}{
+		{
+			name:     "no markers",
+			files:    map[string]string{"README.md": "# Test"},
+			expected: nil,
+		},
+		{
+			name:     "go",
+			files:    map[string]string{"go.mod": "module github.com/acme/api\n\ngo 1.24.2\n\ntoolchain go1.24.4\n"},
+			expected: &SourceDetection{Marker: "go.mod", Language: "go", Workdir: "/go/src/github.com/acme/api", BaseImage: "golang:1.24"},
+		},
+		{
+			name:     "python",
+			files:    map[string]string{"pyproject.toml": "[project]\nname = \"api\"\nrequires-python = \">=3.11,<4\"\n"},
+			expected: &SourceDetection{Marker: "pyproject.toml", Language: "python", Workdir: "/usr/src/app", BaseImage: "python:3.11"},
+		},
+		{
+			name:     "python without version",
+			files:    map[string]string{"pyproject.toml": "[tool.black]\nline-length = 100\n"},
+			expected: &SourceDetection{Marker: "pyproject.toml", Language: "python", Workdir: "/usr/src/app", BaseImage: "python:3"},
+		},
+		{
+			name:     "node",
+			files:    map[string]string{"package.json": `{"name": "web", "engines": {"node": "^20 || ^22"}}`},
+			expected: &SourceDetection{Marker: "package.json", Language: "javascript", Workdir: "/usr/src/app", BaseImage: "node:20"},
+		},
+		{
+			name:     "node without engines",
+			files:    map[string]string{"package.json": `{"name": "web"}`},
+			expected: &SourceDetection{Marker: "package.json", Language: "javascript", Workdir: "/usr/src/app", BaseImage: "node:lts"},
+		},
+		{
+			name: "package.json for tooling",
+			files: map[string]string{
+				"package.json": `{"devDependencies": {"prettier": "^3"}}`,
+				"go.mod":       "module example.com/tool\n\ngo 1.23\n",
+			},
+			expected: &SourceDetection{Marker: "go.mod", Language: "go", Workdir: "/go/src/example.com/tool", BaseImage: "golang:1.23"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			detection, err := DetectSource(func(name string) ([]byte, error) {
+				data, ok := tc.files[name]
+				if !ok {
+					return nil, fs.ErrNotExist
+				}
+				return []byte(data), nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, detection)
+		})
+	}
+}
+
+func TestConfigWithDetected(t *testing.T) {
+	detection := &SourceDetection{Workdir: "/usr/src/app"}
+
+	config := DefaultConfig()
+	assert.Equal(t, "/usr/src/app", config.WithDetected(detection, &EnvironmentConfig{}).Workdir)
+	assert.Equal(t, "/workdir", config.Workdir, "the configuration is copied")
+	assert.Equal(t, "/workdir", config.WithDetected(nil, &EnvironmentConfig{}).Workdir)
+
+	// A configured workdir is kept, even when it is the default
+	assert.Equal(t, "/workdir", config.WithDetected(detection, &EnvironmentConfig{Workdir: "/workdir"}).Workdir)
+	config.Workdir = "/src"
+	assert.Equal(t, "/src", config.WithDetected(detection, &EnvironmentConfig{Workdir: "/src"}).Workdir)
+}
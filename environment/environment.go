@@ -1,10 +1,14 @@
 package environment
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -28,6 +32,14 @@ type Environment struct {
 	Services []*Service
 	Notes    Notes
 
+	// HostServices are services running on the host made reachable from commands run in the environment
+	HostServices []*HostService
+
+	// SkippedBinaryFiles are the binary files left out of the last commit, see EnvironmentConfig.BinaryFilePolicy
+	SkippedBinaryFiles []string
+	// SkippedSubmodules are the submodules with changes left out of the last commit, as submodules are read-only
+	SkippedSubmodules []string
+
 	mu sync.RWMutex
 }
 
@@ -71,7 +83,7 @@ func New(ctx context.Context, args NewEnvArgs) (*Environment, error) {
 }
 
 func (env *Environment) Workdir() *dagger.Directory {
-	return env.container().Directory(env.State.Config.Workdir)
+	return env.withoutMounts(env.container().Directory(env.State.Config.Workdir))
 }
 
 // WorkdirFile returns a single file from the workdir
@@ -169,22 +181,62 @@ func containerWithEnvAndSecrets(dag *dagger.Client, container *dagger.Container,
 	return container, nil
 }
 
+// baseContainer returns the container environments are built on top of: either the configured base image,
+// or the image built from the configured Dockerfile within the source directory.
+func (env *Environment) baseContainer(sourceDir *dagger.Directory) (*dagger.Container, error) {
+	config := env.State.Config
+	if config.Dockerfile == "" {
+		return env.dag.Container().From(config.BaseImage), nil
+	}
+
+	buildContext := filepath.Clean(filepath.FromSlash(cmp.Or(config.BuildContext, ".")))
+	dockerfile, err := filepath.Rel(buildContext, filepath.FromSlash(config.Dockerfile))
+	if err != nil || !filepath.IsLocal(dockerfile) {
+		return nil, fmt.Errorf("dockerfile %s must be within the build context %s", config.Dockerfile, buildContext)
+	}
+
+	buildArgs := []dagger.BuildArg{}
+	for _, key := range config.BuildArgs.Keys() {
+		buildArgs = append(buildArgs, dagger.BuildArg{Name: key, Value: config.BuildArgs.Get(key)})
+	}
+
+	return sourceDir.Directory(filepath.ToSlash(buildContext)).DockerBuild(dagger.DirectoryDockerBuildOpts{
+		Dockerfile: filepath.ToSlash(dockerfile),
+		BuildArgs:  buildArgs,
+	}), nil
+}
+
 func (env *Environment) buildBase(ctx context.Context, baseSourceDir *dagger.Directory) (*dagger.Container, error) {
-	container := env.dag.
-		Container().
-		From(env.State.Config.BaseImage).
-		WithWorkdir(env.State.Config.Workdir)
+	release, err := acquireOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	container, err := containerWithEnvAndSecrets(env.dag, container, env.State.Config.Env, env.State.Config.Secrets)
+	container, err := env.baseContainer(baseSourceDir)
 	if err != nil {
 		return nil, err
 	}
+	// Pulling the base image is the first operation reaching the engine, retry it while the engine warms up
+	container, err = syncWithRetries(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+	container = container.WithWorkdir(env.State.Config.Workdir)
 
-	runCommands := func(commands []string) error {
+	container, err = containerWithEnvAndSecrets(env.dag, container, env.State.Config.Env, env.State.Config.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	// Bind extra hosts first, so setup commands can reach internal package mirrors
+	container = env.withExtraHosts(container)
+
+	// Setup commands run with sh, as they may be what installs the default shell
+	runCommands := func(commands []string, shell string) error {
 		for _, command := range commands {
 			var err error
 
-			container = container.WithExec([]string{"sh", "-c", command})
+			container = container.WithExec(env.State.Config.shellCommand(shell, command))
 
 			exitCode, err := container.ExitCode(ctx)
 			if err != nil {
@@ -212,10 +264,35 @@ func (env *Environment) buildBase(ctx context.Context, baseSourceDir *dagger.Dir
 		return nil
 	}
 
-	// Run setup commands without the source directory for caching purposes
-	if err := runCommands(env.State.Config.SetupCommands); err != nil {
+	// Run setup commands without the source directory for caching purposes.
+	// Each command is its own layer, so editing one only re-runs it and the commands after it on rebuilds.
+	if err := runCommands(env.State.Config.SetupCommands, "sh"); err != nil {
 		return nil, fmt.Errorf("setup command failed: %w", err)
 	}
+	script := env.State.Config.SetupScript
+	if script == DefaultSetupScript {
+		// The default script is optional, e.g. it can be deleted after the environment was created
+		if exists, err := baseSourceDir.Exists(ctx, script); err != nil {
+			return nil, fmt.Errorf("failed to look for setup script %s: %w", script, err)
+		} else if !exists {
+			slog.Info("Skipping missing default setup script", "id", env.ID, "script", script)
+			script = ""
+		}
+	}
+	if script != "" {
+		// Only the script is mounted, so that changes to the rest of the source don't re-run it
+		scriptPath := path.Join("/", script)
+		scriptFile := baseSourceDir.File(script)
+		if _, err := scriptFile.Size(ctx); err != nil {
+			return nil, fmt.Errorf("setup script %s not found in the repository: %w", script, err)
+		}
+		scriptFile = env.dag.Directory().WithFile(setupScriptFile, scriptFile, dagger.DirectoryWithFileOpts{Permissions: 0755}).File(setupScriptFile)
+		container = container.WithMountedFile(scriptPath, scriptFile)
+		if err := runCommands([]string{scriptPath}, "sh"); err != nil {
+			return nil, fmt.Errorf("setup script failed: %w", err)
+		}
+		container = container.WithoutMount(scriptPath)
+	}
 
 	env.Services, err = env.startServices(ctx)
 	if err != nil {
@@ -225,10 +302,14 @@ func (env *Environment) buildBase(ctx context.Context, baseSourceDir *dagger.Dir
 		container = container.WithServiceBinding(service.Config.Name, service.svc)
 	}
 
-	container = container.WithDirectory(".", baseSourceDir)
+	// Setup scripts and Dockerfiles are read from the whole source, only source_paths end up in the workdir
+	container = container.WithDirectory(".", baseSourceDir, dagger.ContainerWithDirectoryOpts{
+		Include: env.State.Config.sourceInclude(),
+	})
+	container = env.withMounts(container)
 
 	// Run the install commands after the source directory is set up
-	if err := runCommands(env.State.Config.InstallCommands); err != nil {
+	if err := runCommands(env.State.Config.InstallCommands, ""); err != nil {
 		return nil, fmt.Errorf("install command failed: %w", err)
 	}
 
@@ -236,53 +317,197 @@ func (env *Environment) buildBase(ctx context.Context, baseSourceDir *dagger.Dir
 }
 
 func (env *Environment) UpdateConfig(ctx context.Context, newConfig *EnvironmentConfig) error {
+	if err := newConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	// Read the current files before switching configurations, as the new one may move the workdir or change mounts
+	sourceDir := env.Workdir()
 	env.State.Config = newConfig
 
 	// Re-build the base image with the new config
-	container, err := env.buildBase(ctx, env.Workdir())
+	return env.Rebuild(ctx, sourceDir)
+}
+
+// Rebuild builds the container again from the configuration, with sourceDir as the contents of the workdir.
+// Changes made outside of the workdir since the environment was built, like installed packages, are discarded.
+func (env *Environment) Rebuild(ctx context.Context, sourceDir *dagger.Directory) error {
+	container, err := env.buildBase(ctx, sourceDir)
 	if err != nil {
 		return err
 	}
 
-	if err := env.apply(ctx, container); err != nil {
-		return err
+	return env.apply(ctx, container)
+}
+
+// resolveCwd resolves the directory a single command runs from. Relative paths are resolved against the workdir,
+// and commands cannot run outside of it.
+func (env *Environment) resolveCwd(cwd string) (string, error) {
+	workdir := path.Clean(env.State.Config.Workdir)
+	if cwd == "" {
+		return workdir, nil
 	}
+	if !path.IsAbs(cwd) {
+		cwd = path.Join(workdir, cwd)
+	}
+	cwd = path.Clean(cwd)
+	if cwd != workdir && !strings.HasPrefix(cwd, strings.TrimSuffix(workdir, "/")+"/") {
+		return "", fmt.Errorf("cwd %s is outside of the workdir %s", cwd, workdir)
+	}
+	return cwd, nil
+}
 
-	return nil
+// withEnvPrefix shows per-command environment variables the way they would be typed in a shell. Their values
+// are masked, as the command is recorded in notes and commits, and they may hold credentials.
+func withEnvPrefix(envs []string, command string) string {
+	if len(envs) == 0 {
+		return command
+	}
+	masked := make([]string, 0, len(envs))
+	for _, env := range envs {
+		k, _, _ := strings.Cut(env, "=")
+		masked = append(masked, k+"=***")
+	}
+	return strings.Join(masked, " ") + " " + command
 }
 
-func (env *Environment) Run(ctx context.Context, command, shell string, useEntrypoint bool) (string, error) {
+// restoreEnv undoes the per-command overrides of envs in container, so they don't leak into later commands.
+// Variables that weren't set before being overridden are removed, those set to an empty value are kept.
+func restoreEnv(ctx context.Context, original, container *dagger.Container, envs []string) (*dagger.Container, error) {
+	// The names of the original variables are only listed when needed, to tell empty from unset variables
+	var names []string
+	for _, env := range envs {
+		k, _, _ := strings.Cut(env, "=")
+		v, err := original.EnvVariable(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			if names == nil {
+				if names, err = envVariableNames(ctx, original); err != nil {
+					return nil, err
+				}
+			}
+			if !slices.Contains(names, k) {
+				container = container.WithoutEnvVariable(k)
+				continue
+			}
+		}
+		container = container.WithEnvVariable(k, v)
+	}
+	return container, nil
+}
+
+// envVariableNames returns the names of the environment variables set in container.
+func envVariableNames(ctx context.Context, container *dagger.Container) ([]string, error) {
+	variables, err := container.EnvVariables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, variable := range variables {
+		name, err := variable.Name(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Run runs command in the environment and records its changes. When cwd is set, the command runs from that
+// directory of the workdir without changing the workdir of later commands. Likewise, envs (KEY=VALUE) only
+// apply to this command. A non-zero exit is not an error, see RunWithExitCode to tell. Commands can be
+// interrupted with CancelCommands, in which case ErrCommandCanceled is returned.
+func (env *Environment) Run(ctx context.Context, command, shell, cwd string, envs []string, useEntrypoint bool) (string, error) {
+	output, _, err := env.RunWithExitCode(ctx, command, shell, cwd, envs, useEntrypoint)
+	return output, err
+}
+
+// RunWithExitCode is Run, also returning the exit code of the command.
+func (env *Environment) RunWithExitCode(ctx context.Context, command, shell, cwd string, envs []string, useEntrypoint bool) (string, int, error) {
+	slog.Debug("Running command", "id", env.ID, "command", command, "cwd", cwd)
+	release, err := acquireOperation(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	defer release()
+
+	workdir, err := env.resolveCwd(cwd)
+	if err != nil {
+		return "", 0, err
+	}
+	original := env.container()
+	container, err := containerWithEnvAndSecrets(env.dag, original, envs, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	displayCommand := withEnvPrefix(envs, command)
+	run := &runningCommand{
+		command:   displayCommand,
+		startedAt: time.Now(),
+	}
 	args := []string{}
 	if command != "" {
-		args = []string{shell, "-c", command}
+		args = env.State.Config.shellCommand(shell, command)
+		// Mirroring the output for CancelCommands takes sh, which minimal images may not have
+		hasShell, err := original.Rootfs().Exists(ctx, "bin/sh")
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to look for sh: %w", err)
+		}
+		if hasShell {
+			stateID, err := original.ID(ctx)
+			if err != nil {
+				return "", 0, err
+			}
+			run.logPath = runLogPath(string(stateID), shell, command, cwd, envs)
+			args = wrapRunCommand(args, run.logPath)
+		}
 	}
-	newState := env.container().WithExec(args, dagger.ContainerWithExecOpts{
-		UseEntrypoint:                 useEntrypoint,
-		Expect:                        dagger.ReturnTypeAny, // Don't treat non-zero exit as error
-		ExperimentalPrivilegedNesting: true,
-	})
+
+	// The command can be interrupted from another operation, see CancelCommands
+	ctx, run.cancel = context.WithCancelCause(ctx)
+	defer run.cancel(nil)
+	running.add(env.ID, run)
+	defer running.remove(env.ID, run)
+
+	newState := env.withHostServices(container).
+		WithWorkdir(workdir).
+		WithMountedCache(processDir, env.processCache()).
+		WithExec(args, dagger.ContainerWithExecOpts{
+			UseEntrypoint:                 useEntrypoint,
+			Expect:                        dagger.ReturnTypeAny, // Don't treat non-zero exit as error
+			ExperimentalPrivilegedNesting: true,
+		})
 
 	exitCode, err := newState.ExitCode(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to get exit code: %w", err)
+		if errors.Is(context.Cause(ctx), ErrCommandCanceled) {
+			env.Notes.AddCommand(displayCommand, canceledExitCode, "", ErrCommandCanceled.Error())
+			return "", 0, ErrCommandCanceled
+		}
+		return "", 0, fmt.Errorf("failed to get exit code: %w", err)
 	}
 
 	stdout, err := newState.Stdout(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to get stdout: %w", err)
+		return "", exitCode, fmt.Errorf("failed to get stdout: %w", err)
 	}
 
 	stderr, err := newState.Stderr(ctx)
 	if err != nil {
-		return "", fmt.Errorf("failed to get stderr: %w", err)
+		return "", exitCode, fmt.Errorf("failed to get stderr: %w", err)
 	}
 
 	// Log the command execution with all details
-	env.Notes.AddCommand(command, exitCode, stdout, stderr)
+	env.Notes.AddCommand(displayCommand, exitCode, stdout, stderr)
 
 	// Always apply the container state (preserving changes even on non-zero exit)
+	newState, err = restoreEnv(ctx, original, newState.WithoutMount(processDir).WithWorkdir(env.State.Config.Workdir), envs)
+	if err != nil {
+		return stdout, exitCode, fmt.Errorf("failed to restore environment variables: %w", err)
+	}
 	if err := env.apply(ctx, newState); err != nil {
-		return stdout, fmt.Errorf("failed to apply container state: %w", err)
+		return stdout, exitCode, fmt.Errorf("failed to apply container state: %w", err)
 	}
 
 	// Return combined output (stdout + stderr if there was stderr)
@@ -293,16 +518,39 @@ func (env *Environment) Run(ctx context.Context, command, shell string, useEntry
 		}
 		combinedOutput += "stderr: " + stderr
 	}
-	return combinedOutput, nil
+	return combinedOutput, exitCode, nil
 }
 
-func (env *Environment) RunBackground(ctx context.Context, command, shell string, ports []int, useEntrypoint bool) (EndpointMappings, error) {
+// RunBackground starts a command as a service and registers it as a background process of the environment.
+func (env *Environment) RunBackground(ctx context.Context, command, shell, cwd string, envs []string, ports []int, useEntrypoint bool) (*Process, error) {
+	slog.Debug("Starting background command", "id", env.ID, "command", command, "cwd", cwd, "ports", ports)
+	release, err := acquireOperation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	workdir, err := env.resolveCwd(cwd)
+	if err != nil {
+		return nil, err
+	}
+	container, err := containerWithEnvAndSecrets(env.dag, env.container(), envs, nil)
+	if err != nil {
+		return nil, err
+	}
+	process := &Process{
+		ID:        processes.nextID(),
+		Command:   command,
+		StartedAt: time.Now(),
+	}
 	args := []string{}
 	if command != "" {
-		args = []string{shell, "-c", command}
+		args = env.State.Config.shellCommand(shell, wrapProcessCommand(process, command))
 	}
-	displayCommand := command + " &"
-	serviceState := env.container()
+	displayCommand := withEnvPrefix(envs, command) + " &"
+	serviceState := env.withHostServices(container).
+		WithWorkdir(workdir).
+		WithMountedCache(processDir, env.processCache())
 
 	// Expose ports
 	for _, port := range ports {
@@ -334,6 +582,8 @@ func (env *Environment) RunBackground(ctx context.Context, command, shell string
 	}
 
 	env.Notes.AddCommand(displayCommand, 0, "", "")
+	process.svc = svc
+	started.track(ctx, svc)
 
 	endpoints := EndpointMappings{}
 	for _, port := range ports {
@@ -341,24 +591,12 @@ func (env *Environment) RunBackground(ctx context.Context, command, shell string
 		endpoints[port] = endpoint
 
 		// Expose port on the host
-		tunnel, err := env.dag.Host().Tunnel(svc, dagger.HostTunnelOpts{
-			Ports: []dagger.PortForward{
-				{
-					Backend:  port,
-					Protocol: dagger.NetworkProtocolTcp,
-				},
-			},
-		}).Start(ctx)
-		if err != nil {
-			return nil, err
-		}
-
-		externalEndpoint, err := tunnel.Endpoint(ctx, dagger.ServiceEndpointOpts{
-			Scheme: "tcp",
-		})
+		tunnel, externalEndpoint, err := env.startTunnel(ctx, svc, port)
 		if err != nil {
+			stopProcessServices(context.WithoutCancel(ctx), process)
 			return nil, err
 		}
+		process.tunnels = append(process.tunnels, tunnel)
 		endpoint.HostExternal = externalEndpoint
 
 		internalEndpoint, err := svc.Endpoint(ctx, dagger.ServiceEndpointOpts{
@@ -366,37 +604,54 @@ func (env *Environment) RunBackground(ctx context.Context, command, shell string
 			Scheme: "tcp",
 		})
 		if err != nil {
+			stopProcessServices(context.WithoutCancel(ctx), process)
 			return nil, err
 		}
 		endpoint.EnvironmentInternal = internalEndpoint
 	}
+	process.Endpoints = endpoints
+
+	processes.add(env.ID, process)
 
-	return endpoints, nil
+	return process, nil
 }
 
-func (env *Environment) Terminal(ctx context.Context) error {
+// Terminal opens an interactive shell in the environment. Without a shell, bash is used when available,
+// falling back to sh. With LoginShell, the shell profiles are read first, as for commands.
+func (env *Environment) Terminal(ctx context.Context, shell string) error {
 	container := env.container()
-	var cmd []string
-	var sourceRC string
-	if shells, err := container.File("/etc/shells").Contents(ctx); err == nil {
-		for shell := range strings.Lines(shells) {
-			if shell[0] == '#' {
-				continue
-			}
-			shell = strings.TrimRight(shell, "\n")
-			if strings.HasSuffix(shell, "/bash") {
-				sourceRC = fmt.Sprintf("[ -f ~/.bashrc ] && . ~/.bashrc; %q --version | head -4; ", shell)
-				cmd = []string{shell, "--rcfile", "/cu/rc.sh", "-i"}
-				break
+	shell = cmp.Or(shell, env.State.Config.DefaultShell)
+	if shell == "" {
+		if shells, err := container.File("/etc/shells").Contents(ctx); err == nil {
+			for line := range strings.Lines(shells) {
+				if line[0] == '#' {
+					continue
+				}
+				line = strings.TrimRight(line, "\n")
+				if strings.HasSuffix(line, "/bash") {
+					shell = line
+					break
+				}
 			}
 		}
 	}
+
+	var cmd []string
+	var sourceRC string
+	if env.State.Config.LoginShell {
+		// Read the profiles like commands do, the rc file replaces the ones login shells would read
+		sourceRC = "[ -f /etc/profile ] && . /etc/profile; [ -f ~/.profile ] && . ~/.profile; "
+	}
+	if path.Base(shell) == "bash" {
+		sourceRC += fmt.Sprintf("[ -f ~/.bashrc ] && . ~/.bashrc; %q --version | head -4; ", shell)
+		cmd = []string{shell, "--rcfile", "/cu/rc.sh", "-i"}
+	}
 	// Try to show the same pretty PS1 as for the default /bin/sh terminal in dagger
 	container = container.WithNewFile("/cu/rc.sh", sourceRC+`export PS1="\033[33mcu\033[0m \033[02m\$(pwd | sed \"s|^\$HOME|~|\")\033[0m \$ "`+"\n")
 	if cmd == nil {
-		// If bash not available, assume POSIX shell
+		// Other shells are assumed to be POSIX shells, which read ENV when interactive
 		container = container.WithEnvVariable("ENV", "/cu/rc.sh")
-		cmd = []string{"sh"}
+		cmd = []string{cmp.Or(shell, "sh")}
 	}
 	if _, err := container.Terminal(dagger.ContainerTerminalOpts{
 		ExperimentalPrivilegedNesting: true,
@@ -407,6 +662,59 @@ func (env *Environment) Terminal(ctx context.Context) error {
 	return nil
 }
 
-func (env *Environment) Checkpoint(ctx context.Context, target string) (string, error) {
-	return env.container().Publish(ctx, target)
+// RegistryAuth holds the credentials to push to an image registry.
+type RegistryAuth struct {
+	Username string
+	// Secret references the password or token like configured secrets do, e.g. env://REGISTRY_TOKEN
+	Secret string
+}
+
+// NewRegistryAuth returns the credentials for username and secret, or nil if neither is set.
+// The secret must be a reference, so that its value never shows up in commands or tool calls.
+func NewRegistryAuth(username, secret string) (*RegistryAuth, error) {
+	if username == "" && secret == "" {
+		return nil, nil
+	}
+	if username == "" || secret == "" {
+		return nil, errors.New("a username and a secret must be set together")
+	}
+	if !strings.Contains(secret, "://") {
+		return nil, errors.New("the secret must be a reference such as env://REGISTRY_TOKEN, not the secret itself")
+	}
+	return &RegistryAuth{Username: username, Secret: secret}, nil
+}
+
+// ConfiguredRegistryAuth returns the credentials for username and the secret configured under secretName in
+// the environment's secrets, or nil if neither is set. Agents only get to pick among the secrets the user
+// configured: arbitrary references could send host credentials to any registry.
+func (env *Environment) ConfiguredRegistryAuth(username, secretName string) (*RegistryAuth, error) {
+	if username == "" && secretName == "" {
+		return nil, nil
+	}
+	if username == "" || secretName == "" {
+		return nil, errors.New("a username and a secret must be set together")
+	}
+	if !slices.Contains(env.State.Config.Secrets.Keys(), secretName) {
+		return nil, fmt.Errorf("secret %q is not configured, the user can add it with `container-use config secret set`", secretName)
+	}
+	return &RegistryAuth{Username: username, Secret: env.State.Config.Secrets.Get(secretName)}, nil
+}
+
+// Checkpoint publishes the environment's container to target, authenticating to its registry with auth if set.
+// Returns the content addressed reference of the published image.
+func (env *Environment) Checkpoint(ctx context.Context, target string, auth *RegistryAuth) (string, error) {
+	container := env.container()
+	if auth != nil {
+		container = container.WithRegistryAuth(registryAddress(target), auth.Username, env.dag.Secret(auth.Secret))
+	}
+	return container.Publish(ctx, target)
+}
+
+// registryAddress returns the registry host of an image reference, Docker Hub for references without one.
+func registryAddress(ref string) string {
+	host, _, found := strings.Cut(ref, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return "docker.io"
+	}
+	return host
 }
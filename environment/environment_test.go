@@ -0,0 +1,116 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveCwd(t *testing.T) {
+	env := &Environment{
+		EnvironmentInfo: &EnvironmentInfo{
+			State: &State{
+				Config: &EnvironmentConfig{Workdir: "/workdir"},
+			},
+		},
+	}
+
+	scenarios := []struct {
+		name     string
+		cwd      string
+		expected string
+	}{
+		{name: "default", cwd: "", expected: "/workdir"},
+		{name: "relative", cwd: "packages/api", expected: "/workdir/packages/api"},
+		{name: "absolute", cwd: "/workdir/packages/api", expected: "/workdir/packages/api"},
+		{name: "workdir", cwd: ".", expected: "/workdir"},
+		{name: "cleaned", cwd: "packages/../docs/", expected: "/workdir/docs"},
+	}
+	for _, scenario := range scenarios {
+		t.Run(scenario.name, func(t *testing.T) {
+			cwd, err := env.resolveCwd(scenario.cwd)
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expected, cwd)
+		})
+	}
+
+	for _, cwd := range []string{"..", "../etc", "/etc", "/workdir-other", "packages/../../etc"} {
+		t.Run("outside "+cwd, func(t *testing.T) {
+			_, err := env.resolveCwd(cwd)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestWithEnvPrefix(t *testing.T) {
+	assert.Equal(t, "npm test", withEnvPrefix(nil, "npm test"))
+	assert.Equal(t, "CI=*** NPM_TOKEN=*** npm test", withEnvPrefix([]string{"CI=true", "NPM_TOKEN=npm_secret"}, "npm test"))
+}
+
+func TestRegistryAddress(t *testing.T) {
+	tests := map[string]string{
+		"golang:1.24":                         "docker.io",
+		"acme/dev:latest":                     "docker.io",
+		"ghcr.io/acme/dev:v1":                 "ghcr.io",
+		"localhost/dev":                       "localhost",
+		"localhost:5000/acme/dev":             "localhost:5000",
+		"registry.example.com/dev@sha256:abc": "registry.example.com",
+	}
+	for ref, expected := range tests {
+		assert.Equal(t, expected, registryAddress(ref), ref)
+	}
+}
+
+func TestNewRegistryAuth(t *testing.T) {
+	auth, err := NewRegistryAuth("", "")
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+
+	auth, err = NewRegistryAuth("acme-bot", "env://GHCR_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, &RegistryAuth{Username: "acme-bot", Secret: "env://GHCR_TOKEN"}, auth)
+
+	_, err = NewRegistryAuth("acme-bot", "")
+	assert.Error(t, err)
+	_, err = NewRegistryAuth("acme-bot", "hunter2")
+	assert.Error(t, err, "secret values must not be accepted")
+}
+
+func TestConfiguredRegistryAuth(t *testing.T) {
+	config := DefaultConfig()
+	config.Secrets.Set("GHCR_TOKEN", "env://GHCR_TOKEN")
+	env := &Environment{EnvironmentInfo: &EnvironmentInfo{State: &State{Config: config}}}
+
+	auth, err := env.ConfiguredRegistryAuth("", "")
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+
+	auth, err = env.ConfiguredRegistryAuth("acme-bot", "GHCR_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, &RegistryAuth{Username: "acme-bot", Secret: "env://GHCR_TOKEN"}, auth)
+
+	// Agents can't pass references of their own, which could read any host secret
+	_, err = env.ConfiguredRegistryAuth("acme-bot", "cmd://cat ~/.docker/config.json")
+	assert.Error(t, err)
+	_, err = env.ConfiguredRegistryAuth("acme-bot", "env://AWS_SECRET_ACCESS_KEY")
+	assert.Error(t, err)
+	_, err = env.ConfiguredRegistryAuth("acme-bot", "")
+	assert.Error(t, err)
+}
+
+func TestBaseContainer_DockerfileOutsideContext(t *testing.T) {
+	env := &Environment{
+		EnvironmentInfo: &EnvironmentInfo{
+			State: &State{
+				Config: &EnvironmentConfig{
+					Dockerfile:   "Dockerfile",
+					BuildContext: "backend",
+				},
+			},
+		},
+	}
+
+	_, err := env.baseContainer(nil)
+	assert.ErrorContains(t, err, "must be within the build context")
+}
@@ -3,10 +3,15 @@ package environment
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"dagger.io/dagger"
 	godiffpatch "github.com/sourcegraph/go-diff-patch"
 )
 
@@ -40,23 +45,110 @@ func (env *Environment) FileRead(ctx context.Context, targetFile string, shouldR
 	return strings.Join(lines[start:end], "\n"), nil
 }
 
-func (env *Environment) FileWrite(ctx context.Context, explanation, targetFile, contents string) error {
+// FileReadBytes reads length bytes of a file starting at offset, without decoding them as text.
+// A negative length reads until the end of the file.
+func (env *Environment) FileReadBytes(ctx context.Context, targetFile string, offset, length int) ([]byte, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("error reading file: offset (%d) cannot be negative", offset)
+	}
+	// Fail on missing files the same way FileRead does
+	if _, err := env.container().File(targetFile).Size(ctx); err != nil {
+		return nil, err
+	}
+
+	// File contents go through GraphQL as strings, which mangles binary data, so encode them in the container
+	script := fmt.Sprintf(`tail -c +%d "$1"`, offset+1)
+	if length >= 0 {
+		script += fmt.Sprintf(" | head -c %d", length)
+	}
+	script += " | base64"
+	encoded, err := env.container().WithExec([]string{"sh", "-c", script, "sh", targetFile}).Stdout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+}
+
+// FileReadHead reads up to maxSize bytes of a file, along with the size of the whole file,
+// so callers can tell when the contents were truncated.
+func (env *Environment) FileReadHead(ctx context.Context, targetFile string, maxSize int) (string, int, error) {
+	file := env.container().File(targetFile)
+	size, err := file.Size(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if size <= maxSize {
+		contents, err := file.Contents(ctx)
+		return contents, size, err
+	}
+
+	head, err := env.FileReadBytes(ctx, targetFile, 0, maxSize)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(head), size, nil
+}
+
+func (env *Environment) FileWrite(ctx context.Context, explanation, targetFile, contents string, allowSubmoduleEdit bool) error {
 	// Check if the file is within a submodule
-	if err := env.validateNotSubmoduleFile(targetFile); err != nil {
+	submodule, err := env.checkSubmoduleEdit(targetFile, allowSubmoduleEdit)
+	if err != nil {
+		return err
+	}
+	if err := env.validateNotSymlink(ctx, targetFile); err != nil {
 		return err
 	}
 
-	err := env.apply(ctx, env.container().WithNewFile(targetFile, contents))
+	// Rewriting a file keeps its permissions, e.g. the executable bit of scripts
+	opts := dagger.ContainerWithNewFileOpts{Permissions: env.filePermissions(ctx, targetFile)}
+	err = env.apply(ctx, env.container().WithNewFile(targetFile, contents, opts))
 	if err != nil {
 		return fmt.Errorf("failed applying file write, skipping git propagation: %w", err)
 	}
-	env.Notes.Add("Write %s", targetFile)
+	env.Notes.Add("Write %s%s", targetFile, submodule)
 	return nil
 }
 
-func (env *Environment) FileEdit(ctx context.Context, explanation, targetFile, search, replace, matchID string) error {
+// FileAppend adds contents at the end of a file, creating it if it doesn't exist.
+func (env *Environment) FileAppend(ctx context.Context, explanation, targetFile, contents string, allowSubmoduleEdit bool) error {
 	// Check if the file is within a submodule
-	if err := env.validateNotSubmoduleFile(targetFile); err != nil {
+	submodule, err := env.checkSubmoduleEdit(targetFile, allowSubmoduleEdit)
+	if err != nil {
+		return err
+	}
+	if err := env.validateNotSymlink(ctx, targetFile); err != nil {
+		return err
+	}
+
+	ctr := env.container()
+	exists, err := ctr.Exists(ctx, targetFile)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		ctr = ctr.WithNewFile(targetFile, contents)
+	} else {
+		existing, err := ctr.File(targetFile).Contents(ctx)
+		if err != nil {
+			return err
+		}
+		// Patch rather than rewrite the file to preserve its permissions
+		patch := godiffpatch.GeneratePatch(targetFile, existing, existing+contents)
+		ctr = ctr.WithDirectory(".", ctr.Directory(".").WithPatch(patch))
+	}
+
+	if err := env.apply(ctx, ctr); err != nil {
+		return fmt.Errorf("failed applying file append, skipping git propagation: %w", err)
+	}
+	env.Notes.Add("Append %s%s", targetFile, submodule)
+	return nil
+}
+
+func (env *Environment) FileEdit(ctx context.Context, explanation, targetFile, search, replace, matchID string, allowSubmoduleEdit bool) error {
+	// Check if the file is within a submodule
+	submodule, err := env.checkSubmoduleEdit(targetFile, allowSubmoduleEdit)
+	if err != nil {
 		return err
 	}
 
@@ -130,36 +222,177 @@ func (env *Environment) FileEdit(ctx context.Context, explanation, targetFile, s
 	if err != nil {
 		return fmt.Errorf("failed applying file edit, skipping git propagation: %w", err)
 	}
-	env.Notes.Add("Edit %s", targetFile)
+	env.Notes.Add("Edit %s%s", targetFile, submodule)
 	return nil
 }
 
-func (env *Environment) FileDelete(ctx context.Context, explanation, targetFile string) error {
+func (env *Environment) FileDelete(ctx context.Context, explanation, targetFile string, allowSubmoduleEdit bool) error {
 	// Check if the file is within a submodule
-	if err := env.validateNotSubmoduleFile(targetFile); err != nil {
+	submodule, err := env.checkSubmoduleEdit(targetFile, allowSubmoduleEdit)
+	if err != nil {
 		return err
 	}
 
-	err := env.apply(ctx, env.container().WithoutFile(targetFile))
+	err = env.apply(ctx, env.container().WithoutFile(targetFile))
 	if err != nil {
 		return fmt.Errorf("failed applying file delete, skipping git propagation: %w", err)
 	}
-	env.Notes.Add("Delete %s", targetFile)
+	env.Notes.Add("Delete %s%s", targetFile, submodule)
+	return nil
+}
+
+// Mkdir creates a directory, including missing parents. Git doesn't track empty directories, so with gitkeep
+// an empty .gitkeep file is added to new empty directories to keep them in the environment's history.
+func (env *Environment) Mkdir(ctx context.Context, explanation, targetDir string, gitkeep bool) error {
+	// Check if the directory is within a submodule
+	if err := env.validateNotSubmoduleFile(targetDir); err != nil {
+		return err
+	}
+
+	ctr := env.container().WithDirectory(targetDir, env.dag.Directory())
+	if gitkeep {
+		entries, err := ctr.Directory(targetDir).Entries(ctx)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			ctr = ctr.WithNewFile(path.Join(targetDir, ".gitkeep"), "")
+		}
+	}
+
+	if err := env.apply(ctx, ctr); err != nil {
+		return fmt.Errorf("failed applying mkdir, skipping git propagation: %w", err)
+	}
+	env.Notes.Add("Create directory %s", targetDir)
+	return nil
+}
+
+// FileCopyFrom copies a file or directory from another environment. Relative paths are resolved
+// against the workdir of each environment.
+func (env *Environment) FileCopyFrom(ctx context.Context, explanation string, source *Environment, sourcePath, targetPath string) error {
+	if targetPath == "" {
+		targetPath = sourcePath
+	}
+	// Check if the target is within a submodule
+	if err := env.validateNotSubmoduleFile(targetPath); err != nil {
+		return err
+	}
+
+	srcCtr := source.container()
+	exists, err := srcCtr.Exists(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s not found in environment %s", sourcePath, source.ID)
+	}
+	isDir, err := srcCtr.Exists(ctx, sourcePath, dagger.ContainerExistsOpts{ExpectedType: dagger.ExistsTypeDirectoryType})
+	if err != nil {
+		return err
+	}
+
+	ctr := env.container()
+	if isDir {
+		ctr = ctr.WithDirectory(targetPath, srcCtr.Directory(sourcePath))
+	} else {
+		ctr = ctr.WithFile(targetPath, srcCtr.File(sourcePath))
+	}
+	if err := env.apply(ctx, ctr); err != nil {
+		return fmt.Errorf("failed applying file copy, skipping git propagation: %w", err)
+	}
+	if sourcePath == targetPath {
+		env.Notes.Add("Copy %s from %s", targetPath, source.ID)
+	} else {
+		env.Notes.Add("Copy %s from %s:%s", targetPath, source.ID, sourcePath)
+	}
 	return nil
 }
 
+// FileList lists the entries of a directory. Symlinks are shown with their target, e.g. "current -> v2".
 func (env *Environment) FileList(ctx context.Context, path string) (string, error) {
 	entries, err := env.container().Directory(path).Entries(ctx)
 	if err != nil {
 		return "", err
 	}
+	symlinks := env.symlinks(ctx, path)
 	out := &strings.Builder{}
 	for _, entry := range entries {
+		if target, ok := symlinks[strings.TrimSuffix(entry, "/")]; ok {
+			fmt.Fprintf(out, "%s -> %s\n", strings.TrimSuffix(entry, "/"), target)
+			continue
+		}
 		fmt.Fprintf(out, "%s\n", entry)
 	}
 	return out.String(), nil
 }
 
+// symlinks returns the targets of the symlinks in a directory, keyed by name.
+// Listing symlinks needs a shell in the container, without one symlinks are listed as regular entries.
+func (env *Environment) symlinks(ctx context.Context, dir string) map[string]string {
+	script := `for f in "$1"/* "$1"/.[!.]* "$1"/..?*; do [ -L "$f" ] && printf '%s\t%s\n' "${f##*/}" "$(readlink "$f")"; done; true`
+	out, err := env.container().WithExec([]string{"sh", "-c", script, "sh", dir}).Stdout(ctx)
+	if err != nil {
+		slog.Debug("Failed to list symlinks", "dir", dir, "err", err)
+		return nil
+	}
+	symlinks := map[string]string{}
+	for line := range strings.Lines(out) {
+		if name, target, ok := strings.Cut(strings.TrimSuffix(line, "\n"), "\t"); ok {
+			symlinks[name] = target
+		}
+	}
+	return symlinks
+}
+
+// filePermissions returns the permissions of an existing file, or 0 if the file doesn't exist
+// or its permissions can't be read.
+func (env *Environment) filePermissions(ctx context.Context, targetFile string) int {
+	ctr := env.container()
+	if exists, err := ctr.Exists(ctx, targetFile, dagger.ContainerExistsOpts{ExpectedType: dagger.ExistsTypeRegularType}); err != nil || !exists {
+		return 0
+	}
+	out, err := ctr.WithExec([]string{"stat", "-c", "%a", targetFile}).Stdout(ctx)
+	if err != nil {
+		slog.Debug("Failed to read file permissions", "file", targetFile, "err", err)
+		return 0
+	}
+	perms, err := strconv.ParseInt(strings.TrimSpace(out), 8, 32)
+	if err != nil {
+		return 0
+	}
+	return int(perms)
+}
+
+// SymlinkTarget reports whether path is a symlink, and the path it points to. The target is empty when
+// it can't be read, e.g. in images without readlink.
+func (env *Environment) SymlinkTarget(ctx context.Context, path string) (string, bool, error) {
+	isSymlink, err := env.container().Exists(ctx, path, dagger.ContainerExistsOpts{
+		ExpectedType:        dagger.ExistsTypeSymlinkType,
+		DoNotFollowSymlinks: true,
+	})
+	if err != nil || !isSymlink {
+		return "", false, err
+	}
+	target, err := env.container().WithExec([]string{"readlink", path}).Stdout(ctx)
+	if err != nil {
+		slog.Debug("Failed to read symlink", "path", path, "err", err)
+		return "", true, nil
+	}
+	return strings.TrimSpace(target), true, nil
+}
+
+// validateNotSymlink prevents writes through symlinks, which would silently change the file they point to.
+func (env *Environment) validateNotSymlink(ctx context.Context, targetFile string) error {
+	target, isSymlink, err := env.SymlinkTarget(ctx, targetFile)
+	if err != nil || !isSymlink {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("%s is a symlink, write to the file it points to or delete the symlink first", targetFile)
+	}
+	return fmt.Errorf("%s is a symlink to %s, write to the file it points to or delete the symlink first", targetFile, target)
+}
+
 // generateMatchID creates a unique ID for a match based on file, search, replace, and index
 func generateMatchID(targetFile, search, replace string, index int) string {
 	data := fmt.Sprintf("%s:%s:%s:%d", targetFile, search, replace, index)
@@ -242,3 +475,15 @@ func (env *Environment) validateNotSubmoduleFile(filePath string) error {
 
 	return nil
 }
+
+// checkSubmoduleEdit validates a file path like validateNotSubmoduleFile, unless allowSubmoduleEdit is set.
+// Returns a suffix for the notes of allowed edits within a submodule, which are not committed to the environment's branch.
+func (env *Environment) checkSubmoduleEdit(filePath string, allowSubmoduleEdit bool) (string, error) {
+	if !env.isWithinSubmodule(filePath, env.State.SubmodulePaths) {
+		return "", nil
+	}
+	if !allowSubmoduleEdit {
+		return "", env.validateNotSubmoduleFile(filePath)
+	}
+	return " (within a submodule, not committed)", nil
+}
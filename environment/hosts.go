@@ -0,0 +1,26 @@
+package environment
+
+import (
+	"dagger.io/dagger"
+)
+
+// withExtraHosts makes the configured extra hosts reachable from the container under their hostname.
+// Containers can't be given custom /etc/hosts entries or DNS resolvers, so each host is bound as a
+// service forwarding its ports to the address. The traffic goes through the Dagger client, so the address is
+// resolved and reached from the machine running container-use, not from the engine. For the same reason,
+// hostnames can't be mapped to an address on their own, without ports.
+func (env *Environment) withExtraHosts(container *dagger.Container) *dagger.Container {
+	for _, host := range env.State.Config.ExtraHosts {
+		ports := make([]dagger.PortForward, len(host.Ports))
+		for i, port := range host.Ports {
+			ports[i] = dagger.PortForward{
+				Frontend: port,
+				Backend:  port,
+				Protocol: dagger.NetworkProtocolTcp,
+			}
+		}
+		svc := env.dag.Host().Service(ports, dagger.HostServiceOpts{Host: host.Address})
+		container = container.WithServiceBinding(host.Hostname, svc)
+	}
+	return container
+}
@@ -0,0 +1,58 @@
+package environment
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile lists paths that never enter environments nor are committed back from them.
+const ignoreFile = "ignore"
+
+// LoadIgnore reads the patterns of the .container-use/ignore file of baseDir. The file uses the .gitignore
+// syntax: one pattern per line, with blank lines and lines starting with # skipped. Like commit_ignore,
+// patterns without a slash match file and directory names anywhere, while patterns with a slash match
+// paths from the repository root. Negated patterns are not supported.
+// A missing file means nothing is ignored.
+func LoadIgnore(baseDir string) ([]string, error) {
+	ignorePath := filepath.Join(baseDir, configDir, ignoreFile)
+	data, err := os.ReadFile(ignorePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var patterns []string
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case pattern == "" || strings.HasPrefix(pattern, "#"):
+			continue
+		case strings.HasPrefix(pattern, "!"):
+			errs = append(errs, fmt.Errorf("line %d: negated patterns are not supported, got '%s'", line, pattern))
+			continue
+		}
+		// Leading # and ! are escaped with a backslash
+		if strings.HasPrefix(pattern, `\#`) || strings.HasPrefix(pattern, `\!`) {
+			pattern = pattern[1:]
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: invalid pattern '%s'", line, pattern))
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ignorePath, err)
+	}
+	return patterns, nil
+}
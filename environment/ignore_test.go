@@ -0,0 +1,39 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIgnore(t *testing.T) {
+	writeIgnore := func(t *testing.T, contents string) string {
+		dir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, configDir), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, configDir, ignoreFile), []byte(contents), 0644))
+		return dir
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		patterns, err := LoadIgnore(t.TempDir())
+		require.NoError(t, err)
+		assert.Empty(t, patterns)
+	})
+
+	t.Run("patterns", func(t *testing.T) {
+		dir := writeIgnore(t, "# Secrets\n.env\nsecrets/  \n\n/fixtures/large\n\\#notes.md\r\n")
+		patterns, err := LoadIgnore(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{".env", "secrets/", "/fixtures/large", "#notes.md"}, patterns)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		dir := writeIgnore(t, "*.log\n!keep.log\n[build\n")
+		_, err := LoadIgnore(dir)
+		assert.ErrorContains(t, err, "line 2: negated patterns are not supported, got '!keep.log'")
+		assert.ErrorContains(t, err, "line 3: invalid pattern '[build'")
+	})
+}
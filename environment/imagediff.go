@@ -0,0 +1,120 @@
+package environment
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ImageDiff summarizes the changes made to the filesystem of an environment's container since its base image,
+// by setup and install commands as well as by the commands run since, outside of the workdir.
+type ImageDiff struct {
+	Added    int `json:"added"`
+	Modified int `json:"modified"`
+	Removed  int `json:"removed"`
+	// Size is the number of bytes of the added and modified files
+	Size int64 `json:"size_bytes"`
+	// Changes lists the changed paths, largest first. Removed directories are listed once rather than file by file.
+	Changes []ImageChange `json:"changes"`
+}
+
+// ImageChange is a path added, modified or removed in the container.
+type ImageChange struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+	Size   int64  `json:"size_bytes,omitempty"`
+}
+
+// imageDiffScript lists the files of /diff with their size, telling added files from modified ones with the
+// listing of /base, followed by the paths of /base missing from /env.
+const imageDiffScript = `set -e
+(cd /base && find . | sort) > /tmp/base
+(cd /env && find . | sort) > /tmp/env
+(cd /diff && find . ! -type d -exec stat -c '%s %n' {} +) > /tmp/diff
+awk 'NR == FNR { base[$0] = 1; next } { p = substr($0, length($1) + 2); print (p in base ? "M" : "A") "|" $1 "|" p }' /tmp/base /tmp/diff
+comm -23 /tmp/base /tmp/env | sed 's/^/D|0|/'`
+
+// ImageDiff compares the filesystem of the environment's container to its base image. The workdir is left out,
+// as changes to it are tracked in git.
+func (env *Environment) ImageDiff(ctx context.Context) (*ImageDiff, error) {
+	base, err := env.baseContainer(env.Workdir())
+	if err != nil {
+		return nil, err
+	}
+	workdir := env.State.Config.Workdir
+	baseRootfs := base.Rootfs().WithoutDirectory(workdir)
+	envRootfs := env.container().Rootfs().WithoutDirectory(workdir)
+
+	out, err := env.dag.Container().
+		From(alpineImage).
+		WithMountedDirectory("/base", baseRootfs).
+		WithMountedDirectory("/env", envRootfs).
+		WithMountedDirectory("/diff", baseRootfs.Diff(envRootfs)).
+		WithExec([]string{"sh", "-c", imageDiffScript}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare the container to its base image: %w", err)
+	}
+	return parseImageDiff(out)
+}
+
+// parseImageDiff parses the `change|size|path` lines printed by imageDiffScript.
+func parseImageDiff(out string) (*ImageDiff, error) {
+	diff := &ImageDiff{Changes: []ImageChange{}}
+	var removed []string
+	for line := range strings.Lines(out) {
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "|", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected diff output: %q", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in diff output: %q", line)
+		}
+		p := strings.TrimPrefix(path.Clean(fields[2]), "./")
+		if p == "." {
+			continue
+		}
+
+		switch fields[0] {
+		case "A":
+			diff.Added++
+			diff.Changes = append(diff.Changes, ImageChange{Path: p, Change: "added", Size: size})
+		case "M":
+			diff.Modified++
+			diff.Changes = append(diff.Changes, ImageChange{Path: p, Change: "modified", Size: size})
+		case "D":
+			removed = append(removed, p)
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected diff output: %q", line)
+		}
+		diff.Size += size
+	}
+
+	slices.SortStableFunc(diff.Changes, func(a, b ImageChange) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), strings.Compare(a.Path, b.Path))
+	})
+
+	// The contents of removed directories are removed too, only report the directories
+	removedPaths := map[string]bool{}
+	for _, p := range removed {
+		removedPaths[p] = true
+	}
+	for _, p := range removed {
+		if removedPaths[path.Dir(p)] {
+			continue
+		}
+		diff.Removed++
+		diff.Changes = append(diff.Changes, ImageChange{Path: p, Change: "removed"})
+	}
+	return diff, nil
+}
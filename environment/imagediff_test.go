@@ -0,0 +1,43 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageDiff(t *testing.T) {
+	out := `A|1048576|./root/.cache/pip/wheel.whl
+M|2048|./etc/apt/sources.list
+A|4096|./usr/local/bin/tool
+D|0|./var/lib/apt/lists
+D|0|./var/lib/apt/lists/archive
+D|0|./var/lib/apt/lists/lock
+D|0|./var/lib/apt/lists-backup
+D|0|./etc/motd
+`
+	diff, err := parseImageDiff(out)
+	require.NoError(t, err)
+	assert.Equal(t, &ImageDiff{
+		Added:    2,
+		Modified: 1,
+		Removed:  3,
+		Size:     1048576 + 2048 + 4096,
+		Changes: []ImageChange{
+			{Path: "root/.cache/pip/wheel.whl", Change: "added", Size: 1048576},
+			{Path: "usr/local/bin/tool", Change: "added", Size: 4096},
+			{Path: "etc/apt/sources.list", Change: "modified", Size: 2048},
+			{Path: "var/lib/apt/lists", Change: "removed"},
+			{Path: "var/lib/apt/lists-backup", Change: "removed"},
+			{Path: "etc/motd", Change: "removed"},
+		},
+	}, diff)
+
+	diff, err = parseImageDiff("")
+	require.NoError(t, err)
+	assert.Equal(t, &ImageDiff{Changes: []ImageChange{}}, diff)
+
+	_, err = parseImageDiff("find: permission denied\n")
+	assert.Error(t, err)
+}
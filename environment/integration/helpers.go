@@ -205,7 +205,7 @@ func (u *UserActions) FileWrite(envID, targetFile, contents, explanation string)
 	env, err := u.repo.Get(u.ctx, u.dag, envID)
 	require.NoError(u.t, err, "Failed to get environment %s", envID)
 
-	err = env.FileWrite(u.ctx, explanation, targetFile, contents)
+	err = env.FileWrite(u.ctx, explanation, targetFile, contents, false)
 	require.NoError(u.t, err, "FileWrite should succeed")
 
 	err = u.repo.Update(u.ctx, env, explanation)
@@ -217,7 +217,7 @@ func (u *UserActions) RunCommand(envID, command, explanation string) string {
 	env, err := u.repo.Get(u.ctx, u.dag, envID)
 	require.NoError(u.t, err, "Failed to get environment %s", envID)
 
-	output, err := env.Run(u.ctx, command, "/bin/sh", false)
+	output, err := env.Run(u.ctx, command, "/bin/sh", "", nil, false)
 	require.NoError(u.t, err, "Run command should succeed")
 
 	err = u.repo.Update(u.ctx, env, explanation)
@@ -228,7 +228,7 @@ func (u *UserActions) RunCommand(envID, command, explanation string) string {
 
 // CreateEnvironment mirrors environment_create MCP tool behavior
 func (u *UserActions) CreateEnvironment(title, explanation string) *environment.Environment {
-	env, err := u.repo.Create(u.ctx, u.dag, title, explanation, "HEAD")
+	env, err := u.repo.Create(u.ctx, u.dag, title, explanation, "HEAD", "")
 	require.NoError(u.t, err, "Create environment should succeed")
 	return env
 }
@@ -254,7 +254,7 @@ func (u *UserActions) FileDelete(envID, targetFile, explanation string) {
 	env, err := u.repo.Get(u.ctx, u.dag, envID)
 	require.NoError(u.t, err, "Failed to get environment %s", envID)
 
-	err = env.FileDelete(u.ctx, explanation, targetFile)
+	err = env.FileDelete(u.ctx, explanation, targetFile, false)
 	require.NoError(u.t, err, "FileDelete should succeed")
 
 	err = u.repo.Update(u.ctx, env, explanation)
@@ -3,6 +3,7 @@ package integration
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -252,6 +253,22 @@ func TestWorktreeUpdatesAreVisibleAfterRebuild(t *testing.T) {
 			assert.Contains(t, output, "Version 2", "Updated version should be used after rebuild")
 		})
 	})
+
+	t.Run("workdir_change", func(t *testing.T) {
+		WithRepository(t, "worktree_workdir_change", SetupNodeRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+			env := user.CreateEnvironment("Workdir Test", "Testing worktree updates after moving the workdir")
+			user.FileWrite(env.ID, "script.sh", `echo "Version 2"`, "Create script")
+
+			env = user.GetEnvironment(env.ID)
+			config := env.State.Config.Copy()
+			config.Workdir = "/src"
+			user.UpdateEnvironment(env.ID, env.State.Title, "Move the workdir", config)
+
+			output := user.RunCommand(env.ID, "pwd && sh script.sh", "Run after rebuild")
+			assert.Contains(t, output, "/src")
+			assert.Contains(t, output, "Version 2", "Files should follow the workdir")
+		})
+	})
 }
 
 // TestWeirdUserScenarios verifies edge case handling
@@ -379,12 +396,12 @@ func TestWeirdUserScenarios(t *testing.T) {
 		repo1, err := repository.OpenWithBasePath(ctx, repoDir1, configDir1)
 		require.NoError(t, err)
 
-		env1, err := repo1.Create(ctx, testDaggerClient, "App", "Creating app in repo1", "HEAD")
+		env1, err := repo1.Create(ctx, testDaggerClient, "App", "Creating app in repo1", "HEAD", "")
 		require.NoError(t, err)
 		defer repo1.Delete(ctx, env1.ID)
 
 		// Write file in env1
-		err = env1.FileWrite(ctx, "Add file", "app.js", "console.log('repo1');")
+		err = env1.FileWrite(ctx, "Add file", "app.js", "console.log('repo1');", false)
 		require.NoError(t, err)
 
 		// Try to use env1 while in repo2 (should fail)
@@ -425,6 +442,54 @@ func TestEnvironmentConfigurationPersists(t *testing.T) {
 		})
 	})
 
+	t.Run("DockerfileBuild", func(t *testing.T) {
+		setup := func(t *testing.T, repoDir string) {
+			writeFile(t, repoDir, ".devcontainer/Dockerfile", "FROM alpine:latest\nARG GREETING\nRUN echo \"$GREETING\" > /greeting\n")
+			gitCommit(t, repoDir, "Add Dockerfile")
+		}
+		WithRepository(t, "dockerfile", setup, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+			newEnv := user.CreateEnvironment("Test with Dockerfile", "Creating environment from a Dockerfile")
+
+			updatedConfig := newEnv.State.Config.Copy()
+			updatedConfig.Dockerfile = ".devcontainer/Dockerfile"
+			updatedConfig.BuildContext = ".devcontainer"
+			updatedConfig.BuildArgs.Set("GREETING", "hello from dockerfile")
+
+			user.UpdateEnvironment(newEnv.ID, "Test with Dockerfile", "Build from the project's Dockerfile", updatedConfig)
+
+			output := user.RunCommand(newEnv.ID, "cat /greeting", "Check the image was built from the Dockerfile")
+			assert.Contains(t, output, "hello from dockerfile")
+
+			newConfig := user.GetEnvironment(newEnv.ID).State.Config
+			assert.Equal(t, ".devcontainer/Dockerfile", newConfig.Dockerfile, "Dockerfile should persist")
+			assert.Equal(t, []string{"GREETING=hello from dockerfile"}, []string(newConfig.BuildArgs), "Build args should persist")
+		})
+	})
+
+	t.Run("SourcePaths", func(t *testing.T) {
+		setup := func(t *testing.T, repoDir string) {
+			writeFile(t, repoDir, "services/api/main.go", "package main\n")
+			writeFile(t, repoDir, "services/web/index.js", "console.log('web')\n")
+			writeFile(t, repoDir, ".container-use/environment.json", `{"source_paths": ["services/api"]}`)
+			gitCommit(t, repoDir, "Add services")
+		}
+		WithRepository(t, "source_paths", setup, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+			newEnv := user.CreateEnvironment("Test with source paths", "Creating environment limited to the api service")
+
+			// Only the source paths are copied, at their place in the workdir
+			output := user.RunCommand(newEnv.ID, "ls services", "List the services")
+			assert.Equal(t, "api\n", output)
+			assert.Equal(t, "package main\n", user.FileRead(newEnv.ID, "services/api/main.go"))
+			user.FileReadExpectError(newEnv.ID, "services/web/index.js")
+
+			// Changes are committed back without deleting the paths left out
+			user.FileWrite(newEnv.ID, "services/api/main.go", "package main // updated\n", "Update the api")
+			assert.Equal(t, "package main // updated\n", user.ReadWorktreeFile(newEnv.ID, "services/api/main.go"))
+			files := user.GitCommand("ls-tree", "-r", "--name-only", "container-use/"+newEnv.ID)
+			assert.Contains(t, files, "services/web/index.js")
+		})
+	})
+
 	t.Run("SetupCommandsPersist", func(t *testing.T) {
 		WithRepository(t, "setup_commands", SetupNodeRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
 			newEnv := user.CreateEnvironment("Test with setup", "Creating environment with setup commands")
@@ -614,3 +679,592 @@ func TestEnvironmentConfigurationPersists(t *testing.T) {
 		})
 	})
 }
+
+// TestHostServiceAccess verifies that commands can reach a TCP listener on the host through a host service
+func TestHostServiceAccess(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			fmt.Fprint(conn, "hello from host\n")
+			conn.Close()
+		}
+	}()
+
+	WithRepository(t, "host-service", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		env := user.CreateEnvironment("Host Service Test", "Testing host service access")
+
+		hostService, err := environment.ParseHostService(listener.Addr().String())
+		require.NoError(t, err)
+
+		env = user.GetEnvironment(env.ID)
+		env.HostServices = []*environment.HostService{hostService}
+
+		command := fmt.Sprintf("exec 3<>/dev/tcp/%s/%d && cat <&3", environment.HostServiceAlias, hostService.Port)
+		output, err := env.Run(context.Background(), command, "bash", "", nil, false)
+		require.NoError(t, err)
+		assert.Contains(t, output, "hello from host")
+	})
+}
+
+// TestRunCwd verifies that commands can run from a subdirectory without changing the workdir of later commands
+func TestRunCwd(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "run-cwd", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Run Cwd Test", "Testing commands in subdirectories")
+		user.FileWrite(env.ID, "packages/api/package.json", "{}", "Add a package")
+
+		env = user.GetEnvironment(env.ID)
+		output, err := env.Run(ctx, "pwd && touch built", "sh", "packages/api", nil, false)
+		require.NoError(t, err)
+		assert.Contains(t, output, "/workdir/packages/api")
+		require.NoError(t, repo.Update(ctx, env, "Build the package"))
+		assert.Equal(t, "", user.ReadWorktreeFile(env.ID, "packages/api/built"))
+
+		output, err = env.Run(ctx, "pwd", "sh", "", nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, "/workdir\n", output)
+
+		_, err = env.Run(ctx, "pwd", "sh", "../etc", nil, false)
+		assert.Error(t, err)
+	})
+}
+
+// TestRunExitCode verifies that failing commands report their exit code while their changes are kept
+func TestRunExitCode(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "run-exit-code", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Run Exit Code Test", "Testing failing commands")
+
+		output, exitCode, err := env.RunWithExitCode(ctx, "echo partial > partial.txt && echo failing && exit 3", "sh", "", nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, 3, exitCode)
+		assert.Equal(t, "failing\n", output)
+		require.NoError(t, repo.Update(ctx, env, "Run a failing command"))
+		assert.Equal(t, "partial\n", user.ReadWorktreeFile(env.ID, "partial.txt"))
+
+		_, exitCode, err = env.RunWithExitCode(ctx, "true", "sh", "", nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, 0, exitCode)
+	})
+}
+
+// TestFileReadHead verifies that output files are read whole, or truncated past the maximum size
+func TestFileReadHead(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-read-head", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("File Read Head Test", "Testing output files")
+
+		env = user.GetEnvironment(env.ID)
+		_, err := env.Run(ctx, "mkdir -p reports && echo 'ok 42 tests' > reports/test.txt", "sh", "", nil, false)
+		require.NoError(t, err)
+
+		contents, size, err := env.FileReadHead(ctx, "reports/test.txt", 1024)
+		require.NoError(t, err)
+		assert.Equal(t, "ok 42 tests\n", contents)
+		assert.Equal(t, 12, size)
+
+		contents, size, err = env.FileReadHead(ctx, "reports/test.txt", 5)
+		require.NoError(t, err)
+		assert.Equal(t, "ok 42", contents)
+		assert.Equal(t, 12, size)
+
+		_, _, err = env.FileReadHead(ctx, "reports/missing.txt", 1024)
+		assert.Error(t, err)
+	})
+}
+
+// TestFileHash verifies that file hashes match between stat and read, and change with the contents
+func TestFileHash(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-hash", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("File Hash Test", "Testing file hashes")
+		user.FileWrite(env.ID, "hello.txt", "hello\n", "Write a file")
+
+		env = user.GetEnvironment(env.ID)
+		hash, err := env.FileHash(ctx, "hello.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03", hash)
+
+		stat, err := env.FileStat(ctx, "hello.txt", true)
+		require.NoError(t, err)
+		assert.Equal(t, hash, stat.Hash)
+
+		_, err = env.Run(ctx, "echo world >> hello.txt", "sh", "", nil, false)
+		require.NoError(t, err)
+		stat, err = env.FileStat(ctx, "hello.txt", true)
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, stat.Hash)
+
+		_, err = env.FileHash(ctx, "missing.txt")
+		assert.Error(t, err)
+	})
+}
+
+// TestImageDiff verifies that changes made outside of the workdir are reported against the base image
+func TestImageDiff(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "image-diff", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Image Diff Test", "Testing image diffs")
+		user.FileWrite(env.ID, "main.go", "package main\n", "Write a file in the workdir")
+
+		env = user.GetEnvironment(env.ID)
+		_, err := env.Run(ctx, "head -c 4096 /dev/zero > /opt/artifact.bin && echo changed >> /etc/motd && rm -rf /etc/apk/keys", "sh", "", nil, false)
+		require.NoError(t, err)
+
+		diff, err := env.ImageDiff(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, diff.Changes, environment.ImageChange{Path: "opt/artifact.bin", Change: "added", Size: 4096})
+		assert.Contains(t, diff.Changes, environment.ImageChange{Path: "etc/apk/keys", Change: "removed"})
+		paths := []string{}
+		for _, change := range diff.Changes {
+			paths = append(paths, change.Path)
+		}
+		assert.Contains(t, paths, "etc/motd")
+		assert.NotContains(t, paths, "workdir/main.go")
+	})
+}
+
+// TestRunEnv verifies that environment variables can be set for a single command
+func TestRunEnv(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "run-env", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Run Env Test", "Testing per-command environment variables")
+
+		env = user.GetEnvironment(env.ID)
+		before, err := env.Run(ctx, `echo "$CI $HOME"`, "sh", "", nil, false)
+		require.NoError(t, err)
+
+		output, err := env.Run(ctx, `echo "$CI $HOME"`, "sh", "", []string{"CI=true", "HOME=/tmp"}, false)
+		require.NoError(t, err)
+		assert.Equal(t, "true /tmp\n", output)
+		require.NoError(t, repo.Update(ctx, env, "Run in CI mode"))
+
+		// Overrides neither leak into later commands nor into the configuration
+		env = user.GetEnvironment(env.ID)
+		output, err = env.Run(ctx, `echo "$CI $HOME"`, "sh", "", nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, before, output)
+		assert.Empty(t, env.State.Config.Env)
+
+		_, err = env.Run(ctx, "true", "sh", "", []string{"CI"}, false)
+		assert.Error(t, err)
+
+		// Variables set to an empty value are still set after being overridden
+		config := env.State.Config.Copy()
+		config.Env.Set("EMPTY", "")
+		require.NoError(t, env.UpdateConfig(ctx, config))
+		_, err = env.Run(ctx, "true", "sh", "", []string{"EMPTY=overridden"}, false)
+		require.NoError(t, err)
+		output, err = env.Run(ctx, `echo "${EMPTY-unset}."`, "sh", "", nil, false)
+		require.NoError(t, err)
+		assert.Equal(t, ".\n", output)
+	})
+}
+
+// TestBackgroundProcessLifecycle verifies that background processes can be listed, their logs read, and stopped
+func TestBackgroundProcessLifecycle(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "background-process", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Background Process Test", "Testing background processes")
+
+		env = user.GetEnvironment(env.ID)
+		process, err := env.RunBackground(ctx, "echo started; sleep 300", "sh", "", nil, nil, false)
+		require.NoError(t, err)
+
+		// Processes outlive the Environment object they were started from
+		env = user.GetEnvironment(env.ID)
+		processes := env.Processes()
+		require.Len(t, processes, 1)
+		assert.Equal(t, process.ID, processes[0].ID)
+
+		assert.Eventually(t, func() bool {
+			logs, err := env.ProcessLogs(ctx, process.ID)
+			return err == nil && strings.Contains(logs, "started")
+		}, 30*time.Second, time.Second)
+
+		require.NoError(t, env.StopProcess(ctx, process.ID))
+		assert.Empty(t, env.Processes())
+
+		_, err = env.ProcessLogs(ctx, process.ID)
+		assert.Error(t, err)
+	})
+}
+
+// TestProcessOutputSince verifies that the output of background processes can be followed incrementally
+func TestProcessOutputSince(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "process-output-since", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Process Output Test", "Testing incremental process output")
+
+		env = user.GetEnvironment(env.ID)
+		process, err := env.RunBackground(ctx, "echo one; sleep 5; echo two; exit 3", "sh", "", nil, nil, false)
+		require.NoError(t, err)
+
+		output := ""
+		cursor := 0
+		assert.Eventually(t, func() bool {
+			out, err := env.ProcessOutputSince(ctx, process.ID, cursor)
+			require.NoError(t, err)
+			output += out.Output
+			cursor = out.Cursor
+			if output == "one\n" {
+				assert.False(t, out.Exited)
+			}
+			return out.Exited && out.ExitCode == 3
+		}, 60*time.Second, time.Second)
+		assert.Equal(t, "one\ntwo\n", output)
+	})
+}
+
+// TestSidecarServices verifies that services declared in the repository configuration are started
+// alongside new environments and reachable at their name
+func TestSidecarServices(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "sidecar-services", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		config := environment.DefaultConfig()
+		config.Services = environment.ServiceConfigs{
+			{
+				Name:         "db",
+				Image:        "postgres:16-alpine",
+				ExposedPorts: []int{5432},
+				Env:          []string{"POSTGRES_PASSWORD=postgres"},
+			},
+		}
+		require.NoError(t, config.Save(repo.SourcePath()))
+
+		env := user.CreateEnvironment("Sidecar Services Test", "Testing sidecar services")
+		require.Len(t, env.Services, 1)
+		assert.Equal(t, "tcp://db:5432", env.Services[0].Endpoints[5432].EnvironmentInternal)
+		assert.NotEmpty(t, env.Services[0].Endpoints[5432].HostExternal)
+
+		// Postgres takes a moment to accept connections after its container starts
+		env = user.GetEnvironment(env.ID)
+		output, err := env.Run(context.Background(), `for i in $(seq 30); do
+  if (exec 3<>/dev/tcp/db/5432) 2>/dev/null; then echo connected; exit 0; fi
+  sleep 1
+done
+exit 1`, "bash", "", nil, false)
+		require.NoError(t, err)
+		assert.Contains(t, output, "connected")
+	})
+}
+
+// TestHostDirectoryMount verifies that mounted host directories are readable in the environment but never committed
+func TestHostDirectoryMount(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "host-mount", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+
+		assets := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(assets, "weights.bin"), []byte("model weights"), 0644))
+
+		env := user.CreateEnvironment("Host Mount Test", "Testing host directory mounts")
+
+		env = user.GetEnvironment(env.ID)
+		require.NoError(t, env.Mount(ctx, "Mount assets", &environment.MountConfig{Source: assets, Target: "assets"}))
+		require.NoError(t, repo.Update(ctx, env, "Mount assets"))
+
+		output := user.RunCommand(env.ID, "cat assets/weights.bin && echo tracked > tracked.txt", "Read mounted assets")
+		assert.Contains(t, output, "model weights")
+
+		// Only the tracked file made it to the worktree
+		assert.Equal(t, "tracked\n", user.ReadWorktreeFile(env.ID, "tracked.txt"))
+		_, err := os.Stat(filepath.Join(user.WorktreePath(env.ID), "assets"))
+		assert.True(t, os.IsNotExist(err), "Mounted directory should not be exported to the worktree")
+
+		// The mount is reapplied when the environment is rebuilt
+		env = user.GetEnvironment(env.ID)
+		require.NoError(t, env.UpdateConfig(ctx, env.State.Config.Copy()))
+		output, err = env.Run(ctx, "cat assets/weights.bin", "sh", "", nil, false)
+		require.NoError(t, err)
+		assert.Contains(t, output, "model weights")
+	})
+}
+
+// TestFileReadBytes verifies that byte ranges of binary files are read without corruption
+func TestFileReadBytes(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-read-bytes", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Binary Read Test", "Testing binary file reads")
+		user.RunCommand(env.ID, `printf '\177ELF\000\001\377\376tail' > app.bin`, "Write a binary file")
+
+		env = user.GetEnvironment(env.ID)
+
+		header, err := env.FileReadBytes(ctx, "app.bin", 0, 4)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x7f, 'E', 'L', 'F'}, header)
+
+		rest, err := env.FileReadBytes(ctx, "app.bin", 4, -1)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x01, 0xff, 0xfe, 't', 'a', 'i', 'l'}, rest)
+
+		_, err = env.FileReadBytes(ctx, "missing.bin", 0, -1)
+		assert.Error(t, err)
+	})
+}
+
+// TestFileAppend verifies that appending creates missing files and preserves existing contents and permissions
+func TestFileAppend(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-append", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("File Append Test", "Testing file appends")
+		user.RunCommand(env.ID, "printf '#!/bin/sh\\necho one\\n' > run.sh && chmod +x run.sh", "Create script")
+
+		env = user.GetEnvironment(env.ID)
+		require.NoError(t, env.FileAppend(ctx, "Append to script", "run.sh", "echo two\n", false))
+		require.NoError(t, env.FileAppend(ctx, "Append to new file", "CHANGELOG.md", "- first entry\n", false))
+		require.NoError(t, repo.Update(ctx, env, "Append files"))
+
+		assert.Equal(t, "#!/bin/sh\necho one\necho two\n", user.ReadWorktreeFile(env.ID, "run.sh"))
+		assert.Equal(t, "- first entry\n", user.ReadWorktreeFile(env.ID, "CHANGELOG.md"))
+
+		output := user.RunCommand(env.ID, "./run.sh", "Run script")
+		assert.Equal(t, "one\ntwo\n", output)
+	})
+}
+
+// TestFileCopyFrom verifies that files and directories can be copied between environments
+func TestFileCopyFrom(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-copy", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		source := user.CreateEnvironment("Copy Source", "Testing file copies")
+		target := user.CreateEnvironment("Copy Target", "Testing file copies")
+		user.FileWrite(source.ID, "fix.py", "print('fixed')\n", "Write fix")
+		user.FileWrite(source.ID, "lib/util.py", "def util(): pass\n", "Write lib")
+
+		source = user.GetEnvironment(source.ID)
+		env := user.GetEnvironment(target.ID)
+		require.NoError(t, env.FileCopyFrom(ctx, "Copy fix", source, "fix.py", ""))
+		require.NoError(t, env.FileCopyFrom(ctx, "Copy lib", source, "lib", "vendor/lib"))
+		require.NoError(t, repo.Update(ctx, env, "Copy from sibling"))
+
+		assert.Equal(t, "print('fixed')\n", user.ReadWorktreeFile(env.ID, "fix.py"))
+		assert.Equal(t, "def util(): pass\n", user.ReadWorktreeFile(env.ID, "vendor/lib/util.py"))
+
+		assert.Error(t, env.FileCopyFrom(ctx, "Copy missing", source, "missing.py", ""))
+	})
+}
+
+// TestSymlinks verifies that symlinks are listed with their target, protected from writes and committed as links
+func TestSymlinks(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "symlinks", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Symlink Test", "Testing symlinks")
+		user.FileWrite(env.ID, "config.yaml", "debug: true\n", "Write config")
+		user.RunCommand(env.ID, "ln -s config.yaml current.yaml", "Link config")
+
+		env = user.GetEnvironment(env.ID)
+		entries, err := env.FileList(ctx, ".")
+		require.NoError(t, err)
+		assert.Contains(t, entries, "current.yaml -> config.yaml\n")
+		target, isSymlink, err := env.SymlinkTarget(ctx, "current.yaml")
+		require.NoError(t, err)
+		assert.True(t, isSymlink)
+		assert.Equal(t, "config.yaml", target)
+		_, isSymlink, err = env.SymlinkTarget(ctx, "config.yaml")
+		require.NoError(t, err)
+		assert.False(t, isSymlink)
+
+		err = env.FileWrite(ctx, "Overwrite link", "current.yaml", "debug: false\n", false)
+		assert.ErrorContains(t, err, "symlink to config.yaml")
+		assert.Equal(t, "debug: true\n", user.FileRead(env.ID, "config.yaml"))
+
+		worktree := user.WorktreePath(env.ID)
+		mode, err := repository.RunGitCommand(ctx, worktree, "ls-files", "-s", "current.yaml")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(mode, "120000"), "symlink should be committed as a link, got %q", mode)
+	})
+}
+
+// TestFileWritePreservesPermissions verifies that rewriting an executable script keeps it executable, in the container and in git
+func TestFileWritePreservesPermissions(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "file-permissions", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("File Permissions Test", "Testing file permissions")
+		user.FileWrite(env.ID, "run.sh", "#!/bin/sh\necho one\n", "Write script")
+		user.RunCommand(env.ID, "chmod +x run.sh", "Make script executable")
+		user.FileWrite(env.ID, "run.sh", "#!/bin/sh\necho two\n", "Rewrite script")
+
+		output := user.RunCommand(env.ID, "./run.sh", "Run script")
+		assert.Equal(t, "two\n", output)
+
+		mode, err := repository.RunGitCommand(ctx, user.WorktreePath(env.ID), "ls-files", "-s", "run.sh")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(mode, "100755"), "script should be committed as executable, got %q", mode)
+	})
+}
+
+// TestApplyPatch verifies that unified diffs are applied atomically, and that failing hunks are reported
+func TestApplyPatch(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "apply-patch", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Apply Patch Test", "Testing patches")
+		user.FileWrite(env.ID, "a.txt", "one\ntwo\nthree\n", "Add a")
+		user.FileWrite(env.ID, "b.txt", "alpha\nbeta\n", "Add b")
+
+		env = user.GetEnvironment(env.ID)
+		require.NoError(t, env.ApplyPatch(ctx, "Update files", `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,3 @@
+ alpha
+ beta
++gamma
+--- /dev/null
++++ b/c.txt
+@@ -0,0 +1 @@
++new
+`))
+		require.NoError(t, repo.Update(ctx, env, "Update files"))
+		assert.Equal(t, "one\nTWO\nthree\n", user.ReadWorktreeFile(env.ID, "a.txt"))
+		assert.Equal(t, "alpha\nbeta\ngamma\n", user.ReadWorktreeFile(env.ID, "b.txt"))
+		assert.Equal(t, "new\n", user.ReadWorktreeFile(env.ID, "c.txt"))
+
+		// Nothing is applied when a hunk doesn't match
+		env = user.GetEnvironment(env.ID)
+		err := env.ApplyPatch(ctx, "Broken patch", `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-TWO
++2
+ three
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ alpha
+-delta
++DELTA
+`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "hunk 1 (@@ -1,2 +1,2 @@) of b.txt")
+		assert.Equal(t, "one\nTWO\nthree\n", user.FileRead(env.ID, "a.txt"))
+	})
+}
+
+// TestMkdir verifies that new empty directories are kept through commits with a .gitkeep file
+func TestMkdir(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("Skipping integration test")
+	}
+
+	WithRepository(t, "mkdir", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := context.Background()
+		env := user.CreateEnvironment("Mkdir Test", "Testing directory creation")
+
+		env = user.GetEnvironment(env.ID)
+		require.NoError(t, env.Mkdir(ctx, "Scaffold", "src/components", true))
+		require.NoError(t, env.Mkdir(ctx, "Scaffold", "tmp", false))
+		require.NoError(t, repo.Update(ctx, env, "Scaffold layout"))
+
+		files, err := repository.RunGitCommand(ctx, user.WorktreePath(env.ID), "ls-files")
+		require.NoError(t, err)
+		assert.Contains(t, files, "src/components/.gitkeep")
+		assert.NotContains(t, files, "tmp")
+
+		// Existing directories are left untouched
+		user.FileWrite(env.ID, "lib/util.py", "def util(): pass\n", "Write lib")
+		env = user.GetEnvironment(env.ID)
+		require.NoError(t, env.Mkdir(ctx, "Scaffold", "lib", true))
+		entries, err := env.FileList(ctx, "lib")
+		require.NoError(t, err)
+		assert.Equal(t, "util.py\n", entries)
+	})
+}
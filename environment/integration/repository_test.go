@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dagger/container-use/repository"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +35,29 @@ func TestRepositoryCreate(t *testing.T) {
 	})
 }
 
+// TestRepositoryCreateWithGitDir tests that environments keep the repository history with include_git_dir
+func TestRepositoryCreateWithGitDir(t *testing.T) {
+	t.Parallel()
+	setup := func(t *testing.T, repoDir string) {
+		writeFile(t, repoDir, "README.md", "# Test Project\n")
+		gitCommit(t, repoDir, "Initial commit")
+		writeFile(t, repoDir, ".container-use/environment.json", `{"base_image": "alpine/git:2.49.0", "include_git_dir": true}`)
+		gitCommit(t, repoDir, "Keep the git directory in environments")
+	}
+	WithRepository(t, "repository-create-git-dir", setup, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		env := user.CreateEnvironment("Test Git Dir", "Testing include_git_dir")
+
+		output := user.RunCommand(env.ID, "git log --format=%s", "Read the history")
+		assert.Contains(t, output, "Initial commit")
+		assert.Contains(t, output, "Keep the git directory in environments")
+
+		// The worktree keeps pointing at the fork repository
+		gitFile, err := os.ReadFile(filepath.Join(user.WorktreePath(env.ID), ".git"))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(gitFile), "gitdir: "))
+	})
+}
+
 // TestRepositoryGet tests retrieving an existing environment
 func TestRepositoryGet(t *testing.T) {
 	t.Parallel()
@@ -104,6 +130,44 @@ func TestRepositoryDelete(t *testing.T) {
 	})
 }
 
+// TestRepositoryReset tests discarding the changes of an environment, back to its base or to a version
+func TestRepositoryReset(t *testing.T) {
+	t.Parallel()
+	WithRepository(t, "repository-reset", SetupEmptyRepo, func(t *testing.T, repo *repository.Repository, user *UserActions) {
+		ctx := t.Context()
+
+		env := user.CreateEnvironment("Test Reset", "Testing repository reset")
+		user.FileWrite(env.ID, "keep.txt", "keep", "Write a file to keep")
+		user.FileWrite(env.ID, "mess.txt", "mess", "Make a mess")
+		user.RunCommand(env.ID, "touch /tmp/installed", "Install something")
+
+		history, err := repo.History(ctx, env.ID)
+		require.NoError(t, err)
+		keepVersion := slices.IndexFunc(history, func(entry repository.HistoryEntry) bool {
+			return entry.Explanation == "Write a file to keep"
+		}) + 1
+		require.Positive(t, keepVersion)
+
+		env, err = repo.Reset(ctx, user.dag, env.ID, keepVersion)
+		require.NoError(t, err)
+		assert.Equal(t, "keep", user.FileRead(env.ID, "keep.txt"))
+		user.FileReadExpectError(env.ID, "mess.txt")
+		stat, err := env.FileStat(ctx, "/tmp/installed", false)
+		require.NoError(t, err)
+		assert.False(t, stat.Exists, "changes outside of the workdir are discarded")
+
+		// The reset is recorded, and the discarded changes stay in the history
+		resetHistory, err := repo.History(ctx, env.ID)
+		require.NoError(t, err)
+		require.Len(t, resetHistory, len(history)+1)
+		assert.Equal(t, "Reset to version "+strconv.Itoa(keepVersion), resetHistory[len(history)].Explanation)
+
+		_, err = repo.Reset(ctx, user.dag, env.ID, 0)
+		require.NoError(t, err)
+		user.FileReadExpectError(env.ID, "keep.txt")
+	})
+}
+
 // TestRepositoryCheckout tests checking out an environment branch
 func TestRepositoryCheckout(t *testing.T) {
 	t.Parallel()
@@ -143,7 +207,7 @@ func TestRepositoryLog(t *testing.T) {
 
 		// Get commit log without patches
 		var logBuf bytes.Buffer
-		err := repo.Log(ctx, env.ID, false, &logBuf)
+		err := repo.Log(ctx, env.ID, false, nil, &logBuf)
 		logOutput := logBuf.String()
 		require.NoError(t, err, logOutput)
 
@@ -154,7 +218,7 @@ func TestRepositoryLog(t *testing.T) {
 
 		// Get commit log with patches
 		logBuf.Reset()
-		err = repo.Log(ctx, env.ID, true, &logBuf)
+		err = repo.Log(ctx, env.ID, true, nil, &logBuf)
 		logWithPatchOutput := logBuf.String()
 		require.NoError(t, err, logWithPatchOutput)
 
@@ -162,8 +226,27 @@ func TestRepositoryLog(t *testing.T) {
 		assert.Contains(t, logWithPatchOutput, "diff --git")
 		assert.Contains(t, logWithPatchOutput, "+updated content")
 
+		// Get commit log of a single file
+		logBuf.Reset()
+		err = repo.Log(ctx, env.ID, true, []string{"file2.txt"}, &logBuf)
+		pathOutput := logBuf.String()
+		require.NoError(t, err, pathOutput)
+		assert.Contains(t, pathOutput, "Add second file")
+		assert.NotContains(t, pathOutput, "Update file")
+		assert.NotContains(t, pathOutput, "+updated content")
+
+		// Only commits made in the time range are shown
+		logBuf.Reset()
+		err = repo.LogWithOptions(ctx, env.ID, repository.LogOptions{Since: time.Now().Add(-time.Hour)}, &logBuf)
+		require.NoError(t, err, logBuf.String())
+		assert.Contains(t, logBuf.String(), "Add second file")
+		logBuf.Reset()
+		err = repo.LogWithOptions(ctx, env.ID, repository.LogOptions{Until: time.Now().Add(-time.Hour)}, &logBuf)
+		require.NoError(t, err, logBuf.String())
+		assert.NotContains(t, logBuf.String(), "Add second file")
+
 		// Test log for non-existent environment
-		err = repo.Log(ctx, "non-existent-env", false, &logBuf)
+		err = repo.Log(ctx, "non-existent-env", false, nil, &logBuf)
 		assert.Error(t, err)
 	})
 }
@@ -197,7 +280,7 @@ func TestRepositoryCreateFromGitRef(t *testing.T) {
 		assert.Contains(t, content, "main content")
 
 		// Test creating environment from feature branch
-		envFromBranch, err := repo.Create(ctx, user.dag, "From Feature", "Environment from feature branch", "feature-branch")
+		envFromBranch, err := repo.Create(ctx, user.dag, "From Feature", "Environment from feature branch", "feature-branch", "")
 		require.NoError(t, err)
 		assert.NotNil(t, envFromBranch)
 
@@ -210,7 +293,7 @@ func TestRepositoryCreateFromGitRef(t *testing.T) {
 		assert.Error(t, err, "main.txt should not exist in feature branch environment")
 
 		// Test creating environment from specific SHA
-		envFromSHA, err := repo.Create(ctx, user.dag, "From SHA", "Environment from initial commit", initialCommitSHA)
+		envFromSHA, err := repo.Create(ctx, user.dag, "From SHA", "Environment from initial commit", initialCommitSHA, "")
 		require.NoError(t, err)
 		assert.NotNil(t, envFromSHA)
 
@@ -226,7 +309,7 @@ func TestRepositoryCreateFromGitRef(t *testing.T) {
 		assert.Error(t, err, "feature.txt should not exist in SHA environment")
 
 		// Test invalid git ref
-		_, err = repo.Create(ctx, user.dag, "Invalid Ref", "Environment from invalid ref", "nonexistent-ref")
+		_, err = repo.Create(ctx, user.dag, "Invalid Ref", "Environment from invalid ref", "nonexistent-ref", "")
 		assert.Error(t, err, "Should fail with invalid git ref")
 	})
 }
@@ -254,6 +337,7 @@ func TestRepositoryWithSubmodule(t *testing.T) {
 			"attempt to write a file to the submodule",
 			"submodule/test.txt",
 			"This should fail",
+			false,
 		))
 
 		assert.NoError(t, repo.Update(ctx, env, "write the env back to the repo"))
@@ -263,6 +347,21 @@ func TestRepositoryWithSubmodule(t *testing.T) {
 		_, statErr := os.Stat(hostSubmoduleTestPath)
 		assert.True(t, os.IsNotExist(statErr), "submodule/test.txt should not exist on the host")
 
+		// Submodule files can be edited explicitly, which is recorded in the notes
+		require.NoError(t, env.FileWrite(
+			ctx,
+			"write a file to the submodule on purpose",
+			"submodule/allowed.txt",
+			"This is allowed",
+			true,
+		))
+		assert.Contains(t, env.Notes.String(), "Write submodule/allowed.txt (within a submodule, not committed)")
+		allowedContent, err := env.FileRead(ctx, "submodule/allowed.txt", true, 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "This is allowed", allowedContent)
+		assert.NoError(t, repo.Update(ctx, env, "write the submodule edit back to the repo"))
+		assert.Equal(t, []string{"submodule"}, env.SkippedSubmodules, "the submodule edit should be reported as not committed")
+
 		// check that the contents of the repo are being cloned into the env
 		checkSubmoduleReadme := func(submodulePath string) {
 			readmeContent, readErr := env.FileRead(ctx, submodulePath+"/README.md", true, 0, 0)
@@ -276,7 +375,7 @@ func TestRepositoryWithSubmodule(t *testing.T) {
 		// Below we document the behavior of env.Run-instigated file writes to submodules.
 		// Ideally, these would error, but practically we don't have an easy way to detect them.
 		// env.Run-instigated submodules writes do not error, but they also do not propagate outwards to the fork repository.
-		_, err := env.Run(ctx, "echo 'content from env_run_cmd' > submodule/test-from-cmd.txt", "sh", false)
+		_, err = env.Run(ctx, "echo 'content from env_run_cmd' > submodule/test-from-cmd.txt", "sh", "", nil, false)
 		require.NoError(t, err, "env_run_cmd should be able to write files in submodules")
 
 		// Verify the file was created inside the container
@@ -319,6 +418,7 @@ func TestRepositoryWithRecursiveSubmodule(t *testing.T) {
 			"attempt to write a file to the submodule",
 			"submodule/test.txt",
 			"This should fail",
+			false,
 		))
 
 		assert.NoError(t, repo.Update(ctx, env, "write the env back to the repo"))
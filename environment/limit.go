@@ -0,0 +1,43 @@
+package environment
+
+import (
+	"context"
+	"log/slog"
+)
+
+// MaxConcurrentOperationsEnv sets how many container operations may run at once, see SetMaxConcurrentOperations.
+const MaxConcurrentOperationsEnv = "CONTAINER_USE_MAX_CONCURRENT_OPERATIONS"
+
+// operationSlots bounds the container operations running at once across environments. Nil means unbounded.
+var operationSlots chan struct{}
+
+// SetMaxConcurrentOperations bounds how many container operations (builds, commands and background
+// processes being started) run at once across all environments. Excess operations wait for a slot.
+// A limit of 0 or less removes the bound. It must be called before any operation runs.
+func SetMaxConcurrentOperations(limit int) {
+	if limit <= 0 {
+		operationSlots = nil
+		return
+	}
+	operationSlots = make(chan struct{}, limit)
+}
+
+// acquireOperation waits for a container operation slot. The returned function releases it.
+func acquireOperation(ctx context.Context) (func(), error) {
+	slots := operationSlots
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		slog.Debug("Waiting for a container operation slot", "limit", cap(slots))
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { <-slots }, nil
+}
@@ -0,0 +1,50 @@
+package environment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireOperation(t *testing.T) {
+	defer SetMaxConcurrentOperations(0)
+
+	t.Run("unbounded", func(t *testing.T) {
+		SetMaxConcurrentOperations(0)
+		for range 10 {
+			_, err := acquireOperation(context.Background())
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		SetMaxConcurrentOperations(2)
+		release1, err := acquireOperation(context.Background())
+		require.NoError(t, err)
+		_, err = acquireOperation(context.Background())
+		require.NoError(t, err)
+
+		// A third operation waits until its context is done
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = acquireOperation(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// and gets a slot once one is released
+		acquired := make(chan struct{})
+		go func() {
+			if _, err := acquireOperation(context.Background()); err == nil {
+				close(acquired)
+			}
+		}()
+		release1()
+		select {
+		case <-acquired:
+		case <-time.After(5 * time.Second):
+			t.Fatal("operation should get the released slot")
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+)
+
+// withMounts mounts the configured host directories into the container.
+// Host directories are snapshotted when mounted: later changes on the host are not picked up until the
+// environment is rebuilt, and writes made in the environment never reach the host.
+func (env *Environment) withMounts(container *dagger.Container) *dagger.Container {
+	for _, mount := range env.State.Config.Mounts {
+		container = container.WithMountedDirectory(mount.Target, env.dag.Host().Directory(mount.Source))
+	}
+	return container
+}
+
+// withoutMounts removes host directories mounted inside the workdir from dir, so they are never committed.
+func (env *Environment) withoutMounts(dir *dagger.Directory) *dagger.Directory {
+	for _, mount := range env.State.Config.Mounts {
+		if rel, ok := strings.CutPrefix(mount.Target, strings.TrimSuffix(env.State.Config.Workdir, "/")+"/"); ok {
+			dir = dir.WithoutDirectory(rel)
+		}
+	}
+	return dir
+}
+
+// Mount makes a host directory available in the environment without adding it to the tracked files.
+// Relative targets are resolved against the workdir.
+func (env *Environment) Mount(ctx context.Context, explanation string, cfg *MountConfig) error {
+	if !filepath.IsAbs(cfg.Source) {
+		return fmt.Errorf("mount source %s must be an absolute path", cfg.Source)
+	}
+	info, err := os.Stat(cfg.Source)
+	if err != nil {
+		return fmt.Errorf("failed to access mount source: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("mount source %s is not a directory", cfg.Source)
+	}
+
+	target := cfg.Target
+	if !path.IsAbs(target) {
+		target = path.Join(env.State.Config.Workdir, target)
+	}
+	target = path.Clean(target)
+	if target == "/" || target == path.Clean(env.State.Config.Workdir) {
+		return fmt.Errorf("cannot mount over %s", target)
+	}
+	if env.State.Config.Mounts.Get(target) != nil {
+		return fmt.Errorf("a directory is already mounted at %s", target)
+	}
+	// Mounting over tracked files would make them look deleted when the workdir is committed
+	exists, err := env.container().Exists(ctx, target)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("mount target %s already exists in the environment", target)
+	}
+
+	mount := &MountConfig{Source: cfg.Source, Target: target}
+	state := env.container().WithMountedDirectory(mount.Target, env.dag.Host().Directory(mount.Source))
+	if err := env.apply(ctx, state); err != nil {
+		return err
+	}
+	env.State.Config.Mounts = append(env.State.Config.Mounts, mount)
+
+	env.Notes.Add("Mount host directory %s at %s\n%s\n\n", mount.Source, mount.Target, explanation)
+
+	return nil
+}
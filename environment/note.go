@@ -18,21 +18,40 @@ func (n *Notes) Add(format string, a ...any) {
 	n.items = append(n.items, fmt.Sprintf(format, a...))
 }
 
+// AddCommand records a command along with its result. The command comes first, prefixed with "$ ", its
+// continuation lines with "> ", followed by "exit N" when it failed and its output. Output lines that could be
+// mistaken for these markers are escaped with a backslash, so that the commands can be parsed back from the log.
 func (n *Notes) AddCommand(command string, exitCode int, stdout, stderr string) {
-	msg := fmt.Sprintf("$ %s", strings.TrimSpace(command))
+	msg := commandNote(command)
 	if exitCode != 0 {
 		msg += fmt.Sprintf("\nexit %d", exitCode)
 	}
 	if strings.TrimSpace(stdout) != "" {
-		msg += fmt.Sprintf("\n%s", stdout)
+		msg += fmt.Sprintf("\n%s", escapeNoteOutput(stdout))
 	}
 	if strings.TrimSpace(stderr) != "" {
-		msg += fmt.Sprintf("\nstderr: %s", stderr)
+		msg += fmt.Sprintf("\nstderr: %s", escapeNoteOutput(stderr))
 	}
 
 	n.Add("%s", msg)
 }
 
+// commandNote formats a command as recorded in notes, see AddCommand.
+func commandNote(command string) string {
+	return "$ " + strings.ReplaceAll(strings.TrimSpace(command), "\n", "\n> ")
+}
+
+// escapeNoteOutput escapes the lines of output starting like the markers of recorded commands, see AddCommand.
+func escapeNoteOutput(output string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "$ ") || strings.HasPrefix(line, "> ") || strings.HasPrefix(line, "exit ") {
+			lines[i] = `\` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (n *Notes) Clear() {
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -56,3 +75,41 @@ func (n *Notes) Pop() string {
 
 	return out
 }
+
+// Operation returns the first line of the oldest pending note, e.g. "Write main.go" or "$ go test ./...".
+func (n *Notes) Operation() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.items) == 0 {
+		return ""
+	}
+	operation, _, _ := strings.Cut(strings.TrimSpace(n.items[0]), "\n")
+	return operation
+}
+
+// CommitMessage formats the message of an environment commit with the configured commit template.
+// The template can reference {explanation}, {operation} (the first operation recorded since the last commit),
+// {environment} (the environment ID) and {title}. Without a template, the explanation is used as is.
+func (env *Environment) CommitMessage(explanation string) string {
+	template := env.State.Config.CommitTemplate
+	if template == "" {
+		return explanation
+	}
+
+	operation := env.Notes.Operation()
+	if operation == "" {
+		operation = explanation
+	}
+	message := strings.NewReplacer(
+		"{explanation}", explanation,
+		"{operation}", operation,
+		"{environment}", env.ID,
+		"{title}", env.State.Title,
+	).Replace(template)
+
+	if strings.TrimSpace(message) == "" {
+		return explanation
+	}
+	return message
+}
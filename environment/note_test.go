@@ -0,0 +1,51 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironmentCommitMessage(t *testing.T) {
+	newEnv := func(template string) *Environment {
+		return &Environment{
+			EnvironmentInfo: &EnvironmentInfo{
+				ID: "fancy-mallard",
+				State: &State{
+					Title:  "User API",
+					Config: &EnvironmentConfig{CommitTemplate: template},
+				},
+			},
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		env := newEnv("")
+		env.Notes.Add("Write %s", "main.go")
+		assert.Equal(t, "Add the main package", env.CommitMessage("Add the main package"))
+	})
+
+	t.Run("template", func(t *testing.T) {
+		env := newEnv("feat({environment}): {operation}\n\n{explanation}\n\n{title}")
+		env.Notes.Add("Write %s", "main.go")
+		env.Notes.AddCommand("go build ./...", 1, "", "build failed")
+		assert.Equal(t, "feat(fancy-mallard): Write main.go\n\nAdd the main package\n\nUser API", env.CommitMessage("Add the main package"))
+	})
+
+	t.Run("multiline operation", func(t *testing.T) {
+		env := newEnv("chore: {operation}")
+		env.Notes.AddCommand("go test ./...", 1, "FAIL", "")
+		assert.Equal(t, "chore: $ go test ./...", env.CommitMessage("Run tests"))
+	})
+
+	t.Run("without operation", func(t *testing.T) {
+		env := newEnv("chore: {operation}")
+		assert.Equal(t, "chore: Run tests", env.CommitMessage("Run tests"))
+	})
+
+	t.Run("empty result", func(t *testing.T) {
+		env := newEnv("{title}")
+		env.State.Title = ""
+		assert.Equal(t, "Run tests", env.CommitMessage("Run tests"))
+	})
+}
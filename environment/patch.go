@@ -0,0 +1,154 @@
+package environment
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// patchHunk is a single hunk of a unified diff, along with the headers of the file it changes,
+// so it can be applied on its own.
+type patchHunk struct {
+	file   string
+	header string
+	hunk   string
+	// index is the position of the hunk among the hunks of its file, starting at 1
+	index int
+}
+
+// patchFilePath returns the path of a file from a `---` or `+++` header line, without its a/ or b/ prefix.
+// Returns an empty path for /dev/null, i.e. created or deleted files.
+func patchFilePath(line string) string {
+	name := strings.TrimSpace(line[4:])
+	// Timestamps are separated by a tab
+	name, _, _ = strings.Cut(name, "\t")
+	if name == "/dev/null" {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(name, "a/"); ok {
+		return rest
+	}
+	if rest, ok := strings.CutPrefix(name, "b/"); ok {
+		return rest
+	}
+	return name
+}
+
+// hunkHeaderPattern matches hunk headers such as `@@ -12,7 +12,8 @@ func main() {`, capturing the line counts.
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// hunkLineCount parses a line count of a hunk header, which defaults to 1 when omitted.
+func hunkLineCount(count string) int {
+	if count == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(count)
+	return n
+}
+
+// splitPatch splits a unified diff into its hunks, and returns the files it changes.
+func splitPatch(patch string) ([]string, []patchHunk, error) {
+	var (
+		files  []string
+		hunks  []patchHunk
+		header strings.Builder
+		file   string
+		hunk   *strings.Builder
+		index  int
+		// oldLines and newLines count the lines of the current hunk left to read
+		oldLines, newLines int
+	)
+	flush := func() {
+		if hunk != nil {
+			index++
+			hunks = append(hunks, patchHunk{file: file, header: header.String(), hunk: hunk.String(), index: index})
+			hunk = nil
+		}
+	}
+
+	lines := strings.SplitAfter(patch, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case hunk != nil && (oldLines > 0 || newLines > 0 || strings.HasPrefix(line, "\\")):
+			// Lines are counted rather than matched, as removed lines may look like file headers
+			hunk.WriteString(line)
+			switch {
+			case strings.HasPrefix(line, "-"):
+				oldLines--
+			case strings.HasPrefix(line, "+"):
+				newLines--
+			case strings.HasPrefix(line, " "), line == "\n":
+				oldLines--
+				newLines--
+			}
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			flush()
+			file = cmp.Or(patchFilePath(lines[i+1]), patchFilePath(line))
+			if file == "" {
+				return nil, nil, fmt.Errorf("invalid patch: missing file name in %q", strings.TrimSpace(line))
+			}
+			files = append(files, file)
+			index = 0
+			header.Reset()
+			header.WriteString(line)
+			header.WriteString(lines[i+1])
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if file == "" {
+				return nil, nil, fmt.Errorf("invalid patch: hunk %q before any file header", strings.TrimSpace(line))
+			}
+			flush()
+			match := hunkHeaderPattern.FindStringSubmatch(line)
+			if match == nil {
+				return nil, nil, fmt.Errorf("invalid patch: malformed hunk header %q", strings.TrimSpace(line))
+			}
+			oldLines, newLines = hunkLineCount(match[1]), hunkLineCount(match[2])
+			hunk = &strings.Builder{}
+			hunk.WriteString(line)
+		default:
+			// Lines outside of hunks, such as `diff --git` or `index` lines, are not needed to apply the patch
+			flush()
+		}
+	}
+	flush()
+
+	if len(hunks) == 0 {
+		return nil, nil, errors.New("invalid patch: no hunks found, expected a unified diff")
+	}
+	return files, hunks, nil
+}
+
+// ApplyPatch applies a unified diff to the workdir, all at once: if any hunk fails to apply, nothing is changed.
+// Paths in the diff are relative to the workdir, with or without git's a/ and b/ prefixes.
+func (env *Environment) ApplyPatch(ctx context.Context, explanation, patch string) error {
+	files, hunks, err := splitPatch(patch)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := env.validateNotSubmoduleFile(file); err != nil {
+			return err
+		}
+	}
+
+	ctr := env.container()
+	workdir := ctr.Directory(".")
+	if err := env.apply(ctx, ctr.WithDirectory(".", workdir.WithPatch(patch))); err != nil {
+		// Find out which hunk is to blame so it can be fixed
+		for _, h := range hunks {
+			if _, hunkErr := workdir.WithPatch(h.header + h.hunk).Sync(ctx); hunkErr != nil {
+				header, _, _ := strings.Cut(h.hunk, "\n")
+				return fmt.Errorf("hunk %d (%s) of %s does not apply: %w", h.index, header, h.file, hunkErr)
+			}
+		}
+		return fmt.Errorf("failed applying patch, skipping git propagation: %w", err)
+	}
+
+	env.Notes.Add("Apply patch to %s", strings.Join(files, ", "))
+	return nil
+}
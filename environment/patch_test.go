@@ -0,0 +1,64 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPatch(t *testing.T) {
+	patch := `diff --git a/main.go b/main.go
+index 3b18e51..a8b1c2d 100644
+--- a/main.go
++++ b/main.go
+@@ -1,2 +1,2 @@
+ package main
+--- removed line that looks like a header
++++ added line that looks like a header
+@@ -10,2 +10,3 @@ func main() {
+ 	fmt.Println("hello")
++	fmt.Println("world")
+ }
+--- /dev/null
++++ b/docs/README.md
+@@ -0,0 +1 @@
++# Docs
+\ No newline at end of file
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-old
+`
+
+	files, hunks, err := splitPatch(patch)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.go", "docs/README.md", "old.txt"}, files)
+	require.Len(t, hunks, 4)
+
+	assert.Equal(t, "main.go", hunks[0].file)
+	assert.Equal(t, 1, hunks[0].index)
+	assert.Equal(t, "--- a/main.go\n+++ b/main.go\n", hunks[0].header)
+	assert.Equal(t, "@@ -1,2 +1,2 @@\n package main\n--- removed line that looks like a header\n+++ added line that looks like a header\n", hunks[0].hunk)
+
+	assert.Equal(t, 2, hunks[1].index)
+	assert.Equal(t, "@@ -10,2 +10,3 @@ func main() {\n \tfmt.Println(\"hello\")\n+\tfmt.Println(\"world\")\n }\n", hunks[1].hunk)
+
+	assert.Equal(t, "docs/README.md", hunks[2].file)
+	assert.Equal(t, 1, hunks[2].index)
+	assert.Equal(t, "@@ -0,0 +1 @@\n+# Docs\n\\ No newline at end of file\n", hunks[2].hunk)
+
+	assert.Equal(t, "old.txt", hunks[3].file)
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, patch := range []string{
+			"",
+			"not a patch",
+			"@@ -1 +1 @@\n-a\n+b\n",
+			"--- a/main.go\n+++ b/main.go\n@@ oops @@\n",
+		} {
+			_, _, err := splitPatch(patch)
+			assert.Error(t, err, patch)
+		}
+	})
+}
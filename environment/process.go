@@ -0,0 +1,427 @@
+package environment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// processDir is where background processes write their output inside the environment.
+// It's backed by a cache volume shared between the process container and the containers used to read logs.
+const processDir = "/cu/processes"
+
+// Process is a command running in the background of an environment.
+type Process struct {
+	ID        string           `json:"id"`
+	Command   string           `json:"command"`
+	StartedAt time.Time        `json:"started_at"`
+	Endpoints EndpointMappings `json:"endpoints,omitempty"`
+
+	svc     *dagger.Service
+	tunnels []*dagger.Service
+}
+
+func (p *Process) logPath() string {
+	return path.Join(processDir, p.ID+".log")
+}
+
+func (p *Process) exitCodePath() string {
+	return path.Join(processDir, p.ID+".exit")
+}
+
+// processRegistry tracks background processes of all environments.
+// Background services live as long as the dagger session, which outlives the Environment
+// objects loaded for each operation, so processes are tracked per server process rather than per Environment.
+type processRegistry struct {
+	mu        sync.Mutex
+	lastID    int
+	processes map[string][]*Process
+	// publishDir is where the registry is written for other commands to read, see PublishProcesses
+	publishDir string
+}
+
+var processes = &processRegistry{
+	processes: map[string][]*Process{},
+}
+
+func (r *processRegistry) nextID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastID++
+	return strconv.Itoa(r.lastID)
+}
+
+func (r *processRegistry) add(envID string, p *Process) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processes[envID] = append(r.processes[envID], p)
+	r.publish()
+}
+
+func (r *processRegistry) list(envID string) []*Process {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.processes[envID])
+}
+
+func (r *processRegistry) get(envID, id string) (*Process, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.processes[envID] {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("process %s not found in environment %s", id, envID)
+}
+
+func (r *processRegistry) remove(envID, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processes[envID] = slices.DeleteFunc(r.processes[envID], func(p *Process) bool {
+		return p.ID == id
+	})
+	if len(r.processes[envID]) == 0 {
+		delete(r.processes, envID)
+	}
+	r.publish()
+}
+
+// publishedProcesses is the registry of a server process as written to its publish directory.
+type publishedProcesses struct {
+	PID       int                   `json:"pid"`
+	Processes map[string][]*Process `json:"processes"`
+}
+
+func (r *processRegistry) publishPath() string {
+	return filepath.Join(r.publishDir, strconv.Itoa(os.Getpid())+".json")
+}
+
+// publish writes the registry to the publish directory, if any. Callers must hold the lock.
+// Failures are only logged: the registry is published for the user's convenience, processes run regardless.
+func (r *processRegistry) publish() {
+	if r.publishDir == "" {
+		return
+	}
+	if err := r.writePublished(); err != nil {
+		slog.Warn("Failed to publish background processes", "dir", r.publishDir, "err", err)
+	}
+}
+
+func (r *processRegistry) writePublished() error {
+	if len(r.processes) == 0 {
+		if err := os.Remove(r.publishPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(publishedProcesses{PID: os.Getpid(), Processes: r.processes})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.publishDir, 0755); err != nil {
+		return err
+	}
+	// Write then rename, so that readers never see a partially written file
+	tmp, err := os.CreateTemp(r.publishDir, ".processes-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.publishPath())
+}
+
+// PublishProcesses makes the background processes started by this server process visible to other commands,
+// by writing them to a file of dir as they start and stop. See ListPublishedProcesses.
+func PublishProcesses(dir string) {
+	processes.mu.Lock()
+	defer processes.mu.Unlock()
+	processes.publishDir = dir
+	processes.publish()
+}
+
+// unpublishProcesses removes the published registry of this server process once its processes are stopped.
+func unpublishProcesses() {
+	processes.mu.Lock()
+	defer processes.mu.Unlock()
+	if processes.publishDir == "" {
+		return
+	}
+	if err := os.Remove(processes.publishPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to unpublish background processes", "dir", processes.publishDir, "err", err)
+	}
+}
+
+// ListPublishedProcesses returns the background processes published to dir by running servers, by environment ID.
+// Registries left behind by servers that are no longer running are skipped, as their processes stopped with them.
+func ListPublishedProcesses(dir string) (map[string][]*Process, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string][]*Process{}, nil
+		}
+		return nil, err
+	}
+
+	all := map[string][]*Process{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue // the server stopped in the meantime
+			}
+			return nil, err
+		}
+		var published publishedProcesses
+		if err := json.Unmarshal(data, &published); err != nil {
+			return nil, fmt.Errorf("invalid process registry %s: %w", entry.Name(), err)
+		}
+		if !processAlive(published.PID) {
+			continue
+		}
+		for envID, envProcesses := range published.Processes {
+			all[envID] = append(all[envID], envProcesses...)
+		}
+	}
+	return all, nil
+}
+
+func (env *Environment) processCache() *dagger.CacheVolume {
+	return env.dag.CacheVolume("container-use-processes-" + env.ID)
+}
+
+// wrapProcessCommand captures the output of a background command in its log file and records its exit code.
+// Output is still forwarded to stdout so failures to start are reported as usual.
+func wrapProcessCommand(p *Process, command string) string {
+	return fmt.Sprintf("{ (\n%s\n) 2>&1; echo $? >%s; } | tee %s\nexit \"$(cat %s)\"",
+		command, p.exitCodePath(), p.logPath(), p.exitCodePath())
+}
+
+// readProcessFile reads a file written by a background process.
+// Missing files read as empty since processes may not have produced them yet.
+func (env *Environment) readProcessFile(ctx context.Context, filePath string) (string, error) {
+	return env.processShell(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", filePath))
+}
+
+// processShell runs script with access to the files written by background processes.
+func (env *Environment) processShell(ctx context.Context, script string) (string, error) {
+	return env.container().
+		WithMountedCache(processDir, env.processCache()).
+		WithEnvVariable("CONTAINER_USE_CACHE_BUSTER", time.Now().String()).
+		WithExec([]string{"sh", "-c", script}).
+		Stdout(ctx)
+}
+
+// Processes returns the background processes started in this environment.
+func (env *Environment) Processes() []*Process {
+	return processes.list(env.ID)
+}
+
+// ProcessLogs returns the combined stdout and stderr captured from a background process.
+func (env *Environment) ProcessLogs(ctx context.Context, id string) (string, error) {
+	p, err := processes.get(env.ID, id)
+	if err != nil {
+		return "", err
+	}
+	return env.readProcessFile(ctx, p.logPath())
+}
+
+// ProcessOutput is the output a background process produced since a cursor.
+type ProcessOutput struct {
+	Output string `json:"output"`
+	// Cursor is passed to the next ProcessOutputSince call to only get the output produced after this one
+	Cursor int `json:"cursor"`
+	// Exited is set once the process finished, after which it won't produce any more output
+	Exited   bool `json:"exited"`
+	ExitCode int  `json:"exit_code,omitempty"`
+}
+
+// ProcessOutputSince returns the combined stdout and stderr a background process produced after cursor,
+// a byte offset in its output returned by a previous call, or 0 to read from the start.
+func (env *Environment) ProcessOutputSince(ctx context.Context, id string, cursor int) (*ProcessOutput, error) {
+	p, err := processes.get(env.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if cursor < 0 {
+		return nil, fmt.Errorf("invalid cursor %d", cursor)
+	}
+	// The exit code is read first: once it's written, the output it's read along with is complete
+	raw, err := env.processShell(ctx, fmt.Sprintf("echo \"$(cat %s 2>/dev/null)\"; tail -c +%d %s 2>/dev/null || true",
+		p.exitCodePath(), cursor+1, p.logPath()))
+	if err != nil {
+		return nil, err
+	}
+	return parseProcessOutput(raw, cursor)
+}
+
+// parseProcessOutput parses the exit code line and output read by ProcessOutputSince.
+func parseProcessOutput(raw string, cursor int) (*ProcessOutput, error) {
+	exitCode, output, _ := strings.Cut(raw, "\n")
+	out := &ProcessOutput{
+		Output: output,
+		Cursor: cursor + len(output),
+	}
+	if exitCode = strings.TrimSpace(exitCode); exitCode != "" {
+		code, err := strconv.Atoi(exitCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exit code %q: %w", exitCode, err)
+		}
+		out.Exited = true
+		out.ExitCode = code
+	}
+	return out, nil
+}
+
+// StopProcess stops a background process along with the host tunnels exposing its ports.
+func (env *Environment) StopProcess(ctx context.Context, id string) error {
+	p, err := processes.get(env.ID, id)
+	if err != nil {
+		return err
+	}
+
+	for _, tunnel := range p.tunnels {
+		if _, err := tunnel.Stop(ctx); err != nil {
+			return fmt.Errorf("failed to stop tunnel for process %s: %w", id, err)
+		}
+		started.remove(tunnel)
+	}
+	if _, err := p.svc.Stop(ctx); err != nil {
+		return fmt.Errorf("failed to stop process %s: %w", id, err)
+	}
+	started.remove(p.svc)
+	processes.remove(env.ID, id)
+
+	env.Notes.Add("Stop background process %s: %s", id, p.Command)
+
+	return nil
+}
+
+// stopProcessServices tears down a process that could not be fully started, ignoring errors:
+// the failure that got us here is the one worth reporting.
+func stopProcessServices(ctx context.Context, p *Process) {
+	for _, tunnel := range p.tunnels {
+		_, _ = tunnel.Stop(ctx)
+		started.remove(tunnel)
+	}
+	_, _ = p.svc.Stop(ctx)
+	started.remove(p.svc)
+}
+
+// ReadinessCheck describes how to tell that a background process is ready to serve requests.
+type ReadinessCheck struct {
+	// Port waits for an exposed port of the process to accept connections
+	Port int
+	// HealthCheck is a command run in the environment that must succeed.
+	// The process is reachable from it at $CONTAINER_USE_PROCESS_HOST.
+	HealthCheck string
+	Timeout     time.Duration
+}
+
+// WaitReady polls a background process until it passes the readiness check or the timeout elapses.
+// Returns how long the process took to become ready.
+func (env *Environment) WaitReady(ctx context.Context, id string, check ReadinessCheck) (time.Duration, error) {
+	p, err := processes.get(env.ID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var ready func(ctx context.Context) (bool, error)
+	switch {
+	case check.HealthCheck != "":
+		hostname, err := p.svc.Hostname(ctx)
+		if err != nil {
+			return 0, err
+		}
+		container := env.container().
+			WithServiceBinding(hostname, p.svc).
+			WithEnvVariable("CONTAINER_USE_PROCESS_HOST", hostname)
+		ready = func(ctx context.Context) (bool, error) {
+			exitCode, err := container.
+				WithEnvVariable("CONTAINER_USE_CACHE_BUSTER", time.Now().String()).
+				WithExec([]string{"sh", "-c", check.HealthCheck}, dagger.ContainerWithExecOpts{
+					Expect: dagger.ReturnTypeAny,
+				}).
+				ExitCode(ctx)
+			return exitCode == 0, err
+		}
+	case check.Port != 0:
+		endpoint, ok := p.Endpoints[check.Port]
+		if !ok {
+			return 0, fmt.Errorf("port %d is not exposed by process %s", check.Port, id)
+		}
+		u, err := url.Parse(endpoint.HostExternal)
+		if err != nil {
+			return 0, fmt.Errorf("invalid endpoint %q: %w", endpoint.HostExternal, err)
+		}
+		ready = func(context.Context) (bool, error) {
+			return portAccepting(u.Host), nil
+		}
+	default:
+		return 0, errors.New("either a port or a health check is required")
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+	for {
+		ok, err := ready(ctx)
+		if ok {
+			return time.Since(start), nil
+		}
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("process %s not ready after %s", id, check.Timeout)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("process %s not ready after %s", id, check.Timeout)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// portAccepting reports whether a connection to addr is served.
+// Host tunnels accept connections even when nothing listens behind them yet and close them right away,
+// so a connection is only considered served if it stays open or receives data.
+func portAccepting(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+		return false
+	}
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	return err == nil || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,149 @@
+package environment
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessRegistry(t *testing.T) {
+	registry := &processRegistry{processes: map[string][]*Process{}}
+
+	first := &Process{ID: registry.nextID(), Command: "npm run dev"}
+	second := &Process{ID: registry.nextID(), Command: "python -m http.server"}
+	assert.NotEqual(t, first.ID, second.ID)
+
+	registry.add("env-a", first)
+	registry.add("env-a", second)
+	registry.add("env-b", &Process{ID: registry.nextID(), Command: "sleep 1000"})
+
+	assert.Len(t, registry.list("env-a"), 2)
+	assert.Len(t, registry.list("env-b"), 1)
+	assert.Empty(t, registry.list("env-c"))
+
+	p, err := registry.get("env-a", second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "python -m http.server", p.Command)
+
+	_, err = registry.get("env-b", first.ID)
+	assert.ErrorContains(t, err, "not found")
+
+	registry.remove("env-a", first.ID)
+	processes := registry.list("env-a")
+	require.Len(t, processes, 1)
+	assert.Equal(t, second.ID, processes[0].ID)
+}
+
+func TestParseProcessOutput(t *testing.T) {
+	t.Run("running", func(t *testing.T) {
+		out, err := parseProcessOutput("\nbuilding...\n", 10)
+		require.NoError(t, err)
+		assert.Equal(t, &ProcessOutput{Output: "building...\n", Cursor: 22}, out)
+	})
+
+	t.Run("no new output", func(t *testing.T) {
+		out, err := parseProcessOutput("\n", 22)
+		require.NoError(t, err)
+		assert.Equal(t, &ProcessOutput{Cursor: 22}, out)
+	})
+
+	t.Run("exited", func(t *testing.T) {
+		out, err := parseProcessOutput("2\nFAIL\n", 22)
+		require.NoError(t, err)
+		assert.Equal(t, &ProcessOutput{Output: "FAIL\n", Cursor: 27, Exited: true, ExitCode: 2}, out)
+	})
+
+	t.Run("invalid exit code", func(t *testing.T) {
+		_, err := parseProcessOutput("oops\n", 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestPortAccepting(t *testing.T) {
+	serve := func(t *testing.T, handle func(net.Conn)) string {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { listener.Close() })
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				handle(conn)
+			}
+		}()
+		return listener.Addr().String()
+	}
+
+	t.Run("served", func(t *testing.T) {
+		addr := serve(t, func(conn net.Conn) {
+			t.Cleanup(func() { conn.Close() })
+		})
+		assert.True(t, portAccepting(addr))
+	})
+
+	t.Run("sends_data", func(t *testing.T) {
+		addr := serve(t, func(conn net.Conn) {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		})
+		assert.True(t, portAccepting(addr))
+	})
+
+	t.Run("closed_immediately", func(t *testing.T) {
+		addr := serve(t, func(conn net.Conn) {
+			conn.Close()
+		})
+		assert.False(t, portAccepting(addr))
+	})
+
+	t.Run("nothing_listening", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		listener.Close()
+		assert.False(t, portAccepting(addr))
+	})
+}
+
+func TestPublishedProcesses(t *testing.T) {
+	dir := t.TempDir()
+	registry := &processRegistry{processes: map[string][]*Process{}, publishDir: dir}
+
+	running, err := ListPublishedProcesses(dir)
+	require.NoError(t, err)
+	assert.Empty(t, running)
+
+	registry.add("env-a", &Process{ID: "1", Command: "npm run dev", Endpoints: EndpointMappings{
+		3000: {EnvironmentInternal: "tcp://10.0.0.2:3000", HostExternal: "127.0.0.1:53124"},
+	}})
+	registry.add("env-b", &Process{ID: "2", Command: "sleep 1000"})
+
+	running, err = ListPublishedProcesses(dir)
+	require.NoError(t, err)
+	require.Len(t, running["env-a"], 1)
+	assert.Equal(t, "127.0.0.1:53124", running["env-a"][0].Endpoints[3000].HostExternal)
+	require.Len(t, running["env-b"], 1)
+
+	// Registries of servers that exited are ignored
+	stale, err := json.Marshal(publishedProcesses{PID: math.MaxInt32, Processes: map[string][]*Process{"env-c": {{ID: "1"}}}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2147483647.json"), stale, 0644))
+	running, err = ListPublishedProcesses(dir)
+	require.NoError(t, err)
+	assert.NotContains(t, running, "env-c")
+
+	registry.remove("env-a", "1")
+	registry.remove("env-b", "2")
+	running, err = ListPublishedProcesses(dir)
+	require.NoError(t, err)
+	assert.Empty(t, running)
+	assert.NoFileExists(t, registry.publishPath())
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package environment
+
+import "syscall"
+
+// processAlive tells whether a process with the given PID is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	// EPERM means the process exists but belongs to another user
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package environment
+
+import "os"
+
+// processAlive tells whether a process with the given PID is running.
+// On Windows, finding a process opens a handle to it, which fails once it exited.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
@@ -0,0 +1,65 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/Khan/genqlient/graphql"
+)
+
+const syncAttempts = 3
+
+// syncBackoff is a variable so tests don't have to wait
+var syncBackoff = 2 * time.Second
+
+// syncWithRetries evaluates a container, retrying transient failures with backoff, see isTransient. Other
+// failures, like failing commands or missing images, would fail the same way.
+func syncWithRetries(ctx context.Context, container *dagger.Container) (*dagger.Container, error) {
+	return retry(ctx, func() (*dagger.Container, error) {
+		return container.Sync(ctx)
+	})
+}
+
+func retry[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	backoff := syncBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt == syncAttempts || !isTransient(err) || ctx.Err() != nil {
+			return result, err
+		}
+
+		slog.Warn("Failed to sync container, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether an error comes from reaching the engine rather than from what it was asked to do:
+// timeouts, connection errors and server errors of the engine.
+func isTransient(err error) bool {
+	var execErr *dagger.ExecError
+	if errors.As(err, &execErr) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var httpErr *graphql.HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= http.StatusInternalServerError
+}
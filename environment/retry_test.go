@@ -0,0 +1,77 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/Khan/genqlient/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	originalBackoff := syncBackoff
+	t.Cleanup(func() { syncBackoff = originalBackoff })
+	syncBackoff = time.Millisecond
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		attempts := 0
+		result, err := retry(context.Background(), func() (string, error) {
+			attempts++
+			if attempts < 3 {
+				return "", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+			}
+			return "ok", nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", result)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		attempts := 0
+		_, err := retry(context.Background(), func() (string, error) {
+			attempts++
+			return "", &graphql.HTTPError{StatusCode: http.StatusBadGateway}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, syncAttempts, attempts)
+	})
+
+	t.Run("doesn't retry failing commands", func(t *testing.T) {
+		attempts := 0
+		_, err := retry(context.Background(), func() (string, error) {
+			attempts++
+			return "", &dagger.ExecError{ExitCode: 1}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("doesn't retry other errors", func(t *testing.T) {
+		attempts := 0
+		_, err := retry(context.Background(), func() (string, error) {
+			attempts++
+			return "", errors.New("pull access denied for acme/missing")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("stops when canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempts := 0
+		_, err := retry(ctx, func() (string, error) {
+			attempts++
+			return "", context.DeadlineExceeded
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
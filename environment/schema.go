@@ -0,0 +1,76 @@
+package environment
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/invopop/jsonschema"
+)
+
+// configFieldDescriptions documents configuration fields in the JSON Schema, keyed by type and field name.
+var configFieldDescriptions = map[string]string{
+	"EnvironmentConfig.Workdir":          "Absolute path of the directory the repository is checked out to in the container.",
+	"EnvironmentConfig.BaseImage":        "Image environments are built from, e.g. `ubuntu:24.04`.",
+	"EnvironmentConfig.Dockerfile":       "Dockerfile to build environments from instead of base_image, relative to the repository root.",
+	"EnvironmentConfig.BuildContext":     "Build context of the Dockerfile, relative to the repository root. Defaults to the repository root.",
+	"EnvironmentConfig.BuildArgs":        "Dockerfile build arguments in the KEY=VALUE format.",
+	"EnvironmentConfig.SetupCommands":    "Commands run when building the environment, before the repository is added. Use them to install tools.",
+	"EnvironmentConfig.SetupScript":      "Script run as a single setup step after setup_commands, relative to the repository root. Defaults to .container-use/setup.sh when it is committed in the source the environment is created from.",
+	"EnvironmentConfig.InstallCommands":  "Commands run after the repository is added, e.g. to install dependencies.",
+	"EnvironmentConfig.Env":              "Environment variables in the KEY=VALUE format.",
+	"EnvironmentConfig.Secrets":          "Secrets in the KEY=REFERENCE format, e.g. `API_KEY=env://API_KEY` or `op://vault/item/field`.",
+	"EnvironmentConfig.Services":         "Services started alongside the environment, reachable at their name.",
+	"EnvironmentConfig.Mounts":           "Host directories mounted into the environment. They are never committed.",
+	"EnvironmentConfig.IncludeGitDir":    "Keep the .git directory, with the full history, in new environments so git commands like log, blame or bisect work. Off by default, as the history can be large.",
+	"EnvironmentConfig.SourcePaths":      "Paths of the repository new environments are limited to, e.g. `services/api` in a monorepo, to keep them small and fast to build. They keep their place in the workdir. Defaults to the whole repository.",
+	"EnvironmentConfig.DetectSource":     "Detect the language of the source of new environments from go.mod, pyproject.toml or package.json, defaulting the workdir to the language's convention and suggesting a base image. A configured workdir is kept.",
+	"EnvironmentConfig.DefaultShell":     "Shell interpreting commands when none is given, including install commands, e.g. `bash`. Setup commands and the setup script always run with `sh`, so they can install it. Defaults to `sh`.",
+	"EnvironmentConfig.LoginShell":       "Run commands in login shells (e.g. `bash -lc`), which read /etc/profile and ~/.profile, so tools set up by shell profiles are found.",
+	"EnvironmentConfig.ExtraHosts":       "Hostnames reachable from the environment, like `--add-host`, e.g. for internal services only the host can resolve.",
+	"EnvironmentConfig.CommitTemplate":   "Format of environment commit messages, e.g. `feat(env): {operation}`. Supports {explanation}, {operation}, {environment} and {title}. Defaults to the explanation.",
+	"EnvironmentConfig.CommitAuthor":     "Identity environment commits and notes are made with, e.g. `Agent <agent@example.com>`, to tell them apart from your commits in log and blame. Defaults to your git identity.",
+	"EnvironmentConfig.CommitIgnore":     "Glob patterns of files never committed to environments, on top of .gitignore, e.g. `.cache/` or `*.log`. Patterns without a slash match file and directory names anywhere.",
+	"EnvironmentConfig.BinaryFilePolicy": "Whether binary files are committed to environments: `skip` (default) leaves them out and reports them, `commit` commits them, `lfs` commits them with Git LFS.",
+	"ServiceConfig.Name":                 "Hostname the service is reachable at from the environment.",
+	"ServiceConfig.Image":                "Image the service runs.",
+	"ServiceConfig.Command":              "Command to run instead of the image's default command.",
+	"ServiceConfig.ExposedPorts":         "Ports exposed by the service.",
+	"ServiceConfig.Env":                  "Environment variables of the service in the KEY=VALUE format.",
+	"ExtraHost.Hostname":                 "Hostname the environment reaches the host at, e.g. `registry.corp.internal`.",
+	"ExtraHost.Address":                  "IP address or hostname the ports are forwarded to, as reached from the machine running container-use.",
+	"ExtraHost.Ports":                    "TCP ports forwarded to the address. Only these ports are reachable: hostnames can't be mapped to an address without ports.",
+	"MountConfig.Source":                 "Absolute path of the directory on the host.",
+	"MountConfig.Target":                 "Absolute path the directory is mounted at in the container.",
+}
+
+// ConfigSchema returns the JSON Schema of the environment configuration file.
+// It is generated from EnvironmentConfig, so it always matches the fields the configuration supports.
+func ConfigSchema() ([]byte, error) {
+	r := &jsonschema.Reflector{
+		ExpandedStruct: true,
+		LookupComment: func(t reflect.Type, field string) string {
+			if field == "" {
+				return ""
+			}
+			return configFieldDescriptions[t.Name()+"."+field]
+		},
+		// Allow configuration files to reference the schema
+		AdditionalFields: func(t reflect.Type) []reflect.StructField {
+			if t != reflect.TypeOf(EnvironmentConfig{}) {
+				return nil
+			}
+			return []reflect.StructField{{
+				Name: "Schema",
+				Type: reflect.TypeOf(""),
+				Tag:  `json:"$schema,omitempty" jsonschema_description:"JSON Schema of this file."`,
+			}}
+		},
+	}
+
+	schema := r.Reflect(&EnvironmentConfig{})
+	schema.ID = ""
+	schema.Title = "container-use environment configuration"
+	schema.Description = "Configuration of new environments, stored in .container-use/environment.json."
+
+	return json.MarshalIndent(schema, "", "  ")
+}
@@ -0,0 +1,56 @@
+package environment
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSchema(t *testing.T) {
+	data, err := ConfigSchema()
+	require.NoError(t, err)
+
+	var schema struct {
+		Properties map[string]struct {
+			Description string `json:"description"`
+		} `json:"properties"`
+		AdditionalProperties bool `json:"additionalProperties"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	assert.False(t, schema.AdditionalProperties)
+	assert.Contains(t, schema.Properties, "$schema")
+
+	// Every configuration field is described
+	configType := reflect.TypeOf(EnvironmentConfig{})
+	for i := range configType.NumField() {
+		name, _, _ := strings.Cut(configType.Field(i).Tag.Get("json"), ",")
+		if assert.Contains(t, schema.Properties, name) {
+			assert.NotEmpty(t, schema.Properties[name].Description, "missing description for %s", name)
+		}
+	}
+}
+
+func TestEnvironmentConfig_SavePreservesSchema(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, configDir, environmentFile)
+	require.NoError(t, os.MkdirAll(filepath.Dir(configPath), 0755))
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"$schema": "./environment.schema.json", "base_image": "alpine:3"}`), 0600))
+
+	config := DefaultConfig()
+	require.NoError(t, config.Load(dir))
+	assert.Equal(t, "alpine:3", config.BaseImage)
+
+	config.BaseImage = "golang:1.24"
+	require.NoError(t, config.Save(dir))
+
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"$schema": "./environment.schema.json"`)
+	assert.Contains(t, string(data), `"base_image": "golang:1.24"`)
+}
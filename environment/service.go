@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"dagger.io/dagger"
@@ -11,8 +13,12 @@ import (
 
 var (
 	serviceStartTimeout = 30 * time.Second
+	tunnelStartTimeout  = 30 * time.Second
 )
 
+// HostServiceAlias is the hostname at which host services listening on loopback are reachable from environments.
+const HostServiceAlias = "host.container-use.internal"
+
 type Service struct {
 	Config    *ServiceConfig   `json:"config"`
 	Endpoints EndpointMappings `json:"endpoints"`
@@ -46,10 +52,6 @@ func (env *Environment) startService(ctx context.Context, cfg *ServiceConfig) (*
 		return nil, err
 	}
 
-	if cfg.Command != "" {
-		container = container.WithExec([]string{"sh", "-c", cfg.Command})
-	}
-
 	args := []string{}
 	if cfg.Command != "" {
 		args = []string{"sh", "-c", cfg.Command}
@@ -81,6 +83,8 @@ func (env *Environment) startService(ctx context.Context, cfg *ServiceConfig) (*
 		return nil, err
 	}
 
+	started.track(ctx, svc)
+
 	endpoints := EndpointMappings{}
 	for _, port := range cfg.ExposedPorts {
 		endpoint := &EndpointMapping{
@@ -89,24 +93,9 @@ func (env *Environment) startService(ctx context.Context, cfg *ServiceConfig) (*
 		endpoints[port] = endpoint
 
 		// Expose ports on the host
-		tunnel, err := env.dag.Host().Tunnel(svc, dagger.HostTunnelOpts{
-			Ports: []dagger.PortForward{
-				{
-					Backend:  port,
-					Frontend: 0,
-					Protocol: dagger.NetworkProtocolTcp,
-				},
-			},
-		}).Start(ctx)
+		_, externalEndpoint, err := env.startTunnel(ctx, svc, port)
 		if err != nil {
-			return nil, err
-		}
-
-		externalEndpoint, err := tunnel.Endpoint(ctx, dagger.ServiceEndpointOpts{
-			Scheme: "tcp",
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to get endpoint for service %s: %w", cfg.Name, err)
+			return nil, fmt.Errorf("service %s: %w", cfg.Name, err)
 		}
 		endpoint.HostExternal = externalEndpoint
 	}
@@ -118,6 +107,38 @@ func (env *Environment) startService(ctx context.Context, cfg *ServiceConfig) (*
 	}, nil
 }
 
+// startTunnel exposes port of svc on the host, returning the tunnel and its host endpoint.
+// Tunnels that cannot be established within tunnelStartTimeout are given up on.
+func (env *Environment) startTunnel(ctx context.Context, svc *dagger.Service, port int) (*dagger.Service, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, tunnelStartTimeout)
+	defer cancel()
+
+	tunnel, err := env.dag.Host().Tunnel(svc, dagger.HostTunnelOpts{
+		Ports: []dagger.PortForward{
+			{
+				Backend:  port,
+				Protocol: dagger.NetworkProtocolTcp,
+			},
+		},
+	}).Start(ctx)
+	if err == nil {
+		var endpoint string
+		endpoint, err = tunnel.Endpoint(ctx, dagger.ServiceEndpointOpts{
+			Scheme: "tcp",
+		})
+		if err == nil {
+			started.track(ctx, tunnel)
+			return tunnel, endpoint, nil
+		}
+		// Don't leave a half-established tunnel behind
+		_, _ = tunnel.Stop(context.WithoutCancel(ctx))
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, "", fmt.Errorf("failed to establish tunnel for port %d within %s timeout", port, tunnelStartTimeout)
+	}
+	return nil, "", fmt.Errorf("failed to establish tunnel for port %d: %w", port, err)
+}
+
 func (env *Environment) AddService(ctx context.Context, explanation string, cfg *ServiceConfig) (*Service, error) {
 	if env.State.Config.Services.Get(cfg.Name) != nil {
 		return nil, fmt.Errorf("service %s already exists", cfg.Name)
@@ -138,3 +159,63 @@ func (env *Environment) AddService(ctx context.Context, explanation string, cfg
 
 	return svc, nil
 }
+
+// HostService is a TCP service running on the host that is exposed to environments.
+type HostService struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+// ParseHostService parses a host:port specification.
+func ParseHostService(spec string) (*HostService, error) {
+	host, port, err := net.SplitHostPort(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host service %q: %w", spec, err)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid host service %q: missing host", spec)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum <= 0 || portNum > 65535 {
+		return nil, fmt.Errorf("invalid host service %q: invalid port %q", spec, port)
+	}
+	return &HostService{Host: host, Port: portNum}, nil
+}
+
+// Alias returns the hostname the service is reachable at from inside the environment.
+// Services on the host's loopback interface are exposed as HostServiceAlias, others keep their hostname.
+func (h *HostService) Alias() string {
+	if h.Host == "localhost" {
+		return HostServiceAlias
+	}
+	if ip := net.ParseIP(h.Host); ip != nil && ip.IsLoopback() {
+		return HostServiceAlias
+	}
+	return h.Host
+}
+
+// withHostServices binds the configured host services to the container.
+// Services sharing an alias are forwarded through a single host service so they don't shadow each other.
+func (env *Environment) withHostServices(container *dagger.Container) *dagger.Container {
+	aliases := []string{}
+	hosts := map[string]string{}
+	ports := map[string][]dagger.PortForward{}
+	for _, hs := range env.HostServices {
+		alias := hs.Alias()
+		if _, ok := ports[alias]; !ok {
+			aliases = append(aliases, alias)
+			hosts[alias] = hs.Host
+		}
+		ports[alias] = append(ports[alias], dagger.PortForward{
+			Frontend: hs.Port,
+			Backend:  hs.Port,
+			Protocol: dagger.NetworkProtocolTcp,
+		})
+	}
+
+	for _, alias := range aliases {
+		svc := env.dag.Host().Service(ports[alias], dagger.HostServiceOpts{Host: hosts[alias]})
+		container = container.WithServiceBinding(alias, svc)
+	}
+	return container
+}
@@ -0,0 +1,41 @@
+package environment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostService(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expectError bool
+		expectHost  string
+		expectPort  int
+		expectAlias string
+	}{
+		{spec: "localhost:5432", expectHost: "localhost", expectPort: 5432, expectAlias: HostServiceAlias},
+		{spec: "127.0.0.1:8080", expectHost: "127.0.0.1", expectPort: 8080, expectAlias: HostServiceAlias},
+		{spec: "[::1]:6379", expectHost: "::1", expectPort: 6379, expectAlias: HostServiceAlias},
+		{spec: "db.local:3306", expectHost: "db.local", expectPort: 3306, expectAlias: "db.local"},
+		{spec: "localhost", expectError: true},
+		{spec: ":5432", expectError: true},
+		{spec: "localhost:http", expectError: true},
+		{spec: "localhost:70000", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			hs, err := ParseHostService(tt.spec)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectHost, hs.Host)
+			assert.Equal(t, tt.expectPort, hs.Port)
+			assert.Equal(t, tt.expectAlias, hs.Alias())
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package environment
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"dagger.io/dagger"
+)
+
+// startedServices tracks the services and host tunnels started by this server process, so that none are
+// left running once it exits. Dagger services outlive the operation that started them.
+type startedServices struct {
+	mu       sync.Mutex
+	services []*dagger.Service
+	// ids holds the IDs of the services, which are the same when a service is started again, e.g. by rebuilds
+	ids []dagger.ServiceID
+}
+
+var started = &startedServices{}
+
+// track adds a started service, unless it is already tracked.
+func (s *startedServices) track(ctx context.Context, svc *dagger.Service) {
+	id, err := svc.ID(ctx)
+	if err != nil {
+		slog.Warn("Failed to identify started service", "error", err)
+	}
+	s.add(svc, id)
+}
+
+func (s *startedServices) add(svc *dagger.Service, id dagger.ServiceID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != "" && slices.Contains(s.ids, id) {
+		return
+	}
+	s.services = append(s.services, svc)
+	s.ids = append(s.ids, id)
+}
+
+func (s *startedServices) remove(svc *dagger.Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.Index(s.services, svc); i >= 0 {
+		s.services = slices.Delete(s.services, i, i+1)
+		s.ids = slices.Delete(s.ids, i, i+1)
+	}
+}
+
+// Shutdown stops the services, background processes and host tunnels started by this process,
+// most recent first so that tunnels are closed before the services they expose.
+func Shutdown(ctx context.Context) error {
+	started.mu.Lock()
+	services := started.services
+	started.services, started.ids = nil, nil
+	started.mu.Unlock()
+	defer unpublishProcesses()
+
+	if len(services) > 0 {
+		slog.Info("Stopping services", "count", len(services))
+	}
+	var errs []error
+	for _, svc := range slices.Backward(services) {
+		if _, err := svc.Stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,27 @@
+package environment
+
+import (
+	"context"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartedServices(t *testing.T) {
+	tracked := &startedServices{}
+	svc1, svc2 := &dagger.Service{}, &dagger.Service{}
+	tracked.add(svc1, "svc1")
+	tracked.add(svc2, "svc2")
+	tracked.remove(svc1)
+	assert.Equal(t, []*dagger.Service{svc2}, tracked.services)
+
+	// Services started again, e.g. when rebuilding an environment, are only tracked once
+	tracked.add(&dagger.Service{}, "svc2")
+	assert.Equal(t, []*dagger.Service{svc2}, tracked.services)
+	assert.Equal(t, []dagger.ServiceID{"svc2"}, tracked.ids)
+
+	// Nothing to stop
+	require.NoError(t, Shutdown(context.Background()))
+}
@@ -0,0 +1,122 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileStat describes a path in the environment without reading its contents.
+type FileStat struct {
+	Path   string `json:"path"`
+	Exists bool   `json:"exists"`
+	// Type is one of file, directory, symlink or other
+	Type    string    `json:"type,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	Mode    string    `json:"mode,omitempty"`
+	ModTime time.Time `json:"mtime,omitzero"`
+	// Target is the path a symlink points to
+	Target string `json:"target,omitempty"`
+	// Hash is the sha256 of the contents of regular files, to tell whether they changed without reading them.
+	// It is only computed on request, as it reads the whole file.
+	Hash string `json:"hash,omitempty"`
+}
+
+// statScript prints the type, size, permissions and modification time of a path without following symlinks,
+// followed by the target of symlinks, or the sha256 of regular files when a second argument is set. It prints
+// nothing for missing paths.
+const statScript = `[ -e "$1" ] || [ -L "$1" ] || exit 0; stat -c '%F|%s|%a|%Y' "$1" && if [ -L "$1" ]; then readlink "$1"; elif [ -f "$1" ] && [ -n "$2" ]; then sha256sum "$1"; fi`
+
+// FileStat returns the metadata of a path, e.g. to check that a file exists or how large it is before reading it.
+// With includeHash, the contents of regular files are hashed too. Missing paths are not an error, they are
+// reported with Exists unset.
+func (env *Environment) FileStat(ctx context.Context, targetPath string, includeHash bool) (*FileStat, error) {
+	hashArg := ""
+	if includeHash {
+		hashArg = "hash"
+	}
+	out, err := env.container().WithExec([]string{"sh", "-c", statScript, "sh", targetPath, hashArg}).Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", targetPath, err)
+	}
+	return parseFileStat(targetPath, out)
+}
+
+func parseFileStat(targetPath, out string) (*FileStat, error) {
+	stat := &FileStat{Path: targetPath}
+	line, extra, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	if line == "" {
+		return stat, nil
+	}
+
+	fields := strings.Split(line, "|")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("unexpected stat output for %s: %q", targetPath, line)
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size for %s: %w", targetPath, err)
+	}
+	mtime, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modification time for %s: %w", targetPath, err)
+	}
+
+	stat.Exists = true
+	switch fields[0] {
+	case "regular file", "regular empty file":
+		stat.Type = "file"
+		// sha256sum prints the hash followed by the path
+		if fields := strings.Fields(extra); len(fields) > 0 {
+			stat.Hash = fields[0]
+		}
+	case "directory":
+		stat.Type = "directory"
+	case "symbolic link":
+		stat.Type = "symlink"
+		stat.Target = strings.TrimSpace(extra)
+	default:
+		stat.Type = "other"
+	}
+	stat.Size = size
+	stat.Mode = fmt.Sprintf("%04s", fields[2])
+	stat.ModTime = time.Unix(mtime, 0).UTC()
+	return stat, nil
+}
+
+// FileHash returns the sha256 of the contents of a file, hashed in the container so the contents aren't transferred.
+func (env *Environment) FileHash(ctx context.Context, targetFile string) (string, error) {
+	out, err := env.container().WithExec([]string{"sha256sum", targetFile}).Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", targetFile, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected sha256sum output for %s: %q", targetFile, out)
+	}
+	return fields[0], nil
+}
+
+// DiskUsage returns the number of bytes used by the files of the workdir, including mounted directories.
+func (env *Environment) DiskUsage(ctx context.Context) (int64, error) {
+	out, err := env.container().WithExec([]string{"du", "-sk", env.State.Config.Workdir}).Stdout(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure disk usage: %w", err)
+	}
+	return parseDiskUsage(out)
+}
+
+// parseDiskUsage parses the output of `du -sk`, the size in KiB followed by the path.
+func parseDiskUsage(out string) (int64, error) {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected du output: %q", out)
+	}
+	kib, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected du output: %q", out)
+	}
+	return kib * 1024, nil
+}
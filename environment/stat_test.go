@@ -0,0 +1,54 @@
+package environment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFileStat(t *testing.T) {
+	stat, err := parseFileStat("main.go", "regular file|1024|644|1760000000\n")
+	require.NoError(t, err)
+	assert.Equal(t, &FileStat{
+		Path:    "main.go",
+		Exists:  true,
+		Type:    "file",
+		Size:    1024,
+		Mode:    "0644",
+		ModTime: time.Unix(1760000000, 0).UTC(),
+	}, stat)
+
+	stat, err = parseFileStat("empty.txt", "regular empty file|0|644|1760000000\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty.txt\n")
+	require.NoError(t, err)
+	assert.Equal(t, "file", stat.Type)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", stat.Hash)
+
+	stat, err = parseFileStat("src", "directory|4096|755|1760000000\n")
+	require.NoError(t, err)
+	assert.Equal(t, "directory", stat.Type)
+
+	stat, err = parseFileStat("current", "symbolic link|7|777|1760000000\nrelease\n")
+	require.NoError(t, err)
+	assert.Equal(t, "symlink", stat.Type)
+	assert.Equal(t, "release", stat.Target)
+
+	stat, err = parseFileStat("missing.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, &FileStat{Path: "missing.txt"}, stat)
+
+	_, err = parseFileStat("main.go", "stat: unrecognized option\n")
+	assert.Error(t, err)
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	size, err := parseDiskUsage("1536\t/workdir\n")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1536*1024), size)
+
+	_, err = parseDiskUsage("")
+	assert.Error(t, err)
+	_, err = parseDiskUsage("du: cannot access '/workdir'\n")
+	assert.Error(t, err)
+}
@@ -6,6 +6,7 @@ toolchain go1.24.6
 
 require (
 	dagger.io/dagger v0.18.17
+	github.com/Khan/genqlient v0.8.1
 	github.com/charmbracelet/bubbletea v1.3.7
 	github.com/charmbracelet/fang v0.4.0
 	github.com/charmbracelet/huh v0.7.0
@@ -13,6 +14,7 @@ require (
 	github.com/dustin/go-humanize v1.0.1
 	github.com/dustinkirkland/golang-petname v0.0.0-20240428194347-eebcea082ee0
 	github.com/gofrs/flock v0.12.1
+	github.com/invopop/jsonschema v0.13.0
 	github.com/karrick/tparse v2.4.2+incompatible
 	github.com/mark3labs/mcp-go v0.39.1
 	github.com/mitchellh/go-homedir v1.1.0
@@ -28,7 +30,6 @@ require (
 
 require (
 	github.com/99designs/gqlgen v0.17.78 // indirect
-	github.com/Khan/genqlient v0.8.1 // indirect
 	github.com/adrg/xdg v0.5.3 // indirect
 	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
@@ -52,7 +53,6 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/grpc-ecosystem/grpc-gateway/v2 v2.27.2 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/invopop/jsonschema v0.13.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
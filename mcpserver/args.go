@@ -31,6 +31,8 @@ type envToolOptions struct {
 	name                  string
 	description           string
 	useCurrentEnvironment bool
+	// readOnly tools don't change environments, they are safe to approve automatically
+	readOnly bool
 }
 
 func newEnvironmentTool(toolOptions envToolOptions, mcpToolOptions ...mcp.ToolOption) mcp.Tool {
@@ -45,6 +47,10 @@ func newEnvironmentTool(toolOptions envToolOptions, mcpToolOptions ...mcp.ToolOp
 		opts = append(opts, environmentIDArgument)
 	}
 
+	if toolOptions.readOnly {
+		opts = append(opts, mcp.WithReadOnlyHintAnnotation(true))
+	}
+
 	opts = append(opts, mcpToolOptions...)
 	return mcp.NewTool(toolOptions.name, opts...)
 }
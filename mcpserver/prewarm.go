@@ -0,0 +1,66 @@
+package mcpserver
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	"github.com/dagger/container-use/repository"
+)
+
+// prewarmTimeout bounds how long pulling a single image may take.
+var prewarmTimeout = 5 * time.Minute
+
+// Prewarm pulls the base images of the most recently used environments of the repository at source,
+// so the next environment_create doesn't have to wait for them.
+// At most limit images are pulled, one at a time. Errors are logged and otherwise ignored.
+func Prewarm(ctx context.Context, dag *dagger.Client, source string, limit int) {
+	repo, err := repository.Open(ctx, source)
+	if err != nil {
+		slog.Info("Skipping pre-warm", "source", source, "reason", err)
+		return
+	}
+
+	envs, err := repo.List(ctx)
+	if err != nil {
+		slog.Warn("Failed to list environments for pre-warm", "error", err)
+		return
+	}
+
+	for _, image := range recentBaseImages(envs, limit) {
+		slog.Info("Pre-warming base image", "image", image)
+		pullCtx, cancel := context.WithTimeout(ctx, prewarmTimeout)
+		_, err := dag.Container().From(image).Sync(pullCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to pre-warm base image", "image", image, "error", err)
+		}
+	}
+}
+
+// recentBaseImages returns up to limit distinct base images, most recently used first.
+// envs are expected to be sorted by most recently updated first, as returned by Repository.List.
+func recentBaseImages(envs []*environment.EnvironmentInfo, limit int) []string {
+	images := []string{}
+	seen := map[string]bool{}
+	for _, env := range envs {
+		if len(images) >= limit {
+			break
+		}
+		if env.State == nil || env.State.Config == nil {
+			continue
+		}
+		image := env.State.Config.BaseImage
+		if image == "" || seen[image] {
+			continue
+		}
+		seen[image] = true
+		images = append(images, image)
+	}
+	return images
+}
@@ -0,0 +1,32 @@
+package mcpserver
+
+import (
+	"testing"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentBaseImages(t *testing.T) {
+	envWithImage := func(image string) *environment.EnvironmentInfo {
+		return &environment.EnvironmentInfo{
+			State: &environment.State{
+				Config: &environment.EnvironmentConfig{BaseImage: image},
+			},
+		}
+	}
+
+	// Sorted by most recently updated first, as returned by Repository.List
+	envs := []*environment.EnvironmentInfo{
+		envWithImage("golang:1.24"),
+		envWithImage("python:3.12"),
+		envWithImage("golang:1.24"),
+		{State: &environment.State{}},
+		envWithImage("node:22"),
+	}
+
+	assert.Equal(t, []string{"golang:1.24"}, recentBaseImages(envs, 1))
+	assert.Equal(t, []string{"golang:1.24", "python:3.12", "node:22"}, recentBaseImages(envs, 5))
+	assert.Empty(t, recentBaseImages(envs, 0))
+	assert.Empty(t, recentBaseImages(nil, 3))
+}
@@ -65,3 +65,12 @@ func setCurrentEnvironment(envID, envSource string) {
 	currentEnvironmentID = envID
 	currentEnvironmentSource = envSource
 }
+
+// renameCurrentEnvironment follows a rename of the current environment in single-tenant mode
+func renameCurrentEnvironment(oldID, newID string) {
+	currentEnvMutex.Lock()
+	defer currentEnvMutex.Unlock()
+	if currentEnvironmentID == oldID {
+		currentEnvironmentID = newID
+	}
+}
@@ -1,14 +1,22 @@
 package mcpserver
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"log/slog"
+	"maps"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"dagger.io/dagger"
 	"github.com/dagger/container-use/environment"
@@ -22,6 +30,8 @@ type daggerClientKey struct{}
 
 type singleTenantKey struct{}
 
+type hostServicesKey struct{}
+
 // single-tenant servers set this context key to indicate that this particular mcp server process will only have 1 chat session in it
 // this allows api optimizations where environment_id is not required and allows claude tasks inherit their parent's envs
 
@@ -93,15 +103,21 @@ func openEnvironment(ctx context.Context, request mcp.CallToolRequest) (*reposit
 	if err != nil {
 		return nil, nil, fmt.Errorf("unable to get environment: %w", err)
 	}
+	env.HostServices, _ = ctx.Value(hostServicesKey{}).([]*environment.HostService)
 	return repo, env, nil
 }
 
+// shutdownTimeout bounds how long the server waits for services to stop when exiting.
+const shutdownTimeout = 10 * time.Second
+
 type Tool struct {
 	Definition mcp.Tool
 	Handler    server.ToolHandlerFunc
 }
 
-func RunStdioServer(ctx context.Context, dag *dagger.Client, singleTenant bool) error {
+// RunStdioServer serves the tools over stdio. In readOnly mode, only the tools that don't change
+// environments are served, see ReadOnlyTools.
+func RunStdioServer(ctx context.Context, dag *dagger.Client, singleTenant, readOnly bool, hostServices []*environment.HostService) error {
 	// Store single-tenant mode in context for tool handlers
 	ctx = context.WithValue(ctx, singleTenantKey{}, singleTenant)
 
@@ -111,9 +127,16 @@ func RunStdioServer(ctx context.Context, dag *dagger.Client, singleTenant bool)
 		server.WithInstructions(rules.AgentRules),
 	)
 
-	for _, t := range createTools(singleTenant) {
-		s.AddTool(t.Definition, wrapToolWithClient(t, dag, singleTenant).Handler)
+	tools := createTools(singleTenant)
+	if readOnly {
+		tools = ReadOnlyTools(tools)
 	}
+	for _, t := range tools {
+		s.AddTool(t.Definition, wrapToolWithClient(t, dag, singleTenant, hostServices).Handler)
+	}
+
+	// Let `container-use services` list the background processes started by this server
+	environment.PublishProcesses(filepath.Join(repository.ConfigDir(), "processes"))
 
 	slog.Info("starting server")
 
@@ -124,6 +147,14 @@ func RunStdioServer(ctx context.Context, dag *dagger.Client, singleTenant bool)
 	defer cancel()
 
 	err := stdioSrv.Listen(ctx, os.Stdin, os.Stdout)
+
+	// Don't leave background processes, services and host port forwards running once the server exits
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancelShutdown()
+	if stopErr := environment.Shutdown(shutdownCtx); stopErr != nil {
+		slog.Error("Failed to stop services on shutdown", "err", stopErr)
+	}
+
 	if err != nil && !errors.Is(err, context.Canceled) {
 		return err
 	}
@@ -135,15 +166,32 @@ func createTools(singleTenant bool) []*Tool {
 		wrapTool(createEnvironmentOpenTool()),
 		wrapTool(createEnvironmentCreateTool(singleTenant)),
 		wrapTool(createEnvironmentUpdateMetadataTool(singleTenant)),
+		wrapTool(createEnvironmentRenameTool(singleTenant)),
 		wrapTool(createEnvironmentConfigTool(singleTenant)),
+		wrapTool(createEnvironmentDescribeBuildTool(singleTenant)),
+		wrapTool(createEnvironmentExportConfigTool(singleTenant)),
 		wrapTool(createEnvironmentListTool(singleTenant)),
+		wrapTool(createEnvironmentStatusTool(singleTenant)),
+		wrapTool(createEnvironmentImageDiffTool(singleTenant)),
+		wrapTool(createEnvironmentLocalDiffTool(singleTenant)),
 		wrapTool(createEnvironmentRunCmdTool(singleTenant)),
 		wrapTool(createEnvironmentFileReadTool(singleTenant)),
 		wrapTool(createEnvironmentFileListTool(singleTenant)),
+		wrapTool(createEnvironmentFileStatTool(singleTenant)),
 		wrapTool(createEnvironmentFileWriteTool(singleTenant)),
 		wrapTool(createEnvironmentFileEditTool(singleTenant)),
+		wrapTool(createEnvironmentApplyPatchTool(singleTenant)),
 		wrapTool(createEnvironmentFileDeleteTool(singleTenant)),
+		wrapTool(createEnvironmentSubmoduleListTool(singleTenant)),
+		wrapTool(createEnvironmentMkdirTool(singleTenant)),
+		wrapTool(createEnvironmentCopyFileTool(singleTenant)),
 		wrapTool(createEnvironmentAddServiceTool(singleTenant)),
+		wrapTool(createEnvironmentMountTool(singleTenant)),
+		wrapTool(createEnvironmentProcessListTool(singleTenant)),
+		wrapTool(createEnvironmentProcessLogsTool(singleTenant)),
+		wrapTool(createEnvironmentProcessOutputSinceTool(singleTenant)),
+		wrapTool(createEnvironmentProcessStopTool(singleTenant)),
+		wrapTool(createEnvironmentCancelTool(singleTenant)),
 		wrapTool(createEnvironmentCheckpointTool(singleTenant)),
 	}
 }
@@ -152,6 +200,44 @@ func Tools() []*Tool {
 	return createTools(false) // Default to multi-tenant mode when called outside of RunStdioServer
 }
 
+// IsReadOnly reports whether a tool only inspects environments, as opposed to changing them or running commands.
+func (t *Tool) IsReadOnly() bool {
+	return t.Definition.Annotations.ReadOnlyHint != nil && *t.Definition.Annotations.ReadOnlyHint
+}
+
+// ReadOnlyTools returns the read-only tools, along with environment_create: creating an environment
+// doesn't change existing ones, and read-only agents need one to inspect the code in. It can't replace
+// the current environment though, see withoutAllowReplace.
+func ReadOnlyTools(tools []*Tool) []*Tool {
+	var readOnly []*Tool
+	for _, t := range tools {
+		switch {
+		case t.IsReadOnly():
+			readOnly = append(readOnly, t)
+		case t.Definition.Name == "environment_create":
+			readOnly = append(readOnly, withoutAllowReplace(t))
+		}
+	}
+	return readOnly
+}
+
+// withoutAllowReplace returns environment_create without its allow_replace argument, rejecting calls that
+// still set it, as replacing the current environment deletes it.
+func withoutAllowReplace(t *Tool) *Tool {
+	definition := t.Definition
+	definition.InputSchema.Properties = maps.Clone(definition.InputSchema.Properties)
+	delete(definition.InputSchema.Properties, "allow_replace")
+	return &Tool{
+		Definition: definition,
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if request.GetBool("allow_replace", false) {
+				return nil, errors.New("allow_replace is not available in read-only mode, environments can't be replaced")
+			}
+			return t.Handler(ctx, request)
+		},
+	}
+}
+
 func wrapTool(tool *Tool) *Tool {
 	return &Tool{
 		Definition: tool.Definition,
@@ -170,12 +256,13 @@ func wrapTool(tool *Tool) *Tool {
 }
 
 // keeping this modular for now. we could move tool registration to RunStdioServer and collapse the 2 wrapTool functions.
-func wrapToolWithClient(tool *Tool, dag *dagger.Client, singleTenant bool) *Tool {
+func wrapToolWithClient(tool *Tool, dag *dagger.Client, singleTenant bool, hostServices []*environment.HostService) *Tool {
 	return &Tool{
 		Definition: tool.Definition,
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			ctx = context.WithValue(ctx, daggerClientKey{}, dag)
 			ctx = context.WithValue(ctx, singleTenantKey{}, singleTenant)
+			ctx = context.WithValue(ctx, hostServicesKey{}, hostServices)
 			return tool.Handler(ctx, request)
 		},
 	}
@@ -190,6 +277,8 @@ type EnvironmentResponse struct {
 	LogCommand      string                         `json:"log_command_to_share_with_user"`
 	DiffCommand     string                         `json:"diff_command_to_share_with_user"`
 	Services        []*environment.Service         `json:"services,omitempty"`
+	// SourceDetection is what detect_source found out about the source on creation, including a suggested base image
+	SourceDetection *environment.SourceDetection `json:"source_detection,omitempty"`
 }
 
 func environmentResponseFromEnvInfo(envInfo *environment.EnvironmentInfo) *EnvironmentResponse {
@@ -250,6 +339,7 @@ func createEnvironmentOpenTool() *Tool {
 				name:                  "environment_open",
 				description:           "Opens an existing environment. Return format is same as environment_create.",
 				useCurrentEnvironment: false,
+				readOnly:              true,
 			},
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -279,6 +369,12 @@ func createEnvironmentCreateTool(singleTenant bool) *Tool {
 		mcp.WithString("from_git_ref",
 			mcp.Description("Git reference to create the environment from (e.g., HEAD, main, feature-branch, SHA). Defaults to HEAD if not specified."),
 		),
+		mcp.WithString("from_image",
+			mcp.Description("Image to start the environment from instead of building one from the configured base image and setup commands, e.g. an image published from another environment. Install commands still run."),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("If true, only return the configuration (base image, setup commands, workdir...) the environment would be created with, without creating it."),
+		),
 	}
 
 	// Add allow_replace parameter only in single-tenant mode
@@ -293,7 +389,8 @@ func createEnvironmentCreateTool(singleTenant bool) *Tool {
 			"environment_create",
 			`Creates a new development environment.
 The environment is the result of a the setups commands on top of the base image.
-Environment configuration is managed by the user via cu config commands.`,
+Environment configuration is managed by the user via cu config commands.
+When the user enabled source detection, source_detection tells the language of the source and may suggest a base image for it.`,
 			args...,
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -306,6 +403,30 @@ Environment configuration is managed by the user via cu config commands.`,
 				return nil, err
 			}
 
+			fromImage := request.GetString("from_image", "")
+			if request.GetBool("dry_run", false) {
+				config, err := repo.CreateConfig(ctx, request.GetString("from_git_ref", "HEAD"), fromImage)
+				if err != nil {
+					return nil, fmt.Errorf("failed to resolve configuration: %w", err)
+				}
+				out, err := json.Marshal(config)
+				if err != nil {
+					return nil, fmt.Errorf("failed to marshal configuration: %w", err)
+				}
+				detection, err := repo.DetectSource(ctx, request.GetString("from_git_ref", "HEAD"), fromImage)
+				if err != nil {
+					return nil, err
+				}
+				if detection != nil {
+					detected, err := json.Marshal(detection)
+					if err != nil {
+						return nil, fmt.Errorf("failed to marshal source detection: %w", err)
+					}
+					out = fmt.Appendf(out, "\n\nSource detection: %s", detected)
+				}
+				return mcp.NewToolResultText(fmt.Sprintf("%s\n\nNo environment was created. This is the configuration environment_create would use.", out)), nil
+			}
+
 			// In single-tenant mode, check allow_replace before creating environment
 			if singleTenantMode, _ := ctx.Value(singleTenantKey{}).(bool); singleTenantMode {
 				allowReplace := request.GetBool("allow_replace", false) // Default false to prevent accidental environment replacement
@@ -325,7 +446,7 @@ Environment configuration is managed by the user via cu config commands.`,
 			}
 
 			gitRef := request.GetString("from_git_ref", "HEAD")
-			env, err := repo.Create(ctx, dag, title, request.GetString("explanation", ""), gitRef)
+			env, err := repo.Create(ctx, dag, title, request.GetString("explanation", ""), gitRef, fromImage)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create environment: %w", err)
 			}
@@ -336,10 +457,17 @@ Environment configuration is managed by the user via cu config commands.`,
 				setCurrentEnvironment(env.ID, source)
 			}
 
-			out, err := marshalEnvironment(env)
+			resp := environmentResponseFromEnv(env)
+			// The environment is created by now, so failing to detect its source only leaves the detection out
+			resp.SourceDetection, err = repo.DetectSource(ctx, gitRef, fromImage)
+			if err != nil {
+				slog.Warn("Failed to detect the source of the environment", "environment.id", env.ID, "error", err)
+			}
+			marshalled, err := json.Marshal(resp)
 			if err != nil {
 				return nil, fmt.Errorf("failed to marshal environment: %w", err)
 			}
+			out := string(marshalled)
 
 			dirty, status, err := repo.IsDirty(ctx)
 			if err != nil {
@@ -398,6 +526,49 @@ func createEnvironmentUpdateMetadataTool(singleTenant bool) *Tool {
 	}
 }
 
+func createEnvironmentRenameTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_rename",
+				description:           "Rename an environment, giving it a meaningful ID. Its history and state are kept. Stop its background processes first. Use the new ID to refer to the environment afterwards.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("new_id",
+				mcp.Description("New ID of the environment. Letters, digits, dashes and underscores only."),
+				mcp.Required(),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			newID, err := request.RequireString("new_id")
+			if err != nil {
+				return nil, err
+			}
+
+			oldID := env.ID
+			if err := repo.Rename(ctx, oldID, newID); err != nil {
+				return nil, fmt.Errorf("unable to rename the environment: %w", err)
+			}
+			env.ID = newID
+
+			// In single-tenant mode, keep targeting the renamed environment
+			if singleTenantMode, _ := ctx.Value(singleTenantKey{}).(bool); singleTenantMode {
+				renameCurrentEnvironment(oldID, newID)
+			}
+
+			out, err := marshalEnvironment(env)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal environment: %w", err)
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Environment %s renamed to %s.\n%s", oldID, newID, out)), nil
+		},
+	}
+}
+
 func createEnvironmentConfigTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -425,6 +596,19 @@ func createEnvironmentConfigTool(singleTenant bool) *Tool {
 						"description": "The environment variables to set (e.g. `[\"FOO=bar\", \"BAZ=qux\"]`).",
 						"items":       map[string]any{"type": "string"},
 					},
+					"dockerfile": map[string]any{
+						"type":        "string",
+						"description": "Path of a Dockerfile in the repository to build the environment from instead of base_image (e.g. `.devcontainer/Dockerfile`). Set to an empty string to use base_image again.",
+					},
+					"build_context": map[string]any{
+						"type":        "string",
+						"description": "Path of the directory in the repository to use as the Dockerfile build context (default: repository root).",
+					},
+					"build_args": map[string]any{
+						"type":        "array",
+						"description": "The Dockerfile build arguments to set (e.g. `[\"VERSION=1.2\"]`).",
+						"items":       map[string]any{"type": "string"},
+					},
 				}),
 			),
 		),
@@ -459,6 +643,21 @@ func createEnvironmentConfigTool(singleTenant bool) *Tool {
 				}
 			}
 
+			if dockerfile, ok := newConfig["dockerfile"].(string); ok {
+				updatedConfig.Dockerfile = dockerfile
+			}
+
+			if buildContext, ok := newConfig["build_context"].(string); ok {
+				updatedConfig.BuildContext = buildContext
+			}
+
+			if buildArgs, ok := newConfig["build_args"].([]any); ok {
+				updatedConfig.BuildArgs = make([]string, len(buildArgs))
+				for i, arg := range buildArgs {
+					updatedConfig.BuildArgs[i] = arg.(string)
+				}
+			}
+
 			if err := env.UpdateConfig(ctx, updatedConfig); err != nil {
 				return nil, fmt.Errorf("unable to update the environment: %w", err)
 			}
@@ -484,11 +683,67 @@ TELL THE USER: To make these changes persistent, they will have to run "cu confi
 	}
 }
 
+func createEnvironmentDescribeBuildTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_describe_build",
+				description:           "Describe how the environment's container is built as a Dockerfile-equivalent text: base image or Dockerfile, env variables, setup and install commands, mounts and services.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			plan, err := repo.DescribeBuild(ctx, env.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to describe the build: %w", err)
+			}
+			return mcp.NewToolResultText(plan), nil
+		},
+	}
+}
+
+func createEnvironmentExportConfigTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_export_config",
+				description:           "Write the environment's configuration (base image, setup and install commands, env variables...) to the repository's .container-use/environment.json, so that new environments start with the same setup. Ask the user before overwriting an existing configuration.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithBoolean("overwrite",
+				mcp.Description("If true, replace the repository configuration if one already exists. Only set after the user has agreed."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			configPath, err := repo.ExportConfig(ctx, env.ID, request.GetBool("overwrite", false))
+			if errors.Is(err, repository.ErrConfigExists) {
+				return nil, fmt.Errorf("%s already exists. Confirm with the user, then call again with overwrite=true to replace it", configPath)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to export the configuration: %w", err)
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Configuration of environment %s written to %s. Commit it to make it the default for new environments.", env.ID, configPath)), nil
+		},
+	}
+}
+
 func createEnvironmentListTool(_ bool) *Tool {
 	return &Tool{
 		Definition: newRepositoryTool(
 			"environment_list",
 			"List available environments",
+			mcp.WithReadOnlyHintAnnotation(true),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			repo, err := openRepository(ctx, request)
@@ -518,6 +773,164 @@ func createEnvironmentListTool(_ bool) *Tool {
 	}
 }
 
+// environmentStatus is the health report returned by environment_status.
+type environmentStatus struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// LatestCommit is the last change made to the environment, without its log
+	LatestCommit *repository.HistoryEntry `json:"latest_commit,omitempty"`
+	// RecentCommands are the last commands run in the environment, oldest first
+	RecentCommands []repository.CommandResult `json:"recent_commands"`
+	// FailedCommands counts the recent commands that exited with a non-zero code
+	FailedCommands int                    `json:"failed_commands"`
+	Processes      []*environment.Process `json:"processes"`
+	// DiskUsage is unset when it can't be measured, e.g. in images without du, with the reason in DiskUsageError
+	DiskUsage      *int64 `json:"disk_usage_bytes,omitempty"`
+	DiskUsageError string `json:"disk_usage_error,omitempty"`
+}
+
+func createEnvironmentStatusTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_status",
+				description:           "Check whether the environment is healthy before continuing work in it: its latest change, the exit codes of the last commands run, the background processes and the disk space used by the workdir. Consider recreating the environment if recent commands keep failing.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+			mcp.WithNumber("recent",
+				mcp.Description("Number of recent commands to report (default: 5)."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			history, err := repo.History(ctx, env.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read environment history: %w", err)
+			}
+
+			status := environmentStatus{
+				ID:             env.ID,
+				Title:          env.State.Title,
+				UpdatedAt:      env.State.UpdatedAt,
+				RecentCommands: recentCommands(history, request.GetInt("recent", 5)),
+				Processes:      env.Processes(),
+			}
+			// The rest of the status is still useful when the disk usage can't be measured
+			if diskUsage, err := env.DiskUsage(ctx); err == nil {
+				status.DiskUsage = &diskUsage
+			} else if ctx.Err() != nil {
+				return nil, err
+			} else {
+				status.DiskUsageError = err.Error()
+			}
+			if len(history) > 0 {
+				latest := history[len(history)-1]
+				latest.Note = ""
+				status.LatestCommit = &latest
+			}
+			for _, command := range status.RecentCommands {
+				if command.ExitCode != 0 {
+					status.FailedCommands++
+				}
+			}
+
+			out, err := json.Marshal(status)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal status: %w", err)
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
+func createEnvironmentImageDiffTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_image_diff",
+				description:           "Compare the environment's container to its base image, outside of the workdir: the files added, modified and removed by the setup and install commands and the commands run since, largest first. Use it to find out why an environment is large, e.g. caches or build artifacts left behind by setup commands.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+			mcp.WithNumber("limit",
+				mcp.Description("Maximum number of changed paths to list (default: 50). Counts and sizes always cover all changes."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			diff, err := env.ImageDiff(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if limit := request.GetInt("limit", 50); limit >= 0 && len(diff.Changes) > limit {
+				diff.Changes = diff.Changes[:limit]
+			}
+
+			out, err := json.Marshal(diff)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal image diff: %w", err)
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
+func createEnvironmentLocalDiffTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_local_diff",
+				description:           "Compare the environment's files to the user's local working tree as it is right now, including their uncommitted and untracked changes. Lines removed (-) are the user's, lines added (+) are the environment's. Use it before asking the user to merge or apply the environment, to review what it would change in their checkout.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+			mcp.WithBoolean("stat",
+				mcp.Description("Only summarize the changed files instead of showing the full diff."),
+			),
+			mcp.WithArray("paths",
+				mcp.Description("Limit the diff to these files or directories, relative to the repository root."),
+				mcp.Items(map[string]any{"type": "string"}),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			var buf bytes.Buffer
+			if err := repo.DiffLocal(ctx, env.ID, request.GetBool("stat", false), request.GetStringSlice("paths", nil), &buf); err != nil {
+				return nil, fmt.Errorf("failed to compare to the local working tree: %w\n%s", err, buf.String())
+			}
+			if buf.Len() == 0 {
+				return mcp.NewToolResultText("No differences: the environment's files match the local working tree."), nil
+			}
+			return mcp.NewToolResultText(buf.String()), nil
+		},
+	}
+}
+
+// recentCommands returns the last n commands recorded in the history, oldest first.
+func recentCommands(history []repository.HistoryEntry, n int) []repository.CommandResult {
+	commands := []repository.CommandResult{}
+	for i := len(history) - 1; i >= 0 && len(commands) < n; i-- {
+		entryCommands := history[i].Commands()
+		take := min(n-len(commands), len(entryCommands))
+		commands = slices.Concat(entryCommands[len(entryCommands)-take:], commands)
+	}
+	return commands
+}
+
 func createEnvironmentRunCmdTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -530,7 +943,14 @@ func createEnvironmentRunCmdTool(singleTenant bool) *Tool {
 				mcp.Description("The terminal command to execute. If empty, the environment's default command is used."),
 			),
 			mcp.WithString("shell",
-				mcp.Description("The shell that will be interpreting this command (default: sh)"),
+				mcp.Description("The shell that will be interpreting this command (default: the environment's default_shell, or sh)"),
+			),
+			mcp.WithString("cwd",
+				mcp.Description("Directory to run the command from, relative to the workdir (e.g. packages/api). Only applies to this command (default: the workdir)."),
+			),
+			mcp.WithArray("env",
+				mcp.Description("Environment variables in the KEY=VALUE format set for this command only (e.g. CI=true). Their values are masked in the audit log. Use environment_config to set them for all commands."),
+				mcp.Items(map[string]any{"type": "string"}),
 			),
 			mcp.WithBoolean("background",
 				mcp.Description(`Run the command in the background
@@ -545,6 +965,21 @@ Failure to do so will result in the tool being stuck, awaiting for the command t
 				mcp.Description("Ports to expose. Only works with background environments. For each port, returns the environment_internal (for use inside environments) and host_external (for use by the user) addresses."),
 				mcp.Items(map[string]any{"type": "number"}),
 			),
+			mcp.WithNumber("wait_for_port",
+				mcp.Description("Only works with background commands. Wait until this exposed port accepts connections before returning."),
+			),
+			mcp.WithString("health_check",
+				mcp.Description("Only works with background commands. Command run in the environment until it succeeds before returning. The background command is reachable from it at $CONTAINER_USE_PROCESS_HOST (e.g. curl -sf http://$CONTAINER_USE_PROCESS_HOST:8080/health)."),
+			),
+			mcp.WithNumber("wait_timeout",
+				mcp.Description("Maximum number of seconds to wait for wait_for_port or health_check (default: 60)."),
+			),
+			mcp.WithBoolean("fail_on_error",
+				mcp.Description("Return an error result when the command exits with a non-zero code, instead of a successful result reporting the exit code. Changes are committed either way. Does not work with background commands."),
+			),
+			mcp.WithString("output_file",
+				mcp.Description(fmt.Sprintf("Path of a file the command writes (e.g. a test report or coverage.xml), absolute or relative to the workdir. Its contents are returned along with the command output, saving an environment_file_read. Files over %d KiB are truncated. Does not work with background commands.", maxOutputFileSize/1024)),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			repo, env, err := openEnvironment(ctx, request)
@@ -553,7 +988,9 @@ Failure to do so will result in the tool being stuck, awaiting for the command t
 			}
 
 			command := request.GetString("command", "")
-			shell := request.GetString("shell", "sh")
+			shell := request.GetString("shell", "")
+			cwd := request.GetString("cwd", "")
+			envs := request.GetStringSlice("env", nil)
 
 			updateRepo := func() error {
 				if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
@@ -570,7 +1007,7 @@ Failure to do so will result in the tool being stuck, awaiting for the command t
 						ports = append(ports, int(port.(float64)))
 					}
 				}
-				endpoints, runErr := env.RunBackground(ctx, command, shell, ports, request.GetBool("use_entrypoint", false))
+				process, runErr := env.RunBackground(ctx, command, shell, cwd, envs, ports, request.GetBool("use_entrypoint", false))
 				// We want to update the repository even if the command failed.
 				if err := updateRepo(); err != nil {
 					return nil, err
@@ -579,22 +1016,38 @@ Failure to do so will result in the tool being stuck, awaiting for the command t
 					return nil, fmt.Errorf("failed to run command: %w", runErr)
 				}
 
-				out, err := json.Marshal(endpoints)
+				out, err := json.Marshal(process.Endpoints)
 				if err != nil {
 					return nil, err
 				}
 
-				return mcp.NewToolResultText(fmt.Sprintf(`Command started in the background in NEW container. Endpoints are %s
+				readiness := ""
+				check := environment.ReadinessCheck{
+					Port:        request.GetInt("wait_for_port", 0),
+					HealthCheck: request.GetString("health_check", ""),
+					Timeout:     time.Duration(request.GetInt("wait_timeout", 60)) * time.Second,
+				}
+				if check.Port != 0 || check.HealthCheck != "" {
+					if elapsed, err := env.WaitReady(ctx, process.ID, check); err != nil {
+						readiness = fmt.Sprintf("\n\nWARNING: the command is NOT ready: %s", err)
+					} else {
+						readiness = fmt.Sprintf("\n\nThe command is ready (took %s).", elapsed.Round(time.Millisecond))
+					}
+				}
+
+				return mcp.NewToolResultText(fmt.Sprintf(`Command started in the background in NEW container with process ID %s. Endpoints are %s%s
 
 To access from the user's machine: use host_external. To access from other commands in this environment: use environment_internal.
 
+Use environment_process_logs to read its output, environment_process_output_since to follow its progress, and environment_process_stop to stop it.
+
 Any changes to the container workdir (%s) WILL NOT be committed to container-use/%s
 
 Background commands are unaffected by filesystem and any other kind of changes. You need to start a new command for changes to take effect.`,
-					string(out), env.State.Config.Workdir, env.ID)), nil
+					process.ID, string(out), readiness, env.State.Config.Workdir, env.ID)), nil
 			}
 
-			stdout, runErr := env.Run(ctx, command, shell, request.GetBool("use_entrypoint", false))
+			stdout, exitCode, runErr := env.RunWithExitCode(ctx, command, shell, cwd, envs, request.GetBool("use_entrypoint", false))
 			// We want to update the repository even if the command failed.
 			if err := updateRepo(); err != nil {
 				return nil, err
@@ -603,18 +1056,63 @@ Background commands are unaffected by filesystem and any other kind of changes.
 				return nil, fmt.Errorf("failed to run command: %w", runErr)
 			}
 
-			return mcp.NewToolResultText(fmt.Sprintf("%s\n\nAny changes to the container workdir (%s) have been committed and pushed to container-use/%s remote ref", stdout, env.State.Config.Workdir, env.ID)), nil
+			outputFile := ""
+			if path := request.GetString("output_file", ""); path != "" {
+				contents, size, err := env.FileReadHead(ctx, path, maxOutputFileSize)
+				if err != nil {
+					outputFile = fmt.Sprintf("\n\nWARNING: failed to read output file %s: %s", path, err)
+				} else {
+					outputFile = formatOutputFile(path, contents, size)
+				}
+			}
+
+			exitStatus := ""
+			if exitCode != 0 {
+				exitStatus = fmt.Sprintf("\n\nThe command exited with code %d.", exitCode)
+			}
+			result := fmt.Sprintf("%s%s%s\n\nAny changes to the container workdir (%s) have been committed and pushed to container-use/%s remote ref%s", stdout, outputFile, exitStatus, env.State.Config.Workdir, env.ID, skippedChangesWarning(env))
+			if exitCode != 0 && request.GetBool("fail_on_error", false) {
+				return mcp.NewToolResultError(result), nil
+			}
+			return mcp.NewToolResultText(result), nil
 		},
 	}
 }
 
+// maxOutputFileSize caps the size of the output files returned by environment_run_cmd,
+// so that a large report doesn't flood the agent's context.
+const maxOutputFileSize = 256 * 1024
+
+// formatOutputFile renders the contents of an output file for the result of environment_run_cmd,
+// telling when they were truncated.
+func formatOutputFile(path, contents string, size int) string {
+	if len(contents) < size {
+		return fmt.Sprintf("\n\nContents of %s (truncated to the first %d of %d bytes, use environment_file_read to read the rest):\n%s", path, len(contents), size, contents)
+	}
+	return fmt.Sprintf("\n\nContents of %s:\n%s", path, contents)
+}
+
+// skippedChangesWarning tells about the binary files and submodule changes left out of the last commit, which would
+// otherwise only be found missing after merging the environment.
+func skippedChangesWarning(env *environment.Environment) string {
+	var warning string
+	if len(env.SkippedBinaryFiles) > 0 {
+		warning += fmt.Sprintf("\n\nWARNING: binary files were NOT committed: %s. The user can set binary_file_policy to commit or lfs in the environment configuration to commit them.", strings.Join(env.SkippedBinaryFiles, ", "))
+	}
+	if len(env.SkippedSubmodules) > 0 {
+		warning += fmt.Sprintf("\n\nWARNING: changes within submodules were NOT committed: %s. Submodules are read-only, so these changes never reach the user's repository.", strings.Join(env.SkippedSubmodules, ", "))
+	}
+	return warning
+}
+
 func createEnvironmentFileReadTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
 			envToolOptions{
 				name:                  "environment_file_read",
-				description:           "Read the contents of a file, specifying a line range or the entire file.",
+				description:           "Read the contents of a file, specifying a line range or the entire file. Symlinks are read through, and reported with their target.",
 				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
 			},
 			mcp.WithString("target_file",
 				mcp.Description("Path of the file to read, absolute or relative to the workdir"),
@@ -629,6 +1127,18 @@ func createEnvironmentFileReadTool(singleTenant bool) *Tool {
 			mcp.WithNumber("end_line_one_indexed_inclusive",
 				mcp.Description("The ending line (1-indexed, inclusive) to read from the file. Must specify both start_line and end_line if not reading entire file."),
 			),
+			mcp.WithBoolean("binary",
+				mcp.Description("Read raw bytes instead of lines and return them base64-encoded, e.g. to inspect binary headers. Uses offset and length instead of the line range."),
+			),
+			mcp.WithNumber("offset",
+				mcp.Description("In binary mode, the byte offset to start reading from. Defaults to 0."),
+			),
+			mcp.WithNumber("length",
+				mcp.Description("In binary mode, the number of bytes to read. Defaults to the rest of the file."),
+			),
+			mcp.WithBoolean("include_hash",
+				mcp.Description("Also return the sha256 hash of the whole file, to compare with the hash from environment_file_stat with include_hash later instead of reading the file again. Defaults to false."),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			_, env, err := openEnvironment(ctx, request)
@@ -641,27 +1151,75 @@ func createEnvironmentFileReadTool(singleTenant bool) *Tool {
 				return nil, err
 			}
 
+			// Symlinks are read through, but reported so that the file actually read is known
+			symlink := ""
+			target, isSymlink, err := env.SymlinkTarget(ctx, targetFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file: %w", err)
+			}
+			if isSymlink {
+				symlink = cmp.Or(target, "unknown target")
+			}
+
+			var hash string
+			if request.GetBool("include_hash", false) {
+				hash, err = env.FileHash(ctx, targetFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read file: %w", err)
+				}
+			}
+
+			if request.GetBool("binary", false) {
+				contents, err := env.FileReadBytes(ctx, targetFile, request.GetInt("offset", 0), request.GetInt("length", -1))
+				if err != nil {
+					return nil, fileReadError(targetFile, symlink, err)
+				}
+				return fileReadResult(base64.StdEncoding.EncodeToString(contents), hash, targetFile, symlink), nil
+			}
+
 			shouldReadEntireFile := request.GetBool("should_read_entire_file", false)
 			startLineOneIndexedInclusive := request.GetInt("start_line_one_indexed_inclusive", 0)
 			endLineOneIndexedInclusive := request.GetInt("end_line_one_indexed_inclusive", 0)
 
 			fileContents, err := env.FileRead(ctx, targetFile, shouldReadEntireFile, startLineOneIndexedInclusive, endLineOneIndexedInclusive)
 			if err != nil {
-				return nil, fmt.Errorf("failed to read file: %w", err)
+				return nil, fileReadError(targetFile, symlink, err)
 			}
 
-			return mcp.NewToolResultText(fileContents), nil
+			return fileReadResult(fileContents, hash, targetFile, symlink), nil
 		},
 	}
 }
 
+// fileReadResult returns the contents read from a file, with the hash of the file and the target of symlinks
+// as separate contents so that they can't be mistaken for the end of the file.
+func fileReadResult(contents, hash, targetFile, symlink string) *mcp.CallToolResult {
+	result := mcp.NewToolResultText(contents)
+	if hash != "" {
+		result.Content = append(result.Content, mcp.NewTextContent("sha256: "+hash))
+	}
+	if symlink != "" {
+		result.Content = append(result.Content, mcp.NewTextContent(fmt.Sprintf("symlink: %s -> %s", targetFile, symlink)))
+	}
+	return result
+}
+
+// fileReadError reports the failure to read a file, and which symlink it was read through, e.g. when it is broken.
+func fileReadError(targetFile, symlink string, err error) error {
+	if symlink != "" {
+		return fmt.Errorf("failed to read file: %s is a symlink to %s: %w", targetFile, symlink, err)
+	}
+	return fmt.Errorf("failed to read file: %w", err)
+}
+
 func createEnvironmentFileListTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
 			envToolOptions{
 				name:                  "environment_file_list",
-				description:           "List the contents of a directory",
+				description:           "List the contents of a directory. Symlinks are shown as `name -> target`.",
 				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
 			},
 			mcp.WithString("path",
 				mcp.Description("Path of the directory to list contents of, absolute or relative to the workdir"),
@@ -689,16 +1247,58 @@ func createEnvironmentFileListTool(singleTenant bool) *Tool {
 	}
 }
 
-func createEnvironmentFileEditTool(singleTenant bool) *Tool {
+func createEnvironmentFileStatTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
 			envToolOptions{
-				name:                  "environment_file_edit",
-				description:           "Find and replace text in a file.",
+				name:                  "environment_file_stat",
+				description:           "Get the metadata of a path without reading it: whether it exists, its type (file, directory, symlink or other), size in bytes, mode, modification time, the target of symlinks and, on request, the sha256 hash of the contents of files. Use it to check for a file, its size before reading it, or whether it changed since it was last read.",
 				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
 			},
-			mcp.WithString("target_file",
-				mcp.Description("Path of the file to write, absolute or relative to the workdir."),
+			mcp.WithString("path",
+				mcp.Description("Path of the file or directory, absolute or relative to the workdir"),
+				mcp.Required(),
+			),
+			mcp.WithBoolean("include_hash",
+				mcp.Description("Also return the sha256 hash of the contents of files, which reads the whole file. Defaults to false."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			path, err := request.RequireString("path")
+			if err != nil {
+				return nil, err
+			}
+
+			stat, err := env.FileStat(ctx, path, request.GetBool("include_hash", false))
+			if err != nil {
+				return nil, err
+			}
+			out, err := json.Marshal(stat)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal file metadata: %w", err)
+			}
+
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
+func createEnvironmentFileEditTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_file_edit",
+				description:           "Find and replace text in a file.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("target_file",
+				mcp.Description("Path of the file to write, absolute or relative to the workdir."),
 				mcp.Required(),
 			),
 			mcp.WithString("search_text",
@@ -712,6 +1312,9 @@ func createEnvironmentFileEditTool(singleTenant bool) *Tool {
 			mcp.WithString("which_match",
 				mcp.Description("The ID of the match to replace, if there were multiple matches."),
 			),
+			mcp.WithBoolean("allow_submodule_edit",
+				mcp.Description("Allow changing a file within a git submodule, which is read-only otherwise. Changes to submodules are not committed to the environment. Defaults to false."),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			repo, env, err := openEnvironment(ctx, request)
@@ -738,6 +1341,7 @@ func createEnvironmentFileEditTool(singleTenant bool) *Tool {
 				search,
 				replace,
 				request.GetString("which_match", ""),
+				request.GetBool("allow_submodule_edit", false),
 			); err != nil {
 				return mcp.NewToolResultErrorFromErr("failed to write file", err), nil
 			}
@@ -751,6 +1355,76 @@ func createEnvironmentFileEditTool(singleTenant bool) *Tool {
 	}
 }
 
+func createEnvironmentApplyPatchTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_apply_patch",
+				description:           "Apply a unified diff, changing several places of several files at once. Either all of the patch is applied, or nothing is.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("patch",
+				mcp.Description("The unified diff to apply, e.g. as produced by `git diff`. Paths are relative to the workdir, with or without a/ and b/ prefixes."),
+				mcp.Required(),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return mcp.NewToolResultErrorFromErr("unable to open the environment", err), nil
+			}
+
+			patch, err := request.RequireString("patch")
+			if err != nil {
+				return nil, err
+			}
+
+			if err := env.ApplyPatch(ctx, request.GetString("explanation", ""), patch); err != nil {
+				return mcp.NewToolResultErrorFromErr("failed to apply patch", err), nil
+			}
+
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return mcp.NewToolResultErrorFromErr("unable to update the environment", err), nil
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("patch applied successfully and committed to container-use/%s remote ref", env.ID)), nil
+		},
+	}
+}
+
+func createEnvironmentSubmoduleListTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_submodule_list",
+				description:           "List the git submodules of the environment with their URL and commit. Files within submodules are read-only unless allow_submodule_edit is set.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			submodules, err := repo.Submodules(ctx, env.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list submodules: %w", err)
+			}
+			if len(submodules) == 0 {
+				return mcp.NewToolResultText("The environment has no submodules."), nil
+			}
+
+			out, err := json.Marshal(submodules)
+			if err != nil {
+				return nil, err
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
 func createEnvironmentFileWriteTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -767,6 +1441,12 @@ func createEnvironmentFileWriteTool(singleTenant bool) *Tool {
 				mcp.Description("Full text content of the file you want to write."),
 				mcp.Required(),
 			),
+			mcp.WithBoolean("append",
+				mcp.Description("Append contents to the end of the file instead of overwriting it. The file is created if it doesn't exist. Defaults to false."),
+			),
+			mcp.WithBoolean("allow_submodule_edit",
+				mcp.Description("Allow changing a file within a git submodule, which is read-only otherwise. Changes to submodules are not committed to the environment. Defaults to false."),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			repo, env, err := openEnvironment(ctx, request)
@@ -783,7 +1463,11 @@ func createEnvironmentFileWriteTool(singleTenant bool) *Tool {
 				return nil, err
 			}
 
-			if err := env.FileWrite(ctx, request.GetString("explanation", ""), targetFile, contents); err != nil {
+			write := env.FileWrite
+			if request.GetBool("append", false) {
+				write = env.FileAppend
+			}
+			if err := write(ctx, request.GetString("explanation", ""), targetFile, contents, request.GetBool("allow_submodule_edit", false)); err != nil {
 				return nil, fmt.Errorf("failed to write file: %w", err)
 			}
 
@@ -791,7 +1475,7 @@ func createEnvironmentFileWriteTool(singleTenant bool) *Tool {
 				return nil, fmt.Errorf("unable to update the environment: %w", err)
 			}
 
-			return mcp.NewToolResultText(fmt.Sprintf("file %s written successfully and committed to container-use/%s remote ref", targetFile, env.ID)), nil
+			return mcp.NewToolResultText(fmt.Sprintf("file %s written successfully and committed to container-use/%s remote ref%s", targetFile, env.ID, skippedChangesWarning(env))), nil
 		},
 	}
 }
@@ -808,6 +1492,9 @@ func createEnvironmentFileDeleteTool(singleTenant bool) *Tool {
 				mcp.Description("Path of the file to delete, absolute or relative to the workdir."),
 				mcp.Required(),
 			),
+			mcp.WithBoolean("allow_submodule_edit",
+				mcp.Description("Allow changing a file within a git submodule, which is read-only otherwise. Changes to submodules are not committed to the environment. Defaults to false."),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			repo, env, err := openEnvironment(ctx, request)
@@ -820,7 +1507,7 @@ func createEnvironmentFileDeleteTool(singleTenant bool) *Tool {
 				return nil, err
 			}
 
-			if err := env.FileDelete(ctx, request.GetString("explanation", ""), targetFile); err != nil {
+			if err := env.FileDelete(ctx, request.GetString("explanation", ""), targetFile, request.GetBool("allow_submodule_edit", false)); err != nil {
 				return nil, fmt.Errorf("failed to delete file: %w", err)
 			}
 
@@ -833,6 +1520,104 @@ func createEnvironmentFileDeleteTool(singleTenant bool) *Tool {
 	}
 }
 
+func createEnvironmentMkdirTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_mkdir",
+				description:           "Create a directory, including missing parents. Use it to scaffold directory layouts: git doesn't track empty directories, so a .gitkeep file is added to keep new empty directories.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("target_dir",
+				mcp.Description("Path of the directory to create, absolute or relative to the workdir."),
+				mcp.Required(),
+			),
+			mcp.WithBoolean("gitkeep",
+				mcp.Description("Add a .gitkeep file if the directory is empty so it is kept in the environment's history. Defaults to true."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			targetDir, err := request.RequireString("target_dir")
+			if err != nil {
+				return nil, err
+			}
+
+			if err := env.Mkdir(ctx, request.GetString("explanation", ""), targetDir, request.GetBool("gitkeep", true)); err != nil {
+				return nil, fmt.Errorf("failed to create directory: %w", err)
+			}
+
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("failed to update env: %w", err)
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("directory %s created successfully and committed to container-use/%s remote ref", targetDir, env.ID)), nil
+		},
+	}
+}
+
+func createEnvironmentCopyFileTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_copy_file",
+				description:           "Copy a file or directory from another environment of the same repository into this environment, e.g. to bring a fix from a sibling environment.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("source_environment_id",
+				mcp.Description("ID of the environment to copy from."),
+				mcp.Required(),
+			),
+			mcp.WithString("source_path",
+				mcp.Description("Path of the file or directory to copy, absolute or relative to the workdir of the source environment."),
+				mcp.Required(),
+			),
+			mcp.WithString("target_path",
+				mcp.Description("Path to copy to, absolute or relative to the workdir. Defaults to source_path."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			sourceID, err := request.RequireString("source_environment_id")
+			if err != nil {
+				return nil, err
+			}
+			sourcePath, err := request.RequireString("source_path")
+			if err != nil {
+				return nil, err
+			}
+			targetPath := request.GetString("target_path", sourcePath)
+
+			dag, ok := ctx.Value(daggerClientKey{}).(*dagger.Client)
+			if !ok {
+				return nil, fmt.Errorf("dagger client not found in context")
+			}
+			source, err := repo.Get(ctx, dag, sourceID)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get source environment: %w", err)
+			}
+
+			if err := env.FileCopyFrom(ctx, request.GetString("explanation", ""), source, sourcePath, targetPath); err != nil {
+				return nil, fmt.Errorf("failed to copy file: %w", err)
+			}
+
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("unable to update the environment: %w", err)
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("%s copied from %s to %s and committed to container-use/%s remote ref", sourcePath, sourceID, targetPath, env.ID)), nil
+		},
+	}
+}
+
 func createEnvironmentCheckpointTool(singleTenant bool) *Tool {
 	return &Tool{
 		Definition: newEnvironmentTool(
@@ -845,6 +1630,12 @@ func createEnvironmentCheckpointTool(singleTenant bool) *Tool {
 				mcp.Description("Container image destination to checkpoint to (e.g. registry.com/user/image:tag"),
 				mcp.Required(),
 			),
+			mcp.WithString("registry_username",
+				mcp.Description("Username to authenticate to the registry with. Requires registry_secret."),
+			),
+			mcp.WithString("registry_secret",
+				mcp.Description("Name of the secret holding the registry password or token, among the secrets the user configured for the environment (e.g. REGISTRY_TOKEN). Never pass the secret value itself."),
+			),
 		),
 		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			_, env, err := openEnvironment(ctx, request)
@@ -857,7 +1648,12 @@ func createEnvironmentCheckpointTool(singleTenant bool) *Tool {
 				return nil, err
 			}
 
-			endpoint, err := env.Checkpoint(ctx, destination)
+			auth, err := env.ConfiguredRegistryAuth(request.GetString("registry_username", ""), request.GetString("registry_secret", ""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid registry credentials: %w", err)
+			}
+
+			endpoint, err := env.Checkpoint(ctx, destination, auth)
 			if err != nil {
 				return nil, fmt.Errorf("failed to checkpoint environment: %w", err)
 			}
@@ -942,3 +1738,232 @@ func createEnvironmentAddServiceTool(singleTenant bool) *Tool {
 		},
 	}
 }
+
+func createEnvironmentMountTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name: "environment_mount",
+				description: `Mount a directory from the user's machine into the environment, for large assets (datasets, model weights, ...) that must not be committed.
+The directory is a snapshot taken when mounted: changes on the host are not visible until the environment is rebuilt, and changes made in the environment are discarded and never reach the host.
+Mounted directories are never committed, even when mounted inside the workdir. Only mount what the user asked for: the environment gets read access to everything in the directory.`,
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("source",
+				mcp.Description("Absolute path of the directory on the host."),
+				mcp.Required(),
+			),
+			mcp.WithString("target",
+				mcp.Description("Path to mount the directory at in the environment, relative to the workdir or absolute (e.g. `/mnt/data`). Must not already exist."),
+				mcp.Required(),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			source, err := request.RequireString("source")
+			if err != nil {
+				return nil, err
+			}
+			target, err := request.RequireString("target")
+			if err != nil {
+				return nil, err
+			}
+
+			if err := env.Mount(ctx, request.GetString("explanation", ""), &environment.MountConfig{
+				Source: source,
+				Target: target,
+			}); err != nil {
+				return nil, fmt.Errorf("failed to mount directory: %w", err)
+			}
+
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("failed to update env: %w", err)
+			}
+
+			mount := env.State.Config.Mounts[len(env.State.Config.Mounts)-1]
+			return mcp.NewToolResultText(fmt.Sprintf("Directory %s mounted at %s", mount.Source, mount.Target)), nil
+		},
+	}
+}
+
+func createEnvironmentProcessListTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_process_list",
+				description:           "List the background processes started in the environment with environment_run_cmd.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := json.Marshal(env.Processes())
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal processes: %w", err)
+			}
+
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	}
+}
+
+func createEnvironmentProcessLogsTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_process_logs",
+				description:           "Read the combined stdout and stderr captured from a background process.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+			mcp.WithString("process_id",
+				mcp.Description("The ID of the background process, as returned by environment_run_cmd."),
+				mcp.Required(),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			processID, err := request.RequireString("process_id")
+			if err != nil {
+				return nil, err
+			}
+
+			logs, err := env.ProcessLogs(ctx, processID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read process logs: %w", err)
+			}
+
+			return mcp.NewToolResultText(logs), nil
+		},
+	}
+}
+
+func createEnvironmentProcessOutputSinceTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_process_output_since",
+				description:           "Read the combined stdout and stderr a background process produced since the previous call, e.g. to check on the progress of a long build without reading its whole output again.",
+				useCurrentEnvironment: singleTenant,
+				readOnly:              true,
+			},
+			mcp.WithString("process_id",
+				mcp.Description("The ID of the background process, as returned by environment_run_cmd."),
+				mcp.Required(),
+			),
+			mcp.WithNumber("cursor",
+				mcp.Description("The cursor returned by the previous call. Defaults to 0, reading the output from the start."),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			processID, err := request.RequireString("process_id")
+			if err != nil {
+				return nil, err
+			}
+
+			output, err := env.ProcessOutputSince(ctx, processID, request.GetInt("cursor", 0))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read process output: %w", err)
+			}
+
+			if output.Exited {
+				return mcp.NewToolResultText(fmt.Sprintf("%s\n\nThe process exited with code %d, it won't produce any more output.", output.Output, output.ExitCode)), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("%s\n\nThe process is still running. Call again with cursor %d to read the output produced after this call.", output.Output, output.Cursor)), nil
+		},
+	}
+}
+
+func createEnvironmentProcessStopTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_process_stop",
+				description:           "Stop a background process and the host tunnels exposing its ports.",
+				useCurrentEnvironment: singleTenant,
+			},
+			mcp.WithString("process_id",
+				mcp.Description("The ID of the background process, as returned by environment_run_cmd."),
+				mcp.Required(),
+			),
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			repo, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			processID, err := request.RequireString("process_id")
+			if err != nil {
+				return nil, err
+			}
+
+			if err := env.StopProcess(ctx, processID); err != nil {
+				return nil, err
+			}
+
+			if err := repo.Update(ctx, env, request.GetString("explanation", "")); err != nil {
+				return nil, fmt.Errorf("failed to update env: %w", err)
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("Process %s stopped successfully", processID)), nil
+		},
+	}
+}
+
+func createEnvironmentCancelTool(singleTenant bool) *Tool {
+	return &Tool{
+		Definition: newEnvironmentTool(
+			envToolOptions{
+				name:                  "environment_cancel",
+				description:           "Cancel the command currently running in the foreground of the environment with environment_run_cmd, e.g. when it's wrong or taking too long. Returns the output it produced so far, unless the image lacks sh. Changes made by the canceled command are discarded. Use environment_process_stop for background commands.",
+				useCurrentEnvironment: singleTenant,
+			},
+		),
+		Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_, env, err := openEnvironment(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+
+			canceled, err := env.CancelCommands(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(canceled) == 0 {
+				return mcp.NewToolResultText(fmt.Sprintf("No command is running in environment %s.", env.ID)), nil
+			}
+
+			var result strings.Builder
+			for i, command := range canceled {
+				if i > 0 {
+					result.WriteString("\n\n")
+				}
+				fmt.Fprintf(&result, "Canceled `%s` after %s.", command.Command, time.Since(command.StartedAt).Round(time.Second))
+				if command.Output != "" {
+					fmt.Fprintf(&result, " Output so far:\n%s", command.Output)
+				} else {
+					result.WriteString(" It produced no output.")
+				}
+			}
+			return mcp.NewToolResultText(result.String()), nil
+		},
+	}
+}
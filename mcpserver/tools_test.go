@@ -0,0 +1,96 @@
+package mcpserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dagger/container-use/repository"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyTools(t *testing.T) {
+	names := []string{}
+	for _, tool := range ReadOnlyTools(Tools()) {
+		names = append(names, tool.Definition.Name)
+	}
+
+	assert.Contains(t, names, "environment_open")
+	assert.Contains(t, names, "environment_create")
+	assert.Contains(t, names, "environment_file_read")
+	assert.Contains(t, names, "environment_file_list")
+	assert.Contains(t, names, "environment_file_stat")
+	assert.Contains(t, names, "environment_status")
+	assert.Contains(t, names, "environment_image_diff")
+	assert.Contains(t, names, "environment_local_diff")
+	assert.NotContains(t, names, "environment_run_cmd")
+	assert.NotContains(t, names, "environment_file_write")
+	assert.NotContains(t, names, "environment_file_delete")
+	assert.NotContains(t, names, "environment_config")
+	assert.NotContains(t, names, "environment_cancel")
+}
+
+func TestReadOnlyToolsCannotReplace(t *testing.T) {
+	var create *Tool
+	for _, tool := range ReadOnlyTools(createTools(true)) {
+		if tool.Definition.Name == "environment_create" {
+			create = tool
+		}
+	}
+	require.NotNil(t, create)
+	assert.NotContains(t, create.Definition.InputSchema.Properties, "allow_replace")
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"title": "Replace", "allow_replace": true}
+	_, err := create.Handler(t.Context(), request)
+	assert.ErrorContains(t, err, "not available in read-only mode")
+
+	// The tools served outside of read-only mode keep the argument
+	for _, tool := range createTools(true) {
+		if tool.Definition.Name == "environment_create" {
+			assert.Contains(t, tool.Definition.InputSchema.Properties, "allow_replace")
+		}
+	}
+}
+
+func TestFormatOutputFile(t *testing.T) {
+	assert.Equal(t, "\n\nContents of report.txt:\nok\n", formatOutputFile("report.txt", "ok\n", 3))
+	assert.Equal(t, "\n\nContents of coverage.xml (truncated to the first 2 of 10 bytes, use environment_file_read to read the rest):\n<c",
+		formatOutputFile("coverage.xml", "<c", 10))
+}
+
+func TestFileReadResult(t *testing.T) {
+	result := fileReadResult("hello\n", "", "hello.txt", "")
+	require.Len(t, result.Content, 1)
+
+	result = fileReadResult("hello\n", "5891b5b5", "hello.txt", "")
+	require.Len(t, result.Content, 2)
+	assert.Equal(t, mcp.NewTextContent("sha256: 5891b5b5"), result.Content[1])
+
+	result = fileReadResult("hello\n", "", "current.txt", "hello.txt")
+	require.Len(t, result.Content, 2)
+	assert.Equal(t, mcp.NewTextContent("symlink: current.txt -> hello.txt"), result.Content[1])
+
+	assert.EqualError(t, fileReadError("current.txt", "missing.txt", errors.New("no such file")),
+		"failed to read file: current.txt is a symlink to missing.txt: no such file")
+}
+
+func TestRecentCommands(t *testing.T) {
+	history := []repository.HistoryEntry{
+		{Note: "$ go mod download"},
+		{Note: "Write main.go"},
+		{Note: "$ go build ./...\n$ go test ./...\nexit 1\nFAIL"},
+	}
+
+	assert.Equal(t, []repository.CommandResult{
+		{Command: "go build ./..."},
+		{Command: "go test ./...", ExitCode: 1},
+	}, recentCommands(history, 2))
+	assert.Equal(t, []repository.CommandResult{
+		{Command: "go mod download"},
+		{Command: "go build ./..."},
+		{Command: "go test ./...", ExitCode: 1},
+	}, recentCommands(history, 5))
+	assert.Empty(t, recentCommands(nil, 5))
+}
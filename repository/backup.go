@@ -0,0 +1,334 @@
+package repository
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// backupManifestFile is stored at the root of backups and records where the data was backed up from,
+// so absolute paths linking worktrees and forks can be rewritten on restore.
+const backupManifestFile = "container-use-backup.json"
+
+type backupManifest struct {
+	BasePath string `json:"base_path"`
+}
+
+// Backup writes a gzipped tarball of all container-use data (forks with their notes, and worktrees) to w.
+func Backup(ctx context.Context, w io.Writer) error {
+	return BackupWithBasePath(ctx, cuGlobalConfigPath, w)
+}
+
+// BackupWithBasePath is like Backup but reads container-use data from a custom base path.
+func BackupWithBasePath(ctx context.Context, basePath string, w io.Writer) error {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	manifest, err := json.Marshal(backupManifest{BasePath: basePath})
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name: backupManifestFile,
+		Mode: 0644,
+		Size: int64(len(manifest)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, dir := range []string{"repos", "worktrees"} {
+		root := filepath.Join(basePath, dir)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+		if err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return addToBackup(tw, basePath, p, d)
+		}); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", root, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func addToBackup(tw *tar.Writer, basePath, p string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(basePath, p)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if d.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Restore recreates container-use data from a backup produced by Backup.
+// Links between worktrees and forks are rewritten to the new location. Existing data is never overwritten.
+// User repositories pointing to a fork at its old location are updated the next time they are opened.
+func Restore(ctx context.Context, r io.Reader) error {
+	return RestoreWithBasePath(ctx, cuGlobalConfigPath, r)
+}
+
+// RestoreWithBasePath is like Restore but writes container-use data to a custom base path.
+// The backup is extracted next to the data first, so an invalid or interrupted backup leaves nothing behind.
+func RestoreWithBasePath(ctx context.Context, basePath string, r io.Reader) error {
+	basePath, err := homedir.Expand(basePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return err
+	}
+	// Within the base path, so that moving the restored data into place is a rename
+	tmpDir, err := os.MkdirTemp(basePath, ".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	defer gr.Close()
+
+	var manifest *backupManifest
+	tr := tar.NewReader(gr)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid backup: %w", err)
+		}
+
+		if hdr.Name == backupManifestFile {
+			manifest = &backupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return fmt.Errorf("invalid backup manifest: %w", err)
+			}
+			continue
+		}
+
+		if err := restoreEntry(tmpDir, hdr, tr); err != nil {
+			return err
+		}
+	}
+
+	if manifest == nil {
+		return errors.New("invalid backup: missing manifest")
+	}
+
+	if err := rewriteBackupPaths(tmpDir, manifest.BasePath, basePath); err != nil {
+		return err
+	}
+	return moveRestored(tmpDir, basePath)
+}
+
+// moveRestored moves the forks and worktrees extracted to tmpDir into basePath. Nothing is moved if any of them
+// already exists.
+func moveRestored(tmpDir, basePath string) error {
+	var names []string
+	for _, dir := range []string{"repos", "worktrees"} {
+		entries, err := os.ReadDir(filepath.Join(tmpDir, dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := filepath.Join(dir, entry.Name())
+			if _, err := os.Lstat(filepath.Join(basePath, name)); err == nil {
+				return fmt.Errorf("refusing to overwrite existing %s, restore into an empty configuration directory", filepath.Join(basePath, name))
+			}
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(basePath, name)), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(tmpDir, name), filepath.Join(basePath, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreEntry(basePath string, hdr *tar.Header, r io.Reader) error {
+	name := path.Clean(hdr.Name)
+	if !strings.HasPrefix(name, "repos/") && !strings.HasPrefix(name, "worktrees/") && name != "repos" && name != "worktrees" {
+		return fmt.Errorf("invalid backup: unexpected entry %q", hdr.Name)
+	}
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("invalid backup: unsafe entry %q", hdr.Name)
+	}
+	target := filepath.Join(basePath, filepath.FromSlash(name))
+	// Entries must not be written through symlinks restored before them, which could point anywhere
+	if err := checkNoSymlinkParents(basePath, name); err != nil {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, hdr.FileInfo().Mode().Perm()|0700)
+	case tar.TypeSymlink:
+		link := filepath.FromSlash(hdr.Linkname)
+		if filepath.IsAbs(link) || path.IsAbs(hdr.Linkname) {
+			return fmt.Errorf("invalid backup: symlink %q points to absolute path %q", hdr.Name, hdr.Linkname)
+		}
+		if resolved, err := filepath.Rel(basePath, filepath.Join(filepath.Dir(target), link)); err != nil || !filepath.IsLocal(resolved) {
+			return fmt.Errorf("invalid backup: symlink %q points outside of the backup to %q", hdr.Name, hdr.Linkname)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, hdr.FileInfo().Mode().Perm())
+		if err != nil {
+			if os.IsExist(err) {
+				return fmt.Errorf("refusing to overwrite existing %s, restore into an empty configuration directory", target)
+			}
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(f, r)
+		return err
+	default:
+		return fmt.Errorf("invalid backup: unsupported entry type for %q", hdr.Name)
+	}
+}
+
+// checkNoSymlinkParents returns an error if a directory of name, a slash-separated path below basePath,
+// is a symlink.
+func checkNoSymlinkParents(basePath, name string) error {
+	current := basePath
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid backup: refusing to write %q through symlink %s", name, current)
+		}
+	}
+	return nil
+}
+
+// rewriteBackupPaths updates the absolute paths git uses to link worktrees and forks together, for the data
+// restored to dir to be moved to newBasePath. Worktrees (and their submodules) point to their fork with .git
+// files, and forks point back to their worktrees with gitdir files.
+func rewriteBackupPaths(dir, oldBasePath, newBasePath string) error {
+	if oldBasePath == newBasePath {
+		return nil
+	}
+
+	rewrite := func(root, name string) error {
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			return nil
+		}
+		return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() || d.Name() != name {
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(string(data), oldBasePath) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(p, []byte(strings.ReplaceAll(string(data), oldBasePath, newBasePath)), info.Mode().Perm())
+		})
+	}
+
+	if err := rewrite(filepath.Join(dir, "worktrees"), ".git"); err != nil {
+		return fmt.Errorf("failed to rewrite worktree links: %w", err)
+	}
+	if err := rewrite(filepath.Join(dir, "repos"), "gitdir"); err != nil {
+		return fmt.Errorf("failed to rewrite fork links: %w", err)
+	}
+	return nil
+}
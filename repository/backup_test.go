@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+	_, err := repo.getWorktree(ctx, "test-env")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, BackupWithBasePath(ctx, repo.basePath, &buf))
+
+	// Simulate moving to a new machine: the old configuration directory is gone
+	require.NoError(t, os.RemoveAll(repo.basePath))
+	newBasePath := t.TempDir()
+	require.NoError(t, RestoreWithBasePath(ctx, newBasePath, bytes.NewReader(buf.Bytes())))
+
+	restored, err := OpenWithBasePath(ctx, repo.userRepoPath, newBasePath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(restored.forkRepoPath, newBasePath), "fork should be found in the new location")
+
+	remote, err := RunGitCommand(ctx, repo.userRepoPath, "remote", "get-url", containerUseRemote)
+	require.NoError(t, err)
+	assert.Equal(t, restored.forkRepoPath, strings.TrimSpace(remote), "remote should point to the restored fork")
+
+	envs, err := restored.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, envs, 1)
+	assert.Equal(t, "test-env", envs[0].ID)
+	assert.Equal(t, "test-env", envs[0].State.Title)
+
+	// The worktree must be linked to the restored fork
+	worktreePath, err := restored.WorktreePath("test-env")
+	require.NoError(t, err)
+	branch, err := RunGitCommand(ctx, worktreePath, "rev-parse", "--abbrev-ref", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "test-env", strings.TrimSpace(branch))
+	worktrees, err := RunGitCommand(ctx, restored.forkRepoPath, "worktree", "list", "--porcelain")
+	require.NoError(t, err)
+	assert.Contains(t, worktrees, "worktree "+worktreePath)
+	assert.NotContains(t, worktrees, "prunable")
+
+	t.Run("refuses_to_overwrite", func(t *testing.T) {
+		err := RestoreWithBasePath(ctx, newBasePath, bytes.NewReader(buf.Bytes()))
+		assert.ErrorContains(t, err, "refusing to overwrite")
+	})
+
+	t.Run("leaves_nothing_behind_on_failure", func(t *testing.T) {
+		basePath := t.TempDir()
+		err := RestoreWithBasePath(ctx, basePath, bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+		assert.ErrorContains(t, err, "invalid backup")
+		entries, err := os.ReadDir(basePath)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestRestoreRejectsUnsafeSymlinks(t *testing.T) {
+	ctx := context.Background()
+
+	// maliciousBackup returns a backup made of the given entries, followed by a manifest
+	maliciousBackup := func(t *testing.T, entries ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for _, hdr := range entries {
+			require.NoError(t, tw.WriteHeader(hdr))
+			if hdr.Typeflag == tar.TypeReg {
+				_, err := tw.Write([]byte("pwned"))
+				require.NoError(t, err)
+			}
+		}
+		manifest := []byte(`{"base_path": "/old"}`)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: backupManifestFile, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(manifest))}))
+		_, err := tw.Write(manifest)
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return &buf
+	}
+	outside := t.TempDir()
+
+	tests := map[string][]*tar.Header{
+		"absolute_link": {
+			{Name: "repos/escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "repos/escape/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		},
+		"relative_link_outside": {
+			{Name: "repos/escape", Typeflag: tar.TypeSymlink, Linkname: "../../../../../../../../" + outside},
+			{Name: "repos/escape/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		},
+		"write_through_link": {
+			{Name: "repos/inside", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "worktrees", Typeflag: tar.TypeSymlink, Linkname: "repos/inside"},
+			{Name: "worktrees/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		},
+	}
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := RestoreWithBasePath(ctx, t.TempDir(), maliciousBackup(t, entries...))
+			assert.ErrorContains(t, err, "invalid backup")
+			assert.NoFileExists(t, filepath.Join(outside, "pwned"))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffEnvironments(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "env-a")
+
+	writeFile(t, repo.userRepoPath, "README.md", "# Test\nUpdated")
+	writeFile(t, repo.userRepoPath, "src/main.go", "package main")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-m", "Second attempt")
+	require.NoError(t, err)
+	createTestEnvironment(t, repo, "env-b")
+
+	t.Run("full", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, repo.DiffEnvironments(ctx, "env-a", "env-b", false, nil, &buf))
+		assert.Contains(t, buf.String(), "+Updated")
+		assert.Contains(t, buf.String(), "+package main")
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, repo.DiffEnvironments(ctx, "env-a", "env-b", true, nil, &buf))
+		assert.Contains(t, buf.String(), "2 files changed")
+		assert.NotContains(t, buf.String(), "+package main")
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, repo.DiffEnvironments(ctx, "env-a", "env-b", false, []string{"src"}, &buf))
+		assert.Contains(t, buf.String(), "src/main.go")
+		assert.NotContains(t, buf.String(), "README.md")
+	})
+
+	t.Run("unknown_environment", func(t *testing.T) {
+		err := repo.DiffEnvironments(ctx, "env-a", "missing-env", false, nil, io.Discard)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
+
+func TestDiffLocal(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironmentWithFile(t, repo, "env-a", "feature.txt", "from the environment\n")
+
+	// Uncommitted and untracked changes are compared, staged ones stay staged
+	writeFile(t, repo.userRepoPath, "README.md", "# Test\nLocal edit")
+	writeFile(t, repo.userRepoPath, "notes.txt", "untracked\n")
+	writeFile(t, repo.userRepoPath, "staged.txt", "staged\n")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", "staged.txt")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.DiffLocal(ctx, "env-a", false, nil, &buf))
+	assert.Contains(t, buf.String(), "+from the environment")
+	assert.Contains(t, buf.String(), "-Local edit")
+	assert.Contains(t, buf.String(), "-untracked")
+	assert.Contains(t, buf.String(), "-staged")
+
+	buf.Reset()
+	require.NoError(t, repo.DiffLocal(ctx, "env-a", true, []string{"feature.txt"}, &buf))
+	assert.Contains(t, buf.String(), "1 file changed")
+
+	status, err := RunGitCommand(ctx, repo.userRepoPath, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, " M README.md\nA  staged.txt\n?? notes.txt\n", status)
+
+	err = repo.DiffLocal(ctx, "missing-env", false, nil, io.Discard)
+	assert.ErrorContains(t, err, "not found")
+}
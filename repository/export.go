@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// ExportFormat is the archive format produced by Export.
+type ExportFormat string
+
+const (
+	// ExportFormatBundle is a git bundle containing the environment branch with its full history
+	// along with the container-use notes, so the environment can be re-imported later.
+	ExportFormatBundle ExportFormat = "bundle"
+	// ExportFormatTar is a tarball of the environment's current tree, without any history.
+	ExportFormatTar ExportFormat = "tar"
+)
+
+// Export writes an archive of the identified environment to w.
+// A bundle contains the full history of the environment branch plus the container-use notes,
+// whereas a tarball only contains the files of the environment's latest commit.
+func (r *Repository) Export(ctx context.Context, id string, format ExportFormat, w io.Writer) error {
+	if err := r.exists(ctx, id); err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportFormatBundle:
+		refs := []string{"refs/heads/" + id}
+		for _, ref := range []string{gitNotesLogRef, gitNotesStateRef} {
+			fullRef := "refs/notes/" + ref
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "show-ref", "--verify", "--quiet", fullRef); err == nil {
+				refs = append(refs, fullRef)
+			}
+		}
+		return r.lockManager.WithRLock(ctx, LockTypeForkRepo, func() error {
+			return runGitCommandStdout(ctx, r.forkRepoPath, w, append([]string{"bundle", "create", "-"}, refs...)...)
+		})
+	case ExportFormatTar:
+		return r.lockManager.WithRLock(ctx, LockTypeForkRepo, func() error {
+			return runGitCommandStdout(ctx, r.forkRepoPath, w, "archive", "--format=tar", "refs/heads/"+id)
+		})
+	default:
+		return fmt.Errorf("unsupported export format %q (expected %q or %q)", format, ExportFormatBundle, ExportFormatTar)
+	}
+}
+
+// runGitCommandStdout executes a git command, streaming its stdout to w.
+// Unlike RunInteractiveGitCommand, stderr is kept separate so binary output isn't corrupted.
+func runGitCommandStdout(ctx context.Context, dir string, w io.Writer, args ...string) (rerr error) {
+	logGitCommand(dir, args)
+	defer func() {
+		logGitCommandDone(dir, args, rerr)
+	}()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git command failed: %w\nOutput: %s", err, stderr.String())
+	}
+	return nil
+}
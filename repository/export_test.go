@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	t.Run("bundle", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, repo.Export(ctx, "test-env", ExportFormatBundle, &buf))
+
+		bundlePath := filepath.Join(t.TempDir(), "test-env.bundle")
+		require.NoError(t, os.WriteFile(bundlePath, buf.Bytes(), 0644))
+
+		heads, err := RunGitCommand(ctx, repo.userRepoPath, "bundle", "list-heads", bundlePath)
+		require.NoError(t, err)
+		assert.Contains(t, heads, "refs/heads/test-env")
+		assert.Contains(t, heads, "refs/notes/"+gitNotesStateRef)
+	})
+
+	t.Run("tar", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, repo.Export(ctx, "test-env", ExportFormatTar, &buf))
+
+		tr := tar.NewReader(&buf)
+		var names []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			names = append(names, hdr.Name)
+		}
+		assert.Contains(t, names, "README.md")
+	})
+
+	t.Run("unknown_format", func(t *testing.T) {
+		err := repo.Export(ctx, "test-env", ExportFormat("zip"), io.Discard)
+		assert.ErrorContains(t, err, "unsupported export format")
+	})
+
+	t.Run("unknown_environment", func(t *testing.T) {
+		err := repo.Export(ctx, "missing-env", ExportFormatBundle, io.Discard)
+		assert.ErrorContains(t, err, "not found")
+	})
+}
@@ -1,11 +1,14 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
@@ -26,28 +29,53 @@ const (
 	LockTypeNotes LockType = "notes"
 )
 
+const (
+	// DefaultLockTimeout is how long to wait for another process to release a lock before giving up
+	DefaultLockTimeout = 5 * time.Minute
+	// LockTimeoutEnv overrides DefaultLockTimeout with a duration such as "30s". 0 waits forever.
+	LockTimeoutEnv = "CONTAINER_USE_LOCK_TIMEOUT"
+)
+
 // RepositoryLockManager provides granular process-level locking for repository operations
 // to prevent git concurrency issues when multiple container-use instances
 // operate on the same repository simultaneously.
 type RepositoryLockManager struct {
 	repoPath string
+	timeout  time.Duration
 	locks    map[LockType]*RepositoryLock
 	mu       sync.Mutex
 }
 
 // RepositoryLock provides process-level locking for specific operation types
 type RepositoryLock struct {
-	flock *flock.Flock
+	flock    *flock.Flock
+	lockType LockType
+	repoPath string
+	timeout  time.Duration
 }
 
 // NewRepositoryLockManager creates a new repository lock manager for the given repository path.
 func NewRepositoryLockManager(repoPath string) *RepositoryLockManager {
 	return &RepositoryLockManager{
 		repoPath: repoPath,
+		timeout:  lockTimeout(),
 		locks:    make(map[LockType]*RepositoryLock),
 	}
 }
 
+func lockTimeout() time.Duration {
+	value := os.Getenv(LockTimeoutEnv)
+	if value == "" {
+		return DefaultLockTimeout
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		slog.Warn("Ignoring invalid lock timeout", "env", LockTimeoutEnv, "value", value)
+		return DefaultLockTimeout
+	}
+	return timeout
+}
+
 // GetLock returns a lock for the specified operation type
 func (rlm *RepositoryLockManager) GetLock(lockType LockType) *RepositoryLock {
 	rlm.mu.Lock()
@@ -67,7 +95,10 @@ func (rlm *RepositoryLockManager) GetLock(lockType LockType) *RepositoryLock {
 	}
 
 	lock := &RepositoryLock{
-		flock: flock.New(lockFile),
+		flock:    flock.New(lockFile),
+		lockType: lockType,
+		repoPath: rlm.repoPath,
+		timeout:  rlm.timeout,
 	}
 
 	rlm.locks[lockType] = lock
@@ -87,33 +118,68 @@ func (rlm *RepositoryLockManager) WithRLock(ctx context.Context, lockType LockTy
 
 // Lock acquires an exclusive repository lock.
 func (rl *RepositoryLock) Lock(ctx context.Context) error {
+	return rl.acquire(ctx, "exclusive", rl.flock.TryLockContext)
+}
+
+// RLock acquires a shared repository lock.
+// Multiple processes can hold shared locks simultaneously.
+func (rl *RepositoryLock) RLock(ctx context.Context) error {
+	return rl.acquire(ctx, "shared", rl.flock.TryRLockContext)
+}
+
+// acquire waits for the lock until the context is done or the lock timeout elapses,
+// then records the current process as its holder.
+func (rl *RepositoryLock) acquire(ctx context.Context, kind string, tryLock func(context.Context, time.Duration) (bool, error)) error {
 	const retryDelay = 100 * time.Millisecond
 
-	locked, err := rl.flock.TryLockContext(ctx, retryDelay)
-	if err != nil {
-		return fmt.Errorf("failed to acquire exclusive lock: %w", err)
+	lockCtx := ctx
+	if rl.timeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, rl.timeout)
+		defer cancel()
 	}
+
+	locked, err := tryLock(lockCtx, retryDelay)
 	if !locked {
-		return fmt.Errorf("failed to acquire exclusive lock within context timeout")
+		if ctx.Err() == nil && errors.Is(lockCtx.Err(), context.DeadlineExceeded) {
+			return rl.timeoutError()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to acquire %s lock: %w", kind, err)
+		}
+		return fmt.Errorf("failed to acquire %s lock within context timeout", kind)
 	}
 
+	rl.recordHolder()
 	return nil
 }
 
-// RLock acquires a shared repository lock.
-// Multiple processes can hold shared locks simultaneously.
-func (rl *RepositoryLock) RLock(ctx context.Context) error {
-	const retryDelay = 100 * time.Millisecond
+// recordHolder writes the PID of the current process to the lock file, so processes waiting
+// for the lock can report who holds it. This is best effort: locked files can't be written on Windows.
+func (rl *RepositoryLock) recordHolder() {
+	_ = os.WriteFile(rl.flock.Path(), []byte(strconv.Itoa(os.Getpid())), 0600)
+}
 
-	locked, err := rl.flock.TryRLockContext(ctx, retryDelay)
+// holder returns the PID of the last process that acquired the lock, or 0 if unknown.
+func (rl *RepositoryLock) holder() int {
+	data, err := os.ReadFile(rl.flock.Path())
 	if err != nil {
-		return fmt.Errorf("failed to acquire shared lock: %w", err)
+		return 0
 	}
-	if !locked {
-		return fmt.Errorf("failed to acquire shared lock within context timeout")
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return 0
 	}
+	return pid
+}
 
-	return nil
+func (rl *RepositoryLock) timeoutError() error {
+	holder := "another container-use process"
+	if pid := rl.holder(); pid != 0 {
+		holder = fmt.Sprintf("another container-use process (pid %d)", pid)
+	}
+	return fmt.Errorf("%s holds the %s lock for repo %s, gave up after %s (lock file: %s, set %s to wait longer)",
+		holder, rl.lockType, rl.repoPath, rl.timeout, rl.flock.Path(), LockTimeoutEnv)
 }
 
 // Unlock releases the repository lock.
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepositoryLockTimeout tests that waiting for a lock held by another process times out with its PID
+func TestRepositoryLockTimeout(t *testing.T) {
+	ctx := context.Background()
+	repoPath := t.TempDir()
+
+	// Lock managers don't share file handles, so a second manager contends like another process would
+	holder := NewRepositoryLockManager(repoPath)
+	lock := holder.GetLock(LockTypeForkRepo)
+	require.NoError(t, lock.Lock(ctx))
+	t.Cleanup(func() { lock.Unlock() })
+
+	waiter := NewRepositoryLockManager(repoPath)
+	waiter.timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	err := waiter.WithLock(ctx, LockTypeForkRepo, func() error {
+		t.Fatal("lock should not be acquired")
+		return nil
+	})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Contains(t, err.Error(), fmt.Sprintf("another container-use process (pid %d) holds the fork-repo lock for repo %s", os.Getpid(), repoPath))
+
+	// Other lock types are independent
+	require.NoError(t, waiter.WithRLock(ctx, LockTypeNotes, func() error { return nil }))
+
+	// Once released, the lock can be acquired
+	require.NoError(t, lock.Unlock())
+	require.NoError(t, waiter.WithLock(ctx, LockTypeForkRepo, func() error { return nil }))
+}
+
+// TestRepositoryLockCancel tests that cancellation is reported as such rather than as a timeout
+func TestRepositoryLockCancel(t *testing.T) {
+	repoPath := t.TempDir()
+
+	holder := NewRepositoryLockManager(repoPath)
+	lock := holder.GetLock(LockTypeNotes)
+	require.NoError(t, lock.Lock(context.Background()))
+	t.Cleanup(func() { lock.Unlock() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := NewRepositoryLockManager(repoPath).WithRLock(ctx, LockTypeNotes, func() error { return nil })
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "another container-use process")
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// GCResult reports the size of the fork repository before and after a garbage collection.
+type GCResult struct {
+	SizeBefore int64 `json:"size_before"`
+	SizeAfter  int64 `json:"size_after"`
+}
+
+// Reclaimed returns the number of bytes freed by the garbage collection.
+func (g GCResult) Reclaimed() int64 {
+	return max(g.SizeBefore-g.SizeAfter, 0)
+}
+
+// GC compacts the fork repository: it prunes the commits of deleted environments, along with
+// the notes recorded for them, and repacks the remaining objects.
+func (r *Repository) GC(ctx context.Context) (GCResult, error) {
+	var result GCResult
+	err := r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		// Notes are written under their own lock, and pruning objects right away would drop the ones
+		// of notes being recorded concurrently
+		return r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
+			var err error
+			if result.SizeBefore, err = dirSize(r.forkRepoPath); err != nil {
+				return err
+			}
+
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "worktree", "prune"); err != nil {
+				return err
+			}
+			// Commits of deleted environments stay reachable from reflogs until they expire
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "reflog", "expire", "--expire-unreachable=now", "--all"); err != nil {
+				return err
+			}
+			if _, err := RunGitCommand(ctx, r.forkRepoPath, "gc", "--quiet", "--prune=now"); err != nil {
+				return err
+			}
+
+			// Notes of pruned commits are only dropped once the commits are gone, which leaves
+			// their contents unreachable in turn
+			notesPruned, err := r.pruneNotes(ctx)
+			if err != nil {
+				return err
+			}
+			if notesPruned {
+				if _, err := RunGitCommand(ctx, r.forkRepoPath, "gc", "--quiet", "--prune=now"); err != nil {
+					return err
+				}
+			}
+
+			result.SizeAfter, err = dirSize(r.forkRepoPath)
+			return err
+		})
+	})
+	return result, err
+}
+
+// pruneNotes removes the notes attached to commits that no longer exist. Returns whether any were removed.
+// The notes lock must be held.
+func (r *Repository) pruneNotes(ctx context.Context) (bool, error) {
+	pruned := false
+	for _, ref := range []string{gitNotesLogRef, gitNotesStateRef} {
+		fullRef := "refs/notes/" + ref
+		before, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", "--quiet", fullRef)
+		if err != nil {
+			// No notes were recorded yet
+			continue
+		}
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", ref, "prune"); err != nil {
+			return false, err
+		}
+		after, err := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", "--quiet", fullRef)
+		if err != nil {
+			return false, err
+		}
+		if strings.TrimSpace(before) != strings.TrimSpace(after) {
+			slog.Debug("Pruned notes of deleted commits", "ref", ref)
+			pruned = true
+		}
+	}
+	return pruned, nil
+}
+
+// autoGC lets git compact the fork repository if it has accumulated enough loose objects.
+// Unlike GC, unreachable objects are only pruned once they are old enough, so it is cheap to run often.
+func (r *Repository) autoGC(ctx context.Context) {
+	if err := r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		_, err := RunGitCommand(ctx, r.forkRepoPath, "gc", "--auto", "--quiet")
+		return err
+	}); err != nil {
+		slog.Warn("Failed to compact the fork repository", "repo", r.forkRepoPath, "err", err)
+	}
+}
+
+// dirSize returns the total size of the files in a directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
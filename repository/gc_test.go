@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryGC(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "kept-env")
+	createTestEnvironmentWithFile(t, repo, "deleted-env", "main.go", "package main\n")
+
+	commit, err := RunGitCommand(ctx, repo.forkRepoPath, "rev-parse", "deleted-env")
+	require.NoError(t, err)
+	commit = strings.TrimSpace(commit)
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com",
+		"notes", "--ref", gitNotesLogRef, "add", "-m", "Write main.go", commit)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Delete(ctx, "deleted-env"))
+
+	// Pruning notes commits to the notes refs
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "config", "user.name", "Test User")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "config", "user.email", "test@example.com")
+	require.NoError(t, err)
+
+	result, err := repo.GC(ctx)
+	require.NoError(t, err)
+	assert.Positive(t, result.SizeAfter)
+	assert.Equal(t, max(result.SizeBefore-result.SizeAfter, 0), result.Reclaimed())
+
+	// The commit of the deleted environment and its notes are gone
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "cat-file", "-e", commit)
+	assert.Error(t, err)
+	notes, err := RunGitCommand(ctx, repo.forkRepoPath, "notes", "--ref", gitNotesLogRef, "list")
+	require.NoError(t, err)
+	assert.NotContains(t, notes, commit)
+
+	// Remaining environments are untouched
+	envs, err := repo.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, envs, 1)
+	assert.Equal(t, "kept-env", envs[0].ID)
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"slices"
@@ -28,12 +30,26 @@ var (
 	scpLikeURLRegExp = regexp.MustCompile(`^(?:(?P<user>[^@]+)@)?(?P<host>[^:\s]+):(?:(?P<port>[0-9]{1,5})(?:\/|:))?(?P<path>[^\\].*\/[^\\].*)$`)
 )
 
+// logGitCommand logs a git command about to run. Commands are only logged at debug level,
+// failures are also logged at info level.
+func logGitCommand(dir string, args []string) {
+	slog.Debug(fmt.Sprintf("[%s] $ git %s", dir, strings.Join(args, " ")))
+}
+
+func logGitCommandDone(dir string, args []string, err error) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, fmt.Sprintf("[%s] $ git %s (DONE)", dir, strings.Join(args, " ")), "err", err)
+}
+
 // RunGitCommand executes a git command in the specified directory.
 // This is exported for use in tests and other packages that need direct git access.
 func RunGitCommand(ctx context.Context, dir string, args ...string) (out string, rerr error) {
-	slog.Info(fmt.Sprintf("[%s] $ git %s", dir, strings.Join(args, " ")))
+	logGitCommand(dir, args)
 	defer func() {
-		slog.Info(fmt.Sprintf("[%s] $ git %s (DONE)", dir, strings.Join(args, " ")), "err", rerr)
+		logGitCommandDone(dir, args, rerr)
 	}()
 
 	cmd := exec.CommandContext(ctx, "git", args...)
@@ -54,9 +70,9 @@ func RunGitCommand(ctx context.Context, dir string, args ...string) (out string,
 
 // RunInteractiveGitCommand executes a git command in the specified directory in interactive mode.
 func RunInteractiveGitCommand(ctx context.Context, dir string, w io.Writer, args ...string) (rerr error) {
-	slog.Info(fmt.Sprintf("[%s] $ git %s", dir, strings.Join(args, " ")))
+	logGitCommand(dir, args)
 	defer func() {
-		slog.Info(fmt.Sprintf("[%s] $ git %s (DONE)", dir, strings.Join(args, " ")), "err", rerr)
+		logGitCommandDone(dir, args, rerr)
 	}()
 
 	cmd := exec.CommandContext(ctx, "git", args...)
@@ -223,13 +239,68 @@ func (r *Repository) getWorktree(ctx context.Context, id string) (string, error)
 	})
 }
 
+// initialCommitPrefix starts the message of the commit made when an environment is created, see createdFrom.
+const initialCommitPrefix = "Create environment "
+
 // createInitialCommit creates an empty commit with the environment creation message - this prevents multiple environments from overwriting the container-use-state on the parent commit
-func (r *Repository) createInitialCommit(ctx context.Context, worktreePath, id, title string) error {
-	commitMessage := fmt.Sprintf("Create environment %s: %s", id, title)
-	_, err := RunGitCommand(ctx, worktreePath, "commit", "--allow-empty", "-m", commitMessage)
+func (r *Repository) createInitialCommit(ctx context.Context, worktreePath, id, title string, config *environment.EnvironmentConfig) error {
+	commitMessage := fmt.Sprintf("%s%s: %s", initialCommitPrefix, id, title)
+	_, err := RunGitCommand(ctx, worktreePath, r.commitArgs(ctx, config, "--allow-empty", "-m", commitMessage)...)
 	return err
 }
 
+// signCommitsConfigKey can be set to false in the user's repository to never sign environment commits,
+// e.g. when commit.gpgsign is enabled globally but the signing key isn't available to agents.
+const signCommitsConfigKey = "container-use.signcommits"
+
+// signingConfigPattern matches the git settings used to sign commits. Environment commits are made in the fork,
+// which doesn't see settings local to the user's repository, so they are forwarded to sign commits the same way.
+const signingConfigPattern = `^(commit\.gpgsign|user\.signingkey|gpg\..*|` + signCommitsConfigKey + `)$`
+
+// commitArgs returns the arguments of a git commit of environment changes, made as the configured commit author
+// and signed according to the user's repository settings.
+func (r *Repository) commitArgs(ctx context.Context, config *environment.EnvironmentConfig, args ...string) []string {
+	return slices.Concat(identityArgs(config), r.signingArgs(ctx), []string{"commit"}, args)
+}
+
+// identityArgs returns the git arguments making commits as the configured commit author, see
+// EnvironmentConfig.CommitAuthor. The user's identity is left untouched otherwise, for their own commits too.
+func identityArgs(config *environment.EnvironmentConfig) []string {
+	if config == nil {
+		return nil
+	}
+	name, email, ok := config.CommitIdentity()
+	if !ok {
+		return nil
+	}
+	return []string{"-c", "user.name=" + name, "-c", "user.email=" + email}
+}
+
+func (r *Repository) signingArgs(ctx context.Context) []string {
+	// Exits with 1 when none of the settings is set
+	settings, err := RunGitCommand(ctx, r.userRepoPath, "config", "--get-regexp", signingConfigPattern)
+	if err != nil {
+		return nil
+	}
+
+	args := []string{}
+	for line := range strings.SplitSeq(strings.TrimSpace(settings), "\n") {
+		key, value, found := strings.Cut(line, " ")
+		if !found {
+			// Settings without a value, like `gpgsign` alone in a [commit] section, are true booleans
+			value = "true"
+		}
+		if key == signCommitsConfigKey {
+			if slices.Contains([]string{"false", "no", "off", "0"}, strings.ToLower(value)) {
+				return []string{"-c", "commit.gpgsign=false"}
+			}
+			continue
+		}
+		args = append(args, "-c", key+"="+value)
+	}
+	return args
+}
+
 func (r *Repository) propagateToWorktree(ctx context.Context, env *environment.Environment, explanation string) (rerr error) {
 	slog.Info("Propagating to worktree...",
 		"environment.id", env.ID,
@@ -257,9 +328,30 @@ func (r *Repository) propagateToGit(ctx context.Context, env *environment.Enviro
 		return fmt.Errorf("failed to get worktree path: %w", err)
 	}
 
-	if err := r.commitWorktreeChanges(ctx, worktreePath, explanation, env.State.SubmodulePaths); err != nil {
+	exclude, err := environment.LoadIgnore(worktreePath)
+	if err != nil {
+		return err
+	}
+
+	opts := stagingOptions{
+		submodulePaths: env.State.SubmodulePaths,
+		ignore:         env.State.Config.CommitIgnore,
+		exclude:        exclude,
+		binaryPolicy:   env.State.Config.BinaryFilePolicy,
+		config:         env.State.Config,
+	}
+	skipped, err := r.commitWorktreeChanges(ctx, worktreePath, env.CommitMessage(explanation), opts)
+	if err != nil {
 		return fmt.Errorf("failed to commit worktree changes: %w", err)
 	}
+	env.SkippedBinaryFiles = skipped.binaryFiles
+	if len(skipped.binaryFiles) > 0 {
+		env.Notes.Add("Binary files not committed: %s", strings.Join(skipped.binaryFiles, ", "))
+	}
+	env.SkippedSubmodules = skipped.submodules
+	if len(skipped.submodules) > 0 {
+		env.Notes.Add("Changes within submodules not committed: %s", strings.Join(skipped.submodules, ", "))
+	}
 
 	if err := r.saveState(ctx, env); err != nil {
 		return fmt.Errorf("failed to add notes: %w", err)
@@ -267,8 +359,18 @@ func (r *Repository) propagateToGit(ctx context.Context, env *environment.Enviro
 
 	if err := r.lockManager.WithLock(ctx, LockTypeUserRepo, func() error {
 		slog.Info("Fetching container-use remote in source repository")
-		_, err := RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, env.ID)
-		return err
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, env.ID); err != nil {
+			return err
+		}
+		if env.State.Config.BinaryFilePolicy != environment.BinaryFilePolicyLFS {
+			return nil
+		}
+		// The branch only holds pointers to the binary files, their contents are fetched so that checking out
+		// or merging the environment finds them
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "lfs", "fetch", containerUseRemote, env.ID); err != nil {
+			return fmt.Errorf("failed to fetch the Git LFS objects of the environment: %w", err)
+		}
+		return nil
 	}); err != nil {
 		return err
 	}
@@ -349,8 +451,9 @@ func (r *Repository) exportEnvironment(ctx context.Context, env *environment.Env
 		return fmt.Errorf("failed to get worktree path: %w", err)
 	}
 
-	// Start with the container's workdir and add the main .git file
-	exportDir := env.Workdir().WithNewFile(".git", worktreePointer)
+	// Start with the container's workdir and add the main .git file,
+	// replacing the .git directory environments created with include_git_dir have
+	exportDir := env.Workdir().WithoutDirectory(".git").WithNewFile(".git", worktreePointer)
 
 	exportDir, err = addSubmoduleGitdirFiles(exportDir, worktreePath, env.State.SubmodulePaths)
 	if err != nil {
@@ -431,7 +534,8 @@ func (r *Repository) saveState(ctx context.Context, env *environment.Environment
 	}
 
 	return r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
-		_, err = RunGitCommand(ctx, worktreePath, "notes", "--ref", gitNotesStateRef, "add", "-f", "-F", f.Name())
+		args := append(identityArgs(env.State.Config), "notes", "--ref", gitNotesStateRef, "add", "-f", "-F", f.Name())
+		_, err = RunGitCommand(ctx, worktreePath, args...)
 		return err
 	})
 }
@@ -461,7 +565,8 @@ func (r *Repository) addGitNote(ctx context.Context, env *environment.Environmen
 		return fmt.Errorf("failed to get worktree path: %w", err)
 	}
 	if err := r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
-		_, err = RunGitCommand(ctx, worktreePath, "notes", "--ref", gitNotesLogRef, "append", "-m", note)
+		args := append(identityArgs(env.State.Config), "notes", "--ref", gitNotesLogRef, "append", "-m", note)
+		_, err = RunGitCommand(ctx, worktreePath, args...)
 		return err
 	}); err != nil {
 		return err
@@ -491,6 +596,116 @@ func (r *Repository) mergeBase(ctx context.Context, env *environment.Environment
 	return strings.TrimSpace(mergeBase), nil
 }
 
+// appliedRefPrefix is where the last commit of an environment applied to each branch of the user's repository
+// is recorded, as refs/container-use/applied/<id>/<branch>.
+const appliedRefPrefix = "refs/container-use/applied/"
+
+// lastApplied returns the last commit of an environment applied to branch, if it is still part of the environment.
+func (r *Repository) lastApplied(ctx context.Context, id, branch string) string {
+	if branch == "" {
+		return ""
+	}
+	commit, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", appliedRefPrefix+id+"/"+branch)
+	if err != nil {
+		return ""
+	}
+	commit = strings.TrimSpace(commit)
+	// The environment may have been reset since
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "merge-base", "--is-ancestor", commit, containerUseRemote+"/"+id); err != nil {
+		return ""
+	}
+	return commit
+}
+
+// recordApplied records the current commit of an environment as applied to branch. Failing to record it
+// only means the next apply starts from further back, so errors are logged.
+func (r *Repository) recordApplied(ctx context.Context, id, branch string) {
+	if branch == "" {
+		return
+	}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "update-ref", appliedRefPrefix+id+"/"+branch, containerUseRemote+"/"+id); err != nil {
+		slog.Warn("Failed to record applied commit", "environment", id, "branch", branch, "err", err)
+	}
+}
+
+// appliedRefs returns the refs recording the commits of an environment applied to branches.
+func (r *Repository) appliedRefs(ctx context.Context, id string) []string {
+	out, err := RunGitCommand(ctx, r.userRepoPath, "for-each-ref", "--format=%(refname)", appliedRefPrefix+id+"/")
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(out)
+}
+
+func (r *Repository) deleteAppliedRefs(ctx context.Context, id string) {
+	for _, ref := range r.appliedRefs(ctx, id) {
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "update-ref", "-d", ref); err != nil {
+			slog.Warn("Failed to delete applied ref", "ref", ref, "err", err)
+		}
+	}
+}
+
+func (r *Repository) renameAppliedRefs(ctx context.Context, oldID, newID string) {
+	for _, ref := range r.appliedRefs(ctx, oldID) {
+		newRef := appliedRefPrefix + newID + "/" + strings.TrimPrefix(ref, appliedRefPrefix+oldID+"/")
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "update-ref", newRef, ref); err != nil {
+			slog.Warn("Failed to rename applied ref", "ref", ref, "err", err)
+			continue
+		}
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "update-ref", "-d", ref); err != nil {
+			slog.Warn("Failed to delete renamed applied ref", "ref", ref, "err", err)
+		}
+	}
+}
+
+// retrackBranches points the local branches tracking an environment, e.g. those made by Checkout, to its new ID.
+func (r *Repository) retrackBranches(ctx context.Context, oldID, newID string) {
+	// Exits with 1 when no branch tracks anything
+	out, _ := RunGitCommand(ctx, r.userRepoPath, "config", "--get-regexp", `^branch\..*\.merge$`)
+	for line := range strings.Lines(out) {
+		key, merge, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if merge != "refs/heads/"+oldID {
+			continue
+		}
+		branch := strings.TrimSuffix(strings.TrimPrefix(key, "branch."), ".merge")
+		if remote, err := RunGitCommand(ctx, r.userRepoPath, "config", "--get", "branch."+branch+".remote"); err != nil || strings.TrimSpace(remote) != containerUseRemote {
+			continue
+		}
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "config", key, "refs/heads/"+newID); err != nil {
+			slog.Warn("Failed to update the upstream of branch", "branch", branch, "err", err)
+		}
+	}
+}
+
+// createdFrom returns the commit an environment was created from: the parent of its initial commit, the
+// latest one in its history as it doesn't change when the environment is renamed. Unlike mergeBase, it
+// doesn't depend on the current branch of the user. Environments without an initial commit, which weren't
+// made by Create, fall back to mergeBase.
+func (r *Repository) createdFrom(ctx context.Context, env *environment.EnvironmentInfo) (string, error) {
+	envGitRef := fmt.Sprintf("%s/%s", containerUseRemote, env.ID)
+	initialCommit, err := RunGitCommand(ctx, r.userRepoPath, "log", "-1", "--format=%H", "--grep=^"+initialCommitPrefix, envGitRef)
+	if err != nil {
+		return "", err
+	}
+	if initialCommit = strings.TrimSpace(initialCommit); initialCommit == "" {
+		return r.mergeBase(ctx, env)
+	}
+	base, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", initialCommit+"^")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the commit environment '%s' was created from: %w", env.ID, err)
+	}
+	return strings.TrimSpace(base), nil
+}
+
+// environmentRange is the revision range of the commits made in an environment since it was created.
+func (r *Repository) environmentRange(ctx context.Context, env *environment.EnvironmentInfo) (string, error) {
+	base, err := r.createdFrom(ctx, env)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s..%s/%s", base, containerUseRemote, env.ID), nil
+}
+
 func (r *Repository) revisionRange(ctx context.Context, env *environment.EnvironmentInfo) (string, error) {
 	mergeBase, err := r.mergeBase(ctx, env)
 	if err != nil {
@@ -500,8 +715,32 @@ func (r *Repository) revisionRange(ctx context.Context, env *environment.Environ
 	return fmt.Sprintf("%s..%s", mergeBase, envGitRef), nil
 }
 
-func (r *Repository) commitWorktreeChanges(ctx context.Context, worktreePath, explanation string, submodulePaths []string) error {
-	return r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+// stagingOptions controls which changes of a worktree are committed.
+type stagingOptions struct {
+	// submodulePaths are never committed, as submodules are read-only
+	submodulePaths []string
+	// ignore holds glob patterns of files never committed, see EnvironmentConfig.CommitIgnore
+	ignore []string
+	// exclude holds the patterns of .container-use/ignore, see environment.LoadIgnore. Excluded files are
+	// missing from environments, so unlike ignored files, their deletions are not committed either.
+	exclude []string
+	// binaryPolicy decides whether binary files are committed, see EnvironmentConfig.BinaryFilePolicy
+	binaryPolicy environment.BinaryFilePolicy
+	// config is the configuration of the environment committed to, for its commit author and source paths
+	config *environment.EnvironmentConfig
+}
+
+// skippedChanges are the changes of a worktree left out of a commit.
+type skippedChanges struct {
+	// binaryFiles are the binary files the binary file policy leaves out
+	binaryFiles []string
+	// submodules are the submodules with changes, which are read-only
+	submodules []string
+}
+
+// commitWorktreeChanges commits the changes of a worktree. Returns the changes left out of the commit.
+func (r *Repository) commitWorktreeChanges(ctx context.Context, worktreePath, explanation string, opts stagingOptions) (skipped skippedChanges, rerr error) {
+	rerr = r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
 		status, err := RunGitCommand(ctx, worktreePath, "status", "--porcelain")
 		if err != nil {
 			return err
@@ -511,13 +750,21 @@ func (r *Repository) commitWorktreeChanges(ctx context.Context, worktreePath, ex
 			return nil
 		}
 
-		if err := r.addNonBinaryFiles(ctx, worktreePath, submodulePaths); err != nil {
+		skipped, err = r.addNonBinaryFiles(ctx, worktreePath, opts)
+		if err != nil {
 			return err
 		}
 
-		_, err = RunGitCommand(ctx, worktreePath, "commit", "--allow-empty", "--allow-empty-message", "-m", explanation)
+		// Changes left unstaged, like the files outside of source_paths missing from the environment, don't
+		// make a commit on their own
+		if _, err := RunGitCommand(ctx, worktreePath, "diff", "--cached", "--quiet"); err == nil {
+			return nil
+		}
+
+		_, err = RunGitCommand(ctx, worktreePath, r.commitArgs(ctx, opts.config, "--allow-empty", "--allow-empty-message", "-m", explanation)...)
 		return err
 	})
+	return skipped, rerr
 }
 
 // AI slop below!
@@ -556,6 +803,65 @@ func (r *Repository) getSubmodulePaths(ctx context.Context, worktreePath string)
 	return submodulePaths
 }
 
+// Submodule is a git submodule of an environment. Files within submodules are read-only by default.
+type Submodule struct {
+	Path string `json:"path"`
+	URL  string `json:"url,omitempty"`
+	// Commit is the commit of the submodule recorded in the environment
+	Commit string `json:"commit,omitempty"`
+}
+
+// Submodules returns the submodules of an environment, as detected when it was created.
+func (r *Repository) Submodules(ctx context.Context, id string) ([]Submodule, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	worktreePath, err := r.getWorktree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := envInfo.State.SubmodulePaths
+	submodules := make([]Submodule, 0, len(paths))
+	for _, submodulePath := range paths {
+		// Nested submodules are recorded in the submodule containing them
+		dir, rel := worktreePath, submodulePath
+		parent := ""
+		for _, other := range paths {
+			if strings.HasPrefix(submodulePath, other+"/") && len(other) > len(parent) {
+				parent = other
+			}
+		}
+		if parent != "" {
+			dir, rel = filepath.Join(worktreePath, parent), strings.TrimPrefix(submodulePath, parent+"/")
+		}
+
+		submodule := Submodule{Path: submodulePath}
+		// Fields are best effort: nested submodules may not be checked out
+		if tree, err := RunGitCommand(ctx, dir, "ls-tree", "HEAD", "--", rel); err == nil {
+			if fields := strings.Fields(tree); len(fields) >= 3 && fields[1] == "commit" {
+				submodule.Commit = fields[2]
+			}
+		}
+		if names, err := RunGitCommand(ctx, dir, "config", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.path$`); err == nil {
+			for line := range strings.SplitSeq(strings.TrimSpace(names), "\n") {
+				key, value, _ := strings.Cut(line, " ")
+				if value != rel {
+					continue
+				}
+				name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+				if url, err := RunGitCommand(ctx, dir, "config", "-f", ".gitmodules", "--get", "submodule."+name+".url"); err == nil {
+					submodule.URL = strings.TrimSpace(url)
+				}
+				break
+			}
+		}
+		submodules = append(submodules, submodule)
+	}
+	return submodules, nil
+}
+
 // isWithinSubmodule checks if a file path is within any of the submodule directories
 func (r *Repository) isWithinSubmodule(filePath string, submodulePaths []string) bool {
 	cleanFilePath := filepath.Clean(filePath)
@@ -575,9 +881,37 @@ func (r *Repository) isWithinSubmodule(filePath string, submodulePaths []string)
 	return false
 }
 
-func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string, submodulePaths []string) error {
+// addNonBinaryFiles stages the changes of a worktree, except for skipped files. Binary files are staged according
+// to the binary file policy. Returns the changes left out of the commit.
+func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string, opts stagingOptions) (skippedChanges, error) {
+	var skipped skippedChanges
+	if opts.binaryPolicy == environment.BinaryFilePolicyLFS {
+		if err := setupLFS(ctx, worktreePath); err != nil {
+			return skipped, err
+		}
+	}
+
 	statusOutput, err := RunGitCommand(ctx, worktreePath, "status", "--porcelain")
 	if err != nil {
+		return skipped, err
+	}
+
+	// stage adds a new or modified file, unless it is a binary file the policy leaves out
+	stage := func(fileName string) error {
+		if isBinaryFileName(fileName) || r.isBinaryFile(worktreePath, fileName) {
+			switch opts.binaryPolicy {
+			case environment.BinaryFilePolicyCommit:
+			case environment.BinaryFilePolicyLFS:
+				if err := trackWithLFS(ctx, worktreePath, fileName); err != nil {
+					return err
+				}
+			default:
+				slog.Warn("Skipping binary file", "file", fileName)
+				skipped.binaryFiles = append(skipped.binaryFiles, fileName)
+				return nil
+			}
+		}
+		_, err := RunGitCommand(ctx, worktreePath, "add", fileName)
 		return err
 	}
 
@@ -602,9 +936,27 @@ func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string,
 			continue
 		}
 
-		// Skip files within submodule directories
-		if r.isWithinSubmodule(fileName, submodulePaths) {
+		// Skip files within submodule directories, changes within a submodule are reported on its path
+		if r.isWithinSubmodule(fileName, opts.submodulePaths) {
 			slog.Debug("Skipping file within submodule", "file", fileName)
+			skipped.submodules = append(skipped.submodules, fileName)
+			continue
+		}
+
+		if matchesCommitIgnore(fileName, opts.exclude) {
+			slog.Debug("Skipping file matching .container-use/ignore", "file", fileName)
+			continue
+		}
+
+		// Files outside of source_paths are missing from environments too, so their deletions are not committed
+		if (indexStatus == 'D' || workTreeStatus == 'D') && opts.config != nil && !opts.config.InSourcePaths(fileName) {
+			slog.Debug("Skipping deletion outside of source_paths", "file", fileName)
+			continue
+		}
+
+		// Deletions are still committed, so files ignored after being committed can be removed
+		if matchesCommitIgnore(fileName, opts.ignore) && indexStatus != 'D' && workTreeStatus != 'D' {
+			slog.Debug("Skipping file matching commit_ignore", "file", fileName)
 			continue
 		}
 
@@ -612,18 +964,13 @@ func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string,
 		case indexStatus == '?' && workTreeStatus == '?':
 			// ?? = untracked files or directories
 			if strings.HasSuffix(fileName, "/") {
-				// Untracked directory - traverse and add non-binary files
+				// Untracked directory - traverse and add its files
 				dirName := strings.TrimSuffix(fileName, "/")
-				if err := r.addFilesFromUntrackedDirectory(ctx, worktreePath, dirName); err != nil {
-					return err
-				}
-			} else if !r.isBinaryFile(worktreePath, fileName) {
-				// Untracked file - add if not binary
-
-				_, err = RunGitCommand(ctx, worktreePath, "add", fileName)
-				if err != nil {
-					return err
+				if err := r.addFilesFromUntrackedDirectory(worktreePath, dirName, slices.Concat(opts.ignore, opts.exclude), stage); err != nil {
+					return skipped, err
 				}
+			} else if err := stage(fileName); err != nil {
+				return skipped, err
 			}
 		case indexStatus == 'A':
 			// A = already staged, skip
@@ -632,24 +979,22 @@ func (r *Repository) addNonBinaryFiles(ctx context.Context, worktreePath string,
 			// D = deleted files (always stage deletion)
 			_, err = RunGitCommand(ctx, worktreePath, "add", fileName)
 			if err != nil {
-				return err
+				return skipped, err
 			}
 		default:
-			// M, R, C and other statuses - add if not binary
-			if !r.isBinaryFile(worktreePath, fileName) {
-				_, err = RunGitCommand(ctx, worktreePath, "add", fileName)
-				if err != nil {
-					return err
-				}
+			// M, R, C and other statuses
+			if err := stage(fileName); err != nil {
+				return skipped, err
 			}
 		}
 	}
 
-	return nil
+	return skipped, nil
 }
 
-func (r *Repository) shouldSkipFile(fileName string) bool {
-	skipExtensions := []string{
+// isBinaryFileName reports whether a file is binary judging by its extension, e.g. archives, images or libraries.
+func isBinaryFileName(fileName string) bool {
+	binaryExtensions := []string{
 		".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz",
 		".zip", ".rar", ".7z", ".gz", ".bz2", ".xz",
 		".exe", ".bin", ".dmg", ".pkg", ".msi",
@@ -660,11 +1005,60 @@ func (r *Repository) shouldSkipFile(fileName string) bool {
 	}
 
 	lowerName := strings.ToLower(fileName)
-	for _, ext := range skipExtensions {
+	for _, ext := range binaryExtensions {
 		if strings.HasSuffix(lowerName, ext) {
 			return true
 		}
 	}
+	return false
+}
+
+// setupLFS installs the Git LFS filters in the fork repository and restores the files tracked by Git LFS in
+// earlier commits, as exports replace the worktree's .gitattributes with the environment's.
+func setupLFS(ctx context.Context, worktreePath string) error {
+	if _, err := RunGitCommand(ctx, worktreePath, "lfs", "install", "--local"); err != nil {
+		return fmt.Errorf("binary_file_policy is lfs, but setting up Git LFS failed, is git-lfs installed? %w", err)
+	}
+
+	committed, err := RunGitCommand(ctx, worktreePath, "show", "HEAD:.gitattributes")
+	if err != nil {
+		// Nothing was tracked yet
+		return nil
+	}
+	attributesPath := filepath.Join(worktreePath, ".gitattributes")
+	current, err := os.ReadFile(attributesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	lines := strings.Split(string(current), "\n")
+	var missing []string
+	for line := range strings.Lines(committed) {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.Contains(line, "filter=lfs") && !slices.Contains(lines, line) {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if len(current) > 0 && !bytes.HasSuffix(current, []byte("\n")) {
+		current = append(current, '\n')
+	}
+	current = append(current, strings.Join(missing, "\n")+"\n"...)
+	return os.WriteFile(attributesPath, current, 0644)
+}
+
+// trackWithLFS adds a file to the files tracked by Git LFS in the worktree's .gitattributes.
+func trackWithLFS(ctx context.Context, worktreePath, fileName string) error {
+	if _, err := RunGitCommand(ctx, worktreePath, "lfs", "track", "--filename", fileName); err != nil {
+		return fmt.Errorf("binary_file_policy is lfs, but tracking %s with Git LFS failed: %w", fileName, err)
+	}
+	_, err := RunGitCommand(ctx, worktreePath, "add", ".gitattributes")
+	return err
+}
+
+func (r *Repository) shouldSkipFile(fileName string) bool {
+	lowerName := strings.ToLower(fileName)
 
 	// Use cross-platform path-aware directory patterns
 	skipDirNames := []string{
@@ -696,6 +1090,48 @@ func (r *Repository) shouldSkipFile(fileName string) bool {
 	return false
 }
 
+// matchesCommitIgnore reports whether a path matches any of the commit_ignore or .container-use/ignore glob patterns.
+// Like in .gitignore, patterns without a slash match any file or directory name, while patterns
+// with a slash match paths from the root of the repository. Files within matching directories match too.
+func matchesCommitIgnore(fileName string, patterns []string) bool {
+	fileName = strings.TrimSuffix(filepath.ToSlash(fileName), "/")
+	parts := strings.Split(fileName, "/")
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if !strings.Contains(pattern, "/") {
+			for _, part := range parts {
+				if ok, _ := path.Match(pattern, part); ok {
+					return true
+				}
+			}
+			continue
+		}
+
+		pattern = strings.TrimPrefix(pattern, "/")
+		for i := range parts {
+			if ok, _ := path.Match(pattern, strings.Join(parts[:i+1], "/")); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterPatterns converts commit_ignore style patterns to the patterns of dagger.Directory.Filter,
+// which are matched from the root of the directory.
+func filterPatterns(patterns []string) []string {
+	filters := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if strings.Contains(pattern, "/") {
+			filters[i] = strings.TrimPrefix(pattern, "/")
+		} else {
+			filters[i] = "**/" + pattern
+		}
+	}
+	return filters
+}
+
 func (r *Repository) IsDirty(ctx context.Context) (bool, string, error) {
 	status, err := RunGitCommand(ctx, r.userRepoPath, "status", "--porcelain")
 	if err != nil {
@@ -709,7 +1145,7 @@ func (r *Repository) IsDirty(ctx context.Context) (bool, string, error) {
 	return true, status, nil
 }
 
-func (r *Repository) addFilesFromUntrackedDirectory(ctx context.Context, worktreePath, dirName string) error {
+func (r *Repository) addFilesFromUntrackedDirectory(worktreePath, dirName string, ignore []string, stage func(fileName string) error) error {
 	dirPath := filepath.Join(worktreePath, dirName)
 
 	return filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
@@ -723,36 +1159,30 @@ func (r *Repository) addFilesFromUntrackedDirectory(ctx context.Context, worktre
 		}
 
 		if info.IsDir() {
-			if r.shouldSkipFile(relPath) {
+			if r.shouldSkipFile(relPath) || matchesCommitIgnore(relPath, ignore) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		if r.shouldSkipFile(relPath) {
+		if r.shouldSkipFile(relPath) || matchesCommitIgnore(relPath, ignore) {
 			return nil
 		}
 
-		if !r.isBinaryFile(worktreePath, relPath) {
-			_, err = RunGitCommand(ctx, worktreePath, "add", relPath)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
+		return stage(relPath)
 	})
 }
 
 func (r *Repository) isBinaryFile(worktreePath, fileName string) bool {
 	fullPath := filepath.Join(worktreePath, fileName)
 
-	stat, err := os.Stat(fullPath)
+	stat, err := os.Lstat(fullPath)
 	if err != nil {
 		return true
 	}
 
-	if stat.IsDir() {
+	// Symlinks are committed as links, whatever they point to
+	if stat.IsDir() || stat.Mode()&os.ModeSymlink != 0 {
 		return false
 	}
 
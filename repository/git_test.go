@@ -3,10 +3,12 @@ package repository
 import (
 	"context"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -77,6 +79,26 @@ func TestSelectiveFileStaging(t *testing.T) {
 			shouldSkip:  []string{"node_modules", "build"},
 			reason:      "Dependencies and build outputs should be excluded",
 		},
+		{
+			name: "symlinks",
+			setup: func(t *testing.T, dir string) {
+				writeFile(t, dir, "config.yaml", "debug: true")
+				writeBinaryFile(t, dir, "logo.png", 100)
+				createDir(t, dir, "docs")
+				writeFile(t, dir, "docs/index.md", "# Docs")
+				for link, target := range map[string]string{
+					"config.link":  "config.yaml",
+					"logo.link":    "logo.png",
+					"docs.link":    "docs",
+					"dangling.lnk": "missing.txt",
+				} {
+					require.NoError(t, os.Symlink(target, filepath.Join(dir, link)))
+				}
+			},
+			shouldStage: []string{"config.yaml", "config.link", "logo.link", "docs.link", "dangling.lnk", "docs/index.md"},
+			shouldSkip:  []string{"logo.png"},
+			reason:      "Symlinks should be committed as links rather than dereferenced",
+		},
 	}
 
 	for _, scenario := range scenarios {
@@ -104,7 +126,7 @@ func TestSelectiveFileStaging(t *testing.T) {
 			}
 
 			// Run the actual staging logic (testing the integration)
-			err = repo.addNonBinaryFiles(ctx, dir, []string{})
+			_, err = repo.addNonBinaryFiles(ctx, dir, stagingOptions{})
 			require.NoError(t, err, "Staging should not error")
 
 			status, err := RunGitCommand(ctx, dir, "status", "--porcelain")
@@ -154,7 +176,7 @@ func TestCommitWorktreeChanges(t *testing.T) {
 
 		// This verifies that commitWorktreeChanges handles empty directories gracefully
 		// It should return nil (success) when there's nothing to commit
-		err := repo.commitWorktreeChanges(ctx, dir, "Empty dirs", []string{})
+		_, err := repo.commitWorktreeChanges(ctx, dir, "Empty dirs", stagingOptions{})
 		assert.NoError(t, err, "commitWorktreeChanges should handle empty dirs gracefully")
 	})
 
@@ -162,7 +184,7 @@ func TestCommitWorktreeChanges(t *testing.T) {
 		// Create a file to commit
 		writeFile(t, dir, "test.txt", "hello world")
 
-		err := repo.commitWorktreeChanges(ctx, dir, "Testing commit functionality", []string{})
+		_, err := repo.commitWorktreeChanges(ctx, dir, "Testing commit functionality", stagingOptions{})
 		require.NoError(t, err)
 
 		// Verify commit was created
@@ -170,6 +192,313 @@ func TestCommitWorktreeChanges(t *testing.T) {
 		require.NoError(t, err)
 		assert.Contains(t, log, "Testing commit functionality")
 	})
+
+	t.Run("skips_commit_ignore", func(t *testing.T) {
+		writeFile(t, dir, "app.go", "package app")
+		writeFile(t, dir, "debug.trace", "trace")
+		writeFile(t, dir, ".cache/modules.json", "{}")
+		writeFile(t, dir, "generated/api.go", "package generated")
+
+		opts := stagingOptions{ignore: []string{"*.trace", ".cache/", "/generated"}}
+		_, err := repo.commitWorktreeChanges(ctx, dir, "Add app", opts)
+		require.NoError(t, err)
+
+		files, err := RunGitCommand(ctx, dir, "ls-files")
+		require.NoError(t, err)
+		assert.Contains(t, files, "app.go")
+		assert.NotContains(t, files, "debug.trace")
+		assert.NotContains(t, files, ".cache")
+		assert.NotContains(t, files, "generated")
+
+		// Deleting a committed file that is now ignored is still committed
+		require.NoError(t, os.Remove(filepath.Join(dir, "app.go")))
+		_, err = repo.commitWorktreeChanges(ctx, dir, "Remove app", stagingOptions{ignore: []string{"*.go"}})
+		require.NoError(t, err)
+		files, err = RunGitCommand(ctx, dir, "ls-files")
+		require.NoError(t, err)
+		assert.NotContains(t, files, "app.go")
+	})
+
+	t.Run("skips_excluded", func(t *testing.T) {
+		writeFile(t, dir, "config/local.json", "{}")
+		writeFile(t, dir, "fixtures/large/dump.sql", "-- dump")
+		writeFile(t, dir, "fixtures/small.sql", "-- small")
+		_, err := repo.commitWorktreeChanges(ctx, dir, "Add fixtures", stagingOptions{})
+		require.NoError(t, err)
+
+		// Excluded files are missing from environments, which must not delete them
+		require.NoError(t, os.Remove(filepath.Join(dir, "config/local.json")))
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "fixtures/large")))
+		writeFile(t, dir, "secrets/key.pem", "key")
+		writeFile(t, dir, "fixtures/small.sql", "-- updated")
+
+		opts := stagingOptions{exclude: []string{"local.json", "secrets/", "/fixtures/large"}}
+		_, err = repo.commitWorktreeChanges(ctx, dir, "Update fixtures", opts)
+		require.NoError(t, err)
+
+		files, err := RunGitCommand(ctx, dir, "ls-files")
+		require.NoError(t, err)
+		assert.Contains(t, files, "config/local.json")
+		assert.Contains(t, files, "fixtures/large/dump.sql")
+		assert.NotContains(t, files, "secrets")
+		contents, err := RunGitCommand(ctx, dir, "show", "HEAD:fixtures/small.sql")
+		require.NoError(t, err)
+		assert.Equal(t, "-- updated", contents)
+	})
+
+	t.Run("skips_deletions_outside_source_paths", func(t *testing.T) {
+		writeFile(t, dir, "services/api/main.go", "package main")
+		writeFile(t, dir, "services/web/index.ts", "export {}")
+		writeFile(t, dir, "services/api/old.go", "package main")
+		_, err := repo.commitWorktreeChanges(ctx, dir, "Add services", stagingOptions{})
+		require.NoError(t, err)
+
+		// Only services/api is loaded into the environment, the web service must not be deleted
+		require.NoError(t, os.RemoveAll(filepath.Join(dir, "services/web")))
+		require.NoError(t, os.Remove(filepath.Join(dir, "services/api/old.go")))
+		writeFile(t, dir, "services/api/main.go", "package main // updated")
+
+		config := &environment.EnvironmentConfig{SourcePaths: []string{"services/api"}}
+		_, err = repo.commitWorktreeChanges(ctx, dir, "Update api", stagingOptions{config: config})
+		require.NoError(t, err)
+
+		files, err := RunGitCommand(ctx, dir, "ls-files", "services")
+		require.NoError(t, err)
+		assert.Contains(t, files, "services/web/index.ts")
+		assert.NotContains(t, files, "services/api/old.go")
+		contents, err := RunGitCommand(ctx, dir, "show", "HEAD:services/api/main.go")
+		require.NoError(t, err)
+		assert.Equal(t, "package main // updated", contents)
+
+		// The deletions left unstaged don't make commits when nothing else changed
+		head, err := RunGitCommand(ctx, dir, "rev-parse", "HEAD")
+		require.NoError(t, err)
+		_, err = repo.commitWorktreeChanges(ctx, dir, "No-op", stagingOptions{config: config})
+		require.NoError(t, err)
+		newHead, err := RunGitCommand(ctx, dir, "rev-parse", "HEAD")
+		require.NoError(t, err)
+		assert.Equal(t, head, newHead)
+	})
+
+	t.Run("binary_file_policy", func(t *testing.T) {
+		writeBinaryFile(t, dir, "logo.png", 100)
+		writeBinaryFile(t, dir, "module.wasm", 100)
+
+		skipped, err := repo.commitWorktreeChanges(ctx, dir, "Skip binaries", stagingOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"logo.png", "module.wasm"}, skipped.binaryFiles)
+
+		if _, err := RunGitCommand(ctx, dir, "lfs", "version"); err != nil {
+			_, err = repo.commitWorktreeChanges(ctx, dir, "Track binaries", stagingOptions{binaryPolicy: environment.BinaryFilePolicyLFS})
+			assert.ErrorContains(t, err, "is git-lfs installed?")
+		}
+
+		skipped, err = repo.commitWorktreeChanges(ctx, dir, "Commit binaries", stagingOptions{binaryPolicy: environment.BinaryFilePolicyCommit})
+		require.NoError(t, err)
+		assert.Empty(t, skipped.binaryFiles)
+		files, err := RunGitCommand(ctx, dir, "ls-files")
+		require.NoError(t, err)
+		assert.Contains(t, files, "logo.png")
+		assert.Contains(t, files, "module.wasm")
+	})
+
+	t.Run("records_mode_changes", func(t *testing.T) {
+		writeFile(t, dir, "run.sh", "#!/bin/sh\necho hello")
+		_, err := repo.commitWorktreeChanges(ctx, dir, "Add script", stagingOptions{})
+		require.NoError(t, err)
+		require.NoError(t, os.Chmod(filepath.Join(dir, "run.sh"), 0755))
+
+		_, err = repo.commitWorktreeChanges(ctx, dir, "Make script executable", stagingOptions{})
+		require.NoError(t, err)
+
+		mode, err := RunGitCommand(ctx, dir, "ls-files", "-s", "run.sh")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(mode, "100755"), "executable bit should be committed, got %q", mode)
+	})
+
+	t.Run("reports_submodule_changes", func(t *testing.T) {
+		libDir := t.TempDir()
+		_, err := RunGitCommand(ctx, libDir, "init", "-q")
+		require.NoError(t, err)
+		writeFile(t, libDir, "lib.txt", "lib\n")
+		_, err = RunGitCommand(ctx, libDir, "add", "lib.txt")
+		require.NoError(t, err)
+		_, err = RunGitCommand(ctx, libDir, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Add lib")
+		require.NoError(t, err)
+		_, err = RunGitCommand(ctx, dir, "-c", "protocol.file.allow=always", "submodule", "add", "-q", libDir, "vendor/lib")
+		require.NoError(t, err)
+		_, err = repo.commitWorktreeChanges(ctx, dir, "Add submodule", stagingOptions{})
+		require.NoError(t, err)
+		head, err := RunGitCommand(ctx, dir, "rev-parse", "HEAD")
+		require.NoError(t, err)
+
+		writeFile(t, dir, "vendor/lib/lib.txt", "changed\n")
+		skipped, err := repo.commitWorktreeChanges(ctx, dir, "Change submodule", stagingOptions{submodulePaths: []string{"vendor/lib"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"vendor/lib"}, skipped.submodules)
+
+		newHead, err := RunGitCommand(ctx, dir, "rev-parse", "HEAD")
+		require.NoError(t, err)
+		assert.Equal(t, head, newHead)
+	})
+}
+
+func TestCommitWorktreeChangesLFS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	if _, err := RunGitCommand(ctx, dir, "lfs", "version"); err != nil {
+		t.Skip("git-lfs is not installed")
+	}
+
+	_, err := RunGitCommand(ctx, dir, "init")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, dir, "config", "user.email", "test@example.com")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, dir, "config", "user.name", "Test User")
+	require.NoError(t, err)
+
+	repo := &Repository{
+		lockManager: NewRepositoryLockManager(dir),
+	}
+	opts := stagingOptions{binaryPolicy: environment.BinaryFilePolicyLFS}
+
+	writeBinaryFile(t, dir, "logo.png", 100)
+	skipped, err := repo.commitWorktreeChanges(ctx, dir, "Track binaries", opts)
+	require.NoError(t, err)
+	assert.Empty(t, skipped.binaryFiles)
+	lfsFiles, err := RunGitCommand(ctx, dir, "lfs", "ls-files", "--name-only")
+	require.NoError(t, err)
+	assert.Equal(t, "logo.png", strings.TrimSpace(lfsFiles))
+
+	// Exports replace .gitattributes with the environment's, which doesn't track the binary file
+	require.NoError(t, os.Remove(filepath.Join(dir, ".gitattributes")))
+	writeFile(t, dir, "main.go", "package main")
+	_, err = repo.commitWorktreeChanges(ctx, dir, "Add main.go", opts)
+	require.NoError(t, err)
+
+	attributes, err := RunGitCommand(ctx, dir, "show", "HEAD:.gitattributes")
+	require.NoError(t, err)
+	assert.Contains(t, attributes, "logo.png filter=lfs")
+	lfsFiles, err = RunGitCommand(ctx, dir, "lfs", "ls-files", "--name-only")
+	require.NoError(t, err)
+	assert.Equal(t, "logo.png", strings.TrimSpace(lfsFiles))
+}
+
+func TestMatchesCommitIgnore(t *testing.T) {
+	patterns := []string{"*.log", ".cache/", "/dist", "docs/*.pdf"}
+
+	for _, fileName := range []string{"app.log", "logs/app.log", ".cache", ".cache/", "pkg/.cache/x.json", "dist/app.js", "docs/manual.pdf"} {
+		assert.True(t, matchesCommitIgnore(fileName, patterns), "%s should be ignored", fileName)
+	}
+	for _, fileName := range []string{"main.go", "log.txt", "src/dist/app.js", "docs/api/manual.pdf", "docs/manual.md"} {
+		assert.False(t, matchesCommitIgnore(fileName, patterns), "%s should not be ignored", fileName)
+	}
+	assert.False(t, matchesCommitIgnore("app.log", nil))
+}
+
+func TestFilterPatterns(t *testing.T) {
+	assert.Equal(t,
+		[]string{"**/*.log", "**/.cache", "dist", "docs/*.pdf"},
+		filterPatterns([]string{"*.log", ".cache/", "/dist", "docs/*.pdf"}))
+}
+
+// Environment commits are signed according to the user's repository settings
+func TestCommitSigning(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is required to sign commits")
+	}
+	for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(name, "Test User")
+	}
+	for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(name, "test@example.com")
+	}
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "signed-env")
+	worktree, err := repo.getWorktree(ctx, "signed-env")
+	require.NoError(t, err)
+
+	// Signing is configured in the user's repository only, the fork doesn't see it
+	key := filepath.Join(t.TempDir(), "key")
+	_, err = exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput()
+	require.NoError(t, err)
+	for _, setting := range [][]string{
+		{"gpg.format", "ssh"},
+		{"user.signingkey", key},
+		{"commit.gpgsign", "true"},
+	} {
+		_, err := RunGitCommand(ctx, repo.userRepoPath, "config", setting[0], setting[1])
+		require.NoError(t, err)
+	}
+
+	isSigned := func() bool {
+		commit, err := RunGitCommand(ctx, worktree, "cat-file", "commit", "HEAD")
+		require.NoError(t, err)
+		return strings.Contains(commit, "gpgsig")
+	}
+
+	writeFile(t, worktree, "signed.txt", "signed")
+	_, err = repo.commitWorktreeChanges(ctx, worktree, "Signed commit", stagingOptions{})
+	require.NoError(t, err)
+	assert.True(t, isSigned(), "environment commits should be signed")
+
+	// Signing can be disabled for environments only
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "config", signCommitsConfigKey, "false")
+	require.NoError(t, err)
+	writeFile(t, worktree, "unsigned.txt", "unsigned")
+	_, err = repo.commitWorktreeChanges(ctx, worktree, "Unsigned commit", stagingOptions{})
+	require.NoError(t, err)
+	assert.False(t, isSigned(), "environment commits should not be signed")
+}
+
+func TestSigningArgs(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	assert.Empty(t, repo.signingArgs(ctx))
+
+	// git config can't write settings without a value, but users can
+	f, err := os.OpenFile(filepath.Join(repo.userRepoPath, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("[commit]\n\tgpgsign\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, []string{"-c", "commit.gpgsign=true"}, repo.signingArgs(ctx))
+}
+
+func TestCommitAuthor(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "agent-env")
+	worktree, err := repo.getWorktree(ctx, "agent-env")
+	require.NoError(t, err)
+	identity := func() string {
+		out, err := RunGitCommand(ctx, worktree, "log", "-1", "--format=%an <%ae>|%cn <%ce>")
+		require.NoError(t, err)
+		return strings.TrimSpace(out)
+	}
+
+	// Environments are committed to in the fork, with the user's global identity
+	for key, value := range map[string]string{"user.name": "Test User", "user.email": "test@example.com"} {
+		_, err := RunGitCommand(ctx, repo.forkRepoPath, "config", key, value)
+		require.NoError(t, err)
+	}
+
+	writeFile(t, worktree, "user.txt", "user")
+	_, err = repo.commitWorktreeChanges(ctx, worktree, "User commit", stagingOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Test User <test@example.com>|Test User <test@example.com>", identity())
+
+	config := &environment.EnvironmentConfig{CommitAuthor: "Coding Agent <agent@example.com>"}
+	writeFile(t, worktree, "agent.txt", "agent")
+	_, err = repo.commitWorktreeChanges(ctx, worktree, "Agent commit", stagingOptions{config: config})
+	require.NoError(t, err)
+	assert.Equal(t, "Coding Agent <agent@example.com>|Coding Agent <agent@example.com>", identity())
+
+	// The user's own configuration is left untouched
+	name, err := RunGitCommand(ctx, repo.userRepoPath, "config", "user.name")
+	require.NoError(t, err)
+	assert.Equal(t, "Test User\n", name)
 }
 
 // Test helper functions
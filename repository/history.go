@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is a commit of an environment along with the audit log note recorded for it.
+type HistoryEntry struct {
+	Commit string    `json:"commit"`
+	Time   time.Time `json:"time"`
+	// Explanation is the subject of the commit, the explanation given for the operation by default
+	Explanation string `json:"explanation"`
+	// Note lists the operations and commands run, as recorded in the container-use notes
+	Note string `json:"note,omitempty"`
+}
+
+// History returns the commits of an environment since it was created, oldest first, with the operations and
+// commands recorded in the container-use notes. It doesn't depend on the current branch, so that the versions
+// of Reset, numbered after its entries, always designate the same commits.
+func (r *Repository) History(ctx context.Context, id string) ([]HistoryEntry, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	revisionRange, err := r.environmentRange(ctx, envInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits are separated by a record separator, and their fields by a NUL byte.
+	// Notes are only read once some exist, as git warns about missing notes refs in its output.
+	logArgs := []string{"log", "--reverse", "--no-notes", "--format=%H%x00%cI%x00%s%x00%x1e"}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "show-ref", "--verify", "--quiet", "refs/notes/"+gitNotesLogRef); err == nil {
+		logArgs = []string{"log", "--reverse", fmt.Sprintf("--notes=%s", gitNotesLogRef), "--format=%H%x00%cI%x00%s%x00%N%x1e"}
+	}
+	out, err := RunGitCommand(ctx, r.userRepoPath, append(logArgs, revisionRange)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []HistoryEntry
+	for record := range strings.SplitSeq(out, "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(record), "\x00", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		commitTime, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit time %q: %w", fields[1], err)
+		}
+		history = append(history, HistoryEntry{
+			Commit:      fields[0],
+			Time:        commitTime,
+			Explanation: fields[2],
+			Note:        strings.TrimSpace(fields[3]),
+		})
+	}
+	return history, nil
+}
+
+// FilterHistory returns the entries of history made between since and until. Zero bounds don't filter.
+func FilterHistory(history []HistoryEntry, since, until time.Time) []HistoryEntry {
+	var filtered []HistoryEntry
+	for _, entry := range history {
+		if !since.IsZero() && entry.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && entry.Time.After(until) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+// CommandResult is a command run in an environment, as recorded in its log notes.
+type CommandResult struct {
+	Command  string `json:"command"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Commands returns the commands recorded in the note of the entry, in the order they ran.
+// See environment.Notes.AddCommand for how they are recorded.
+func (e HistoryEntry) Commands() []CommandResult {
+	var commands []CommandResult
+	lines := strings.Split(e.Note, "\n")
+	for i := 0; i < len(lines); i++ {
+		command, ok := strings.CutPrefix(lines[i], "$ ")
+		if !ok {
+			continue
+		}
+		// Multi-line commands are recorded with continuation lines
+		for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "> ") {
+			i++
+			command += "\n" + strings.TrimPrefix(lines[i], "> ")
+		}
+		result := CommandResult{Command: command}
+		// Failed commands are followed by their exit code
+		if i+1 < len(lines) {
+			if code, ok := strings.CutPrefix(lines[i+1], "exit "); ok {
+				result.ExitCode, _ = strconv.Atoi(code)
+			}
+		}
+		commands = append(commands, result)
+	}
+	return commands
+}
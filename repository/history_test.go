@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dagger/container-use/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryHistory(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	history, err := repo.History(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	createTestEnvironmentWithFile(t, repo, "work-env", "main.go", "package main\n")
+	history, err = repo.History(ctx, "work-env")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "Write main.go", history[0].Explanation)
+	assert.Empty(t, history[0].Note, "commits without a note have an empty note")
+
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com",
+		"notes", "--ref", gitNotesLogRef, "add", "-m", "Write main.go\n$ go test ./...\nexit 1\nFAIL", "work-env")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "fetch", "-q", containerUseRemote, "refs/notes/"+gitNotesLogRef+":refs/notes/"+gitNotesLogRef)
+	require.NoError(t, err)
+
+	history, err = repo.History(ctx, "work-env")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	tip, err := RunGitCommand(ctx, repo.forkRepoPath, "rev-parse", "work-env")
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(tip), history[0].Commit)
+	assert.False(t, history[0].Time.IsZero())
+	assert.Equal(t, "Write main.go\n$ go test ./...\nexit 1\nFAIL", history[0].Note)
+}
+
+func TestHistoryEntryCommands(t *testing.T) {
+	assert.Empty(t, HistoryEntry{Note: "Write main.go"}.Commands())
+	assert.Equal(t,
+		[]CommandResult{{Command: "ls"}, {Command: "make", ExitCode: 2}, {Command: "make clean"}},
+		HistoryEntry{Note: "Write main.go\n$ ls\nmain.go\n$ make\nexit 2\nstderr: no rule\n$ make clean"}.Commands(),
+	)
+
+	// Multi-line commands keep their exit code, and output looking like commands isn't taken for one
+	var notes environment.Notes
+	notes.AddCommand("cat <<EOF > run.sh\nset -e\nEOF\nsh run.sh", 1, "$ echo nested\nexit 0\n", "> not a continuation")
+	notes.AddCommand("npm run build &&\\\n  npm test", 0, "", "")
+	notes.AddCommand("sleep 600", 130, "", "command canceled")
+	assert.Equal(t,
+		[]CommandResult{{Command: "cat <<EOF > run.sh\nset -e\nEOF\nsh run.sh", ExitCode: 1}, {Command: "npm run build &&\\\n  npm test"}, {Command: "sleep 600", ExitCode: 130}},
+		HistoryEntry{Note: notes.String()}.Commands(),
+	)
+}
+
+func TestFilterHistory(t *testing.T) {
+	start := time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC)
+	history := []HistoryEntry{
+		{Commit: "a", Time: start},
+		{Commit: "b", Time: start.Add(time.Hour)},
+		{Commit: "c", Time: start.Add(2 * time.Hour)},
+	}
+	commits := func(entries []HistoryEntry) []string {
+		var commits []string
+		for _, entry := range entries {
+			commits = append(commits, entry.Commit)
+		}
+		return commits
+	}
+
+	assert.Equal(t, []string{"a", "b", "c"}, commits(FilterHistory(history, time.Time{}, time.Time{})))
+	assert.Equal(t, []string{"b", "c"}, commits(FilterHistory(history, start.Add(time.Hour), time.Time{})))
+	assert.Equal(t, []string{"a", "b"}, commits(FilterHistory(history, time.Time{}, start.Add(90*time.Minute))))
+	assert.Empty(t, FilterHistory(history, start.Add(3*time.Hour), time.Time{}))
+}
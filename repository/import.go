@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+	petname "github.com/dustinkirkland/golang-petname"
+)
+
+// Import recreates an environment from a git bundle produced by Export.
+// The environment keeps its original ID unless it collides with an existing environment,
+// in which case a fresh ID is generated. The container is rebuilt from the configuration
+// recorded in the bundle.
+func (r *Repository) Import(ctx context.Context, dag *dagger.Client, bundlePath, explanation string) (*environment.Environment, error) {
+	id, sourceID, state, err := r.importBundle(ctx, bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := r.getWorktree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	worktreeHead, err := RunGitCommand(ctx, worktree, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	worktreeHead = strings.TrimSpace(worktreeHead)
+
+	// Bundles without a state note fall back to the configuration stored in the tree
+	if state == nil {
+		state = []byte("{}")
+	}
+	info, err := environment.LoadInfo(ctx, id, state, worktree)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := environment.LoadIgnore(worktree)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDir, err := r.loadSourceDir(ctx, dag, worktreeHead, info.State.Config.IncludeGitDir, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading imported source directory: %w", err)
+	}
+
+	env, err := environment.New(ctx, environment.NewEnvArgs{
+		Dag:              dag,
+		ID:               id,
+		Title:            info.State.Title,
+		Config:           info.State.Config,
+		InitialSourceDir: sourceDir,
+		SubmodulePaths:   info.State.SubmodulePaths,
+	})
+	if err != nil {
+		return nil, err
+	}
+	env.Notes.Add("Imported environment %s", sourceID)
+
+	if err := r.propagateToWorktree(ctx, env, explanation); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// importBundle fetches the environment branch and container-use notes contained in a bundle into the fork.
+// Returns the ID the environment was imported as, the ID it had in the bundle, and its recorded state (nil if none).
+func (r *Repository) importBundle(ctx context.Context, bundlePath string) (string, string, []byte, error) {
+	// git runs from the fork, so relative paths must be resolved from the current directory first
+	bundlePath, err := filepath.Abs(bundlePath)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to resolve bundle path: %w", err)
+	}
+	heads, err := RunGitCommand(ctx, r.forkRepoPath, "bundle", "list-heads", bundlePath)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to read bundle: %w", err)
+	}
+
+	branches := []string{}
+	noteRefs := []string{}
+	for line := range strings.SplitSeq(heads, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch ref := fields[1]; {
+		case strings.HasPrefix(ref, "refs/heads/"):
+			branches = append(branches, strings.TrimPrefix(ref, "refs/heads/"))
+		case ref == "refs/notes/"+gitNotesLogRef || ref == "refs/notes/"+gitNotesStateRef:
+			noteRefs = append(noteRefs, strings.TrimPrefix(ref, "refs/notes/"))
+		}
+	}
+	if len(branches) != 1 {
+		return "", "", nil, fmt.Errorf("expected exactly one environment in bundle, found %d", len(branches))
+	}
+	sourceID := branches[0]
+
+	var (
+		id    string
+		state []byte
+	)
+	err = r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		// Handle ID collisions the same way Create picks IDs
+		id = sourceID
+		for r.exists(ctx, id) == nil {
+			id = petname.Generate(2, "-")
+		}
+
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "fetch", bundlePath, fmt.Sprintf("refs/heads/%s:refs/heads/%s", sourceID, id)); err != nil {
+			return err
+		}
+
+		return r.lockManager.WithLock(ctx, LockTypeNotes, func() error {
+			for _, ref := range noteRefs {
+				if err := r.importNotes(ctx, bundlePath, ref, id); err != nil {
+					return err
+				}
+			}
+
+			note, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", gitNotesStateRef, "show", id)
+			if err != nil {
+				if strings.Contains(err.Error(), "no note found") {
+					return nil
+				}
+				return err
+			}
+			state = []byte(note)
+			return nil
+		})
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return id, sourceID, state, nil
+}
+
+// importNotes copies the notes of ref from a bundle into the fork, keeping any note already present for a commit.
+func (r *Repository) importNotes(ctx context.Context, bundlePath, ref, id string) error {
+	tmpRef := fmt.Sprintf("refs/notes/%s-import-%s", ref, id)
+	if _, err := RunGitCommand(ctx, r.forkRepoPath, "fetch", bundlePath, fmt.Sprintf("+refs/notes/%s:%s", ref, tmpRef)); err != nil {
+		return err
+	}
+	defer RunGitCommand(ctx, r.forkRepoPath, "update-ref", "-d", tmpRef)
+
+	notes, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", tmpRef, "list")
+	if err != nil {
+		return err
+	}
+	for line := range strings.SplitSeq(notes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		_, err := RunGitCommand(ctx, r.forkRepoPath, "notes", "--ref", ref, "add", "-C", fields[0], fields[1])
+		if err != nil && !strings.Contains(err.Error(), "existing notes") {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportBundle(t *testing.T) {
+	ctx := context.Background()
+
+	source := setupTestRepository(t)
+	createTestEnvironment(t, source, "test-env")
+
+	var buf bytes.Buffer
+	require.NoError(t, source.Export(ctx, "test-env", ExportFormatBundle, &buf))
+	bundlePath := filepath.Join(t.TempDir(), "test-env.bundle")
+	require.NoError(t, os.WriteFile(bundlePath, buf.Bytes(), 0644))
+
+	target := setupTestRepository(t)
+	_, err := RunGitCommand(ctx, target.forkRepoPath, "config", "user.email", "test@example.com")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, target.forkRepoPath, "config", "user.name", "Test User")
+	require.NoError(t, err)
+
+	t.Run("keeps_original_id", func(t *testing.T) {
+		id, sourceID, state, err := target.importBundle(ctx, bundlePath)
+		require.NoError(t, err)
+		assert.Equal(t, "test-env", id)
+		assert.Equal(t, "test-env", sourceID)
+		assert.Contains(t, string(state), `"title":"test-env"`)
+		assert.NoError(t, target.exists(ctx, "test-env"))
+	})
+
+	t.Run("generates_id_on_collision", func(t *testing.T) {
+		id, sourceID, state, err := target.importBundle(ctx, bundlePath)
+		require.NoError(t, err)
+		assert.NotEqual(t, "test-env", id)
+		assert.Equal(t, "test-env", sourceID)
+		assert.Contains(t, string(state), `"title":"test-env"`)
+		assert.NoError(t, target.exists(ctx, id))
+	})
+
+	t.Run("relative_path", func(t *testing.T) {
+		t.Chdir(filepath.Dir(bundlePath))
+		id, sourceID, _, err := target.importBundle(ctx, filepath.Base(bundlePath))
+		require.NoError(t, err)
+		assert.Equal(t, "test-env", sourceID)
+		assert.NoError(t, target.exists(ctx, id))
+	})
+
+	t.Run("invalid_bundle", func(t *testing.T) {
+		invalidPath := filepath.Join(t.TempDir(), "invalid.bundle")
+		require.NoError(t, os.WriteFile(invalidPath, []byte("not a bundle"), 0644))
+		_, _, _, err := target.importBundle(ctx, invalidPath)
+		assert.ErrorContains(t, err, "failed to read bundle")
+	})
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestEnvironmentWithFile creates environment id with a commit writing file on top of the user's HEAD,
+// and fetches it into the user repository like environments created by agents.
+func createTestEnvironmentWithFile(t *testing.T, repo *Repository, id, file, contents string) {
+	t.Helper()
+	ctx := context.Background()
+
+	head, err := RunGitCommand(ctx, repo.userRepoPath, "branch", "--show-current")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "checkout", "-q", "-b", "tmp-"+id)
+	require.NoError(t, err)
+	writeFile(t, repo.userRepoPath, file, contents)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "add", file)
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Write "+file)
+	require.NoError(t, err)
+
+	createTestEnvironment(t, repo, id)
+
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "checkout", "-q", strings.TrimSpace(head))
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "branch", "-q", "-D", "tmp-"+id)
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "fetch", "-q", containerUseRemote, id)
+	require.NoError(t, err)
+}
+
+func TestRepositoryMergeWithOptions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("squash", func(t *testing.T) {
+		repo := setupTestRepository(t)
+		createTestEnvironmentWithFile(t, repo, "squash-env", "feature.txt", "feature\n")
+
+		var out bytes.Buffer
+		err := repo.MergeWithOptions(ctx, "squash-env", MergeOptions{Squash: true, Message: "feat: add feature"}, &out)
+		require.NoError(t, err, out.String())
+
+		log, err := RunGitCommand(ctx, repo.userRepoPath, "log", "--format=%s")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"feat: add feature", "Initial commit"}, strings.Split(strings.TrimSpace(log), "\n"))
+		assert.FileExists(t, filepath.Join(repo.userRepoPath, "feature.txt"))
+
+		// Squashing again has nothing to commit
+		require.NoError(t, repo.MergeWithOptions(ctx, "squash-env", MergeOptions{Squash: true}, &out))
+	})
+
+	t.Run("fast_forward", func(t *testing.T) {
+		repo := setupTestRepository(t)
+		createTestEnvironmentWithFile(t, repo, "ff-env", "feature.txt", "feature\n")
+
+		var out bytes.Buffer
+		require.NoError(t, repo.MergeWithOptions(ctx, "ff-env", MergeOptions{FastForward: true}, &out), out.String())
+
+		subject, err := RunGitCommand(ctx, repo.userRepoPath, "log", "-1", "--format=%s")
+		require.NoError(t, err)
+		assert.Equal(t, "Write feature.txt", strings.TrimSpace(subject))
+	})
+
+	t.Run("no_ff_message", func(t *testing.T) {
+		repo := setupTestRepository(t)
+		createTestEnvironmentWithFile(t, repo, "merge-env", "feature.txt", "feature\n")
+
+		var out bytes.Buffer
+		require.NoError(t, repo.MergeWithOptions(ctx, "merge-env", MergeOptions{Message: "Merge the feature"}, &out), out.String())
+
+		subject, err := RunGitCommand(ctx, repo.userRepoPath, "log", "-1", "--format=%s")
+		require.NoError(t, err)
+		assert.Equal(t, "Merge the feature", strings.TrimSpace(subject))
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		repo := setupTestRepository(t)
+		createTestEnvironmentWithFile(t, repo, "conflict-env", "README.md", "# From environment\n")
+
+		writeFile(t, repo.userRepoPath, "README.md", "# From user\n")
+		_, err := RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-am", "User change")
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		err = repo.MergeWithOptions(ctx, "conflict-env", MergeOptions{}, &out)
+		var conflict *MergeConflictError
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, []string{"README.md"}, conflict.Files)
+
+		// The working tree is left conflicted for manual resolution
+		contents, err := os.ReadFile(filepath.Join(repo.userRepoPath, "README.md"))
+		require.NoError(t, err)
+		assert.Contains(t, string(contents), "<<<<<<<")
+	})
+
+	for _, scenario := range []struct {
+		strategy MergeStrategy
+		squash   bool
+		expected string
+	}{
+		{strategy: MergeStrategyTheirs, expected: "# From environment\n"},
+		{strategy: MergeStrategyOurs, expected: "# From user\n"},
+		{strategy: MergeStrategyTheirs, squash: true, expected: "# From environment\n"},
+	} {
+		name := "strategy_" + string(scenario.strategy)
+		if scenario.squash {
+			name += "_squash"
+		}
+		t.Run(name, func(t *testing.T) {
+			repo := setupTestRepository(t)
+			createTestEnvironmentWithFile(t, repo, "conflict-env", "README.md", "# From environment\n")
+
+			writeFile(t, repo.userRepoPath, "README.md", "# From user\n")
+			_, err := RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-am", "User change")
+			require.NoError(t, err)
+
+			var out bytes.Buffer
+			err = repo.MergeWithOptions(ctx, "conflict-env", MergeOptions{Strategy: scenario.strategy, Squash: scenario.squash}, &out)
+			require.NoError(t, err, out.String())
+
+			contents, err := os.ReadFile(filepath.Join(repo.userRepoPath, "README.md"))
+			require.NoError(t, err)
+			assert.Equal(t, scenario.expected, string(contents))
+		})
+	}
+
+	t.Run("unknown_strategy", func(t *testing.T) {
+		repo := setupTestRepository(t)
+		createTestEnvironmentWithFile(t, repo, "merge-env", "feature.txt", "feature\n")
+
+		var out bytes.Buffer
+		err := repo.MergeWithOptions(ctx, "merge-env", MergeOptions{Strategy: "recursive"}, &out)
+		assert.ErrorContains(t, err, "unknown merge strategy")
+	})
+}
+
+func TestRepositoryPreviewApply(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	writeFile(t, repo.userRepoPath, "notes.txt", "notes\n")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", "notes.txt")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Add notes")
+	require.NoError(t, err)
+	createTestEnvironmentWithFile(t, repo, "preview-env", "README.md", "# From environment\n")
+
+	preview, err := repo.PreviewApply(ctx, "preview-env", ApplyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"M README.md"}, preview.Changes)
+	assert.Empty(t, preview.LocalChanges)
+	assert.Empty(t, preview.Conflicts)
+
+	// Uncommitted changes to files changed by the environment are reported
+	writeFile(t, repo.userRepoPath, "README.md", "# Local edit\n")
+	writeFile(t, repo.userRepoPath, "notes.txt", "more notes\n")
+	preview, err = repo.PreviewApply(ctx, "preview-env", ApplyOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"README.md", "notes.txt"}, preview.LocalChanges)
+	assert.Equal(t, []string{"README.md"}, preview.LocalConflicts)
+
+	// Committed changes conflicting with the environment are reported
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-am", "User change")
+	require.NoError(t, err)
+	preview, err = repo.PreviewApply(ctx, "preview-env", ApplyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"README.md"}, preview.Conflicts)
+
+	// Nothing was applied
+	contents, err := os.ReadFile(filepath.Join(repo.userRepoPath, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Local edit\n", string(contents))
+}
+
+func TestRepositoryPreviewApplyRenamesAndQuotedPaths(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	writeFile(t, repo.userRepoPath, "old name.txt", "old\n")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", "old name.txt")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Add old name")
+	require.NoError(t, err)
+	createTestEnvironmentWithFile(t, repo, "quoted-env", "café.txt", "env\n")
+
+	preview, err := repo.PreviewApply(ctx, "quoted-env", ApplyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A café.txt"}, preview.Changes)
+
+	// A staged rename of a file changed by the environment is a local conflict
+	createTestEnvironmentWithFile(t, repo, "rename-env", "old name.txt", "env\n")
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "mv", "old name.txt", "new name.txt")
+	require.NoError(t, err)
+
+	preview, err = repo.PreviewApply(ctx, "rename-env", ApplyOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"M old name.txt"}, preview.Changes)
+	assert.Equal(t, []string{"new name.txt"}, preview.LocalChanges)
+	assert.Equal(t, []string{"new name.txt"}, preview.LocalConflicts)
+}
+
+func TestRepositoryApplySkipsAppliedChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironmentWithFile(t, repo, "apply-env", "feature.txt", "v1\n")
+
+	// The branch moves on after the environment was created
+	writeFile(t, repo.userRepoPath, "notes.txt", "notes\n")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", "notes.txt")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Add notes")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, repo.Apply(ctx, "apply-env", &out), out.String())
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Apply feature")
+	require.NoError(t, err)
+
+	// The user reworks the applied change while the environment keeps going
+	writeFile(t, repo.userRepoPath, "feature.txt", "v1 reviewed\n")
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-am", "Review feature")
+	require.NoError(t, err)
+
+	worktreePath, err := repo.getWorktree(ctx, "apply-env")
+	require.NoError(t, err)
+	writeFile(t, worktreePath, "second.txt", "second\n")
+	_, err = RunGitCommand(ctx, worktreePath, "add", "second.txt")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, worktreePath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Write second.txt")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "notes", "--ref", gitNotesStateRef, "add", "-f", "-m", `{"title":"apply-env"}`, "apply-env")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "fetch", "-q", containerUseRemote, "apply-env")
+	require.NoError(t, err)
+
+	// By default, everything the environment changed is applied again
+	preview, err := repo.PreviewApply(ctx, "apply-env", ApplyOptions{})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"A feature.txt", "A second.txt"}, preview.Changes)
+
+	// Since the last apply, only the new change is applied, the reviewed one isn't reverted nor conflicting
+	preview, err = repo.PreviewApply(ctx, "apply-env", ApplyOptions{SinceLastApply: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A second.txt"}, preview.Changes)
+	assert.Empty(t, preview.Conflicts)
+
+	writeFile(t, repo.userRepoPath, "notes.txt", "local notes\n")
+	out.Reset()
+	require.NoError(t, repo.ApplyWithOptions(ctx, "apply-env", ApplyOptions{SinceLastApply: true}, &out), out.String())
+
+	status, err := RunGitCommand(ctx, repo.userRepoPath, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, " M notes.txt\nA  second.txt\n", status)
+	contents, err := os.ReadFile(filepath.Join(repo.userRepoPath, "feature.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1 reviewed\n", string(contents))
+
+	// An explicit base applies everything since it
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "reset", "-q", "--hard")
+	require.NoError(t, err)
+	preview, err = repo.PreviewApply(ctx, "apply-env", ApplyOptions{Base: "HEAD~3"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"A feature.txt", "A second.txt"}, preview.Changes)
+	assert.Equal(t, []string{"feature.txt"}, preview.Conflicts)
+
+	_, err = repo.PreviewApply(ctx, "apply-env", ApplyOptions{Base: "no-such-ref"})
+	assert.Error(t, err)
+}
@@ -1,18 +1,23 @@
 package repository
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"dagger.io/dagger"
 	"github.com/dagger/container-use/environment"
@@ -27,8 +32,18 @@ const (
 	gitNotesStateRef   = "container-use-state"
 )
 
-// getDefaultConfigPath returns the default configuration path for the current OS
+// ConfigDirEnv overrides where container-use stores its data.
+const ConfigDirEnv = "CONTAINER_USE_CONFIG_DIR"
+
+// getDefaultConfigPath returns the configuration path set in the environment, or the default one for the current OS
 func getDefaultConfigPath() string {
+	if dir := os.Getenv(ConfigDirEnv); dir != "" {
+		// Relative directories are resolved once, as commands run git from other directories
+		if abs, err := filepath.Abs(dir); err == nil {
+			return abs
+		}
+		return dir
+	}
 	if runtime.GOOS == "windows" {
 		// On Windows, use APPDATA or LOCALAPPDATA
 		if appData := os.Getenv("APPDATA"); appData != "" {
@@ -54,6 +69,22 @@ var (
 	cuGlobalConfigPath = getDefaultConfigPath()
 )
 
+// SetConfigDir changes where Open, Backup and Restore find container-use data. Relative directories are
+// resolved from the current directory.
+func SetConfigDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config directory %s: %w", dir, err)
+	}
+	cuGlobalConfigPath = abs
+	return nil
+}
+
+// ConfigDir returns where container-use data is stored.
+func ConfigDir() string {
+	return cuGlobalConfigPath
+}
+
 type Repository struct {
 	userRepoPath string
 	forkRepoPath string
@@ -71,6 +102,11 @@ func (r *Repository) getWorktreePath() string {
 	return filepath.Join(r.basePath, "worktrees")
 }
 
+// getProcessesPath returns where running servers publish their background processes, see environment.PublishProcesses
+func (r *Repository) getProcessesPath() string {
+	return filepath.Join(r.basePath, "processes")
+}
+
 func Open(ctx context.Context, repo string) (*Repository, error) {
 	return OpenWithBasePath(ctx, repo, cuGlobalConfigPath)
 }
@@ -97,6 +133,16 @@ func OpenWithBasePath(ctx context.Context, repo string, basePath string) (*Repos
 	userRepoPath := strings.TrimSpace(output)
 
 	forkRepoPath, err := getContainerUseRemote(ctx, userRepoPath)
+	if err == nil {
+		// The fork may have moved, e.g. when container-use data was restored on another machine,
+		// or belong to another configuration directory. Fall back to the fork of this configuration
+		// directory, ensureUserRemote will then update the remote.
+		if _, statErr := os.Stat(forkRepoPath); os.IsNotExist(statErr) {
+			err = os.ErrNotExist
+		} else if rel, relErr := filepath.Rel(filepath.Join(expandedBasePath, "repos"), forkRepoPath); relErr != nil || !filepath.IsLocal(rel) {
+			err = os.ErrNotExist
+		}
+	}
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, err
@@ -181,13 +227,147 @@ func (r *Repository) exists(ctx context.Context, id string) error {
 	return nil
 }
 
+// Config returns the configuration new environments are created with: the defaults overridden by the
+// repository configuration (.container-use/environment.json).
+func (r *Repository) Config() (*environment.EnvironmentConfig, error) {
+	config := environment.DefaultConfig()
+	if err := config.Load(r.userRepoPath); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// CreateConfig returns the configuration Create uses: the repository configuration, starting from fromImage if set,
+// with the workdir of the source at gitRef when detect_source is enabled. The default setup script is run when
+// the source at gitRef has one, see EnvironmentConfig.SetupScript.
+func (r *Repository) CreateConfig(ctx context.Context, gitRef, fromImage string) (*environment.EnvironmentConfig, error) {
+	config, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	if config.SetupScript == "" {
+		// The script is read from the source environments are built from, not from the working tree
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "cat-file", "-e", gitRef+":"+environment.DefaultSetupScript); err == nil {
+			config.SetupScript = environment.DefaultSetupScript
+		}
+	}
+	if config.DetectSource {
+		detection, err := r.DetectSource(ctx, gitRef, fromImage)
+		if err != nil {
+			return nil, err
+		}
+		// Tell a workdir set to the default apart from an unset one
+		repoConfig := &environment.EnvironmentConfig{}
+		if err := repoConfig.Load(r.userRepoPath); err != nil {
+			return nil, err
+		}
+		config = config.WithDetected(detection, repoConfig)
+	}
+	if fromImage == "" {
+		return config, nil
+	}
+	config = config.StartingFrom(fromImage)
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid from_image: %w", err)
+	}
+	return config, nil
+}
+
+// DetectSource detects the language of the source at gitRef, see environment.DetectSource. Returns nil when
+// detect_source is disabled. The base image is only suggested when none is configured or given as fromImage.
+func (r *Repository) DetectSource(ctx context.Context, gitRef, fromImage string) (*environment.SourceDetection, error) {
+	config, err := r.Config()
+	if err != nil || !config.DetectSource {
+		return nil, err
+	}
+
+	// Only read the markers the source has, git show fails on the others
+	out, err := RunGitCommand(ctx, r.userRepoPath, "ls-tree", "--name-only", gitRef, "--", "go.mod", "pyproject.toml", "package.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the source of %s: %w", gitRef, err)
+	}
+	markers := strings.Fields(out)
+	detection, err := environment.DetectSource(func(name string) ([]byte, error) {
+		if !slices.Contains(markers, name) {
+			return nil, fs.ErrNotExist
+		}
+		data, err := RunGitCommand(ctx, r.userRepoPath, "show", gitRef+":"+name)
+		return []byte(data), err
+	})
+	if err != nil || detection == nil {
+		return nil, err
+	}
+
+	if fromImage != "" || config.Dockerfile != "" || config.BaseImage != environment.DefaultConfig().BaseImage {
+		detection.BaseImage = ""
+	}
+	return detection, nil
+}
+
+// ErrConfigExists is returned by ExportConfig when the repository already has a configuration
+// and overwriting it was not requested.
+var ErrConfigExists = errors.New("repository configuration already exists")
+
+// ExportConfig writes the identified environment's configuration to the repository configuration
+// (.container-use/environment.json), making it the default for new environments.
+// An existing configuration is only replaced if overwrite is set. Returns the path written to.
+func (r *Repository) ExportConfig(ctx context.Context, id string, overwrite bool) (string, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	configPath := environment.ConfigPath(r.userRepoPath)
+	if !overwrite {
+		if _, err := os.Stat(configPath); err == nil {
+			return configPath, fmt.Errorf("%w: %s", ErrConfigExists, configPath)
+		}
+	}
+
+	if err := envInfo.State.Config.Save(r.userRepoPath); err != nil {
+		return "", fmt.Errorf("failed to save configuration: %w", err)
+	}
+	return configPath, nil
+}
+
+// DescribeBuild renders how the identified environment is built as a Dockerfile-equivalent text.
+// See EnvironmentConfig.BuildPlan.
+func (r *Repository) DescribeBuild(ctx context.Context, id string) (string, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	config := envInfo.State.Config
+
+	dockerfile := ""
+	if config.Dockerfile != "" {
+		worktreePath, err := r.getWorktree(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(filepath.Join(worktreePath, filepath.FromSlash(config.Dockerfile)))
+		if err != nil {
+			return "", fmt.Errorf("failed to read the environment's Dockerfile: %w", err)
+		}
+		dockerfile = string(data)
+	}
+
+	return config.BuildPlan(dockerfile), nil
+}
+
 // Create creates a new environment with the given description, explanation, and optional git reference.
 // The git reference can be HEAD (default), a SHA, a branch name, or a tag.
+// With fromImage, the environment starts from that image instead of building one, see EnvironmentConfig.StartingFrom.
 // Requires a dagger client for container operations during environment initialization.
-func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description, explanation, gitRef string) (*environment.Environment, error) {
+func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description, explanation, gitRef, fromImage string) (*environment.Environment, error) {
 	if gitRef == "" {
 		gitRef = "HEAD"
 	}
+	config, err := r.CreateConfig(ctx, gitRef, fromImage)
+	if err != nil {
+		return nil, err
+	}
+
 	id := petname.Generate(2, "-")
 	worktree, submoduleWarning, err := r.initializeWorktree(ctx, id, gitRef)
 	if err != nil {
@@ -196,7 +376,7 @@ func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description
 
 	// Protect createInitialCommit to prevent concurrent writes to .git/worktrees/*/logs/HEAD
 	if err := r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
-		return r.createInitialCommit(ctx, worktree, id, description)
+		return r.createInitialCommit(ctx, worktree, id, description, config)
 	}); err != nil {
 		return nil, fmt.Errorf("failed to create initial commit: %w", err)
 	}
@@ -207,26 +387,14 @@ func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description
 	}
 	worktreeHead = strings.TrimSpace(worktreeHead)
 
-	var baseSourceDir *dagger.Directory
-	err = r.lockManager.WithRLock(ctx, LockTypeForkRepo, func() error {
-		var err error
-		baseSourceDir, err = dag.
-			Host().
-			Directory(r.forkRepoPath, dagger.HostDirectoryOpts{NoCache: true}). // bust cache for each Create call
-			AsGit().
-			Ref(worktreeHead).
-			Tree(dagger.GitRefTreeOpts{DiscardGitDir: true}).
-			Sync(ctx) // don't bust cache when loading from state
-
-		return err
-	})
+	exclude, err := environment.LoadIgnore(worktree)
 	if err != nil {
-		return nil, fmt.Errorf("failed loading initial source directory: %w", err)
+		return nil, err
 	}
 
-	config := environment.DefaultConfig()
-	if err := config.Load(r.userRepoPath); err != nil {
-		return nil, err
+	baseSourceDir, err := r.loadSourceDir(ctx, dag, worktreeHead, config.IncludeGitDir, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading initial source directory: %w", err)
 	}
 
 	// Detect submodules from the host worktree before creating the environment
@@ -256,6 +424,35 @@ func (r *Repository) Create(ctx context.Context, dag *dagger.Client, description
 	return env, nil
 }
 
+// loadSourceDir loads the tree of a commit of the fork repository, the source environments start from.
+// With includeGitDir, the .git directory is kept with the full history instead of being discarded.
+// Paths matching the exclude patterns of .container-use/ignore are left out.
+func (r *Repository) loadSourceDir(ctx context.Context, dag *dagger.Client, commit string, includeGitDir bool, exclude []string) (*dagger.Directory, error) {
+	treeOpts := dagger.GitRefTreeOpts{DiscardGitDir: true}
+	if includeGitDir {
+		// A negative depth fetches the whole history rather than the commit alone
+		treeOpts = dagger.GitRefTreeOpts{Depth: -1}
+	}
+
+	var sourceDir *dagger.Directory
+	err := r.lockManager.WithRLock(ctx, LockTypeForkRepo, func() error {
+		tree := dag.
+			Host().
+			Directory(r.forkRepoPath, dagger.HostDirectoryOpts{NoCache: true}). // bust cache for each call
+			AsGit().
+			Ref(commit).
+			Tree(treeOpts)
+		if len(exclude) > 0 {
+			tree = tree.Filter(dagger.DirectoryFilterOpts{Exclude: filterPatterns(exclude)})
+		}
+
+		var err error
+		sourceDir, err = tree.Sync(ctx) // don't bust cache when loading from state
+		return err
+	})
+	return sourceDir, err
+}
+
 // Get retrieves a full Environment with dagger client embedded for container operations.
 // Use this when you need to perform container operations like running commands, terminals, etc.
 // For basic metadata access without container operations, use Info() instead.
@@ -312,16 +509,26 @@ func (r *Repository) Info(ctx context.Context, id string) (*environment.Environm
 // Returns EnvironmentInfo slice avoiding dagger client initialization.
 // Use Get() on individual environments when you need full Environment with container operations.
 func (r *Repository) List(ctx context.Context) ([]*environment.EnvironmentInfo, error) {
-	branches, err := RunGitCommand(ctx, r.forkRepoPath, "branch", "--format", "%(refname:short)")
+	branches, err := RunGitCommand(ctx, r.forkRepoPath, "for-each-ref", "--format", "%(refname:short) %(objectname)", "refs/heads")
 	if err != nil {
 		return nil, err
 	}
 
-	branchList := []string{}
-	for branch := range strings.SplitSeq(branches, "\n") {
-		branch = strings.TrimSpace(branch)
-		if branch != "" {
-			branchList = append(branchList, branch)
+	// Any change to the state notes moves the notes ref, invalidating cached states.
+	// The ref doesn't exist until the first environment is created.
+	notesTip, _ := RunGitCommand(ctx, r.forkRepoPath, "rev-parse", "--verify", "--quiet", "refs/notes/"+gitNotesStateRef)
+	notesTip = strings.TrimSpace(notesTip)
+
+	branchList := []stateCacheKey{}
+	for line := range strings.SplitSeq(branches, "\n") {
+		branch, tip, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if ok && branch != "" {
+			branchList = append(branchList, stateCacheKey{
+				forkRepoPath: r.forkRepoPath,
+				branch:       branch,
+				tip:          tip,
+				notesTip:     notesTip,
+			})
 		}
 	}
 
@@ -333,7 +540,7 @@ func (r *Repository) List(ctx context.Context) ([]*environment.EnvironmentInfo,
 	}
 
 	// Channel for sending work to workers
-	branchChan := make(chan string, len(branchList))
+	branchChan := make(chan stateCacheKey, len(branchList))
 
 	// Slice to collect results with mutex protection
 	var envs []*environment.EnvironmentInfo
@@ -345,16 +552,16 @@ func (r *Repository) List(ctx context.Context) ([]*environment.EnvironmentInfo,
 	// Start worker goroutines
 	for range maxWorkers {
 		g.Go(func() error {
-			for branch := range branchChan {
+			for key := range branchChan {
 				// Check if context was cancelled
 				if ctx.Err() != nil {
 					return ctx.Err()
 				}
 
 				// note:  we used to do a loadState here to validate that branch contains an environment.
-				// r.Info does the exact same process, so instead we rely on its errors to determine if the branch is an env.
+				// r.listInfo does the exact same process, so instead we rely on its errors to determine if the branch is an env.
 				// we always need the full info here, even if it looks like we just use the ID, because we need it to sort the IDs by updated_at.
-				envInfo, err := r.Info(ctx, branch)
+				envInfo, err := r.listInfo(ctx, key)
 				if err != nil {
 					// Skip branches where we can't load info
 					continue
@@ -370,8 +577,8 @@ func (r *Repository) List(ctx context.Context) ([]*environment.EnvironmentInfo,
 	}
 
 	// Send all branches to workers
-	for _, branch := range branchList {
-		branchChan <- branch
+	for _, key := range branchList {
+		branchChan <- key
 	}
 	close(branchChan)
 
@@ -389,6 +596,33 @@ func (r *Repository) List(ctx context.Context) ([]*environment.EnvironmentInfo,
 	return envs, nil
 }
 
+// listInfo is like Info for a branch known to exist, reusing the state read by previous listings
+// if neither the branch nor the state notes changed since.
+func (r *Repository) listInfo(ctx context.Context, key stateCacheKey) (*environment.EnvironmentInfo, error) {
+	if state, ok := states.get(key); ok {
+		worktree, err := r.WorktreePath(key.branch)
+		if err != nil {
+			return nil, err
+		}
+		return environment.LoadInfo(ctx, key.branch, state, worktree)
+	}
+
+	worktree, err := r.getWorktree(ctx, key.branch)
+	if err != nil {
+		return nil, err
+	}
+	state, err := r.loadState(ctx, worktree)
+	if err != nil {
+		return nil, err
+	}
+	envInfo, err := environment.LoadInfo(ctx, key.branch, state, worktree)
+	if err != nil {
+		return nil, err
+	}
+	states.put(key, state)
+	return envInfo, nil
+}
+
 // ListDescendantEnvironments returns environments that are descendants of the given commit.
 // This filters environments to only those where the provided commit is an ancestor
 // of the environment's current HEAD. Environments are sorted by most recently updated first.
@@ -445,9 +679,85 @@ func (r *Repository) Delete(ctx context.Context, id string) error {
 	if err := r.deleteLocalRemoteBranch(id); err != nil {
 		return err
 	}
+	r.deleteAppliedRefs(ctx, id)
+	r.autoGC(ctx)
 	return nil
 }
 
+// validEnvironmentID matches IDs usable both as branch names and worktree directory names.
+var validEnvironmentID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// Rename changes the ID of an environment. The environment branch is renamed and its worktree recreated,
+// and the container-use remote of the source repository is updated, along with the local branches tracking it.
+// Background processes are tracked and store their output under the environment ID, so environments running
+// some can't be renamed. Notes are attached to commits, so the
+// environment keeps its state and log.
+func (r *Repository) Rename(ctx context.Context, oldID, newID string) error {
+	if !validEnvironmentID.MatchString(newID) {
+		return fmt.Errorf("invalid environment ID %q: use letters, digits, dashes and underscores", newID)
+	}
+	if err := r.exists(ctx, oldID); err != nil {
+		return err
+	}
+	if oldID == newID {
+		return nil
+	}
+	running, err := environment.ListPublishedProcesses(r.getProcessesPath())
+	if err != nil {
+		return fmt.Errorf("failed to list background processes: %w", err)
+	}
+	if n := len(running[oldID]); n > 0 {
+		return fmt.Errorf("environment %q has %d background processes running, stop them before renaming it", oldID, n)
+	}
+
+	oldWorktreePath, err := r.WorktreePath(oldID)
+	if err != nil {
+		return err
+	}
+	newWorktreePath, err := r.WorktreePath(newID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.lockManager.WithLock(ctx, LockTypeForkRepo, func() error {
+		if r.exists(ctx, newID) == nil {
+			return fmt.Errorf("environment %q already exists", newID)
+		}
+		if _, err := os.Stat(newWorktreePath); err == nil {
+			return fmt.Errorf("worktree %s already exists", newWorktreePath)
+		}
+
+		// Worktrees only hold committed changes. Recreating the worktree rather than moving it keeps
+		// its git directory named after the environment, which exports rely on.
+		if err := os.RemoveAll(oldWorktreePath); err != nil {
+			return fmt.Errorf("failed to remove worktree: %w", err)
+		}
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "worktree", "prune"); err != nil {
+			return err
+		}
+
+		if _, err := RunGitCommand(ctx, r.forkRepoPath, "branch", "-m", oldID, newID); err != nil {
+			return fmt.Errorf("failed to rename branch: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if _, err := r.getWorktree(ctx, newID); err != nil {
+		return err
+	}
+
+	return r.lockManager.WithLock(ctx, LockTypeUserRepo, func() error {
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "remote", "prune", containerUseRemote); err != nil {
+			return err
+		}
+		r.renameAppliedRefs(ctx, oldID, newID)
+		r.retrackBranches(ctx, oldID, newID)
+		return nil
+	})
+}
+
 // Checkout changes the user's current branch to that of the identified environment.
 // It attempts to get the most recent commit from the environment without discarding any user changes.
 func (r *Repository) Checkout(ctx context.Context, id, branch string) (string, error) {
@@ -477,31 +787,103 @@ func (r *Repository) Checkout(ctx context.Context, id, branch string) (string, e
 	if localBranchExists {
 		remoteRef := fmt.Sprintf("%s/%s", containerUseRemote, id)
 
-		counts, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--left-right", "--count", fmt.Sprintf("HEAD...%s", remoteRef))
+		aheadCount, behindCount, err := r.aheadBehind(ctx, "HEAD", remoteRef)
 		if err != nil {
 			return branch, err
 		}
 
-		parts := strings.Split(strings.TrimSpace(counts), "\t")
-		if len(parts) != 2 {
-			return branch, fmt.Errorf("unexpected git rev-list output: %s", counts)
-		}
-		aheadCount, behindCount := parts[0], parts[1]
-
-		if behindCount != "0" && aheadCount == "0" {
+		if behindCount != 0 && aheadCount == 0 {
 			_, err = RunGitCommand(ctx, r.userRepoPath, "merge", "--ff-only", remoteRef)
 			if err != nil {
 				return branch, err
 			}
-		} else if behindCount != "0" {
-			return branch, fmt.Errorf("switched to %s, but %s is %s ahead and container-use/ remote has %s additional commits", branch, branch, aheadCount, behindCount)
+		} else if behindCount != 0 {
+			return branch, fmt.Errorf("switched to %s, but %s is %d ahead and container-use/ remote has %d additional commits", branch, branch, aheadCount, behindCount)
 		}
 	}
 
 	return branch, err
 }
 
-func (r *Repository) Log(ctx context.Context, id string, patch bool, w io.Writer) error {
+// CheckoutWorktree checks out the branch of the identified environment into a new git worktree at path,
+// leaving the user's current branch and working directory untouched. Returns the branch checked out.
+func (r *Repository) CheckoutWorktree(ctx context.Context, id, branch, path string) (string, error) {
+	if err := r.exists(ctx, id); err != nil {
+		return "", err
+	}
+
+	if branch == "" {
+		branch = "cu-" + id
+	}
+
+	args := []string{"worktree", "add"}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "show-ref", "--verify", "--quiet", fmt.Sprintf("refs/heads/%s", branch)); err == nil {
+		args = append(args, path, branch)
+	} else {
+		args = append(args, "--track", "-b", branch, path, fmt.Sprintf("%s/%s", containerUseRemote, id))
+	}
+	if _, err := RunGitCommand(ctx, r.userRepoPath, args...); err != nil {
+		return "", err
+	}
+
+	return branch, nil
+}
+
+// RemoveCheckoutWorktree removes a worktree created by CheckoutWorktree. Its branch is kept.
+// Worktrees with uncommitted changes are not removed.
+func (r *Repository) RemoveCheckoutWorktree(ctx context.Context, path string) error {
+	_, err := RunGitCommand(ctx, r.userRepoPath, "worktree", "remove", path)
+	return err
+}
+
+// PushToRemote pushes the branch of the identified environment to a remote of the source repository, e.g. to open
+// a pull request. refspec is the branch or ref to push to, defaulting to cu-<id> like Checkout. Authentication
+// relies on the user's git credentials. Returns the ref pushed to.
+func (r *Repository) PushToRemote(ctx context.Context, id, remoteName, refspec string) (string, error) {
+	if err := r.exists(ctx, id); err != nil {
+		return "", err
+	}
+	if remoteName == containerUseRemote {
+		return "", fmt.Errorf("the %s remote holds the environments already, push to another remote", containerUseRemote)
+	}
+
+	if refspec == "" {
+		refspec = "cu-" + id
+	}
+	if !strings.HasPrefix(refspec, "refs/") {
+		refspec = "refs/heads/" + refspec
+	}
+
+	// Make sure the latest state of the environment is pushed
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "fetch", containerUseRemote, id); err != nil {
+		return "", err
+	}
+	source := fmt.Sprintf("refs/remotes/%s/%s", containerUseRemote, id)
+	if _, err := RunGitCommand(ctx, r.userRepoPath, "push", remoteName, source+":"+refspec); err != nil {
+		return "", fmt.Errorf("failed to push to %s: %w", remoteName, err)
+	}
+
+	return refspec, nil
+}
+
+// Log writes the history of an environment to w. With paths, only commits touching them are shown.
+func (r *Repository) Log(ctx context.Context, id string, patch bool, paths []string, w io.Writer) error {
+	return r.LogWithOptions(ctx, id, LogOptions{Patch: patch, Paths: paths}, w)
+}
+
+// LogOptions controls which commits of an environment Log shows, and how.
+type LogOptions struct {
+	// Patch shows the changes of each commit
+	Patch bool
+	// Paths only shows the commits touching them
+	Paths []string
+	// Since and Until, when set, only show the commits made in between
+	Since time.Time
+	Until time.Time
+}
+
+// LogWithOptions writes the history of an environment to w, see LogOptions.
+func (r *Repository) LogWithOptions(ctx context.Context, id string, opts LogOptions, w io.Writer) error {
 	envInfo, err := r.Info(ctx, id)
 	if err != nil {
 		return err
@@ -512,18 +894,25 @@ func (r *Repository) Log(ctx context.Context, id string, patch bool, w io.Writer
 		fmt.Sprintf("--notes=%s", gitNotesLogRef),
 	}
 
-	if patch {
+	if opts.Patch {
 		logArgs = append(logArgs, "--patch")
 	} else {
 		logArgs = append(logArgs, "--format=%C(yellow)%h%Creset  %s %Cgreen(%cr)%Creset %+N")
 	}
+	if !opts.Since.IsZero() {
+		logArgs = append(logArgs, "--since="+opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		logArgs = append(logArgs, "--until="+opts.Until.Format(time.RFC3339))
+	}
 
 	revisionRange, err := r.revisionRange(ctx, envInfo)
 	if err != nil {
 		return err
 	}
 
-	logArgs = append(logArgs, revisionRange)
+	logArgs = append(logArgs, revisionRange, "--")
+	logArgs = append(logArgs, opts.Paths...)
 
 	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, logArgs...)
 }
@@ -548,20 +937,358 @@ func (r *Repository) Diff(ctx context.Context, id string, w io.Writer) error {
 	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, diffArgs...)
 }
 
+// DiffEnvironments writes the differences between the latest states of two environments.
+// With stat, only a summary of changed files is written. Paths limit the diff to matching files.
+func (r *Repository) DiffEnvironments(ctx context.Context, idA, idB string, stat bool, paths []string, w io.Writer) error {
+	for _, id := range []string{idA, idB} {
+		if err := r.exists(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	diffArgs := []string{"diff"}
+	if stat {
+		diffArgs = append(diffArgs, "--stat")
+	}
+	diffArgs = append(diffArgs, "refs/heads/"+idA, "refs/heads/"+idB, "--")
+	diffArgs = append(diffArgs, paths...)
+
+	return RunInteractiveGitCommand(ctx, r.forkRepoPath, w, diffArgs...)
+}
+
+// DiffLocal writes the differences between the user's working tree as it is now, uncommitted and untracked files
+// included, and the latest state of an environment. Unlike Diff, which shows what the environment changed since it
+// started, it shows what the files would look like with the environment's versions.
+// With stat, only a summary of changed files is written. Paths limit the diff to matching files.
+func (r *Repository) DiffLocal(ctx context.Context, id string, stat bool, paths []string, w io.Writer) error {
+	if err := r.exists(ctx, id); err != nil {
+		return err
+	}
+
+	localTree, err := r.workingTreeSnapshot(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot the working tree: %w", err)
+	}
+
+	diffArgs := []string{"diff"}
+	if stat {
+		diffArgs = append(diffArgs, "--stat")
+	}
+	diffArgs = append(diffArgs, localTree, "container-use/"+id, "--")
+	diffArgs = append(diffArgs, paths...)
+
+	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, diffArgs...)
+}
+
+// workingTreeSnapshot writes the user's working tree as a git tree, untracked files included and ignored files
+// left out, and returns its ID. A copy of the index is used so that the user's staged changes are left untouched.
+func (r *Repository) workingTreeSnapshot(ctx context.Context) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "container-use-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	index := filepath.Join(tmpDir, "index")
+
+	// Starting from the user's index saves hashing the files that didn't change
+	indexPath, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	if data, err := os.ReadFile(strings.TrimSpace(indexPath)); err == nil {
+		if err := os.WriteFile(index, data, 0600); err != nil {
+			return "", err
+		}
+	}
+
+	var tree string
+	for _, args := range [][]string{{"add", "--all"}, {"write-tree"}} {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = r.userRepoPath
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+index)
+		// Only stdout holds the tree, warnings go to stderr
+		output, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				output = append(output, exitErr.Stderr...)
+			}
+			return "", fmt.Errorf("git %s failed: %w\nOutput: %s", args[0], err, output)
+		}
+		tree = strings.TrimSpace(string(output))
+	}
+	return tree, nil
+}
+
 func (r *Repository) Merge(ctx context.Context, id string, w io.Writer) error {
+	return r.MergeWithOptions(ctx, id, MergeOptions{}, w)
+}
+
+// MergeOptions controls how an environment is merged into the current branch.
+type MergeOptions struct {
+	// Squash merges the environment's changes as a single commit, dropping its history
+	Squash bool
+	// Message replaces the default commit message
+	Message string
+	// FastForward allows fast-forwarding the current branch instead of always creating a merge commit
+	FastForward bool
+	// Strategy decides how conflicting changes are resolved, defaults to MergeStrategyManual
+	Strategy MergeStrategy
+}
+
+// MergeStrategy decides how conflicts between an environment and the current branch are resolved.
+type MergeStrategy string
+
+const (
+	// MergeStrategyManual leaves conflicts in the working tree for the user to resolve.
+	MergeStrategyManual MergeStrategy = "manual"
+	// MergeStrategyOurs resolves conflicting hunks in favor of the current branch.
+	MergeStrategyOurs MergeStrategy = "ours"
+	// MergeStrategyTheirs resolves conflicting hunks in favor of the environment.
+	MergeStrategyTheirs MergeStrategy = "theirs"
+)
+
+// args returns the git merge arguments implementing the strategy.
+func (s MergeStrategy) args() ([]string, error) {
+	switch s {
+	case "", MergeStrategyManual:
+		return nil, nil
+	case MergeStrategyOurs, MergeStrategyTheirs:
+		return []string{"-X", string(s)}, nil
+	default:
+		return nil, fmt.Errorf("unknown merge strategy %q (expected %q, %q or %q)", s, MergeStrategyManual, MergeStrategyOurs, MergeStrategyTheirs)
+	}
+}
+
+// MergeConflictError is returned when merging an environment conflicts with the current branch.
+// The working tree is left in the conflicted state for manual resolution.
+type MergeConflictError struct {
+	Files []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("merge conflicts in %s", strings.Join(e.Files, ", "))
+}
+
+// MergeWithOptions merges an environment into the current branch, autostashing local changes.
+func (r *Repository) MergeWithOptions(ctx context.Context, id string, opts MergeOptions, w io.Writer) error {
 	envInfo, err := r.Info(ctx, id)
 	if err != nil {
 		return err
 	}
+	ref := "container-use/" + envInfo.ID
+	strategyArgs, err := opts.Strategy.args()
+	if err != nil {
+		return err
+	}
 
-	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, "merge", "--no-ff", "--autostash", "-m", "Merge environment "+envInfo.ID, "--", "container-use/"+envInfo.ID)
+	if opts.Squash {
+		args := append([]string{"merge", "--autostash", "--squash"}, strategyArgs...)
+		args = append(args, "--", ref)
+		if err := RunInteractiveGitCommand(ctx, r.userRepoPath, w, args...); err != nil {
+			return r.mergeError(ctx, err)
+		}
+		// Nothing is staged if the environment was already merged
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--cached", "--quiet"); err == nil {
+			return nil
+		}
+		return RunInteractiveGitCommand(ctx, r.userRepoPath, w, "commit", "-m", cmp.Or(opts.Message, "Squash environment "+envInfo.ID))
+	}
+
+	args := []string{"merge", "--autostash", "-m", cmp.Or(opts.Message, "Merge environment "+envInfo.ID)}
+	if !opts.FastForward {
+		args = append(args, "--no-ff")
+	}
+	args = append(args, strategyArgs...)
+	args = append(args, "--", ref)
+	if err := RunInteractiveGitCommand(ctx, r.userRepoPath, w, args...); err != nil {
+		return r.mergeError(ctx, err)
+	}
+	return nil
+}
+
+// mergeError returns a MergeConflictError if a failed merge left conflicts behind.
+func (r *Repository) mergeError(ctx context.Context, err error) error {
+	conflicts, diffErr := RunGitCommand(ctx, r.userRepoPath, "diff", "--name-only", "--diff-filter=U")
+	if diffErr != nil || strings.TrimSpace(conflicts) == "" {
+		return err
+	}
+	return &MergeConflictError{Files: strings.Split(strings.TrimSpace(conflicts), "\n")}
 }
 
 func (r *Repository) Apply(ctx context.Context, id string, w io.Writer) error {
+	return r.ApplyWithOptions(ctx, id, ApplyOptions{}, w)
+}
+
+// ApplyOptions controls how an environment is applied to the current branch.
+type ApplyOptions struct {
+	// Base is the commit of the environment to apply the changes since. Defaults to where the environment
+	// forked from the current branch, see SinceLastApply.
+	Base string
+	// SinceLastApply defaults Base to the last commit of the environment applied to the current branch, so that
+	// changes applied and committed before aren't applied again. Applied changes are only recorded as staged:
+	// those the user discarded since are skipped too.
+	SinceLastApply bool
+}
+
+// base returns the commit of the environment to apply the changes since, empty for where it forked from branch.
+func (opts ApplyOptions) base(ctx context.Context, r *Repository, id, branch string) string {
+	if opts.Base != "" || !opts.SinceLastApply {
+		return opts.Base
+	}
+	return r.lastApplied(ctx, id, branch)
+}
+
+// ApplyWithOptions stages the changes of an environment on the current branch, autostashing local changes.
+func (r *Repository) ApplyWithOptions(ctx context.Context, id string, opts ApplyOptions, w io.Writer) error {
 	envInfo, err := r.Info(ctx, id)
 	if err != nil {
 		return err
 	}
+	ref := "container-use/" + envInfo.ID
+	branch, err := r.currentUserBranch(ctx)
+	if err != nil {
+		return err
+	}
+	branch = strings.TrimSpace(branch)
+
+	if base := opts.base(ctx, r, envInfo.ID, branch); base == "" {
+		err = RunInteractiveGitCommand(ctx, r.userRepoPath, w, "merge", "--autostash", "--squash", "--", ref)
+	} else {
+		err = r.applySince(ctx, ref, base, w)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.recordApplied(ctx, envInfo.ID, branch)
+	return nil
+}
+
+// applySince stages the changes of ref since base, leaving out those made before. Local changes are stashed
+// and restored, like squash merges do with --autostash.
+func (r *Repository) applySince(ctx context.Context, ref, base string, w io.Writer) error {
+	baseCommit, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--verify", "--quiet", base+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("invalid base %q: not a commit", base)
+	}
+	// A commit of the environment's tree on top of base holds exactly the changes since base,
+	// and cherry-picking it merges them with base as the merge base.
+	commit, err := RunGitCommand(ctx, r.userRepoPath, "commit-tree", "--no-gpg-sign", "-p", strings.TrimSpace(baseCommit), "-m", "Apply "+ref, ref+"^{tree}")
+	if err != nil {
+		return err
+	}
+
+	status, err := RunGitCommand(ctx, r.userRepoPath, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return err
+	}
+	stashed := strings.TrimSpace(status) != ""
+	if stashed {
+		if _, err := RunGitCommand(ctx, r.userRepoPath, "stash", "push", "-m", "container-use apply autostash"); err != nil {
+			return fmt.Errorf("failed to stash local changes: %w", err)
+		}
+	}
+
+	if err := RunInteractiveGitCommand(ctx, r.userRepoPath, w, "cherry-pick", "--no-commit", strings.TrimSpace(commit)); err != nil {
+		if stashed {
+			fmt.Fprintln(w, "Your local changes were stashed, run 'git stash pop' once the conflicts are resolved.")
+		}
+		return err
+	}
+	if stashed {
+		return RunInteractiveGitCommand(ctx, r.userRepoPath, w, "stash", "pop")
+	}
+	return nil
+}
+
+// ApplyPreview describes what applying an environment would do to the user's working tree.
+type ApplyPreview struct {
+	// Changes are the files changed by the environment, prefixed with their git status letter (A, M, D, ...)
+	Changes []string
+	// LocalChanges are the files with uncommitted changes, stashed before applying and restored after
+	LocalChanges []string
+	// Conflicts are the files expected to conflict with the current branch
+	Conflicts []string
+	// LocalConflicts are the files with uncommitted changes also changed by the environment.
+	// Restoring those local changes after applying may conflict.
+	LocalConflicts []string
+}
+
+// PreviewApply reports what ApplyWithOptions would do without touching the working tree.
+func (r *Repository) PreviewApply(ctx context.Context, id string, opts ApplyOptions) (*ApplyPreview, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	preview := &ApplyPreview{}
+
+	branch, err := r.currentUserBranch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	base := opts.base(ctx, r, envInfo.ID, strings.TrimSpace(branch))
+	revisionRange := base + "..container-use/" + envInfo.ID
+	if base == "" {
+		revisionRange, err = r.revisionRange(ctx, envInfo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Paths are NUL-terminated with -z, instead of being quoted when they have unusual characters
+	changes, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--name-status", "--no-renames", "-z", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+	changedFiles := map[string]bool{}
+	fields := strings.Split(strings.TrimSuffix(changes, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, file := fields[i], fields[i+1]
+		preview.Changes = append(preview.Changes, status+" "+file)
+		changedFiles[file] = true
+	}
+
+	status, err := RunGitCommand(ctx, r.userRepoPath, "status", "--porcelain", "-z", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+	fields = strings.Split(strings.TrimSuffix(status, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		entry := fields[i]
+		if len(entry) < 4 {
+			continue
+		}
+		file := entry[3:]
+		conflicts := changedFiles[file]
+		// Renames and copies are followed by their original path, which the environment may change too
+		if strings.ContainsAny(entry[:2], "RC") && i+1 < len(fields) {
+			i++
+			conflicts = conflicts || changedFiles[fields[i]]
+		}
+		preview.LocalChanges = append(preview.LocalChanges, file)
+		if conflicts {
+			preview.LocalConflicts = append(preview.LocalConflicts, file)
+		}
+	}
+
+	// merge-tree performs the merge in memory, exiting with 1 and listing conflicting files on conflicts
+	cmd := exec.CommandContext(ctx, "git", "merge-tree", "--write-tree", "--name-only", "--no-messages", "-z", "HEAD", "container-use/"+envInfo.ID)
+	cmd.Dir = r.userRepoPath
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return nil, fmt.Errorf("failed to check for conflicts (requires git 2.38 or later): %w", err)
+		}
+		// The first entry is the ID of the merged tree
+		files := strings.Split(strings.TrimRight(string(output), "\x00\n"), "\x00")
+		for _, file := range files[1:] {
+			// merge-tree merges from the fork point, files only changed before base aren't applied again
+			if base == "" || changedFiles[file] {
+				preview.Conflicts = append(preview.Conflicts, file)
+			}
+		}
+	}
 
-	return RunInteractiveGitCommand(ctx, r.userRepoPath, w, "merge", "--autostash", "--squash", "--", "container-use/"+envInfo.ID)
+	return preview, nil
 }
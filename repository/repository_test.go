@@ -2,11 +2,14 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/dagger/container-use/environment"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -65,4 +68,454 @@ func TestRepositoryOpen(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, repo.forkRepoPath, strings.TrimSpace(remote))
 	})
+
+	t.Run("switching_config_dir", func(t *testing.T) {
+		repo := setupTestRepository(t)
+		otherConfigDir := t.TempDir()
+
+		other, err := OpenWithBasePath(ctx, repo.userRepoPath, otherConfigDir)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(other.forkRepoPath, otherConfigDir), "fork should be in the configuration directory in use, got %s", other.forkRepoPath)
+
+		remote, err := RunGitCommand(ctx, repo.userRepoPath, "remote", "get-url", "container-use")
+		require.NoError(t, err)
+		assert.Equal(t, other.forkRepoPath, strings.TrimSpace(remote))
+	})
+}
+
+func TestConfigDirEnv(t *testing.T) {
+	t.Setenv(ConfigDirEnv, "/tmp/container-use-profile")
+	assert.Equal(t, "/tmp/container-use-profile", getDefaultConfigPath())
+
+	// Relative directories are resolved from the current directory
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	t.Setenv(ConfigDirEnv, "profile")
+	assert.Equal(t, filepath.Join(cwd, "profile"), getDefaultConfigPath())
+
+	previous := ConfigDir()
+	t.Cleanup(func() { cuGlobalConfigPath = previous })
+	require.NoError(t, SetConfigDir("other-profile"))
+	assert.Equal(t, filepath.Join(cwd, "other-profile"), ConfigDir())
+}
+
+// setupTestRepository creates a git repository with a single commit and opens it with an isolated base path.
+func setupTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	ctx := context.Background()
+	repoDir := t.TempDir()
+	configDir := t.TempDir()
+
+	_, err := RunGitCommand(ctx, repoDir, "init")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repoDir, "config", "user.email", "test@example.com")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repoDir, "config", "user.name", "Test User")
+	require.NoError(t, err)
+
+	writeFile(t, repoDir, "README.md", "# Test")
+	_, err = RunGitCommand(ctx, repoDir, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repoDir, "commit", "-m", "Initial commit")
+	require.NoError(t, err)
+
+	repo, err := OpenWithBasePath(ctx, repoDir, configDir)
+	require.NoError(t, err)
+	return repo
+}
+
+// createTestEnvironment pushes the user repository's HEAD to the fork as environment id
+// and attaches a minimal state note, without requiring dagger.
+func createTestEnvironment(t *testing.T, repo *Repository, id string) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "push", containerUseRemote, "HEAD:refs/heads/"+id)
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "notes", "--ref", gitNotesStateRef, "add", "-f", "-m", `{"title":"`+id+`"}`, id)
+	require.NoError(t, err)
+}
+
+// TestRepositoryConfig tests that the configuration of new environments is resolved from the repository
+func TestRepositoryConfig(t *testing.T) {
+	repo := setupTestRepository(t)
+
+	config, err := repo.Config()
+	require.NoError(t, err)
+	assert.Equal(t, environment.DefaultConfig(), config)
+
+	writeFile(t, repo.userRepoPath, ".container-use/environment.json", `{"base_image": "python:3.12", "setup_commands": ["pip install uv"]}`)
+	config, err = repo.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "python:3.12", config.BaseImage)
+	assert.Equal(t, []string{"pip install uv"}, config.SetupCommands)
+	assert.Equal(t, environment.DefaultConfig().Workdir, config.Workdir)
+
+	writeFile(t, repo.userRepoPath, ".container-use/environment.json", `{"workdir": "relative"}`)
+	_, err = repo.Config()
+	assert.Error(t, err)
+}
+
+// TestRepositoryCreateConfig tests that environments created from an image skip building one
+func TestRepositoryCreateConfig(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	writeFile(t, repo.userRepoPath, ".container-use/environment.json", `{"dockerfile": "Dockerfile", "setup_commands": ["apt-get install -y make"], "install_commands": ["make deps"], "env": ["CI=true"]}`)
+
+	config, err := repo.CreateConfig(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Dockerfile", config.Dockerfile)
+
+	config, err = repo.CreateConfig(ctx, "HEAD", "ghcr.io/acme/golden-dev:v1")
+	require.NoError(t, err)
+	assert.Equal(t, "ghcr.io/acme/golden-dev:v1", config.BaseImage)
+	assert.Empty(t, config.Dockerfile)
+	assert.Empty(t, config.SetupCommands)
+	assert.Equal(t, []string{"make deps"}, config.InstallCommands)
+	assert.Equal(t, environment.KVList{"CI=true"}, config.Env)
+
+	_, err = repo.CreateConfig(ctx, "HEAD", "Not An Image")
+	assert.Error(t, err)
+}
+
+// TestRepositoryCreateConfigSetupScript tests that the default setup script is only run once committed
+func TestRepositoryCreateConfigSetupScript(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	writeFile(t, repo.userRepoPath, ".container-use/setup.sh", "#!/bin/sh\napk add bash\n")
+
+	config, err := repo.CreateConfig(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Empty(t, config.SetupScript, "uncommitted scripts aren't part of the source environments are built from")
+
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-m", "Add setup script")
+	require.NoError(t, err)
+	config, err = repo.CreateConfig(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, environment.DefaultSetupScript, config.SetupScript)
+	config, err = repo.CreateConfig(ctx, "HEAD~1", "")
+	require.NoError(t, err)
+	assert.Empty(t, config.SetupScript)
+
+	config, err = repo.CreateConfig(ctx, "HEAD", "ghcr.io/acme/golden-dev:v1")
+	require.NoError(t, err)
+	assert.Empty(t, config.SetupScript, "images to start from are already set up")
+}
+
+// TestRepositoryDetectSource tests that the workdir follows the source's language once detect_source is enabled
+func TestRepositoryDetectSource(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	writeFile(t, repo.userRepoPath, "go.mod", "module example.com/app\n\ngo 1.24.2\n")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-m", "Add go.mod")
+	require.NoError(t, err)
+
+	// Off by default
+	detection, err := repo.DetectSource(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Nil(t, detection)
+	config, err := repo.CreateConfig(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/workdir", config.Workdir)
+
+	writeFile(t, repo.userRepoPath, ".container-use/environment.json", `{"detect_source": true}`)
+	detection, err = repo.DetectSource(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, &environment.SourceDetection{
+		Marker:    "go.mod",
+		Language:  "go",
+		Workdir:   "/go/src/example.com/app",
+		BaseImage: "golang:1.24",
+	}, detection)
+	config, err = repo.CreateConfig(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/go/src/example.com/app", config.Workdir)
+	assert.Equal(t, "ubuntu:24.04", config.BaseImage)
+
+	// Sources are read at the ref environments are created from
+	detection, err = repo.DetectSource(ctx, "HEAD~1", "")
+	require.NoError(t, err)
+	assert.Nil(t, detection)
+
+	// The image given is not second-guessed
+	detection, err = repo.DetectSource(ctx, "HEAD", "ghcr.io/acme/golden-dev:v1")
+	require.NoError(t, err)
+	assert.Empty(t, detection.BaseImage)
+
+	// Configured values win
+	writeFile(t, repo.userRepoPath, ".container-use/environment.json", `{"detect_source": true, "workdir": "/src", "base_image": "golang:1.23"}`)
+	detection, err = repo.DetectSource(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Empty(t, detection.BaseImage)
+	config, err = repo.CreateConfig(ctx, "HEAD", "")
+	require.NoError(t, err)
+	assert.Equal(t, "/src", config.Workdir)
+}
+
+// TestRepositoryListCache tests that List reuses states read from git notes until they change
+func TestRepositoryListCache(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	envs, err := repo.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, envs, 1)
+	assert.Equal(t, "test-env", envs[0].State.Title)
+
+	tip, err := RunGitCommand(ctx, repo.forkRepoPath, "rev-parse", "test-env")
+	require.NoError(t, err)
+	notesTip, err := RunGitCommand(ctx, repo.forkRepoPath, "rev-parse", "refs/notes/"+gitNotesStateRef)
+	require.NoError(t, err)
+	_, ok := states.get(stateCacheKey{
+		forkRepoPath: repo.forkRepoPath,
+		branch:       "test-env",
+		tip:          strings.TrimSpace(tip),
+		notesTip:     strings.TrimSpace(notesTip),
+	})
+	assert.True(t, ok, "state should be cached after listing")
+
+	// Updating the state invalidates the cache
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "notes", "--ref", gitNotesStateRef, "add", "-f", "-m", `{"title":"renamed"}`, "test-env")
+	require.NoError(t, err)
+
+	envs, err = repo.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, envs, 1)
+	assert.Equal(t, "renamed", envs[0].State.Title)
+}
+
+// TestRepositoryRename tests that renaming an environment moves its branch, worktree and remote ref, keeping its state
+func TestRepositoryRename(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "fancy-mallard")
+	createTestEnvironment(t, repo, "clever-dolphin")
+
+	oldWorktree, err := repo.getWorktree(ctx, "fancy-mallard")
+	require.NoError(t, err)
+	before, err := repo.Info(ctx, "fancy-mallard")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "fetch", "-q", containerUseRemote, "fancy-mallard")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "branch", "--track", "cu-fancy-mallard", containerUseRemote+"/fancy-mallard")
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Rename(ctx, "fancy-mallard", "user-api"))
+
+	info, err := repo.Info(ctx, "user-api")
+	require.NoError(t, err)
+	assert.Equal(t, before.State, info.State, "state should follow the renamed environment")
+	assert.Error(t, repo.exists(ctx, "fancy-mallard"))
+
+	newWorktree, err := repo.WorktreePath("user-api")
+	require.NoError(t, err)
+	assert.NoDirExists(t, oldWorktree)
+	assert.DirExists(t, newWorktree)
+	branch, err := RunGitCommand(ctx, newWorktree, "branch", "--show-current")
+	require.NoError(t, err)
+	assert.Equal(t, "user-api", strings.TrimSpace(branch))
+	gitDir, err := RunGitCommand(ctx, newWorktree, "rev-parse", "--absolute-git-dir")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo.forkRepoPath, "worktrees", "user-api"), strings.TrimSpace(gitDir), "exports point worktrees to the git directory named after the environment")
+
+	refs, err := RunGitCommand(ctx, repo.userRepoPath, "for-each-ref", "--format=%(refname)", "refs/remotes/"+containerUseRemote)
+	require.NoError(t, err)
+	assert.Contains(t, refs, "refs/remotes/container-use/user-api")
+	assert.NotContains(t, refs, "refs/remotes/container-use/fancy-mallard")
+	upstream, err := RunGitCommand(ctx, repo.userRepoPath, "rev-parse", "--abbrev-ref", "cu-fancy-mallard@{upstream}")
+	require.NoError(t, err)
+	assert.Equal(t, "container-use/user-api", strings.TrimSpace(upstream), "checked out branches keep tracking the environment")
+
+	t.Run("collision", func(t *testing.T) {
+		err := repo.Rename(ctx, "user-api", "clever-dolphin")
+		assert.ErrorContains(t, err, "already exists")
+	})
+
+	t.Run("invalid ID", func(t *testing.T) {
+		err := repo.Rename(ctx, "user-api", "../user-api")
+		assert.ErrorContains(t, err, "invalid environment ID")
+	})
+
+	t.Run("missing environment", func(t *testing.T) {
+		err := repo.Rename(ctx, "fancy-mallard", "other-name")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("background processes", func(t *testing.T) {
+		// Processes are published by the server running them, this test process standing for it
+		published := fmt.Sprintf(`{"pid": %d, "processes": {"user-api": [{"id": "1", "command": "npm start"}]}}`, os.Getpid())
+		writeFile(t, repo.getProcessesPath(), strconv.Itoa(os.Getpid())+".json", published)
+		err := repo.Rename(ctx, "user-api", "other-name")
+		assert.ErrorContains(t, err, "has 1 background processes running")
+		assert.NoError(t, repo.exists(ctx, "user-api"))
+	})
+}
+
+// TestRepositoryCheckoutWorktree tests that environments can be checked out without switching the user's branch
+func TestRepositoryCheckoutWorktree(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	before, err := repo.currentUserBranch(ctx)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "review")
+	branch, err := repo.CheckoutWorktree(ctx, "test-env", "", path)
+	require.NoError(t, err)
+	assert.Equal(t, "cu-test-env", branch)
+
+	after, err := repo.currentUserBranch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, before, after, "the user's branch should not change")
+
+	upstream, err := RunGitCommand(ctx, path, "rev-parse", "--abbrev-ref", "@{upstream}")
+	require.NoError(t, err)
+	assert.Equal(t, "container-use/test-env", strings.TrimSpace(upstream))
+	_, err = os.Stat(filepath.Join(path, "README.md"))
+	assert.NoError(t, err)
+
+	_, err = repo.CheckoutWorktree(ctx, "missing-env", "", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+
+	require.NoError(t, repo.RemoveCheckoutWorktree(ctx, path))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// The branch is kept and reused
+	_, err = repo.CheckoutWorktree(ctx, "test-env", "", path)
+	require.NoError(t, err)
+}
+
+// TestRepositoryExportConfig tests that an environment's configuration is written to the repository, asking before overwriting
+func TestRepositoryExportConfig(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+	_, err := RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "notes", "--ref", gitNotesStateRef, "add", "-f", "-m",
+		`{"title":"test-env","config":{"base_image":"python:3.12","workdir":"/workdir","setup_commands":["pip install uv"]}}`, "test-env")
+	require.NoError(t, err)
+
+	configPath, err := repo.ExportConfig(ctx, "test-env", false)
+	require.NoError(t, err)
+	assert.Equal(t, environment.ConfigPath(repo.userRepoPath), configPath)
+	config, err := repo.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "python:3.12", config.BaseImage)
+	assert.Equal(t, []string{"pip install uv"}, config.SetupCommands)
+
+	writeFile(t, repo.userRepoPath, ".container-use/environment.json", `{"base_image": "golang:1.24"}`)
+	_, err = repo.ExportConfig(ctx, "test-env", false)
+	assert.ErrorIs(t, err, ErrConfigExists)
+	config, err = repo.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "golang:1.24", config.BaseImage, "existing configuration should be kept")
+
+	_, err = repo.ExportConfig(ctx, "test-env", true)
+	require.NoError(t, err)
+	config, err = repo.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "python:3.12", config.BaseImage)
+}
+
+// TestRepositoryDescribeBuild tests that Dockerfile-based environments are described with their Dockerfile
+func TestRepositoryDescribeBuild(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+
+	writeFile(t, repo.userRepoPath, "Dockerfile", "FROM golang:1.24\n")
+	_, err := RunGitCommand(ctx, repo.userRepoPath, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-m", "Add Dockerfile")
+	require.NoError(t, err)
+	createTestEnvironment(t, repo, "test-env")
+
+	plan, err := repo.DescribeBuild(ctx, "test-env")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(plan, "FROM "+environment.DefaultConfig().BaseImage+"\n"), "environments without a recorded configuration use the defaults")
+
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "notes", "--ref", gitNotesStateRef, "add", "-f", "-m",
+		`{"title":"test-env","config":{"workdir":"/workdir","dockerfile":"Dockerfile","install_commands":["go mod download"]}}`, "test-env")
+	require.NoError(t, err)
+
+	plan, err = repo.DescribeBuild(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Contains(t, plan, "FROM golang:1.24\n")
+	assert.Contains(t, plan, "RUN go mod download\n")
+}
+
+// TestRepositoryPushToRemote tests that an environment's branch is pushed to a remote of the source repository
+func TestRepositoryPushToRemote(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	remoteDir := t.TempDir()
+	_, err := RunGitCommand(ctx, remoteDir, "init", "--bare")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "remote", "add", "origin", remoteDir)
+	require.NoError(t, err)
+
+	envHead, err := RunGitCommand(ctx, repo.forkRepoPath, "rev-parse", "test-env")
+	require.NoError(t, err)
+
+	ref, err := repo.PushToRemote(ctx, "test-env", "origin", "feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/feature/x", ref)
+	pushed, err := RunGitCommand(ctx, remoteDir, "rev-parse", "feature/x")
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(envHead), strings.TrimSpace(pushed))
+
+	ref, err = repo.PushToRemote(ctx, "test-env", "origin", "")
+	require.NoError(t, err)
+	assert.Equal(t, "refs/heads/cu-test-env", ref)
+
+	_, err = repo.PushToRemote(ctx, "test-env", containerUseRemote, "feature/x")
+	assert.Error(t, err)
+	_, err = repo.PushToRemote(ctx, "test-env", "missing-remote", "feature/x")
+	assert.Error(t, err)
+	_, err = repo.PushToRemote(ctx, "missing-env", "origin", "feature/x")
+	assert.Error(t, err)
+}
+
+// TestRepositorySubmodules tests that the submodules of an environment are listed with their URL and commit
+func TestRepositorySubmodules(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+
+	libDir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=Test User", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "Library"},
+	} {
+		_, err := RunGitCommand(ctx, libDir, args...)
+		require.NoError(t, err)
+	}
+	libCommit, err := RunGitCommand(ctx, libDir, "rev-parse", "HEAD")
+	require.NoError(t, err)
+
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "-c", "protocol.file.allow=always", "submodule", "add", "-q", libDir, "vendor/lib")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Add library")
+	require.NoError(t, err)
+
+	createTestEnvironment(t, repo, "test-env")
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com", "notes", "--ref", gitNotesStateRef, "add", "-f", "-m", `{"title":"test-env","submodule_paths":["vendor/lib"]}`, "test-env")
+	require.NoError(t, err)
+
+	submodules, err := repo.Submodules(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Equal(t, []Submodule{{
+		Path:   "vendor/lib",
+		URL:    libDir,
+		Commit: strings.TrimSpace(libCommit),
+	}}, submodules)
+
+	_, err = repo.Submodules(ctx, "missing-env")
+	assert.Error(t, err)
 }
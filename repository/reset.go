@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"dagger.io/dagger"
+	"github.com/dagger/container-use/environment"
+)
+
+// Reset discards the changes made in an environment after version, rebuilding its container from its
+// configuration with the source of that version. Versions are numbered after the entries of History:
+// version N is the source after the N-th change, and version 0 the commit the environment started from.
+// The reset is committed as a new change, so the discarded changes remain in the history.
+func (r *Repository) Reset(ctx context.Context, dag *dagger.Client, id string, version int) (*environment.Environment, error) {
+	history, err := r.History(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version < 0 || version > len(history) {
+		return nil, fmt.Errorf("environment '%s' has no version %d, versions go from 0 (its base) to %d", id, version, len(history))
+	}
+
+	env, err := r.Get(ctx, dag, id)
+	if err != nil {
+		return nil, err
+	}
+
+	target := ""
+	if version == 0 {
+		target, err = r.createdFrom(ctx, env.EnvironmentInfo)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		target = history[version-1].Commit
+	}
+
+	worktreePath, err := r.WorktreePath(id)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := environment.LoadIgnore(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+	sourceDir, err := r.loadSourceDir(ctx, dag, target, env.State.Config.IncludeGitDir, exclude)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading source of version %d: %w", version, err)
+	}
+
+	if err := env.Rebuild(ctx, sourceDir); err != nil {
+		return nil, fmt.Errorf("failed to rebuild environment: %w", err)
+	}
+	env.Notes.Add("Reset to version %d (%s)", version, target[:7])
+
+	if err := r.Update(ctx, env, fmt.Sprintf("Reset to version %d", version)); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryResetUnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironmentWithFile(t, repo, "work-env", "main.go", "package main\n")
+
+	// Versions are checked before connecting to the engine
+	_, err := repo.Reset(ctx, nil, "work-env", 2)
+	assert.ErrorContains(t, err, "environment 'work-env' has no version 2, versions go from 0 (its base) to 1")
+	_, err = repo.Reset(ctx, nil, "work-env", -1)
+	assert.Error(t, err)
+	_, err = repo.Reset(ctx, nil, "missing-env", 0)
+	assert.Error(t, err)
+}
+
+// TestRepositoryCreatedFrom tests that versions don't depend on the current branch, e.g. once an environment is merged
+func TestRepositoryCreatedFrom(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+
+	base, err := RunGitCommand(ctx, repo.userRepoPath, "rev-parse", "HEAD")
+	require.NoError(t, err)
+	head, err := RunGitCommand(ctx, repo.userRepoPath, "branch", "--show-current")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "checkout", "-q", "-b", "tmp-created-env")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "--allow-empty", "-m", initialCommitPrefix+"created-env: Test")
+	require.NoError(t, err)
+	writeFile(t, repo.userRepoPath, "main.go", "package main\n")
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "add", "main.go")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-q", "-m", "Write main.go")
+	require.NoError(t, err)
+	createTestEnvironment(t, repo, "created-env")
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "checkout", "-q", strings.TrimSpace(head))
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "fetch", "-q", containerUseRemote, "created-env")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "merge", "-q", "--ff-only", "tmp-created-env")
+	require.NoError(t, err)
+
+	envInfo, err := repo.Info(ctx, "created-env")
+	require.NoError(t, err)
+	createdFrom, err := repo.createdFrom(ctx, envInfo)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(base), createdFrom)
+
+	history, err := repo.History(ctx, "created-env")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "Write main.go", history[1].Explanation)
+	_, err = repo.Reset(ctx, nil, "created-env", 3)
+	assert.ErrorContains(t, err, "versions go from 0 (its base) to 2")
+}
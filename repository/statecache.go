@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// stateCacheTTL bounds how long environment states read from git notes are reused.
+const stateCacheTTL = 30 * time.Second
+
+// stateCacheKey identifies an environment state. Any commit to the environment or change to the
+// state notes produces a new key, so entries never go stale before they expire.
+type stateCacheKey struct {
+	forkRepoPath string
+	branch       string
+	tip          string
+	notesTip     string
+}
+
+type stateCacheEntry struct {
+	state   []byte
+	expires time.Time
+}
+
+// stateCache avoids re-reading the state of unchanged environments on repeated listings,
+// such as shell completion or agents calling environment_list in a loop.
+type stateCache struct {
+	mu      sync.Mutex
+	entries map[stateCacheKey]stateCacheEntry
+}
+
+var states = &stateCache{
+	entries: map[stateCacheKey]stateCacheEntry{},
+}
+
+func (c *stateCache) get(key stateCacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.state, true
+}
+
+func (c *stateCache) put(key stateCacheKey, state []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = stateCacheEntry{
+		state:   state,
+		expires: now.Add(stateCacheTTL),
+	}
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dagger/container-use/environment"
+)
+
+// BranchStatus describes how the user's current branch relates to the environment it tracks.
+type BranchStatus struct {
+	Branch      string
+	Environment *environment.EnvironmentInfo
+	// Ahead and Behind count the commits only on the branch and only in the environment, respectively
+	Ahead  int
+	Behind int
+	// Dirty is set when the working tree has changes that aren't committed to the branch
+	Dirty bool
+}
+
+// Status reports which environment the current branch tracks and how far they diverged.
+// Branches are associated with environments through their upstream (container-use/<id>, as set up by Checkout),
+// or else by being named after them (cu-<id>).
+func (r *Repository) Status(ctx context.Context) (*BranchStatus, error) {
+	branch, err := r.currentUserBranch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	branch = strings.TrimSpace(branch)
+	if branch == "" {
+		return nil, errors.New("not on a branch")
+	}
+
+	id, ok := "", false
+	if upstream, err := RunGitCommand(ctx, r.userRepoPath, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}"); err == nil {
+		id, ok = strings.CutPrefix(strings.TrimSpace(upstream), containerUseRemote+"/")
+	}
+	if !ok {
+		id, ok = strings.CutPrefix(branch, "cu-")
+	}
+	if !ok || r.exists(ctx, id) != nil {
+		return nil, fmt.Errorf("branch %s is not associated with an environment, use `container-use checkout` to check one out", branch)
+	}
+
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ahead, behind, err := r.aheadBehind(ctx, "HEAD", containerUseRemote+"/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	dirty, _, err := r.IsDirty(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BranchStatus{
+		Branch:      branch,
+		Environment: envInfo,
+		Ahead:       ahead,
+		Behind:      behind,
+		Dirty:       dirty,
+	}, nil
+}
+
+// aheadBehind counts the commits only reachable from left and only reachable from right in the user repository.
+func (r *Repository) aheadBehind(ctx context.Context, left, right string) (int, int, error) {
+	counts, err := RunGitCommand(ctx, r.userRepoPath, "rev-list", "--left-right", "--count", fmt.Sprintf("%s...%s", left, right))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	parts := strings.Split(strings.TrimSpace(counts), "\t")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %s", counts)
+	}
+	ahead, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %s", counts)
+	}
+	behind, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output: %s", counts)
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryStatus(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	_, err := repo.Status(ctx)
+	assert.ErrorContains(t, err, "not associated with an environment")
+
+	_, err = repo.Checkout(ctx, "test-env", "")
+	require.NoError(t, err)
+
+	status, err := repo.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "cu-test-env", status.Branch)
+	assert.Equal(t, "test-env", status.Environment.ID)
+	assert.Equal(t, "test-env", status.Environment.State.Title)
+	assert.Zero(t, status.Ahead)
+	assert.Zero(t, status.Behind)
+	assert.False(t, status.Dirty)
+
+	writeFile(t, repo.userRepoPath, "local.txt", "local change")
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "add", ".")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "commit", "-m", "Local change")
+	require.NoError(t, err)
+	writeFile(t, repo.userRepoPath, "README.md", "# Uncommitted")
+
+	status, err = repo.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.Ahead)
+	assert.Zero(t, status.Behind)
+	assert.True(t, status.Dirty)
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GenerateSummary formats the history of an environment as a markdown changelog, e.g. to use as the
+// description of a pull request. Each commit is listed with the commands recorded in its log note,
+// followed by the files changed since the environment diverged from the current branch.
+func (r *Repository) GenerateSummary(ctx context.Context, id string) (string, error) {
+	envInfo, err := r.Info(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	revisionRange, err := r.revisionRange(ctx, envInfo)
+	if err != nil {
+		return "", err
+	}
+
+	history, err := r.History(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	stat, err := RunGitCommand(ctx, r.userRepoPath, "diff", "--stat", revisionRange)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	title := envInfo.State.Title
+	if title == "" {
+		title = id
+	}
+	fmt.Fprintf(&sb, "## %s\n\n", title)
+
+	sb.WriteString("### Changes\n\n")
+	for _, entry := range history {
+		fmt.Fprintf(&sb, "- %s\n", entry.Explanation)
+		for _, command := range summaryCommands(entry.Note) {
+			fmt.Fprintf(&sb, "  - %s\n", command)
+		}
+	}
+	if len(history) == 0 {
+		sb.WriteString("No changes yet.\n")
+	}
+
+	if stat = strings.TrimRight(stat, "\n"); stat != "" {
+		fmt.Fprintf(&sb, "\n### Files changed\n\n```\n%s\n```\n", stat)
+	}
+
+	return sb.String(), nil
+}
+
+// summaryCommands returns the commands recorded in a log note as inline code, without their output.
+// Commands that failed are followed by their exit code.
+func summaryCommands(note string) []string {
+	var commands []string
+	for _, result := range (HistoryEntry{Note: note}).Commands() {
+		command := "`" + result.Command + "`"
+		if result.ExitCode != 0 {
+			command += fmt.Sprintf(" (exit %d)", result.ExitCode)
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryGenerateSummary(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepository(t)
+	createTestEnvironment(t, repo, "test-env")
+
+	summary, err := repo.GenerateSummary(ctx, "test-env")
+	require.NoError(t, err)
+	assert.Equal(t, "## test-env\n\n### Changes\n\nNo changes yet.\n", summary)
+
+	// Add a commit with a log note to an environment, like an agent would
+	createTestEnvironmentWithFile(t, repo, "work-env", "main.go", "package main\n")
+	_, err = RunGitCommand(ctx, repo.forkRepoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com",
+		"notes", "--ref", gitNotesLogRef, "add", "-m", "Write main.go\n$ go build ./...\n$ go test ./...\nexit 1\nFAIL", "work-env")
+	require.NoError(t, err)
+	_, err = RunGitCommand(ctx, repo.userRepoPath, "fetch", "-q", containerUseRemote, "refs/notes/"+gitNotesLogRef+":refs/notes/"+gitNotesLogRef)
+	require.NoError(t, err)
+
+	summary, err = repo.GenerateSummary(ctx, "work-env")
+	require.NoError(t, err)
+	assert.Contains(t, summary, "- Write main.go\n  - `go build ./...`\n  - `go test ./...` (exit 1)\n")
+	assert.NotContains(t, summary, "FAIL")
+	assert.Contains(t, summary, "### Files changed")
+	assert.Contains(t, summary, "main.go")
+
+	_, err = repo.GenerateSummary(ctx, "missing-env")
+	assert.Error(t, err)
+}
+
+func TestSummaryCommands(t *testing.T) {
+	assert.Empty(t, summaryCommands(""))
+	assert.Empty(t, summaryCommands("Write main.go"))
+	assert.Equal(t,
+		[]string{"`ls`", "`make` (exit 2)"},
+		summaryCommands("$ ls\nmain.go\n$ make\nexit 2\nstderr: no rule"),
+	)
+}